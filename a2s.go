@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"time"
+)
+
+// a2sConfig is the options of an a2s target, a server answering the
+// Source engine query protocol (Source and GoldSrc games, Rust, ARK, Valheim,
+// DayZ and most other Steam dedicated servers)
+type a2sConfig struct {
+	Address string   `yaml:"address"` // host:port of the query port
+	Rules   []string `yaml:"rules"`   // Rules (cvars) to export from A2S_RULES, e.g. sv_maxrate
+	timeout time.Duration
+}
+
+// Source query packet headers and types
+const (
+	a2sSinglePacket = 0xFFFFFFFF
+	a2sSplitPacket  = 0xFFFFFFFE
+	a2sInfoRequest  = 'T'
+	a2sInfoReply    = 'I'
+	a2sPlayerReq    = 'U'
+	a2sPlayerReply  = 'D'
+	a2sRulesRequest = 'V'
+	a2sRulesReply   = 'E'
+	a2sChallenge    = 'A'
+)
+
+func init() {
+	registerQueryDriver("a2s", func(target queryConfig) (querier, error) {
+		c := a2sConfig{timeout: target.timeout()}
+		if err := target.decodeOptions(&c); err != nil {
+			return nil, err
+		}
+		if c.Address == "" {
+			return nil, errors.New("address is required")
+		}
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			return nil, err
+		}
+		return a2sQuerier(c), nil
+	})
+}
+
+// a2sQuerier queries a server over A2S, a new exchange every time
+type a2sQuerier a2sConfig
+
+func (q a2sQuerier) query() (*serverInfo, []playerInfo, error) {
+	return queryA2S(a2sConfig(q))
+}
+
+// a2sReader reads the little-endian fields of a reply
+type a2sReader struct {
+	data []byte
+	err  error
+}
+
+func (r *a2sReader) byte() byte {
+	if len(r.data) < 1 {
+		r.err = errors.New("short reply")
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *a2sReader) uint32() uint32 {
+	if len(r.data) < 4 {
+		r.err = errors.New("short reply")
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return v
+}
+
+func (r *a2sReader) uint16() uint16 {
+	if len(r.data) < 2 {
+		r.err = errors.New("short reply")
+		return 0
+	}
+	v := binary.LittleEndian.Uint16(r.data)
+	r.data = r.data[2:]
+	return v
+}
+
+func (r *a2sReader) skip(n int) {
+	if len(r.data) < n {
+		r.err = errors.New("short reply")
+		n = len(r.data)
+	}
+	r.data = r.data[n:]
+}
+
+func (r *a2sReader) string() string {
+	i := bytes.IndexByte(r.data, 0)
+	if i < 0 {
+		r.err = errors.New("unterminated string")
+		return ""
+	}
+	s := string(r.data[:i])
+	r.data = r.data[i+1:]
+	return s
+}
+
+// a2sRequest sends a request and returns the reply payload after the type
+// byte, answering a challenge if the server sends one first
+func a2sRequest(conn net.Conn, reqType byte, payload []byte, replyType byte) ([]byte, error) {
+	request := binary.LittleEndian.AppendUint32(nil, a2sSinglePacket)
+	request = append(request, reqType)
+	request = append(request, payload...)
+	for attempt := 0; attempt < 3; attempt++ {
+		if _, err := conn.Write(request); err != nil {
+			return nil, err
+		}
+		reply, err := a2sReadReply(conn)
+		if err != nil {
+			return nil, err
+		}
+		if len(reply) == 0 {
+			return nil, errors.New("empty reply")
+		}
+		switch reply[0] {
+		case replyType:
+			return reply[1:], nil
+		case a2sChallenge:
+			if len(reply) < 5 {
+				return nil, errors.New("short challenge")
+			}
+			// Resend with the challenge, replacing the placeholder for
+			// A2S_PLAYER and A2S_RULES
+			challenge := reply[1:5]
+			request = request[:5]
+			if reqType == a2sInfoRequest {
+				request = append(request, payload...)
+			}
+			request = append(request, challenge...)
+		default:
+			return nil, fmt.Errorf("unexpected reply type 0x%02x", reply[0])
+		}
+	}
+	return nil, errors.New("too many challenges")
+}
+
+// a2sReadReply reads a reply, reassembling replies split over several
+// packets (Source engine format, uncompressed only)
+func a2sReadReply(conn net.Conn) ([]byte, error) {
+	buf := make([]byte, 1400)
+	var parts [][]byte
+	received := 0
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		r := &a2sReader{data: buf[:n]}
+		switch r.uint32() {
+		case a2sSinglePacket:
+			return append([]byte(nil), r.data...), nil
+		case a2sSplitPacket:
+			id := r.uint32()
+			total := int(r.byte())
+			number := int(r.byte())
+			r.skip(2) // Maximum packet size
+			if r.err != nil || total == 0 || number >= total {
+				return nil, errors.New("malformed split reply")
+			}
+			if id&0x80000000 != 0 {
+				return nil, errors.New("compressed replies are not supported")
+			}
+			if parts == nil {
+				parts = make([][]byte, total)
+			}
+			if number < len(parts) && parts[number] == nil {
+				parts[number] = append([]byte(nil), r.data...)
+				received++
+			}
+			if received == len(parts) {
+				// The reassembled payload starts with its own single packet header
+				reply := bytes.Join(parts, nil)
+				if len(reply) < 4 {
+					return nil, errors.New("short reply")
+				}
+				return reply[4:], nil
+			}
+		default:
+			return nil, errors.New("invalid reply header")
+		}
+	}
+}
+
+// queryA2SRules returns the configured rules the server reports
+func queryA2SRules(conn net.Conn, names []string) (map[string]string, error) {
+	reply, err := a2sRequest(conn, a2sRulesRequest, binary.LittleEndian.AppendUint32(nil, a2sSinglePacket), a2sRulesReply)
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	rules := make(map[string]string)
+	r := &a2sReader{data: reply}
+	count := int(r.uint16())
+	for i := 0; i < count && r.err == nil; i++ {
+		name, value := r.string(), r.string()
+		if wanted[name] {
+			rules[name] = value
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("parsing A2S_RULES reply: %w", r.err)
+	}
+	return rules, nil
+}
+
+// queryA2S asks a server for its info, its configured rules and, with
+// --collector.query.players, its player list
+func queryA2S(c a2sConfig) (*serverInfo, []playerInfo, error) {
+	address := c.Address
+	conn, err := net.DialTimeout("udp", address, c.timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.timeout))
+
+	start := time.Now()
+	reply, err := a2sRequest(conn, a2sInfoRequest, []byte("Source Engine Query\x00"), a2sInfoReply)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := &serverInfo{latency: time.Since(start)}
+	r := &a2sReader{data: reply}
+	r.byte() // Protocol version
+	info.name = r.string()
+	info.mapName = r.string()
+	r.string() // Game folder
+	info.game = r.string()
+	r.skip(2) // Steam app ID
+	info.players = float64(r.byte())
+	info.maxPlayers = float64(r.byte())
+	info.bots = float64(r.byte())
+	r.byte() // Server type
+	r.byte() // Environment
+	r.byte() // Visibility
+	r.byte() // VAC
+	info.version = r.string()
+	if r.err != nil {
+		return nil, nil, fmt.Errorf("parsing A2S_INFO reply: %w", r.err)
+	}
+
+	if len(c.Rules) > 0 {
+		// Like the player list, rules can be disabled on the server
+		if info.rules, err = queryA2SRules(conn, c.Rules); err != nil {
+			log.Println("Error querying rules of", address+":", err)
+		}
+	}
+	if !*queryPlayers {
+		return info, nil, nil
+	}
+
+	// The challenge placeholder asks the server for a challenge
+	reply, err = a2sRequest(conn, a2sPlayerReq, binary.LittleEndian.AppendUint32(nil, a2sSinglePacket), a2sPlayerReply)
+	if err != nil {
+		// Some servers disable the player list; keep the server info
+		log.Println("Error querying players of", address+":", err)
+		return info, nil, nil
+	}
+	r = &a2sReader{data: reply}
+	players := make([]playerInfo, r.byte())
+	for i := range players {
+		r.byte() // Index, always 0 on most servers
+		players[i].name = r.string()
+		players[i].score = float64(int32(r.uint32()))
+		players[i].connected = time.Duration(float64(math.Float32frombits(r.uint32())) * float64(time.Second))
+	}
+	if r.err != nil {
+		return nil, nil, fmt.Errorf("parsing A2S_PLAYER reply: %w", r.err)
+	}
+	return info, players, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a2sString appends a null-terminated string of a reply
+func a2sString(b []byte, s string) []byte {
+	return append(append(b, s...), 0)
+}
+
+// serveA2S answers A2S_INFO and A2S_PLAYER on a local UDP port, asking for a
+// challenge first, and returns its address
+func serveA2S(t *testing.T, split bool) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("no UDP on the loopback interface:", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	info := binary.LittleEndian.AppendUint32(nil, a2sSinglePacket)
+	info = append(info, a2sInfoReply, 17)
+	info = a2sString(info, "Test Server")
+	info = a2sString(info, "de_dust2")
+	info = a2sString(info, "csgo")
+	info = a2sString(info, "Counter-Strike 2")
+	info = binary.LittleEndian.AppendUint16(info, 730)
+	info = append(info, 12, 32, 2, 'd', 'l', 0, 1)
+	info = a2sString(info, "1.40.1.5")
+
+	players := binary.LittleEndian.AppendUint32(nil, a2sSinglePacket)
+	players = append(players, a2sPlayerReply, 2)
+	players = a2sString(append(players, 0), "alice")
+	players = binary.LittleEndian.AppendUint32(players, 15)
+	players = binary.LittleEndian.AppendUint32(players, math.Float32bits(90))
+	players = a2sString(append(players, 0), "bob")
+	players = binary.LittleEndian.AppendUint32(players, uint32(0xFFFFFFFF)) // -1
+	players = binary.LittleEndian.AppendUint32(players, math.Float32bits(1.5))
+
+	challenge := []byte{0xFF, 0xFF, 0xFF, 0xFF, a2sChallenge, 1, 2, 3, 4}
+	go func() {
+		buf := make([]byte, 1400)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			request := buf[:n]
+			var reply []byte
+			if !strings.HasSuffix(string(request), "\x01\x02\x03\x04") {
+				reply = challenge
+			} else if request[4] == a2sInfoRequest {
+				reply = info
+			} else {
+				reply = players
+			}
+			if !split {
+				conn.WriteTo(reply, addr)
+				continue
+			}
+			// Two packets of a split reply, the second one first
+			half := len(reply) / 2
+			for _, number := range []byte{1, 0} {
+				part := binary.LittleEndian.AppendUint32(nil, a2sSplitPacket)
+				part = binary.LittleEndian.AppendUint32(part, 42)
+				part = append(part, 2, number, 0xE0, 0x04)
+				if number == 0 {
+					part = append(part, reply[:half]...)
+				} else {
+					part = append(part, reply[half:]...)
+				}
+				conn.WriteTo(part, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestQueryA2S(t *testing.T) {
+	old := *queryPlayers
+	*queryPlayers = true
+	t.Cleanup(func() { *queryPlayers = old })
+
+	wantInfo := serverInfo{
+		name:       "Test Server",
+		mapName:    "de_dust2",
+		game:       "Counter-Strike 2",
+		version:    "1.40.1.5",
+		players:    12,
+		maxPlayers: 32,
+		bots:       2,
+	}
+	wantPlayers := []playerInfo{
+		{name: "alice", score: 15, connected: 90 * time.Second},
+		{name: "bob", score: -1, connected: 1500 * time.Millisecond},
+	}
+	for _, split := range []bool{false, true} {
+		info, players, err := queryA2S(a2sConfig{Address: serveA2S(t, split), timeout: 2 * time.Second})
+		if err != nil {
+			t.Fatalf("split %v: queryA2S() = %v", split, err)
+		}
+		info.latency = 0
+		if !reflect.DeepEqual(*info, wantInfo) {
+			t.Errorf("split %v: info = %+v, want %+v", split, *info, wantInfo)
+		}
+		if !reflect.DeepEqual(players, wantPlayers) {
+			t.Errorf("split %v: players = %+v, want %+v", split, players, wantPlayers)
+		}
+	}
+}
+
+func TestA2SReader(t *testing.T) {
+	r := &a2sReader{data: []byte{7, 0x34, 0x12, 'h', 'i', 0, 'x'}}
+	if b := r.byte(); b != 7 {
+		t.Errorf("byte() = %d, want 7", b)
+	}
+	if v := r.uint16(); v != 0x1234 {
+		t.Errorf("uint16() = %#x, want 0x1234", v)
+	}
+	if s := r.string(); s != "hi" {
+		t.Errorf("string() = %q, want %q", s, "hi")
+	}
+	if r.err != nil {
+		t.Fatalf("err = %v before the end", r.err)
+	}
+	// An unterminated string or a short field is an error, not a panic
+	if r.string(); r.err == nil {
+		t.Error("unterminated string read without an error")
+	}
+	r = &a2sReader{data: []byte{1, 2}}
+	if r.uint32(); r.err == nil {
+		t.Error("short uint32 read without an error")
+	}
+}
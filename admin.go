@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+var adminTokenFile = flag.String("web.admin-token-file", "", "File with the bearer token for the admin API under /admin/, which toggles collectors and adds or removes query targets at runtime. Disabled by default.")
+
+// Collectors disabled through the admin API, until enabled again or restart
+var (
+	adminMu            sync.Mutex
+	disabledCollectors = make(map[string]bool)
+)
+
+// The admin API's bearer token, also required by the gRPC control methods
+var adminToken string
+
+func collectorDisabled(name string) bool {
+	adminMu.Lock()
+	defer adminMu.Unlock()
+	return disabledCollectors[name]
+}
+
+// startAdmin registers the admin API if a token file is given
+func startAdmin() error {
+	if *adminTokenFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(*adminTokenFile)
+	if err != nil {
+		return err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return fmt.Errorf("%s is empty", *adminTokenFile)
+	}
+	adminToken = token
+	auth := func(h http.HandlerFunc) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			h(w, r)
+		})
+	}
+	http.Handle("POST /admin/collectors/{name}/enable", auth(adminToggleCollector(false)))
+	http.Handle("POST /admin/collectors/{name}/disable", auth(adminToggleCollector(true)))
+	http.Handle("POST /admin/queries", auth(adminAddQuery))
+	http.Handle("DELETE /admin/queries/{instance}", auth(adminRemoveQuery))
+	return nil
+}
+
+// adminToggleCollector disables or re-enables a collector. A disabled
+// collector isn't run; its series keep their last values.
+func adminToggleCollector(disable bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if err := setCollectorDisabled(name, disable); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if disable {
+			log.Println("Collector", name, "disabled through the admin API")
+		} else {
+			log.Println("Collector", name, "enabled through the admin API")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// setCollectorDisabled disables or re-enables a collector
+func setCollectorDisabled(name string, disable bool) error {
+	if !slices.ContainsFunc(collectors, func(c collector) bool { return c.name == name }) {
+		return fmt.Errorf("unknown collector %q", name)
+	}
+	adminMu.Lock()
+	defer adminMu.Unlock()
+	if disable {
+		disabledCollectors[name] = true
+	} else {
+		delete(disabledCollectors, name)
+	}
+	return nil
+}
+
+// adminAddQuery starts querying a target given in the body like an entry of
+// the queries section, as YAML or JSON
+func adminAddQuery(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var c queryConfig
+	if err := yaml.Unmarshal(body, &c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateQueries([]queryConfig{c}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := startQuery(c); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.Println("Query target", c.Instance, "added through the admin API")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// adminRemoveQuery stops querying a target and removes its series
+func adminRemoveQuery(w http.ResponseWriter, r *http.Request) {
+	instance := r.PathValue("instance")
+	if err := stopQuery(instance); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Println("Query target", instance, "removed through the admin API")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// alertingConfig defines threshold rules that notify webhooks directly, for
+// hosts that don't run Alertmanager
+type alertingConfig struct {
+	Webhooks []webhookConfig `yaml:"webhooks"`
+	Rules    []alertRule     `yaml:"rules"`
+}
+
+type webhookConfig struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"` // discord, slack or generic
+	URL  string `yaml:"url"`
+}
+
+type alertRule struct {
+	Name           string `yaml:"name"`
+	metricSelector `yaml:",inline"`
+	Op             string        `yaml:"op"`
+	Threshold      float64       `yaml:"threshold"`
+	For            time.Duration `yaml:"for"`
+	Webhooks       []string      `yaml:"webhooks"` // Default all webhooks
+}
+
+func (c alertingConfig) validate() error {
+	webhooks := make(map[string]bool)
+	for _, w := range c.Webhooks {
+		switch w.Type {
+		case "discord", "slack", "generic":
+		default:
+			return fmt.Errorf("webhook %q: unknown type %q", w.Name, w.Type)
+		}
+		if w.URL == "" {
+			return fmt.Errorf("webhook %q: url is required", w.Name)
+		}
+		webhooks[w.Name] = true
+	}
+	rules := make(map[string]bool)
+	for _, r := range c.Rules {
+		if r.Name == "" || r.Metric == "" {
+			return fmt.Errorf("alert rules need a name and a metric")
+		}
+		if rules[r.Name] {
+			return fmt.Errorf("duplicate alert rule %q", r.Name)
+		}
+		rules[r.Name] = true
+		if _, err := compare(r.Op, 0, 0); err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		for _, name := range r.Webhooks {
+			if !webhooks[name] {
+				return fmt.Errorf("rule %q: unknown webhook %q", r.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// metricSelector picks series from the gathered metrics by name and labels
+type metricSelector struct {
+	Metric string            `yaml:"metric"`
+	Labels map[string]string `yaml:"labels"`
+}
+
+// sample is the current value of a single series
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+func (s metricSelector) selectSamples(families []*dto.MetricFamily) []sample {
+	var samples []sample
+	for _, family := range families {
+		if family.GetName() != s.Metric {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, pair := range m.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			if !matchLabels(labels, s.Labels) {
+				continue
+			}
+			var value float64
+			switch {
+			case m.Gauge != nil:
+				value = m.GetGauge().GetValue()
+			case m.Counter != nil:
+				value = m.GetCounter().GetValue()
+			case m.Untyped != nil:
+				value = m.GetUntyped().GetValue()
+			default:
+				continue
+			}
+			samples = append(samples, sample{labels: labels, value: value})
+		}
+	}
+	return samples
+}
+
+// matchLabels tells whether labels has all the matchers' values
+func matchLabels(labels, matchers map[string]string) bool {
+	for name, value := range matchers {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// formatSeries renders a series as metric{label="value",...}
+func formatSeries(metric string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return metric
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, labels[name]))
+	}
+	return metric + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func compare(op string, a, b float64) (bool, error) {
+	switch op {
+	case ">":
+		return a > b, nil
+	case ">=":
+		return a >= b, nil
+	case "<":
+		return a < b, nil
+	case "<=":
+		return a <= b, nil
+	case "==":
+		return a == b, nil
+	case "!=":
+		return a != b, nil
+	}
+	return false, fmt.Errorf("unknown comparison operator %q", op)
+}
+
+var alertWebhookErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "game_alert_webhook_errors_total",
+	Help: "Number of failed alert webhook deliveries",
+}, []string{"webhook"})
+
+func init() {
+	prometheus.MustRegister(alertWebhookErrors)
+}
+
+// alertState tracks one series of a rule between evaluations
+type alertState struct {
+	pendingSince time.Time
+	firing       bool
+}
+
+// alertKey identifies a series of a rule
+type alertKey struct {
+	rule   string
+	series string
+}
+
+var alertStates = make(map[alertKey]*alertState)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Evaluate alert rules against the current metrics and notify on changes
+func evaluateAlerts(families []*dto.MetricFamily) {
+	now := time.Now()
+	seen := make(map[alertKey]bool)
+	for _, rule := range cfg.Alerting.Rules {
+		for _, s := range rule.selectSamples(families) {
+			series := formatSeries(rule.Metric, s.labels)
+			key := alertKey{rule.Name, series}
+			seen[key] = true
+
+			breached, _ := compare(rule.Op, s.value, rule.Threshold)
+			state, exists := alertStates[key]
+			if !breached {
+				if exists && state.firing {
+					notifyAlert(rule, series, s.value, "resolved")
+				}
+				delete(alertStates, key)
+				continue
+			}
+			if !exists {
+				state = &alertState{pendingSince: now}
+				alertStates[key] = state
+			}
+			if !state.firing && now.Sub(state.pendingSince) >= rule.For {
+				state.firing = true
+				notifyAlert(rule, series, s.value, "firing")
+			}
+		}
+	}
+
+	// Series that disappeared can no longer be breaching
+	for key, state := range alertStates {
+		if seen[key] {
+			continue
+		}
+		if state.firing {
+			for _, rule := range cfg.Alerting.Rules {
+				if rule.Name == key.rule {
+					notifyAlert(rule, key.series, 0, "resolved")
+					break
+				}
+			}
+		}
+		delete(alertStates, key)
+	}
+}
+
+func notifyAlert(rule alertRule, series string, value float64, status string) {
+	hostname, _ := os.Hostname()
+	text := fmt.Sprintf("[%s] %s on %s: %s = %g (%s %g)",
+		strings.ToUpper(status), rule.Name, hostname, series, value, rule.Op, rule.Threshold)
+	log.Println("Alert", text)
+
+	for _, webhook := range cfg.Alerting.Webhooks {
+		if len(rule.Webhooks) > 0 && !slices.Contains(rule.Webhooks, webhook.Name) {
+			continue
+		}
+		var payload any
+		switch webhook.Type {
+		case "discord":
+			payload = map[string]string{"content": text}
+		case "slack":
+			payload = map[string]string{"text": text}
+		default:
+			payload = map[string]any{
+				"alert":     rule.Name,
+				"status":    status,
+				"series":    series,
+				"value":     value,
+				"op":        rule.Op,
+				"threshold": rule.Threshold,
+				"hostname":  hostname,
+				"timestamp": time.Now().Unix(),
+				"message":   text,
+			}
+		}
+		go postWebhook(webhook, payload)
+	}
+}
+
+func postWebhook(webhook webhookConfig, payload any) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Println("Error encoding webhook payload:", err)
+		return
+	}
+	resp, err := webhookClient.Post(webhook.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error sending webhook %s: %v", webhook.Name, err)
+		alertWebhookErrors.WithLabelValues(webhook.Name).Inc()
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Error sending webhook %s: %s", webhook.Name, resp.Status)
+		alertWebhookErrors.WithLabelValues(webhook.Name).Inc()
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestEvaluateAlertsPerSeries(t *testing.T) {
+	notifications := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		notifications <- payload["status"].(string) + " " + payload["series"].(string)
+	}))
+	defer server.Close()
+
+	oldConfig, oldStates := cfg.Alerting, alertStates
+	t.Cleanup(func() { cfg.Alerting, alertStates = oldConfig, oldStates })
+	cfg.Alerting = alertingConfig{
+		Webhooks: []webhookConfig{{Name: "test", Type: "generic", URL: server.URL}},
+		Rules: []alertRule{{
+			Name:           "disk",
+			metricSelector: metricSelector{Metric: "game_test_disk_usage_percent"},
+			Op:             ">",
+			Threshold:      80,
+		}},
+	}
+	alertStates = make(map[alertKey]*alertState)
+
+	registry := prometheus.NewRegistry()
+	disk := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "game_test_disk_usage_percent", Help: "test"}, []string{"partition"})
+	registry.MustRegister(disk)
+	evaluate := func(want ...string) {
+		t.Helper()
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		evaluateAlerts(families)
+		var got []string
+		for range want {
+			select {
+			case n := <-notifications:
+				got = append(got, n)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("notifications = %q, want %q", got, want)
+			}
+		}
+		select {
+		case n := <-notifications:
+			got = append(got, n)
+		case <-time.After(50 * time.Millisecond):
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("notifications = %q, want %q", got, want)
+		}
+	}
+
+	disk.WithLabelValues("/").Set(90)
+	disk.WithLabelValues("/data").Set(50)
+	evaluate(`firing game_test_disk_usage_percent{partition="/"}`)
+
+	// The second series fires on its own while the first keeps firing
+	disk.WithLabelValues("/data").Set(95)
+	evaluate(`firing game_test_disk_usage_percent{partition="/data"}`)
+	evaluate()
+
+	// Resolving one series leaves the other firing
+	disk.WithLabelValues("/").Set(10)
+	evaluate(`resolved game_test_disk_usage_percent{partition="/"}`)
+	if len(alertStates) != 1 || !alertStates[alertKey{"disk", `game_test_disk_usage_percent{partition="/data"}`}].firing {
+		t.Errorf("alert states = %v, want only /data firing", alertStates)
+	}
+
+	disk.DeleteLabelValues("/data")
+	evaluate(`resolved game_test_disk_usage_percent{partition="/data"}`)
+}
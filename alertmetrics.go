@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// alertMetricConfig defines a 0/1 gauge game_alert_<name> computed from an
+// expression such as `game_disk_usage_percent{partition="/data"} > 90`
+type alertMetricConfig struct {
+	Name string `yaml:"name"`
+	Expr string `yaml:"expr"`
+}
+
+// alertMetric is a parsed alert metric expression and its gauge
+type alertMetric struct {
+	selector  metricSelector
+	op        string
+	threshold float64
+	gauge     prometheus.Gauge
+}
+
+var alertMetrics []alertMetric
+
+// Parse the alert metric expressions and register their gauges
+func registerAlertMetrics(configs []alertMetricConfig) error {
+	for _, c := range configs {
+		selector, op, threshold, err := parseAlertExpr(c.Expr)
+		if err != nil {
+			return fmt.Errorf("alert metric %q: %w", c.Name, err)
+		}
+		gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "game_alert_" + c.Name,
+			Help: "1 if " + c.Expr + " holds for any matching series, 0 otherwise",
+		})
+		if err := prometheus.Register(gauge); err != nil {
+			return fmt.Errorf("alert metric %q: %w", c.Name, err)
+		}
+		alertMetrics = append(alertMetrics, alertMetric{selector: selector, op: op, threshold: threshold, gauge: gauge})
+	}
+	return nil
+}
+
+// Evaluate the alert metrics; a series that doesn't exist yields 0
+func updateAlertMetrics(families []*dto.MetricFamily) {
+	for _, m := range alertMetrics {
+		value := 0.0
+		for _, s := range m.selector.selectSamples(families) {
+			if breached, _ := compare(m.op, s.value, m.threshold); breached {
+				value = 1
+				break
+			}
+		}
+		m.gauge.Set(value)
+	}
+}
+
+// Evaluate alert rules, alert metrics, derived metrics, recording rules and
+// the SNMP objects against one snapshot of the metrics
+func evaluateRules() {
+	if len(cfg.Alerting.Rules) == 0 && len(alertMetrics) == 0 && len(derivedMetrics) == 0 && len(recordingRules) == 0 && len(snmpObjects) == 0 {
+		return
+	}
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		log.Println("Error gathering metrics for alerting:", err)
+		return
+	}
+	evaluateAlerts(families)
+	updateAlertMetrics(families)
+	updateDerivedMetrics(families)
+	updateRecordingRules(families)
+	updateSNMPValues(families)
+}
+
+// parseAlertExpr parses `metric{label="value",...} op number`
+func parseAlertExpr(expr string) (metricSelector, string, float64, error) {
+	var selector metricSelector
+	s := strings.TrimSpace(expr)
+
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return !(r == '_' || r == ':' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	if end < 0 {
+		end = len(s)
+	}
+	if end == 0 {
+		return selector, "", 0, fmt.Errorf("expected metric name in %q", expr)
+	}
+	selector.Metric = s[:end]
+	s = strings.TrimSpace(s[end:])
+
+	if strings.HasPrefix(s, "{") {
+		closing := matchersEnd(s)
+		if closing < 0 {
+			return selector, "", 0, fmt.Errorf("unterminated label matchers in %q", expr)
+		}
+		labels, err := parseLabelMatchers(s[1:closing])
+		if err != nil {
+			return selector, "", 0, fmt.Errorf("%w in %q", err, expr)
+		}
+		selector.Labels = labels
+		s = strings.TrimSpace(s[closing+1:])
+	}
+
+	var op string
+	for _, candidate := range []string{">=", "<=", "==", "!=", ">", "<"} {
+		if strings.HasPrefix(s, candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return selector, "", 0, fmt.Errorf("expected comparison operator in %q", expr)
+	}
+	threshold, err := strconv.ParseFloat(strings.TrimSpace(s[len(op):]), 64)
+	if err != nil {
+		return selector, "", 0, fmt.Errorf("invalid threshold in %q", expr)
+	}
+	return selector, op, threshold, nil
+}
+
+// matchersEnd returns the index of the brace closing the label matchers s
+// starts with, skipping quoted label values, or -1
+func matchersEnd(s string) int {
+	quoted := false
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == '}':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseLabelMatchers parses `name="value", name2="value2"`
+func parseLabelMatchers(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return labels, nil
+		}
+		name, rest, found := strings.Cut(s, "=")
+		if !found {
+			return nil, fmt.Errorf("expected label=\"value\"")
+		}
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, `"`) {
+			return nil, fmt.Errorf("label values must be double-quoted")
+		}
+		// Find the closing quote, skipping escaped ones
+		i := 1
+		for ; i < len(rest); i++ {
+			if rest[i] == '\\' {
+				i++
+				continue
+			}
+			if rest[i] == '"' {
+				break
+			}
+		}
+		if i >= len(rest) {
+			return nil, fmt.Errorf("unterminated label value")
+		}
+		value, err := strconv.Unquote(rest[:i+1])
+		if err != nil {
+			return nil, err
+		}
+		labels[strings.TrimSpace(name)] = value
+		s = strings.TrimPrefix(strings.TrimSpace(rest[i+1:]), ",")
+	}
+}
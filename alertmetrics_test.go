@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchersEnd(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{`{}`, 1},
+		{`{} > 1`, 1},
+		{`{a="b"} > 1`, 6},
+		{`{a="}"}`, 6},
+		{`{a="{}", b="c"}x`, 14},
+		{`{a="\"}"}`, 8},
+		{`{a="\\"}`, 7},
+		{`{a="\\\"}"}`, 10},
+		{`{a="}`, -1},
+		{`{a="\"}`, -1},
+		{`{`, -1},
+		{`{a="b"`, -1},
+	}
+	for _, tt := range tests {
+		if got := matchersEnd(tt.s); got != tt.want {
+			t.Errorf("matchersEnd(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseAlertExpr(t *testing.T) {
+	tests := []struct {
+		expr     string
+		selector metricSelector
+		op       string
+		value    float64
+		ok       bool
+	}{
+		{`game_cpu_usage_percent > 90`, metricSelector{Metric: "game_cpu_usage_percent"}, ">", 90, true},
+		{`game_query_up{} == 0`, metricSelector{Metric: "game_query_up", Labels: map[string]string{}}, "==", 0, true},
+		{`game_query_up{instance_name="a}b"} < 1`, metricSelector{Metric: "game_query_up", Labels: map[string]string{"instance_name": "a}b"}}, "<", 1, true},
+		{`game_query_up{instance_name="say \"}\"", protocol="a2s"}<=0`, metricSelector{Metric: "game_query_up", Labels: map[string]string{"instance_name": `say "}"`, "protocol": "a2s"}}, "<=", 0, true},
+		{`game_query_up{instance_name="a\\"} != 1`, metricSelector{Metric: "game_query_up", Labels: map[string]string{"instance_name": `a\`}}, "!=", 1, true},
+		{`game_query_up{instance_name="a} > 1`, metricSelector{}, "", 0, false},
+		{`game_query_up{instance_name=a} > 1`, metricSelector{}, "", 0, false},
+		{`game_query_up{instance_name="a"}`, metricSelector{}, "", 0, false},
+	}
+	for _, tt := range tests {
+		selector, op, value, err := parseAlertExpr(tt.expr)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseAlertExpr(%q) error = %v, want ok %v", tt.expr, err, tt.ok)
+			continue
+		}
+		if tt.ok && (!reflect.DeepEqual(selector, tt.selector) || op != tt.op || value != tt.value) {
+			t.Errorf("parseAlertExpr(%q) = %+v, %q, %v, want %+v, %q, %v", tt.expr, selector, op, value, tt.selector, tt.op, tt.value)
+		}
+	}
+}
+
+func TestParseDerivedSelectors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want derivedExpr
+	}{
+		{`game_query_players{}`, derivedSelector{Metric: "game_query_players", Labels: map[string]string{}}},
+		{`game_network{activity="out"} / game_query_players{instance_name="{a}"}`, derivedBinary{
+			op:    '/',
+			left:  derivedSelector{Metric: "game_network", Labels: map[string]string{"activity": "out"}},
+			right: derivedSelector{Metric: "game_query_players", Labels: map[string]string{"instance_name": "{a}"}},
+		}},
+		{`game_query_players{instance_name="a\"}"} * 2`, derivedBinary{
+			op:    '*',
+			left:  derivedSelector{Metric: "game_query_players", Labels: map[string]string{"instance_name": `a"}`}},
+			right: derivedNumber(2),
+		}},
+		{`game_query_players{instance_name="a}`, nil},
+		{`game_query_players{instance_name="a"} + `, nil},
+	}
+	for _, tt := range tests {
+		got, err := parseDerivedExpr(tt.expr)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("parseDerivedExpr(%q) = %+v, want an error", tt.expr, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseDerivedExpr(%q) = %+v, %v, want %+v", tt.expr, got, err, tt.want)
+		}
+	}
+}
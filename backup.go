@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// backupConfig is one entry of the backups config section: a status file
+// written by the backup script at the end of each run, e.g.
+// {"start_time": 1700000000, "end_time": 1700000420, "bytes": 5368709120, "exit_code": 0}
+type backupConfig struct {
+	Instance string `yaml:"instance"`
+	Path     string `yaml:"path"`
+}
+
+// backupStatus is the status file; times are Unix seconds or RFC 3339 strings
+type backupStatus struct {
+	StartTime statusTime `json:"start_time"`
+	EndTime   statusTime `json:"end_time"`
+	Bytes     float64    `json:"bytes"`
+	ExitCode  *int       `json:"exit_code"`
+}
+
+type statusTime struct {
+	time.Time
+}
+
+func (t *statusTime) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		t.Time = time.Unix(0, int64(seconds*1e9))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("expected Unix seconds or an RFC 3339 string")
+	}
+	parsed, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+var (
+	backupStartTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_backup_start_time_seconds",
+		Help: "Start time of the last backup as a Unix timestamp in seconds",
+	}, []string{"instance_name"})
+	backupEndTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_backup_end_time_seconds",
+		Help: "End time of the last backup as a Unix timestamp in seconds",
+	}, []string{"instance_name"})
+	backupDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_backup_duration_seconds",
+		Help: "Duration of the last backup",
+	}, []string{"instance_name"})
+	backupSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_backup_size_bytes",
+		Help: "Size of the last backup in bytes",
+	}, []string{"instance_name"})
+	backupExitCode = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_backup_exit_code",
+		Help: "Exit code of the last backup",
+	}, []string{"instance_name"})
+	backupSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_backup_success",
+		Help: "Whether the last backup finished with exit code 0",
+	}, []string{"instance_name"})
+)
+
+func init() {
+	prometheus.MustRegister(backupStartTime)
+	prometheus.MustRegister(backupEndTime)
+	prometheus.MustRegister(backupDuration)
+	prometheus.MustRegister(backupSize)
+	prometheus.MustRegister(backupExitCode)
+	prometheus.MustRegister(backupSuccess)
+}
+
+func validateBackups(configs []backupConfig) error {
+	instances := make(map[string]bool)
+	for _, b := range configs {
+		if b.Path == "" {
+			return errors.New("backups: path is required")
+		}
+		if instances[b.Instance] {
+			return fmt.Errorf("backups: instance %q defined twice", b.Instance)
+		}
+		instances[b.Instance] = true
+	}
+	return nil
+}
+
+func readBackupStatus(path string) (backupStatus, error) {
+	var status backupStatus
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return status, err
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return status, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return status, nil
+}
+
+// setBackupValue sets the instance's gauge, or removes it when the status
+// doesn't have the value
+func setBackupValue(g *prometheus.GaugeVec, instance string, value float64, ok bool) {
+	if ok {
+		g.WithLabelValues(instance).Set(value)
+	} else {
+		g.DeleteLabelValues(instance)
+	}
+}
+
+// Collect the status of the last backup of each instance
+func updateBackupMetrics() {
+	for _, b := range cfg.Backups {
+		status, err := readBackupStatus(rootfsFilePath(b.Path))
+		if err != nil {
+			logCollectorError("backup", "Error reading backup status:", err)
+			checkPermission("backup", err)
+			for _, g := range []*prometheus.GaugeVec{backupStartTime, backupEndTime, backupDuration, backupSize, backupExitCode, backupSuccess} {
+				g.DeleteLabelValues(b.Instance)
+			}
+			continue
+		}
+
+		started, ended := !status.StartTime.IsZero(), !status.EndTime.IsZero()
+		setBackupValue(backupStartTime, b.Instance, float64(status.StartTime.UnixNano())/1e9, started)
+		setBackupValue(backupEndTime, b.Instance, float64(status.EndTime.UnixNano())/1e9, ended)
+		setBackupValue(backupDuration, b.Instance, status.EndTime.Sub(status.StartTime.Time).Seconds(), started && ended)
+		backupSize.WithLabelValues(b.Instance).Set(status.Bytes)
+
+		// A status without exit code is a backup still running or one that died
+		var exitCode float64
+		if status.ExitCode != nil {
+			exitCode = float64(*status.ExitCode)
+		}
+		setBackupValue(backupExitCode, b.Instance, exitCode, status.ExitCode != nil)
+		success := 0.0
+		if status.ExitCode != nil && *status.ExitCode == 0 && ended {
+			success = 1
+		}
+		backupSuccess.WithLabelValues(b.Instance).Set(success)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var bandwidthIperf3Path = flag.String("collector.bandwidth.iperf3-path", "iperf3", "Path to the iperf3 binary, for bandwidth tests of type iperf3.")
+
+// bandwidthTestConfig is one entry of the bandwidth_tests config section, a
+// throughput test of the uplink against an iperf3 server or HTTP endpoints
+type bandwidthTestConfig struct {
+	Name    string `yaml:"name"`
+	Type    string `yaml:"type"`    // iperf3 or http
+	Address string `yaml:"address"` // iperf3 server, host:port
+	// HTTP: downloaded from, and uploaded to with a POST; either can be left
+	// out to test one direction
+	DownloadURL string `yaml:"download_url"`
+	UploadURL   string `yaml:"upload_url"`
+	// Bytes transferred per direction at most over HTTP, default 100MB
+	MaxBytes int64 `yaml:"max_bytes"`
+	// Time per direction at most, default 10s
+	Duration time.Duration `yaml:"duration"`
+	// Run daily at this local time (HH:MM), or else every interval
+	At       string        `yaml:"at"`
+	Interval time.Duration `yaml:"interval"` // Default 24h
+}
+
+const (
+	defaultBandwidthMaxBytes = 100 << 20
+	defaultBandwidthDuration = 10 * time.Second
+	defaultBandwidthInterval = 24 * time.Hour
+	// Tests saturate the uplink the game traffic goes over
+	minBandwidthInterval = time.Hour
+	maxBandwidthDuration = time.Minute
+)
+
+var (
+	bandwidthBitsPerSecond = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_bandwidth_bits_per_second",
+		Help: "Throughput measured by the last successful bandwidth test",
+	}, []string{"test", "direction"})
+	bandwidthTestSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_bandwidth_test_success",
+		Help: "Whether the last bandwidth test succeeded",
+	}, []string{"test", "direction"})
+	bandwidthTestTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_bandwidth_test_timestamp_seconds",
+		Help: "When the last bandwidth test ran",
+	}, []string{"test"})
+)
+
+func init() {
+	prometheus.MustRegister(bandwidthBitsPerSecond)
+	prometheus.MustRegister(bandwidthTestSuccess)
+	prometheus.MustRegister(bandwidthTestTimestamp)
+}
+
+// Only one test runs at a time, so tests never measure each other
+var bandwidthTestMu sync.Mutex
+
+func validateBandwidthTests(configs []bandwidthTestConfig) error {
+	names := make(map[string]bool)
+	for _, c := range configs {
+		if c.Name == "" {
+			return errors.New("bandwidth_tests: name is required")
+		}
+		switch c.Type {
+		case "iperf3":
+			if _, _, err := net.SplitHostPort(c.Address); err != nil {
+				return fmt.Errorf("bandwidth test %q: address: %w", c.Name, err)
+			}
+		case "http":
+			if c.DownloadURL == "" && c.UploadURL == "" {
+				return fmt.Errorf("bandwidth test %q: download_url or upload_url is required", c.Name)
+			}
+			for _, u := range []string{c.DownloadURL, c.UploadURL} {
+				if u != "" && !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+					return fmt.Errorf("bandwidth test %q: %q is not an http or https URL", c.Name, u)
+				}
+			}
+		default:
+			return fmt.Errorf("bandwidth test %q: type must be iperf3 or http", c.Name)
+		}
+		if c.At != "" {
+			if _, err := time.Parse("15:04", c.At); err != nil {
+				return fmt.Errorf("bandwidth test %q: at must be HH:MM", c.Name)
+			}
+		}
+		if c.Interval != 0 && c.Interval < minBandwidthInterval {
+			return fmt.Errorf("bandwidth test %q: interval must be at least %s", c.Name, minBandwidthInterval)
+		}
+		if c.Duration < 0 || c.Duration > maxBandwidthDuration {
+			return fmt.Errorf("bandwidth test %q: duration must be at most %s", c.Name, maxBandwidthDuration)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("bandwidth test %q defined twice", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return nil
+}
+
+// Start the scheduled bandwidth tests. None runs at startup, so a crash
+// looping exporter doesn't saturate the uplink.
+func startBandwidthTests(configs []bandwidthTestConfig) {
+	for _, c := range configs {
+		go runBandwidthTests(c)
+	}
+}
+
+func runBandwidthTests(c bandwidthTestConfig) {
+	for {
+		time.Sleep(time.Until(c.next(time.Now())))
+		bandwidthTestMu.Lock()
+		c.run()
+		bandwidthTestMu.Unlock()
+	}
+}
+
+// next returns the time of the next test after now
+func (c bandwidthTestConfig) next(now time.Time) time.Time {
+	if c.At == "" {
+		interval := c.Interval
+		if interval == 0 {
+			interval = defaultBandwidthInterval
+		}
+		return now.Add(interval)
+	}
+	at, _ := time.Parse("15:04", c.At)
+	next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// run tests both directions and exports the results
+func (c bandwidthTestConfig) run() {
+	duration := c.Duration
+	if duration == 0 {
+		duration = defaultBandwidthDuration
+	}
+	maxBytes := c.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = defaultBandwidthMaxBytes
+	}
+	bandwidthTestTimestamp.WithLabelValues(c.Name).Set(float64(time.Now().Unix()))
+	for _, direction := range []string{"download", "upload"} {
+		var bps float64
+		var err error
+		switch {
+		case c.Type == "iperf3":
+			bps, err = runIperf3(c.Address, direction, duration)
+		case direction == "download" && c.DownloadURL != "":
+			bps, err = httpDownload(c.DownloadURL, duration, maxBytes)
+		case direction == "upload" && c.UploadURL != "":
+			bps, err = httpUpload(c.UploadURL, duration, maxBytes)
+		default:
+			continue
+		}
+		if err != nil {
+			log.Println("Error testing bandwidth", c.Name, direction+":", err)
+			bandwidthTestSuccess.WithLabelValues(c.Name, direction).Set(0)
+			continue
+		}
+		bandwidthTestSuccess.WithLabelValues(c.Name, direction).Set(1)
+		bandwidthBitsPerSecond.WithLabelValues(c.Name, direction).Set(bps)
+	}
+}
+
+// runIperf3 runs the iperf3 client, in reverse mode for the download, and
+// returns the receiver's throughput
+func runIperf3(address, direction string, duration time.Duration) (float64, error) {
+	host, port, _ := net.SplitHostPort(address)
+	seconds := max(int(duration.Seconds()), 1) // -t 0 runs forever
+	args := []string{"-c", host, "-p", port, "-J", "-t", fmt.Sprint(seconds)}
+	if direction == "download" {
+		args = append(args, "-R")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), duration+30*time.Second)
+	defer cancel()
+	// iperf3 -J reports errors in the JSON and exits with 1
+	out, runErr := execOutput(exec.CommandContext(ctx, *bandwidthIperf3Path, args...))
+	var result struct {
+		Error string `json:"error"`
+		End   struct {
+			SumReceived struct {
+				BitsPerSecond float64 `json:"bits_per_second"`
+			} `json:"sum_received"`
+		} `json:"end"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		if runErr != nil {
+			return 0, runErr
+		}
+		return 0, err
+	}
+	if result.Error != "" {
+		return 0, errors.New(result.Error)
+	}
+	if runErr != nil {
+		return 0, runErr
+	}
+	return result.End.SumReceived.BitsPerSecond, nil
+}
+
+// httpDownload reads the URL's body for up to the duration or maxBytes
+func httpDownload(url string, duration time.Duration, maxBytes int64) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status %s", resp.Status)
+	}
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxBytes))
+	// Hitting the duration ends the test, it isn't a failure
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return 0, err
+	}
+	return bitsPerSecond(n, time.Since(start))
+}
+
+// httpUpload posts maxBytes of zeros, or what could be sent within the
+// duration
+func httpUpload(url string, duration time.Duration, maxBytes int64) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	body := &countingReader{r: io.LimitReader(zeroReader{}, maxBytes)}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = maxBytes
+	req.Header.Set("Content-Type", "application/octet-stream")
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	elapsed := time.Since(start)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return bitsPerSecond(body.n.Load(), elapsed)
+		}
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("status %s", resp.Status)
+	}
+	return bitsPerSecond(body.n.Load(), elapsed)
+}
+
+func bitsPerSecond(bytes int64, elapsed time.Duration) (float64, error) {
+	if bytes == 0 {
+		return 0, errors.New("nothing transferred")
+	}
+	return float64(bytes) * 8 / elapsed.Seconds(), nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// countingReader counts the bytes read, i.e. handed to the connection. The
+// transport may still be reading when the request times out.
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
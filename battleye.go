@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// battleyeConfig is the options of a battleye target, the BattlEye
+// RCon port of an Arma or DayZ server (RConPort in BEServer_x64.cfg)
+type battleyeConfig struct {
+	Address string `yaml:"address"`
+}
+
+// BattlEye RCon packet types
+const (
+	battleyeLogin   = 0x00
+	battleyeCommand = 0x01
+	battleyeMessage = 0x02
+)
+
+func init() {
+	registerQueryDriver("battleye", func(target queryConfig) (querier, error) {
+		var c battleyeConfig
+		if err := target.decodeOptions(&c); err != nil {
+			return nil, err
+		}
+		if c.Address == "" || target.Password == "" {
+			return nil, errors.New("address and password (RConPassword) are required")
+		}
+		return &battleyeClient{address: c.Address, password: target.Password, timeout: target.timeout()}, nil
+	})
+}
+
+// battleyeClient is a BattlEye RCon session. The server drops clients that
+// are quiet for 45 seconds; with longer query intervals it logs in again.
+type battleyeClient struct {
+	address  string
+	password string
+	timeout  time.Duration
+	conn     net.Conn
+	seq      byte
+}
+
+// write sends a packet: "BE", the CRC32 of the rest, 0xFF, type and payload
+func (c *battleyeClient) write(packetType byte, payload []byte) error {
+	body := append([]byte{0xFF, packetType}, payload...)
+	packet := binary.LittleEndian.AppendUint32([]byte("BE"), crc32.ChecksumIEEE(body))
+	_, err := c.conn.Write(append(packet, body...))
+	return err
+}
+
+// read returns the type and payload of the next valid packet
+func (c *battleyeClient) read() (byte, []byte, error) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		packet := buf[:n]
+		if n < 8 || !bytes.HasPrefix(packet, []byte("BE")) || packet[6] != 0xFF ||
+			binary.LittleEndian.Uint32(packet[2:6]) != crc32.ChecksumIEEE(packet[6:]) {
+			continue
+		}
+		return packet[7], append([]byte(nil), packet[8:]...), nil
+	}
+}
+
+func (c *battleyeClient) connect() error {
+	conn, err := net.DialTimeout("udp", c.address, c.timeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if err := c.write(battleyeLogin, []byte(c.password)); err != nil {
+		return err
+	}
+	for {
+		packetType, payload, err := c.read()
+		if err != nil {
+			return err
+		}
+		if packetType != battleyeLogin || len(payload) < 1 {
+			continue
+		}
+		if payload[0] != 0x01 {
+			return errors.New("BattlEye RCon login failed")
+		}
+		return nil
+	}
+}
+
+func (c *battleyeClient) ensureConnected() error {
+	if c.conn != nil {
+		return nil
+	}
+	if err := c.connect(); err != nil {
+		c.close()
+		return err
+	}
+	return nil
+}
+
+func (c *battleyeClient) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// command runs a command and returns its output, reassembled when the server
+// splits it over several packets
+func (c *battleyeClient) command(cmd string) (string, error) {
+	if err := c.ensureConnected(); err != nil {
+		return "", err
+	}
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	seq := c.seq
+	c.seq++
+	if err := c.write(battleyeCommand, append([]byte{seq}, cmd...)); err != nil {
+		c.close()
+		return "", err
+	}
+	var parts [][]byte
+	received := 0
+	for {
+		packetType, payload, err := c.read()
+		if err != nil {
+			c.close()
+			return "", err
+		}
+		if len(payload) < 1 {
+			continue
+		}
+		// Chat and log messages must be acknowledged or the server resends them
+		if packetType == battleyeMessage {
+			c.write(battleyeMessage, payload[:1])
+			continue
+		}
+		if packetType != battleyeCommand || payload[0] != seq {
+			continue
+		}
+		// Multi-packet replies: 0x00, packet count, index
+		if len(payload) >= 4 && payload[1] == 0x00 && payload[2] > 0 && payload[3] < payload[2] {
+			if parts == nil {
+				parts = make([][]byte, payload[2])
+			}
+			if int(payload[3]) < len(parts) && parts[payload[3]] == nil {
+				parts[payload[3]] = payload[4:]
+				received++
+			}
+			if received == len(parts) {
+				return string(bytes.Join(parts, nil)), nil
+			}
+			continue
+		}
+		return string(payload[1:]), nil
+	}
+}
+
+// "(12 players in total)" at the end of the players command
+var battleyePlayersRegexp = regexp.MustCompile(`\((\d+) players in total\)`)
+
+// query counts the players; the command's round trip shows how responsive
+// the server is
+func (c *battleyeClient) query() (*serverInfo, []playerInfo, error) {
+	if err := c.ensureConnected(); err != nil {
+		return nil, nil, err
+	}
+	start := time.Now()
+	out, err := c.command("players")
+	if err != nil {
+		return nil, nil, err
+	}
+	info := &serverInfo{latency: time.Since(start)}
+	m := battleyePlayersRegexp.FindStringSubmatch(out)
+	if m == nil {
+		return nil, nil, errors.New("unexpected players output")
+	}
+	info.players, _ = strconv.ParseFloat(m[1], 64)
+	return info, nil, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RakNet unconnected ping and pong packet IDs, and the magic that marks
+// offline messages
+const (
+	raknetUnconnectedPing = 0x01
+	raknetUnconnectedPong = 0x1c
+)
+
+var raknetMagic = []byte{0x00, 0xff, 0xff, 0x00, 0xfe, 0xfe, 0xfe, 0xfe, 0xfd, 0xfd, 0xfd, 0xfd, 0x12, 0x34, 0x56, 0x78}
+
+// pingBedrock sends a RakNet unconnected ping, answered by Bedrock servers
+// with their status as "MCPE;motd;protocol;version;online;max;server ID;level;..."
+func pingBedrock(address string, timeout time.Duration) (*serverInfo, error) {
+	conn, err := net.DialTimeout("udp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	start := time.Now()
+	ping := []byte{raknetUnconnectedPing}
+	ping = binary.BigEndian.AppendUint64(ping, uint64(start.UnixMilli()))
+	ping = append(ping, raknetMagic...)
+	ping = binary.BigEndian.AppendUint64(ping, 0) // Client GUID
+	if _, err := conn.Write(ping); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	latency := time.Since(start)
+
+	// ID, time, server GUID, magic, then the length-prefixed status
+	pong := buf[:n]
+	if len(pong) < 35 || pong[0] != raknetUnconnectedPong || !bytes.Equal(pong[17:33], raknetMagic) {
+		return nil, errors.New("invalid unconnected pong")
+	}
+	length := int(binary.BigEndian.Uint16(pong[33:35]))
+	if len(pong) < 35+length {
+		return nil, errors.New("short unconnected pong")
+	}
+	fields := strings.Split(string(pong[35:35+length]), ";")
+	if len(fields) < 6 {
+		return nil, errors.New("invalid Bedrock status")
+	}
+	info := &serverInfo{
+		name:    fields[1],
+		game:    "Minecraft Bedrock",
+		version: fields[3],
+		latency: latency,
+	}
+	info.players, _ = strconv.ParseFloat(fields[4], 64)
+	info.maxPlayers, _ = strconv.ParseFloat(fields[5], 64)
+	if len(fields) > 7 {
+		info.mapName = fields[7]
+	}
+	return info, nil
+}
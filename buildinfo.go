@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// buildConfig is one entry of the builds config section, the version of a game
+// instance not installed through Steam. The version is the first line of the
+// file or of the command's output.
+type buildConfig struct {
+	Instance string   `yaml:"instance"`
+	File     string   `yaml:"file"`
+	Command  []string `yaml:"command"` // Program and arguments, run without a shell
+}
+
+// Versions rarely change, so commands are only rerun after this long
+const buildCommandInterval = time.Minute
+
+var buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "game_build_info",
+	Help: "Version of the game instance read from its version file or command, always 1",
+}, []string{"instance_name", "version"})
+
+func init() {
+	prometheus.MustRegister(buildInfo)
+}
+
+func validateBuilds(configs []buildConfig) error {
+	instances := make(map[string]bool)
+	for _, b := range configs {
+		if b.Instance == "" {
+			return errors.New("builds: instance is required")
+		}
+		if (b.File == "") == (len(b.Command) == 0) {
+			return fmt.Errorf("build %q: exactly one of file and command is required", b.Instance)
+		}
+		if instances[b.Instance] {
+			return fmt.Errorf("build %q defined twice", b.Instance)
+		}
+		instances[b.Instance] = true
+	}
+	return nil
+}
+
+// firstLine returns the first non-empty line of data, trimmed
+func firstLine(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// buildCommandResult is a command's version, reused until
+// buildCommandInterval passed
+type buildCommandResult struct {
+	version string
+	at      time.Time
+}
+
+var buildCommandResults = make(map[string]buildCommandResult)
+
+// readBuildVersion returns the instance's current version
+func readBuildVersion(b buildConfig) (string, error) {
+	if b.File != "" {
+		data, err := os.ReadFile(rootfsFilePath(b.File))
+		if err != nil {
+			return "", err
+		}
+		return firstLine(data), nil
+	}
+
+	if last, ok := buildCommandResults[b.Instance]; ok && time.Since(last.at) < buildCommandInterval {
+		return last.version, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// Some servers print their version on stderr
+	out, err := execCombinedOutput(exec.CommandContext(ctx, b.Command[0], b.Command[1:]...))
+	if err != nil {
+		return "", err
+	}
+	version := firstLine(out)
+	buildCommandResults[b.Instance] = buildCommandResult{version, time.Now()}
+	return version, nil
+}
+
+// Collect the versions of the configured builds
+func updateBuildInfoMetrics() {
+	if len(cfg.Builds) == 0 {
+		return
+	}
+	// A new version replaces the old series
+	buildInfo.Reset()
+	for _, b := range cfg.Builds {
+		version, err := readBuildVersion(b)
+		if err != nil {
+			logCollectorError("build_info", "Error reading version of", b.Instance+":", err)
+			checkPermission("build_info", err)
+			continue
+		}
+		if version != "" {
+			buildInfo.WithLabelValues(b.Instance, version).Set(1)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// collectorTTLFlag collects repeated --collector.ttl=name=duration flags
+type collectorTTLFlag map[string]time.Duration
+
+func (f collectorTTLFlag) String() string {
+	var parts []string
+	for name, ttl := range f {
+		parts = append(parts, name+"="+ttl.String())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (f collectorTTLFlag) Set(value string) error {
+	name, ttl, found := strings.Cut(value, "=")
+	if !found || name == "" {
+		return fmt.Errorf("expected name=duration, got %q", value)
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return err
+	}
+	f[name] = d
+	return nil
+}
+
+var collectorTTLs = make(collectorTTLFlag)
+
+func init() {
+	flag.Var(collectorTTLs, "collector.ttl", "Minimum time between refreshes of a collector as name=duration, e.g. disk=5m. Until then its last values are served. Repeatable; 0 refreshes every cycle. Default 30s for disk and fail2ban, 1m for backup and steam, 5m for host_info, os_info and public_ip.")
+}
+
+// Last refresh of each collector
+var collectorRefreshed = make(map[string]time.Time)
+
+// validateCollectorTTLs checks that --collector.ttl names real collectors
+func validateCollectorTTLs() error {
+	for name := range collectorTTLs {
+		if !slices.ContainsFunc(collectors, func(c collector) bool { return c.name == name }) {
+			return fmt.Errorf("--collector.ttl: unknown collector %q", name)
+		}
+	}
+	return nil
+}
+
+// cached tells whether the collector's last values are still within its TTL
+func (c collector) cached(now time.Time) bool {
+	ttl := c.ttl
+	if v, ok := collectorTTLs[c.name]; ok {
+		ttl = v
+	}
+	return ttl > 0 && now.Sub(collectorRefreshed[c.name]) < ttl
+}
+
+// maxAgeHandler runs a collection cycle before serving a scrape with
+// ?max_age=duration, refreshing the collectors whose values are older than
+// that regardless of their TTL. Only the collectors returned by selected are
+// refreshed, all of them if it returns nil.
+func maxAgeHandler(selected func(r *http.Request) ([]collector, error), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.URL.Query().Get("max_age"); v != "" {
+			maxAge, err := time.ParseDuration(v)
+			if err != nil || maxAge < 0 {
+				http.Error(w, fmt.Sprintf("invalid max_age %q", v), http.StatusBadRequest)
+				return
+			}
+			// Unknown collectors are reported by the metrics handler
+			if selected, err := selected(r); err == nil {
+				collect(func(c collector, now time.Time) bool {
+					if selected != nil && !slices.ContainsFunc(selected, func(s collector) bool { return s.name == c.name }) {
+						return true
+					}
+					return now.Sub(collectorRefreshed[c.name]) < maxAge
+				})
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
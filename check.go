@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The check subcommand runs one collector once and reports a metric like a
+// Nagios plugin, so NRPE and Icinga can use the same binary:
+//
+//	game_exporter check --collector=disk --warn=80 --crit=90
+
+// Nagios plugin exit codes
+const (
+	checkOK = iota
+	checkWarning
+	checkCritical
+	checkUnknown
+)
+
+var checkStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// Metrics checked by default where a collector's first metric isn't the
+// interesting one
+var checkDefaultMetrics = map[string]string{
+	"memory": "game_memory_usage_percent",
+}
+
+// runCheck runs the check subcommand and returns its exit code
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	name := fs.String("collector", "", "Collector to run, e.g. disk.")
+	metric := fs.String("metric", "", "Metric to check, by default the collector's first metric.")
+	labels := fs.String("labels", "", `Label matchers selecting the series, e.g. partition="/".`)
+	warn := fs.String("warn", "", "Nagios range of values that aren't a warning, e.g. 80 for 0 to 80.")
+	crit := fs.String("crit", "", "Nagios range of values that aren't critical, e.g. 90.")
+	// The exporter's flags configure the collectors the same way
+	flag.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	if err := fs.Parse(args); err != nil {
+		return checkUnknown
+	}
+
+	service := strings.ToUpper(*name)
+	if service == "" {
+		service = "CHECK"
+	}
+	unknown := func(err error) int {
+		fmt.Printf("%s UNKNOWN - %v\n", service, err)
+		return checkUnknown
+	}
+	i := slices.IndexFunc(collectors, func(c collector) bool { return c.name == *name })
+	if i < 0 {
+		return unknown(fmt.Errorf("unknown collector %q", *name))
+	}
+	c := collectors[i]
+	if c.enabled != nil && !*c.enabled {
+		return unknown(fmt.Errorf("collector %s is disabled", c.name))
+	}
+	selector := metricSelector{Metric: *metric}
+	if selector.Metric == "" {
+		selector.Metric = checkDefaultMetrics[c.name]
+	}
+	if selector.Metric == "" {
+		selector.Metric = c.metrics[0]
+	}
+	var err error
+	if selector.Labels, err = parseLabelMatchers(*labels); err != nil {
+		return unknown(fmt.Errorf("--labels: %w", err))
+	}
+	var warnRange, critRange nagiosRange
+	if warnRange, err = parseNagiosRange(*warn); err != nil {
+		return unknown(fmt.Errorf("--warn: %w", err))
+	}
+	if critRange, err = parseNagiosRange(*crit); err != nil {
+		return unknown(fmt.Errorf("--crit: %w", err))
+	}
+
+	if *configFile != "" {
+		if cfg, err = loadConfig(*configFile); err != nil {
+			return unknown(err)
+		}
+	}
+	if err := setupGameInstances(cfg.Instances); err != nil {
+		return unknown(err)
+	}
+	if err := setupSandbox(cfg.Sandbox); err != nil {
+		return unknown(err)
+	}
+	setupFilters()
+	gameProcesses = findGameProcesses()
+	c.update()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return unknown(err)
+	}
+	samples := selector.selectSamples(families)
+	if len(samples) == 0 {
+		return unknown(fmt.Errorf("no series of %s", formatSeries(selector.Metric, selector.Labels)))
+	}
+
+	// The worst series sets the state and is listed in the output
+	states := make([]int, len(samples))
+	state := checkOK
+	for i, s := range samples {
+		switch {
+		case critRange.alert(s.value):
+			states[i] = checkCritical
+		case warnRange.alert(s.value):
+			states[i] = checkWarning
+		}
+		state = max(state, states[i])
+	}
+	var text, perfdata []string
+	for i, s := range samples {
+		if states[i] == state {
+			text = append(text, formatSeries(selector.Metric, s.labels)+" = "+formatCheckValue(s.value))
+		}
+		perfdata = append(perfdata, fmt.Sprintf("'%s'=%s;%s;%s", checkPerfLabel(selector.Metric, s.labels), formatCheckValue(s.value), *warn, *crit))
+	}
+	fmt.Printf("%s %s - %s | %s\n", service, checkStates[state], strings.Join(text, ", "), strings.Join(perfdata, " "))
+	return state
+}
+
+// checkPerfLabel names a series in the performance data by its label
+// values, as Nagios labels can't contain = or '
+func checkPerfLabel(metric string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return metric
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = strings.NewReplacer("=", "_", "'", "_").Replace(labels[name])
+	}
+	return strings.Join(values, ",")
+}
+
+func formatCheckValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// nagiosRange is a threshold in the Nagios plugin format [@]start:end, where
+// a value outside start..end alerts, or inside with @. start defaults to 0,
+// ~ is negative infinity and an empty end is infinity.
+type nagiosRange struct {
+	set        bool
+	start, end float64
+	inside     bool
+}
+
+func parseNagiosRange(s string) (nagiosRange, error) {
+	r := nagiosRange{end: math.Inf(1)}
+	if s == "" {
+		return r, nil
+	}
+	r.set = true
+	s, r.inside = strings.CutPrefix(s, "@")
+	start, end, found := strings.Cut(s, ":")
+	if !found {
+		start, end = "0", s
+	}
+	var err error
+	switch start {
+	case "~":
+		r.start = math.Inf(-1)
+	case "":
+	default:
+		if r.start, err = strconv.ParseFloat(start, 64); err != nil {
+			return r, fmt.Errorf("invalid range %q", s)
+		}
+	}
+	if end != "" {
+		if r.end, err = strconv.ParseFloat(end, 64); err != nil {
+			return r, fmt.Errorf("invalid range %q", s)
+		}
+	}
+	if r.start > r.end {
+		return r, errors.New("range start is above its end")
+	}
+	return r, nil
+}
+
+func (r nagiosRange) alert(v float64) bool {
+	if !r.set {
+		return false
+	}
+	within := v >= r.start && v <= r.end
+	return within == r.inside
+}
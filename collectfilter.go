@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// requestedCollectors returns the collectors named by ?collect[]=name, or nil
+// for all of them
+func requestedCollectors(r *http.Request) ([]collector, error) {
+	return selectCollectors(r.URL.Query()["collect[]"])
+}
+
+// selectCollectors returns the named collectors, or nil for all of them
+func selectCollectors(names []string) ([]collector, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	var selected []collector
+	for _, name := range names {
+		i := slices.IndexFunc(collectors, func(c collector) bool { return c.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown collector %q", name)
+		}
+		selected = append(selected, collectors[i])
+	}
+	return selected, nil
+}
+
+// collectorGatherer keeps the metric families of the selected collectors,
+// their series of the per-collector exporter metrics and the listed families
+type collectorGatherer struct {
+	prometheus.Gatherer
+	selected []collector
+	families []string
+}
+
+func (g collectorGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	var kept []*dto.MetricFamily
+	for _, family := range families {
+		switch name := family.GetName(); name {
+		case "game_last_collection_timestamp_seconds", "game_collector_permission_denied":
+			family.Metric = slices.DeleteFunc(family.Metric, func(m *dto.Metric) bool {
+				return !g.selects(collectorLabel(m))
+			})
+			if len(family.Metric) > 0 {
+				kept = append(kept, family)
+			}
+		default:
+			if slices.Contains(g.families, name) || slices.ContainsFunc(g.selected, func(c collector) bool { return c.exports(name) }) {
+				kept = append(kept, family)
+			}
+		}
+	}
+	return kept, err
+}
+
+func (g collectorGatherer) selects(name string) bool {
+	return slices.ContainsFunc(g.selected, func(c collector) bool { return c.name == name })
+}
+
+func collectorLabel(m *dto.Metric) string {
+	for _, l := range m.Label {
+		if l.GetName() == "collector" {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// exports tells whether the metric family comes from the collector
+func (c collector) exports(family string) bool {
+	for _, m := range c.metrics {
+		if family == m || strings.HasPrefix(family, m+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// Scrapers asking for OpenMetrics get it, with the exemplars of
+// game_query_duration_seconds
+var metricsHandlerOpts = promhttp.HandlerOpts{EnableOpenMetrics: true}
+
+// metricsHandler serves all metrics, or with ?collect[]=name only those of
+// the named collectors. A federation hub adds the metrics of its peers.
+func metricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		selected, err := requestedCollectors(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		promhttp.HandlerFor(federate(metricsGatherer(selected, requestTraceID(r)), r), metricsHandlerOpts).ServeHTTP(w, r)
+	})
+}
+
+// metricsGatherer gathers the metrics of the selected collectors, or all of
+// them and the query targets' if nil. traceID is the trace of the scrape.
+func metricsGatherer(selected []collector, traceID string) prometheus.Gatherer {
+	if selected != nil {
+		return relabelGatherer{hostLabelGatherer{targetLabelGatherer{collectorGatherer{Gatherer: prometheus.DefaultGatherer, selected: selected}}}}
+	}
+	return relabelGatherer{hostLabelGatherer{targetLabelGatherer{queryGatherer{Gatherer: prometheus.DefaultGatherer, traceID: traceID}}}}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+var configFile = flag.String("config.file", "", "Path to the YAML configuration file (optional).")
+
+// config is the YAML configuration file
+type config struct {
+	Instances    []instanceConfig    `yaml:"instances"`
+	Alerting     alertingConfig      `yaml:"alerting"`
+	AlertMetrics []alertMetricConfig `yaml:"alert_metrics"`
+	AuthLogs     []authLogConfig     `yaml:"auth_logs"`
+	Directories  []directoryConfig   `yaml:"directories"`
+	Files        []fileConfig        `yaml:"files"`
+	Backups      []backupConfig      `yaml:"backups"`
+	GameLogs     []gameLogConfig     `yaml:"game_logs"`
+	JournalUnits []journalUnitConfig `yaml:"journal_units"`
+	Services     []serviceConfig     `yaml:"services"`
+	Sessions     []sessionConfig     `yaml:"sessions"`
+	Builds       []buildConfig       `yaml:"builds"`
+	Queries      []queryConfig       `yaml:"queries"`
+	Voice        []voiceConfig       `yaml:"voice"`
+	Probes       []probeConfig       `yaml:"probes"`
+	PathProbes   []pathProbeConfig   `yaml:"path_probes"`
+	Plugins      []pluginConfig      `yaml:"plugins"`
+
+	BandwidthTests []bandwidthTestConfig `yaml:"bandwidth_tests"`
+
+	HostnameLabels []hostnameLabelConfig `yaml:"hostname_labels"`
+	DerivedMetrics []derivedMetricConfig `yaml:"derived_metrics"`
+	RecordingRules []recordingRuleConfig `yaml:"recording_rules"`
+	Federation     federationConfig      `yaml:"federation"`
+	Kafka          kafkaConfig           `yaml:"kafka"`
+	MQTT           mqttConfig            `yaml:"mqtt"`
+	SNMP           snmpConfig            `yaml:"snmp"`
+	Zabbix         zabbixConfig          `yaml:"zabbix"`
+	Dump           dumpConfig            `yaml:"dump"`
+	History        historyConfig         `yaml:"history"`
+	Sandbox        []sandboxConfig       `yaml:"sandbox"`
+	Relabel        []relabelConfig       `yaml:"relabel"`
+
+	// Shorthands for queries with the protocol of the section
+	A2S       []queryConfig `yaml:"a2s"`
+	Minecraft []queryConfig `yaml:"minecraft"`
+	FiveM     []queryConfig `yaml:"fivem"`
+	BattlEye  []queryConfig `yaml:"battleye"`
+	Telnet    []queryConfig `yaml:"telnet"`
+
+	source yaml.Node // The file as parsed, for /debug/config
+}
+
+// queryConfigs returns the query targets of the queries section and the
+// protocol sections
+func (c *config) queryConfigs() []queryConfig {
+	configs := append([]queryConfig(nil), c.Queries...)
+	for _, section := range []struct {
+		protocol string
+		targets  []queryConfig
+	}{
+		{"a2s", c.A2S},
+		{"minecraft", c.Minecraft},
+		{"fivem", c.FiveM},
+		{"battleye", c.BattlEye},
+		{"telnet", c.Telnet},
+	} {
+		for _, q := range section.targets {
+			q.Protocol = section.protocol
+			configs = append(configs, q)
+		}
+	}
+	return configs
+}
+
+// Loaded configuration; the zero value when no file is given
+var cfg config
+
+func loadConfig(path string) (config, error) {
+	var c config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, &c.source); err != nil {
+		return c, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := c.Alerting.validate(); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateDirectories(c.Directories); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateFiles(c.Files); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateBackups(c.Backups); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateServices(c.Services); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateBuilds(c.Builds); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateQueries(c.queryConfigs()); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateVoice(c.Voice); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateProbes(c.Probes); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validatePathProbes(c.PathProbes); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validatePlugins(c.Plugins); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateBandwidthTests(c.BandwidthTests); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateHostnameLabels(c.HostnameLabels); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateRecordingRules(c.RecordingRules); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateFederation(c.Federation); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateKafka(c.Kafka); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateMQTT(c.MQTT); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateSNMP(c.SNMP); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateZabbix(c.Zabbix); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateDump(c.Dump); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateHistory(c.History); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateSandbox(c.Sandbox); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateRelabeling(c.Relabel); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// queryValueConfig is a value exported as game_query_value{name}, taken from
+// the first group of pattern in console output or from path in a JSON reply,
+// times scale (e.g. 1048576 for MB)
+type queryValueConfig struct {
+	Name    string  `yaml:"name"`
+	Pattern string  `yaml:"pattern"`
+	Path    string  `yaml:"path"`
+	Scale   float64 `yaml:"scale"`
+}
+
+// validateQueryValues checks the names of a target's values
+func validateQueryValues(values []queryValueConfig) error {
+	names := make(map[string]bool)
+	for _, v := range values {
+		if v.Name == "" {
+			return errors.New("values need a name")
+		}
+		if names[v.Name] {
+			return fmt.Errorf("value %q defined twice", v.Name)
+		}
+		names[v.Name] = true
+	}
+	return nil
+}
+
+func (v queryValueConfig) scale() float64 {
+	if v.Scale == 0 {
+		return 1
+	}
+	return v.Scale
+}
+
+// outputPatterns extracts the player count, slots and values from the output
+// of a console command
+type outputPatterns struct {
+	players    *regexp.Regexp
+	maxPlayers *regexp.Regexp
+	values     []queryValueConfig
+	valueRegs  []*regexp.Regexp
+}
+
+func newOutputPatterns(players, maxPlayers string, values []queryValueConfig) (*outputPatterns, error) {
+	if players == "" && maxPlayers == "" && len(values) == 0 {
+		return nil, errors.New("nothing to extract, set players, max_players or values")
+	}
+	if err := validateQueryValues(values); err != nil {
+		return nil, err
+	}
+	p := &outputPatterns{values: values}
+	var err error
+	if p.players, err = compileOptional(players); err != nil {
+		return nil, err
+	}
+	if p.maxPlayers, err = compileOptional(maxPlayers); err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		if v.Pattern == "" {
+			return nil, fmt.Errorf("value %q needs a pattern", v.Name)
+		}
+		re, err := regexp.Compile(v.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		p.valueRegs = append(p.valueRegs, re)
+	}
+	return p, nil
+}
+
+// compileOptional compiles a pattern, nil if it's empty
+func compileOptional(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+// all returns the configured patterns
+func (p *outputPatterns) all() []*regexp.Regexp {
+	patterns := append([]*regexp.Regexp(nil), p.valueRegs...)
+	for _, re := range []*regexp.Regexp{p.players, p.maxPlayers} {
+		if re != nil {
+			patterns = append(patterns, re)
+		}
+	}
+	return patterns
+}
+
+// matchedAll tells whether every pattern matched the output
+func (p *outputPatterns) matchedAll(output []byte) bool {
+	for _, re := range p.all() {
+		if !re.Match(output) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *outputPatterns) matchedAny(output []byte) bool {
+	for _, re := range p.all() {
+		if re.Match(output) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets what the patterns found in the output. Values that didn't match
+// are left out; the player count is 0 then.
+func (p *outputPatterns) apply(info *serverInfo, output []byte) {
+	if v, ok := lastMatchValue(p.players, output); ok {
+		info.players = v
+	}
+	if v, ok := lastMatchValue(p.maxPlayers, output); ok {
+		info.maxPlayers = v
+	}
+	for i, c := range p.values {
+		if v, ok := lastMatchValue(p.valueRegs[i], output); ok {
+			if info.values == nil {
+				info.values = make(map[string]float64)
+			}
+			info.values[c.Name] = v * c.scale()
+		}
+	}
+}
+
+// lastMatchValue parses the first group of the last match of re, the latest
+// value when the console repeats a line
+func lastMatchValue(re *regexp.Regexp, output []byte) (float64, bool) {
+	if re == nil {
+		return 0, false
+	}
+	matches := re.FindAllSubmatch(output, -1)
+	if len(matches) == 0 || len(matches[len(matches)-1]) < 2 {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(string(matches[len(matches)-1][1]), 64)
+	return v, err == nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config keys whose values are never shown
+var secretConfigKeys = []string{"password", "rcon_password", "token", "secret", "api_key"}
+
+const redacted = "<redacted>"
+
+// effectiveConfig is what /debug/config shows
+type effectiveConfig struct {
+	ConfigFile string            `yaml:"config_file"`
+	Flags      map[string]string `yaml:"flags"`
+	FlagsSet   []string          `yaml:"flags_set"` // Given on the command line, the others are defaults
+	Config     *yaml.Node        `yaml:"config,omitempty"`
+}
+
+// debugConfigHandler serves the flags, defaults included, and the config
+// file the exporter runs with as YAML, with secrets redacted
+func debugConfigHandler(w http.ResponseWriter, r *http.Request) {
+	effective := effectiveConfig{ConfigFile: *configFile, Flags: make(map[string]string)}
+	flag.VisitAll(func(f *flag.Flag) {
+		effective.Flags[f.Name] = f.Value.String()
+	})
+	flag.Visit(func(f *flag.Flag) {
+		effective.FlagsSet = append(effective.FlagsSet, f.Name)
+	})
+	sort.Strings(effective.FlagsSet)
+	if len(cfg.source.Content) > 0 {
+		// Redact a copy, the handler may run concurrently
+		doc := copyNode(cfg.source.Content[0])
+		redactNode(doc, "")
+		effective.Config = doc
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(effective); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func copyNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
+
+// redactNode hides secret values: those of secret keys, passwords in URLs,
+// the URLs of alert webhooks, whose path holds their token, and the values
+// set by sandbox environments. parent is the
+// key the node is under, sequences pass it on to their entries.
+func redactNode(n *yaml.Node, parent string) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i].Value, n.Content[i+1]
+			switch {
+			case value.Kind == yaml.ScalarNode && isSecretKey(key):
+				value.Value, value.Tag, value.Style = redacted, "!!str", 0
+			case value.Kind == yaml.ScalarNode && key == "url":
+				value.Value = redactURL(value.Value, parent == "webhooks")
+			default:
+				redactNode(value, key)
+			}
+		}
+	case yaml.SequenceNode:
+		for _, child := range n.Content {
+			// NAME=value entries of a sandbox's environment may hold credentials
+			if parent == "environment" && child.Kind == yaml.ScalarNode {
+				if name, _, found := strings.Cut(child.Value, "="); found {
+					child.Value = name + "=" + redacted
+				}
+				continue
+			}
+			redactNode(child, parent)
+		}
+	}
+}
+
+func isSecretKey(key string) bool {
+	for _, secret := range secretConfigKeys {
+		if key == secret || strings.HasSuffix(key, "_"+secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL drops the password of a URL, and everything after the host if
+// the whole URL is a secret
+func redactURL(raw string, secret bool) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		if secret {
+			return redacted
+		}
+		return raw
+	}
+	if secret {
+		return u.Scheme + "://" + u.Host + "/" + redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
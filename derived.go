@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// derivedMetricConfig defines a gauge game_derived_<name> computed from the
+// collected metrics, e.g. `game_network{activity="out",metric="bps"} /
+// game_query_players`
+type derivedMetricConfig struct {
+	Name string `yaml:"name"`
+	Expr string `yaml:"expr"`
+	Help string `yaml:"help"`
+}
+
+// derivedMetric is a parsed derived metric expression and its gauge, a
+// vector without labels so it can be left out while the value is undefined
+type derivedMetric struct {
+	expr  derivedExpr
+	gauge *prometheus.GaugeVec
+}
+
+var derivedMetrics []derivedMetric
+
+// derivedExpr is a node of a derived metric expression. ok is false when the
+// value is undefined: a selector without matching series or a division by 0.
+type derivedExpr interface {
+	eval(families []*dto.MetricFamily) (value float64, ok bool)
+}
+
+type derivedNumber float64
+
+func (n derivedNumber) eval([]*dto.MetricFamily) (float64, bool) {
+	return float64(n), true
+}
+
+// derivedSelector stands for the sum of the matching series
+type derivedSelector metricSelector
+
+func (s derivedSelector) eval(families []*dto.MetricFamily) (float64, bool) {
+	samples := metricSelector(s).selectSamples(families)
+	if len(samples) == 0 {
+		return 0, false
+	}
+	sum := 0.0
+	for _, sample := range samples {
+		sum += sample.value
+	}
+	return sum, true
+}
+
+type derivedNegation struct{ operand derivedExpr }
+
+func (n derivedNegation) eval(families []*dto.MetricFamily) (float64, bool) {
+	value, ok := n.operand.eval(families)
+	return -value, ok
+}
+
+type derivedBinary struct {
+	op          byte
+	left, right derivedExpr
+}
+
+func (b derivedBinary) eval(families []*dto.MetricFamily) (float64, bool) {
+	left, ok := b.left.eval(families)
+	if !ok {
+		return 0, false
+	}
+	right, ok := b.right.eval(families)
+	if !ok {
+		return 0, false
+	}
+	switch b.op {
+	case '+':
+		return left + right, true
+	case '-':
+		return left - right, true
+	case '*':
+		return left * right, true
+	case '/':
+		if right == 0 {
+			return 0, false
+		}
+		return left / right, true
+	}
+	return 0, false
+}
+
+// Parse the derived metric expressions and register their gauges
+func registerDerivedMetrics(configs []derivedMetricConfig) error {
+	for _, c := range configs {
+		expr, err := parseDerivedExpr(c.Expr)
+		if err != nil {
+			return fmt.Errorf("derived metric %q: %w", c.Name, err)
+		}
+		help := c.Help
+		if help == "" {
+			help = "Derived from " + c.Expr
+		}
+		gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "game_derived_" + c.Name,
+			Help: help,
+		}, nil)
+		if err := prometheus.Register(gauge); err != nil {
+			return fmt.Errorf("derived metric %q: %w", c.Name, err)
+		}
+		derivedMetrics = append(derivedMetrics, derivedMetric{expr: expr, gauge: gauge})
+	}
+	return nil
+}
+
+// Evaluate the derived metrics; an undefined value removes the series
+func updateDerivedMetrics(families []*dto.MetricFamily) {
+	for _, m := range derivedMetrics {
+		value, ok := m.expr.eval(families)
+		if !ok {
+			m.gauge.Reset()
+			continue
+		}
+		m.gauge.WithLabelValues().Set(value)
+	}
+}
+
+// parseDerivedExpr parses an arithmetic expression of numbers and
+// `metric{label="value",...}` selectors with + - * / and parentheses
+func parseDerivedExpr(expr string) (derivedExpr, error) {
+	p := &derivedParser{s: expr}
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, fmt.Errorf("%w in %q", err, expr)
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("unexpected %q in %q", p.s[p.pos:], expr)
+	}
+	return e, nil
+}
+
+type derivedParser struct {
+	s   string
+	pos int
+}
+
+func (p *derivedParser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end
+func (p *derivedParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *derivedParser) parseSum() (derivedExpr, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = derivedBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *derivedParser) parseProduct() (derivedExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = derivedBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *derivedParser) parseUnary() (derivedExpr, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return derivedNegation{operand}, nil
+	}
+	return p.parseOperand()
+}
+
+func (p *derivedParser) parseOperand() (derivedExpr, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, errors.New("unexpected end")
+	case c == '(':
+		p.pos++
+		e, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, errors.New("missing )")
+		}
+		p.pos++
+		return e, nil
+	case c == '.' || (c >= '0' && c <= '9'):
+		end := p.pos
+		for end < len(p.s) && (p.s[end] == '.' || (p.s[end] >= '0' && p.s[end] <= '9') ||
+			p.s[end] == 'e' || p.s[end] == 'E' ||
+			((p.s[end] == '+' || p.s[end] == '-') && (p.s[end-1] == 'e' || p.s[end-1] == 'E'))) {
+			end++
+		}
+		n, err := strconv.ParseFloat(p.s[p.pos:end], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p.s[p.pos:end])
+		}
+		p.pos = end
+		return derivedNumber(n), nil
+	case c == '_' || c == ':' || unicode.IsLetter(rune(c)):
+		return p.parseSelector()
+	}
+	return nil, fmt.Errorf("unexpected %q", c)
+}
+
+// parseSelector parses `metric{label="value",...}`
+func (p *derivedParser) parseSelector() (derivedExpr, error) {
+	var selector metricSelector
+	start := p.pos
+	for p.pos < len(p.s) {
+		r := rune(p.s[p.pos])
+		if !(r == '_' || r == ':' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			break
+		}
+		p.pos++
+	}
+	selector.Metric = p.s[start:p.pos]
+	if p.peek() != '{' {
+		return derivedSelector(selector), nil
+	}
+	closing := matchersEnd(p.s[p.pos:])
+	if closing < 0 {
+		return nil, errors.New("unterminated label matchers")
+	}
+	labels, err := parseLabelMatchers(p.s[p.pos+1 : p.pos+closing])
+	if err != nil {
+		return nil, err
+	}
+	selector.Labels = labels
+	p.pos += closing + 1
+	return derivedSelector(selector), nil
+}
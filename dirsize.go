@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Directory sizes are walked in the background on their own, slower schedule,
+// since world saves or demo folders can hold many thousands of files
+var dirSizeInterval = flag.Duration("collector.dirsize.interval", 5*time.Minute, "Interval between scans of the directories configured in the directories config section.")
+
+// directoryConfig is one entry of the directories config section
+type directoryConfig struct {
+	Name     string `yaml:"name"`
+	Path     string `yaml:"path"`
+	Instance string `yaml:"instance"` // Game instance the directory belongs to, if any
+}
+
+var (
+	directorySize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_directory_size_bytes",
+		Help: "Total size of the regular files under the directory",
+	}, []string{"name", "instance_name"})
+	directoryFiles = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_directory_files",
+		Help: "Number of regular files under the directory",
+	}, []string{"name", "instance_name"})
+	directoryScanDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_directory_scan_duration_seconds",
+		Help: "Time the last scan of the directory took",
+	}, []string{"name", "instance_name"})
+)
+
+func init() {
+	prometheus.MustRegister(directorySize)
+	prometheus.MustRegister(directoryFiles)
+	prometheus.MustRegister(directoryScanDuration)
+}
+
+func validateDirectories(configs []directoryConfig) error {
+	names := make(map[string]bool)
+	for _, d := range configs {
+		if d.Name == "" || d.Path == "" {
+			return errors.New("directories: name and path are required")
+		}
+		if names[d.Name] {
+			return fmt.Errorf("directory %q defined twice", d.Name)
+		}
+		names[d.Name] = true
+	}
+	return nil
+}
+
+// scanDirectory returns the total size and count of regular files under path
+func scanDirectory(path string) (size, files float64, err error) {
+	reported := false
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if p == path {
+				return walkErr
+			}
+			// Report the first unreadable entry but keep counting the rest
+			if !reported {
+				log.Println("Error scanning", p+":", walkErr)
+				reported = true
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed meanwhile
+		}
+		size += float64(info.Size())
+		files++
+		return nil
+	})
+	return size, files, err
+}
+
+// Scan the configured directories every interval
+func runDirSizes(configs []directoryConfig) {
+	for {
+		for _, d := range configs {
+			start := time.Now()
+			size, files, err := scanDirectory(rootfsFilePath(d.Path))
+			if err != nil {
+				log.Println("Error scanning directory", d.Path+":", err)
+				directorySize.DeleteLabelValues(d.Name, d.Instance)
+				directoryFiles.DeleteLabelValues(d.Name, d.Instance)
+				continue
+			}
+			directorySize.WithLabelValues(d.Name, d.Instance).Set(size)
+			directoryFiles.WithLabelValues(d.Name, d.Instance).Set(files)
+			directoryScanDuration.WithLabelValues(d.Name, d.Instance).Set(time.Since(start).Seconds())
+		}
+		time.Sleep(*dirSizeInterval)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dumpConfig is the dump config section, a sink appending the metrics of
+// every cycle to rotating files, for offline analysis on machines without
+// Prometheus, e.g. of tournament matches
+type dumpConfig struct {
+	Directory string        `yaml:"directory"`
+	Format    string        `yaml:"format"`   // csv or parquet, default csv
+	Interval  time.Duration `yaml:"interval"` // Default --collector.query.interval
+	Metrics   []string      `yaml:"metrics"`  // Names or prefixes up to a _, default all
+	Rotate    time.Duration `yaml:"rotate"`   // Period of a file, default 1h
+	Keep      int           `yaml:"keep"`     // Files kept, default all
+}
+
+const defaultDumpRotate = time.Hour
+
+// The columns of the dumps, one row per series
+var dumpColumns = []parquetColumn{
+	{"timestamp", parquetInt64, parquetTimestampMillis},
+	{"host", parquetByteArray, parquetUTF8},
+	{"metric", parquetByteArray, parquetUTF8},
+	{"labels", parquetByteArray, parquetUTF8},
+	{"value", parquetDouble, parquetNoConversion},
+}
+
+func validateDump(c dumpConfig) error {
+	if c.Directory == "" {
+		return nil
+	}
+	switch c.Format {
+	case "", "csv", "parquet":
+	default:
+		return fmt.Errorf("dump: unknown format %q", c.Format)
+	}
+	if c.Rotate < 0 || c.Rotate > 0 && c.Rotate < time.Minute {
+		return errors.New("dump: rotate must be at least 1m")
+	}
+	if c.Keep < 0 {
+		return errors.New("dump: keep can't be negative")
+	}
+	return nil
+}
+
+// Start dumping in the background, if configured
+func startDump(c dumpConfig) error {
+	if c.Directory == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.Directory, 0o755); err != nil {
+		return err
+	}
+	if c.Format == "" {
+		c.Format = "csv"
+	}
+	if c.Rotate == 0 {
+		c.Rotate = defaultDumpRotate
+	}
+	d := &dumpWriter{dumpConfig: c}
+	go runSink("dump", c.Interval, c.Metrics, d.write)
+	return nil
+}
+
+// dumpWriter appends to the file of the current period. The files are named
+// game_metrics-<start of the period in UTC>.<format>.
+type dumpWriter struct {
+	dumpConfig
+	period  time.Time
+	csv     *os.File
+	parquet *parquetWriter
+}
+
+func (d *dumpWriter) write(msg sinkMessage) (int, error) {
+	if len(msg.Metrics) == 0 {
+		return 0, nil
+	}
+	at := time.UnixMilli(int64(msg.Timestamp * 1000)).UTC()
+	if period := at.Truncate(d.Rotate); !period.Equal(d.period) || d.csv == nil && d.parquet == nil {
+		if err := d.rotate(period); err != nil {
+			return 0, err
+		}
+	}
+	var err error
+	if d.Format == "parquet" {
+		err = d.writeParquet(at, msg)
+	} else {
+		err = d.writeCSV(at, msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// rotate closes the current file, opens the period's and removes the
+// oldest files beyond keep
+func (d *dumpWriter) rotate(period time.Time) error {
+	d.close()
+	name := "game_metrics-" + period.Format("20060102T150405Z")
+	var err error
+	if d.Format == "parquet" {
+		// A Parquet file can only be appended to by its writer, so a restart
+		// within the period starts another file
+		path := filepath.Join(d.Directory, name+".parquet")
+		for i := 1; ; i++ {
+			d.parquet, err = createParquet(path, dumpColumns)
+			if !errors.Is(err, os.ErrExist) {
+				break
+			}
+			path = filepath.Join(d.Directory, fmt.Sprintf("%s.%d.parquet", name, i))
+		}
+	} else {
+		d.csv, err = os.OpenFile(filepath.Join(d.Directory, name+".csv"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err == nil {
+			err = d.writeCSVHeader()
+		}
+	}
+	if err != nil {
+		d.close()
+		return err
+	}
+	d.period = period
+	d.prune()
+	return nil
+}
+
+func (d *dumpWriter) close() {
+	if d.csv != nil {
+		d.csv.Close()
+		d.csv = nil
+	}
+	if d.parquet != nil {
+		d.parquet.Close()
+		d.parquet = nil
+	}
+}
+
+// prune removes the oldest dumps beyond keep
+func (d *dumpWriter) prune() {
+	if d.Keep == 0 {
+		return
+	}
+	files, _ := filepath.Glob(filepath.Join(d.Directory, "game_metrics-*."+d.Format))
+	// The names sort by period, and a restart's files after the first one
+	slices.SortFunc(files, func(a, b string) int {
+		return strings.Compare(strings.TrimSuffix(a, "."+d.Format), strings.TrimSuffix(b, "."+d.Format))
+	})
+	for len(files) > d.Keep {
+		if err := os.Remove(files[0]); err != nil {
+			break
+		}
+		files = files[1:]
+	}
+}
+
+// writeCSVHeader writes the header to a new file
+func (d *dumpWriter) writeCSVHeader() error {
+	info, err := d.csv.Stat()
+	if err != nil || info.Size() > 0 {
+		return err
+	}
+	header := make([]string, len(dumpColumns))
+	for i, c := range dumpColumns {
+		header[i] = c.name
+	}
+	w := csv.NewWriter(d.csv)
+	w.Write(header)
+	w.Flush()
+	return w.Error()
+}
+
+func (d *dumpWriter) writeCSV(at time.Time, msg sinkMessage) error {
+	w := csv.NewWriter(d.csv)
+	timestamp := at.Format("2006-01-02T15:04:05.000Z07:00")
+	for _, s := range msg.Metrics {
+		w.Write([]string{timestamp, msg.Host, s.Name, dumpLabels(s.Labels), strconv.FormatFloat(s.Value, 'g', -1, 64)})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func (d *dumpWriter) writeParquet(at time.Time, msg sinkMessage) error {
+	values := make([][]byte, len(dumpColumns))
+	appendString := func(b []byte, s string) []byte {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(s)))
+		return append(b, s...)
+	}
+	for _, s := range msg.Metrics {
+		values[0] = binary.LittleEndian.AppendUint64(values[0], uint64(at.UnixMilli()))
+		values[1] = appendString(values[1], msg.Host)
+		values[2] = appendString(values[2], s.Name)
+		values[3] = appendString(values[3], dumpLabels(s.Labels))
+		values[4] = binary.LittleEndian.AppendUint64(values[4], math.Float64bits(s.Value))
+	}
+	return d.parquet.appendRowGroup(len(msg.Metrics), values)
+}
+
+// dumpLabels encodes the labels as a JSON object, {} without labels
+func dumpLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	data, _ := json.Marshal(labels)
+	return string(data)
+}
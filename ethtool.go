@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ethtool collector. Ring sizes and driver statistics are only exposed
+// through the ethtool ioctl, so it runs the ethtool binary like the GPU
+// collector runs nvidia-smi
+var (
+	ethtoolEnabled = flag.Bool("collector.ethtool", false, "Enable the NIC ring buffer and queue drop collector (requires ethtool).")
+	ethtoolPath    = flag.String("collector.ethtool.path", "ethtool", "Path to the ethtool binary.")
+)
+
+var (
+	nicRingSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_nic_ring_size",
+		Help: "RX/TX ring buffer size of the NIC in descriptors, as configured (current) and the hardware maximum (max)",
+	}, []string{"interface", "direction", "type"})
+	nicQueueDrops = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_nic_queue_drops",
+		Help: "Packets dropped on a NIC queue according to the driver statistics, by driver counter name",
+	}, []string{"interface", "queue", "direction", "counter"})
+)
+
+func init() {
+	prometheus.MustRegister(nicRingSize)
+	prometheus.MustRegister(nicQueueDrops)
+}
+
+// Per-queue drop counters as named by the common drivers, e.g.
+// rx_queue_0_drops (virtio_net, ixgbe), rx0_dropped, rx-0.drops,
+// queue_0_rx_drops (ena) and "[0]: rx_discards" (bnxt_en)
+var nicQueueDropPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(?P<direction>rx|tx)[_-]?(?:queue_)?(?P<queue>\d+)[_.](?P<counter>\w*(?:drop|discard|missed)\w*)$`),
+	regexp.MustCompile(`^queue_(?P<queue>\d+)_(?P<direction>rx|tx)_(?P<counter>\w*(?:drop|discard|missed)\w*)$`),
+	regexp.MustCompile(`^\[(?P<queue>\d+)\]: (?P<direction>rx|tx)_(?P<counter>\w*(?:drop|discard|missed)\w*)$`),
+}
+
+var ethtoolSeries = newSeriesGeneration()
+
+// Collect ring sizes and per-queue drops of the physical interfaces
+func updateEthtoolMetrics() {
+	defer ethtoolSeries.sweep()
+	entries, err := os.ReadDir(sysFilePath("class/net"))
+	if err != nil {
+		logCollectorError("ethtool", "Error reading /sys/class/net:", err)
+		return
+	}
+	for _, entry := range entries {
+		iface := entry.Name()
+		// Virtual interfaces have no device and no rings
+		if _, err := os.Stat(sysFilePath(filepath.Join("class/net", iface, "device"))); err != nil {
+			continue
+		}
+		if networkDeviceFilter.ignored(iface) {
+			continue
+		}
+		updateRingSizes(iface)
+		updateQueueDrops(iface)
+	}
+}
+
+// updateRingSizes parses "ethtool -g", sections "Pre-set maximums:" and
+// "Current hardware settings:" with "RX:\t4096" lines
+func updateRingSizes(iface string) {
+	out, err := execOutput(exec.Command(*ethtoolPath, "-g", iface))
+	if err != nil {
+		logCollectorError("ethtool", "Error reading ring sizes of", iface+":", err)
+		return
+	}
+	var kind string
+	for _, line := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(line, "Pre-set maximums"):
+			kind = "max"
+			continue
+		case strings.HasPrefix(line, "Current hardware settings"):
+			kind = "current"
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || kind == "" {
+			continue
+		}
+		direction := strings.ToLower(key)
+		if direction != "rx" && direction != "tx" {
+			continue
+		}
+		// "n/a" for rings the driver doesn't report
+		if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			ethtoolSeries.set(nicRingSize, v, iface, direction, kind)
+		}
+	}
+}
+
+// updateQueueDrops parses the "name: value" lines of "ethtool -S"
+func updateQueueDrops(iface string) {
+	out, err := execOutput(exec.Command(*ethtoolPath, "-S", iface))
+	if err != nil {
+		logCollectorError("ethtool", "Error reading NIC statistics of", iface+":", err)
+		return
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		i := strings.LastIndex(line, ":")
+		if i < 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(line[i+1:]), 64)
+		if err != nil {
+			continue
+		}
+		name := line[:i]
+		for _, re := range nicQueueDropPatterns {
+			m := re.FindStringSubmatch(name)
+			if m == nil {
+				continue
+			}
+			ethtoolSeries.set(nicQueueDrops, v, iface, m[re.SubexpIndex("queue")], m[re.SubexpIndex("direction")], m[re.SubexpIndex("counter")])
+			break
+		}
+	}
+}
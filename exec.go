@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Controls for the commands the collectors run, so that many exporters
+// don't fork them in lockstep
+
+var (
+	execMaxConcurrent = flag.Int("exec.max-concurrent", 4, "Maximum number of commands the collectors run at the same time, 0 for no limit.")
+	execJitter        = flag.Duration("exec.jitter", 0, "Delay the start of the collection cycles and the other periodic commands by a random time up to this, so exporters started together don't run their commands in lockstep.")
+)
+
+// execIntervalFlag collects repeated --exec.min-interval=[command=]duration
+// flags; the empty command is the default of all commands
+type execIntervalFlag map[string]time.Duration
+
+func (f execIntervalFlag) String() string {
+	var parts []string
+	for command, interval := range f {
+		if command == "" {
+			parts = append(parts, interval.String())
+		} else {
+			parts = append(parts, command+"="+interval.String())
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (f execIntervalFlag) Set(value string) error {
+	command, interval, found := strings.Cut(value, "=")
+	if !found {
+		command, interval = "", value
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		return fmt.Errorf("negative interval %s", interval)
+	}
+	f[command] = d
+	return nil
+}
+
+var execMinIntervals = make(execIntervalFlag)
+
+func init() {
+	flag.Var(execMinIntervals, "exec.min-interval", "Minimum time between two runs of the same command line, as command=duration for the command with that base name, e.g. smartctl=5m, or duration for all commands. Within it, the last output is reused. Repeatable.")
+}
+
+var (
+	execSlots     chan struct{}
+	execSlotsOnce sync.Once
+
+	execResultsMu sync.Mutex
+	execResults   = make(map[string]execResult) // By command line
+)
+
+type execResult struct {
+	out []byte
+	err error
+	at  time.Time
+}
+
+// execOutput runs the command like cmd.Output, within the exec limits
+func execOutput(cmd *exec.Cmd) ([]byte, error) {
+	return throttleExec(cmd, cmd.Output)
+}
+
+// execCombinedOutput runs the command like cmd.CombinedOutput, within the
+// exec limits
+func execCombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	return throttleExec(cmd, cmd.CombinedOutput)
+}
+
+// throttleExec reuses the last output of the command line within its minimum
+// interval, or runs it sandboxed once a slot is free
+func throttleExec(cmd *exec.Cmd, run func() ([]byte, error)) ([]byte, error) {
+	interval, ok := execMinIntervals[filepath.Base(cmd.Args[0])]
+	if !ok {
+		interval = execMinIntervals[""]
+	}
+	key := strings.Join(cmd.Args, "\x00")
+	if interval > 0 {
+		execResultsMu.Lock()
+		r, ok := execResults[key]
+		execResultsMu.Unlock()
+		if ok && time.Since(r.at) < interval {
+			return slices.Clone(r.out), r.err
+		}
+	}
+
+	if err := sandboxCommand(cmd); err != nil {
+		return nil, err
+	}
+	if *execMaxConcurrent > 0 {
+		execSlotsOnce.Do(func() {
+			execSlots = make(chan struct{}, *execMaxConcurrent)
+		})
+		execSlots <- struct{}{}
+		defer func() { <-execSlots }()
+	}
+	out, err := run()
+	if interval > 0 {
+		execResultsMu.Lock()
+		execResults[key] = execResult{slices.Clone(out), err, time.Now()}
+		execResultsMu.Unlock()
+	}
+	return out, err
+}
+
+// sleepJitter sleeps a random time up to --exec.jitter
+func sleepJitter() {
+	if *execJitter > 0 {
+		time.Sleep(rand.N(*execJitter))
+	}
+}
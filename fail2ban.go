@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fail2ban collector. The server socket speaks a pickle protocol, so it is
+// queried through fail2ban-client like the GPU collector uses nvidia-smi
+var (
+	fail2banEnabled    = flag.Bool("collector.fail2ban", false, "Enable the fail2ban jail collector (requires fail2ban-client and access to the fail2ban socket).")
+	fail2banClientPath = flag.String("collector.fail2ban.client-path", "fail2ban-client", "Path to the fail2ban-client binary.")
+	fail2banSocket     = flag.String("collector.fail2ban.socket", "/var/run/fail2ban/fail2ban.sock", "Path to the fail2ban server socket.")
+)
+
+var (
+	fail2banUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "game_fail2ban_up",
+		Help: "Whether the fail2ban server answered the last status query",
+	})
+	fail2banBanned = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_fail2ban_banned",
+		Help: "IPs currently banned by the jail",
+	}, []string{"jail"})
+	fail2banBans = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_fail2ban_bans",
+		Help: "Ban events of the jail since fail2ban started",
+	}, []string{"jail"})
+	fail2banFailed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_fail2ban_failed",
+		Help: "Failures currently tracked by the jail filter",
+	}, []string{"jail"})
+	fail2banFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_fail2ban_failures",
+		Help: "Failures matched by the jail filter since fail2ban started",
+	}, []string{"jail"})
+)
+
+func init() {
+	prometheus.MustRegister(fail2banUp)
+	prometheus.MustRegister(fail2banBanned)
+	prometheus.MustRegister(fail2banBans)
+	prometheus.MustRegister(fail2banFailed)
+	prometheus.MustRegister(fail2banFailures)
+}
+
+// runFail2banStatus runs "fail2ban-client status [jail]" and returns the
+// "key: value" pairs of its tree output
+func runFail2banStatus(args ...string) (map[string]string, error) {
+	args = append([]string{"-s", *fail2banSocket, "status"}, args...)
+	out, err := execOutput(exec.Command(*fail2banClientPath, args...))
+	if err != nil {
+		return nil, err
+	}
+	status := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		// Strip the tree drawing, e.g. "|  `- Total failed:"
+		key = strings.TrimLeft(key, " |`-")
+		status[key] = strings.TrimSpace(value)
+	}
+	return status, nil
+}
+
+// Series of the jails, which can be added and removed on reload
+var fail2banSeries = newSeriesGeneration()
+
+// Collect per-jail ban and failure counts
+func updateFail2banMetrics() {
+	// The socket is usually only writable by root
+	if err := checkWritable(*fail2banSocket); err != nil {
+		checkPermission("fail2ban", err)
+	}
+	status, err := runFail2banStatus()
+	if err != nil {
+		logCollectorError("fail2ban", "Error running fail2ban-client:", err)
+		fail2banUp.Set(0)
+		return
+	}
+	fail2banUp.Set(1)
+
+	for _, jail := range strings.Split(status["Jail list"], ",") {
+		jail = strings.TrimSpace(jail)
+		if jail == "" {
+			continue
+		}
+		jailStatus, err := runFail2banStatus(jail)
+		if err != nil {
+			logCollectorError("fail2ban", "Error reading fail2ban jail", jail+":", err)
+			continue
+		}
+		for name, g := range map[string]*prometheus.GaugeVec{
+			"Currently banned": fail2banBanned,
+			"Total banned":     fail2banBans,
+			"Currently failed": fail2banFailed,
+			"Total failed":     fail2banFailures,
+		} {
+			if v, err := strconv.ParseFloat(jailStatus[name], 64); err == nil {
+				fail2banSeries.set(g, v, jail)
+			}
+		}
+	}
+	fail2banSeries.sweep()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Collectors served on /metrics/fast, cheap enough to scrape every second
+var fastCollectorNames = []string{"cpu", "load", "network"}
+
+// Query and voice metrics served on /metrics/fast, from the last background
+// query; scrape time queries aren't run for it
+var fastFamilies = []string{
+	"game_query_up",
+	"game_query_players",
+	"game_query_max_players",
+	"game_voice_up",
+	"game_voice_clients",
+	"game_voice_max_clients",
+}
+
+func fastCollectors(*http.Request) ([]collector, error) {
+	var fast []collector
+	for _, c := range collectors {
+		if slices.Contains(fastCollectorNames, c.name) {
+			fast = append(fast, c)
+		}
+	}
+	return fast, nil
+}
+
+// fastMetricsHandler serves /metrics/fast, the cheap high-frequency subset
+// of /metrics
+func fastMetricsHandler() http.Handler {
+	fast, _ := fastCollectors(nil)
+	gatherer := relabelGatherer{hostLabelGatherer{targetLabelGatherer{queryGatherer{
+		Gatherer:    collectorGatherer{Gatherer: prometheus.DefaultGatherer, selected: fast, families: fastFamilies},
+		lastResults: true,
+	}}}}
+	return promhttp.HandlerFor(gatherer, metricsHandlerOpts)
+}
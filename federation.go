@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// federationConfig makes the exporter a hub for small setups: every scrape
+// also scrapes the exporters of the other game hosts and serves the union,
+// with a host label, so Prometheus needs one target and the firewall one hole
+type federationConfig struct {
+	Host  string       `yaml:"host"` // host label of the hub's own series, default the hostname
+	Peers []peerConfig `yaml:"peers"`
+}
+
+type peerConfig struct {
+	Host    string        `yaml:"host"`
+	URL     string        `yaml:"url"`     // e.g. http://10.0.0.2:9108/metrics
+	Timeout time.Duration `yaml:"timeout"` // Default 5s
+}
+
+const (
+	defaultPeerTimeout = 5 * time.Second
+	maxPeerResponse    = 64 << 20
+	// Set on the hub's requests to its peers, which then don't federate
+	// themselves, so a hub listed as a peer doesn't loop
+	federationHeader = "X-Game-Exporter-Federation"
+)
+
+var (
+	peerUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_peer_up",
+		Help: "Whether the last scrape of the peer exporter succeeded",
+	}, []string{"peer"})
+	peerScrapeDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_peer_scrape_duration_seconds",
+		Help: "Time taken by the last scrape of the peer exporter",
+	}, []string{"peer"})
+)
+
+func init() {
+	prometheus.MustRegister(peerUp)
+	prometheus.MustRegister(peerScrapeDuration)
+}
+
+func validateFederation(c federationConfig) error {
+	hosts := map[string]bool{c.Host: true}
+	if c.Host == "" {
+		hostname, _ := os.Hostname()
+		hosts = map[string]bool{hostname: true}
+	}
+	for _, p := range c.Peers {
+		if p.Host == "" || p.URL == "" {
+			return errors.New("federation peers: host and url are required")
+		}
+		if !strings.HasPrefix(p.URL, "http://") && !strings.HasPrefix(p.URL, "https://") {
+			return fmt.Errorf("peer %q: url must be an http or https URL", p.Host)
+		}
+		if hosts[p.Host] {
+			return fmt.Errorf("peer %q: host used twice, or by the hub itself", p.Host)
+		}
+		hosts[p.Host] = true
+	}
+	return nil
+}
+
+// federate returns the gatherer with the peers' series added, unless there
+// are no peers or the request comes from a hub
+func federate(g prometheus.Gatherer, r *http.Request) prometheus.Gatherer {
+	if len(cfg.Federation.Peers) == 0 || r.Header.Get(federationHeader) != "" {
+		return g
+	}
+	host := cfg.Federation.Host
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	// Peers filter their collectors like the hub
+	query := url.Values{"collect[]": r.URL.Query()["collect[]"]}
+	return federationGatherer{Gatherer: g, host: host, query: query.Encode()}
+}
+
+// federationGatherer adds the series of the peers to the hub's, with a host
+// label. A series' own host label is kept as exported_host.
+type federationGatherer struct {
+	prometheus.Gatherer
+	host  string
+	query string
+}
+
+func (g federationGatherer) Gather() ([]*dto.MetricFamily, error) {
+	peers := cfg.Federation.Peers
+	results := make([]map[string]*dto.MetricFamily, len(peers))
+	var wg sync.WaitGroup
+	for i, p := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			families, err := p.scrape(g.query)
+			peerScrapeDuration.WithLabelValues(p.Host).Set(time.Since(start).Seconds())
+			if err != nil {
+				log.Println("Error scraping peer", p.Host+":", err)
+				peerUp.WithLabelValues(p.Host).Set(0)
+				return
+			}
+			peerUp.WithLabelValues(p.Host).Set(1)
+			results[i] = families
+		}()
+	}
+	wg.Wait()
+
+	// The hub's own series, after the peer metrics are updated
+	families, err := g.Gatherer.Gather()
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, f := range families {
+		setHostLabel(f, g.host)
+		byName[f.GetName()] = f
+	}
+	for i, p := range peers {
+		names := make([]string, 0, len(results[i]))
+		for name := range results[i] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			f := results[i][name]
+			setHostLabel(f, p.Host)
+			existing, ok := byName[name]
+			if !ok {
+				byName[name] = f
+				families = append(families, f)
+				continue
+			}
+			// Peers running another version may export a family with another
+			// type, which can't be merged
+			if existing.GetType() == f.GetType() {
+				existing.Metric = append(existing.Metric, f.Metric...)
+			}
+		}
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].GetName() < families[j].GetName() })
+	return families, err
+}
+
+// setHostLabel labels every series of the family with the host
+func setHostLabel(f *dto.MetricFamily, host string) {
+	name, exportedName := "host", "exported_host"
+	for _, m := range f.Metric {
+		for _, l := range m.Label {
+			if l.GetName() == name {
+				l.Name = &exportedName
+			}
+		}
+		m.Label = append(m.Label, &dto.LabelPair{Name: &name, Value: &host})
+		sort.Slice(m.Label, func(i, j int) bool { return m.Label[i].GetName() < m.Label[j].GetName() })
+	}
+}
+
+// scrape fetches the peer's metrics in the text format
+func (p peerConfig) scrape(query string) (map[string]*dto.MetricFamily, error) {
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = defaultPeerTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	target := p.URL
+	if query != "" {
+		if strings.Contains(target, "?") {
+			target += "&" + query
+		} else {
+			target += "?" + query
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+	req.Header.Set(federationHeader, "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(io.LimitReader(resp.Body, maxPeerResponse))
+}
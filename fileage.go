@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fileConfig is one entry of the files config section; path may be a glob,
+// in which case the most recently modified match is used
+type fileConfig struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+}
+
+var (
+	fileAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_file_age_seconds",
+		Help: "Seconds since the file (newest match of the pattern) was last modified",
+	}, []string{"name"})
+	fileMatches = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_file_matches",
+		Help: "Number of files matching the configured path or pattern",
+	}, []string{"name"})
+)
+
+func init() {
+	prometheus.MustRegister(fileAge)
+	prometheus.MustRegister(fileMatches)
+}
+
+func validateFiles(configs []fileConfig) error {
+	names := make(map[string]bool)
+	for _, f := range configs {
+		if f.Name == "" || f.Path == "" {
+			return errors.New("files: name and path are required")
+		}
+		if _, err := filepath.Match(f.Path, ""); err != nil {
+			return fmt.Errorf("file %q: invalid pattern %q", f.Name, f.Path)
+		}
+		if names[f.Name] {
+			return fmt.Errorf("file %q defined twice", f.Name)
+		}
+		names[f.Name] = true
+	}
+	return nil
+}
+
+// Collect the age of the configured files
+func updateFileAgeMetrics() {
+	now := time.Now()
+	for _, f := range cfg.Files {
+		matches, _ := filepath.Glob(rootfsFilePath(f.Path))
+		var newest time.Time
+		count := 0
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if err != nil {
+				checkPermission("file_age", err)
+				continue
+			}
+			if info.IsDir() {
+				continue
+			}
+			count++
+			if info.ModTime().After(newest) {
+				newest = info.ModTime()
+			}
+		}
+
+		fileMatches.WithLabelValues(f.Name).Set(float64(count))
+		if count == 0 {
+			// Leave no stale age behind, so the series is absent() for alerts
+			if fileAge.DeleteLabelValues(f.Name) {
+				log.Println("No files match", f.Path, "for", f.Name)
+			}
+			continue
+		}
+		fileAge.WithLabelValues(f.Name).Set(now.Sub(newest).Seconds())
+	}
+}
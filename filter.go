@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log"
+	"regexp"
+)
+
+// regexFilter decides whether a name (mountpoint, device, interface, ...) is
+// collected. An empty include pattern matches everything.
+type regexFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func mustNewRegexFilter(flagName, include, exclude string) regexFilter {
+	var f regexFilter
+	var err error
+	if include != "" {
+		if f.include, err = regexp.Compile(include); err != nil {
+			log.Fatalf("Invalid %s-include pattern: %v", flagName, err)
+		}
+	}
+	if exclude != "" {
+		if f.exclude, err = regexp.Compile(exclude); err != nil {
+			log.Fatalf("Invalid %s-exclude pattern: %v", flagName, err)
+		}
+	}
+	return f
+}
+
+func (f regexFilter) ignored(name string) bool {
+	if f.include != nil && !f.include.MatchString(name) {
+		return true
+	}
+	return f.exclude != nil && f.exclude.MatchString(name)
+}
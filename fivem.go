@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fivemConfig is the options of a fivem target, a FiveM or RedM
+// server (FXServer) queried over its HTTP endpoints
+type fivemConfig struct {
+	Instance string `yaml:"instance"`
+	Address  string `yaml:"address"` // host:port of the game port, usually 30120
+	timeout  time.Duration
+}
+
+var (
+	fivemResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_fivem_resources",
+		Help: "Resources started on the FXServer",
+	}, []string{"instance_name"})
+	fivemOneSync = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_fivem_onesync_enabled",
+		Help: "Whether OneSync is enabled on the FXServer",
+	}, []string{"instance_name"})
+)
+
+func init() {
+	prometheus.MustRegister(fivemResources)
+	prometheus.MustRegister(fivemOneSync)
+
+	registerQueryDriver("fivem", func(target queryConfig) (querier, error) {
+		c := fivemConfig{Instance: target.Instance, timeout: target.timeout()}
+		if err := target.decodeOptions(&c); err != nil {
+			return nil, err
+		}
+		if c.Address == "" {
+			return nil, errors.New("address is required")
+		}
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			return nil, err
+		}
+		return fivemQuerier(c), nil
+	})
+}
+
+// fivemQuerier queries an FXServer over HTTP
+type fivemQuerier fivemConfig
+
+func (q fivemQuerier) query() (*serverInfo, []playerInfo, error) {
+	info, err := queryFiveM(fivemConfig(q))
+	if err != nil {
+		fivemResources.DeleteLabelValues(q.Instance)
+		fivemOneSync.DeleteLabelValues(q.Instance)
+	}
+	return info, nil, err
+}
+
+// fivemInfo is the part of /info.json the collector uses
+type fivemInfo struct {
+	Server    string            `json:"server"` // e.g. "FXServer-master SERVER v1.0.0.7290 linux"
+	Resources []string          `json:"resources"`
+	Vars      map[string]string `json:"vars"`
+}
+
+// getFiveMJSON fetches one of the server's JSON endpoints
+func getFiveMJSON(client *http.Client, url string, v any) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// queryFiveM reads the server's info and player list
+func queryFiveM(c fivemConfig) (*serverInfo, error) {
+	client := &http.Client{Timeout: c.timeout}
+	base := "http://" + c.Address
+
+	var info fivemInfo
+	if err := getFiveMJSON(client, base+"/info.json", &info); err != nil {
+		return nil, err
+	}
+	// The player list is the lighter request, so it gives the latency
+	start := time.Now()
+	var players []json.RawMessage
+	if err := getFiveMJSON(client, base+"/players.json", &players); err != nil {
+		return nil, err
+	}
+	latency := time.Since(start)
+
+	result := &serverInfo{
+		name:    info.Vars["sv_projectName"],
+		game:    info.Vars["gamename"],
+		version: info.Server,
+		players: float64(len(players)),
+		latency: latency,
+	}
+	if result.game == "" {
+		result.game = "gta5"
+	}
+	result.maxPlayers, _ = strconv.ParseFloat(info.Vars["sv_maxClients"], 64)
+
+	fivemResources.WithLabelValues(c.Instance).Set(float64(len(info.Resources)))
+	// Newer builds set onesync to on/legacy/off, older ones onesync_enabled
+	oneSync := 0.0
+	if v := info.Vars["onesync"]; v == "on" || v == "legacy" || info.Vars["onesync_enabled"] == "true" {
+		oneSync = 1
+	}
+	fivemOneSync.WithLabelValues(c.Instance).Set(oneSync)
+	return result, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// GPU collector, backed by NVML through nvidia-smi so the exporter stays a
+// static binary on hosts without the NVIDIA driver
+var (
+	gpuCollectorEnabled = flag.Bool("collector.gpu", false, "Enable the NVIDIA GPU collector (requires nvidia-smi).")
+	gpuNvidiaSmiPath    = flag.String("collector.gpu.nvidia-smi-path", "nvidia-smi", "Path to the nvidia-smi binary.")
+	gpuProcessInclude   = flag.String("collector.gpu.process-include", "", "Regexp of process names to export per-process GPU memory for (default all).")
+
+	gpuProcessFilter regexFilter
+)
+
+var (
+	gpuInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_gpu_info",
+		Help: "GPU model and driver information",
+	}, []string{"gpu", "uuid", "name", "driver_version"})
+	gpuUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_gpu_utilization_percent",
+		Help: "GPU core utilization percentage",
+	}, []string{"gpu"})
+	gpuMemoryUtilization = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_gpu_memory_utilization_percent",
+		Help: "GPU memory controller utilization percentage",
+	}, []string{"gpu"})
+	gpuMemoryTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_gpu_memory_total_bytes",
+		Help: "Total GPU memory in bytes",
+	}, []string{"gpu"})
+	gpuMemoryUsed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_gpu_memory_used_bytes",
+		Help: "Used GPU memory in bytes",
+	}, []string{"gpu"})
+	gpuTemperature = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_gpu_temperature_celsius",
+		Help: "GPU core temperature in degrees Celsius",
+	}, []string{"gpu"})
+	gpuPower = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_gpu_power_watts",
+		Help: "GPU power draw in watts",
+	}, []string{"gpu"})
+	gpuProcessMemory = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_gpu_process_memory_bytes",
+		Help: "GPU memory used by a process in bytes",
+	}, []string{"gpu", "pid", "process"})
+)
+
+func init() {
+	prometheus.MustRegister(gpuInfo)
+	prometheus.MustRegister(gpuUtilization)
+	prometheus.MustRegister(gpuMemoryUtilization)
+	prometheus.MustRegister(gpuMemoryTotal)
+	prometheus.MustRegister(gpuMemoryUsed)
+	prometheus.MustRegister(gpuTemperature)
+	prometheus.MustRegister(gpuPower)
+	prometheus.MustRegister(gpuProcessMemory)
+}
+
+// runNvidiaSmi runs a CSV query and returns the rows split into fields
+func runNvidiaSmi(args ...string) ([][]string, error) {
+	args = append(args, "--format=csv,noheader,nounits")
+	out, err := execOutput(exec.Command(*gpuNvidiaSmiPath, args...))
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		rows = append(rows, fields)
+	}
+	return rows, nil
+}
+
+// Series of the GPUs and their processes, to drop those of exited processes
+// and of fields that stop being reported
+var gpuSeries = newSeriesGeneration()
+
+// setGPUValue sets the gauge of the labels unless nvidia-smi reported "[N/A]"
+// or "[Not Supported]"
+func setGPUValue(vec *prometheus.GaugeVec, value string, scale float64, labels ...string) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return
+	}
+	gpuSeries.set(vec, v*scale, labels...)
+}
+
+// Collect GPU metrics
+func updateGPUMetrics() {
+	rows, err := runNvidiaSmi("--query-gpu=index,uuid,name,driver_version,utilization.gpu,utilization.memory,memory.total,memory.used,temperature.gpu,power.draw")
+	if err != nil {
+		logCollectorError("gpu", "Error running nvidia-smi:", err)
+		return
+	}
+
+	uuidToIndex := make(map[string]string)
+	for _, fields := range rows {
+		if len(fields) < 10 {
+			continue
+		}
+		gpu := fields[0]
+		uuidToIndex[fields[1]] = gpu
+		gpuSeries.set(gpuInfo, 1, gpu, fields[1], fields[2], fields[3])
+		setGPUValue(gpuUtilization, fields[4], 1, gpu)
+		setGPUValue(gpuMemoryUtilization, fields[5], 1, gpu)
+		setGPUValue(gpuMemoryTotal, fields[6], 1024*1024, gpu) // Convert MiB to bytes
+		setGPUValue(gpuMemoryUsed, fields[7], 1024*1024, gpu)  // Convert MiB to bytes
+		setGPUValue(gpuTemperature, fields[8], 1, gpu)
+		setGPUValue(gpuPower, fields[9], 1, gpu)
+	}
+
+	rows, err = runNvidiaSmi("--query-compute-apps=gpu_uuid,pid,process_name,used_memory")
+	if err != nil {
+		logCollectorError("gpu", "Error running nvidia-smi:", err)
+		return
+	}
+
+	for _, fields := range rows {
+		if len(fields) < 4 {
+			continue
+		}
+		process := fields[2]
+		if gpuProcessFilter.ignored(process) {
+			continue
+		}
+		gpu, ok := uuidToIndex[fields[0]]
+		if !ok {
+			continue
+		}
+		setGPUValue(gpuProcessMemory, fields[3], 1024*1024, gpu, fields[1], process) // Convert MiB to bytes
+	}
+	gpuSeries.sweep()
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"game_exporter/api"
+
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+var grpcListenAddress = flag.String("grpc.listen-address", "", "Address to serve the gRPC API on over cleartext HTTP/2, e.g. :9109, see api/game_exporter.proto. Disabled by default.")
+
+// The service of api/game_exporter.proto, with its messages generated in
+// api. The gRPC framing over HTTP/2 is done by hand.
+const grpcService = "/game_exporter.v1.Exporter/"
+
+// gRPC status codes
+const (
+	grpcOK               = 0
+	grpcUnknown          = 2
+	grpcInvalidArgument  = 3
+	grpcNotFound         = 5
+	grpcAlreadyExists    = 6
+	grpcPermissionDenied = 7
+	grpcUnimplemented    = 12
+	grpcInternal         = 13
+	grpcUnauthenticated  = 16
+)
+
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string { return e.message }
+
+type grpcMethod struct {
+	control bool // Needs the admin token
+	handle  func(req []byte) ([]byte, error)
+}
+
+var grpcMethods = map[string]grpcMethod{
+	"GetMetrics":          {handle: grpcGetMetrics},
+	"ListCollectors":      {handle: grpcListCollectors},
+	"SetCollectorEnabled": {control: true, handle: grpcSetCollectorEnabled},
+	"AddQueryTarget":      {control: true, handle: grpcAddQueryTarget},
+}
+
+// startGRPC serves the gRPC API, if an address is given. gRPC clients speak
+// HTTP/2 without TLS to it with prior knowledge.
+func startGRPC() error {
+	if *grpcListenAddress == "" {
+		return nil
+	}
+	l, err := net.Listen("tcp", *grpcListenAddress)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(grpcHandler), Protocols: new(http.Protocols)}
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	go func() {
+		log.Fatal(srv.Serve(l))
+	}()
+	log.Println("gRPC API started on", *grpcListenAddress)
+	return nil
+}
+
+func grpcHandler(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	if r.Method != http.MethodPost || contentType != "application/grpc" && contentType != "application/grpc+proto" {
+		http.Error(w, "gRPC only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	name, _ := strings.CutPrefix(r.URL.Path, grpcService)
+	method, ok := grpcMethods[name]
+	if !ok {
+		grpcReply(w, nil, &grpcError{grpcUnimplemented, "unknown method " + r.URL.Path})
+		return
+	}
+	if method.control {
+		if err := grpcAuthorize(r); err != nil {
+			grpcReply(w, nil, err)
+			return
+		}
+	}
+	req, err := grpcReadMessage(r.Body)
+	if err != nil {
+		grpcReply(w, nil, err)
+		return
+	}
+	resp, err := method.handle(req)
+	grpcReply(w, resp, err)
+}
+
+func grpcAuthorize(r *http.Request) error {
+	if adminToken == "" {
+		return &grpcError{grpcPermissionDenied, "control methods need --web.admin-token-file"}
+	}
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(adminToken)) != 1 {
+		return &grpcError{grpcUnauthenticated, "invalid admin token"}
+	}
+	return nil
+}
+
+// grpcReadMessage reads the length-prefixed request message
+func grpcReadMessage(body io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "reading request: " + err.Error()}
+	}
+	if prefix[0] != 0 {
+		return nil, &grpcError{grpcUnimplemented, "compressed requests aren't supported"}
+	}
+	n := binary.BigEndian.Uint32(prefix[1:])
+	if n > 1<<20 {
+		return nil, &grpcError{grpcInvalidArgument, fmt.Sprintf("request of %d bytes", n)}
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "reading request: " + err.Error()}
+	}
+	return msg, nil
+}
+
+// grpcReply writes the response message, or none on an error, and the status
+// in the trailers
+func grpcReply(w http.ResponseWriter, resp []byte, err error) {
+	code, message := grpcOK, ""
+	if err != nil {
+		code, message = grpcUnknown, err.Error()
+		var e *grpcError
+		if errors.As(err, &e) {
+			code = e.code
+		}
+	}
+	if code == grpcOK {
+		frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(resp)))
+		w.Write(append(frame, resp...))
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", grpcEncodeMessage(message))
+	}
+}
+
+// grpcEncodeMessage percent-encodes the status message as gRPC requires
+func grpcEncodeMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// grpcUnmarshal decodes a request message
+func grpcUnmarshal(req []byte, m proto.Message) error {
+	if err := proto.Unmarshal(req, m); err != nil {
+		return &grpcError{grpcInvalidArgument, "invalid request message: " + err.Error()}
+	}
+	return nil
+}
+
+// grpcMarshal encodes a response message
+func grpcMarshal(m proto.Message) ([]byte, error) {
+	resp, err := proto.Marshal(m)
+	if err != nil {
+		return nil, &grpcError{grpcInternal, err.Error()}
+	}
+	return resp, nil
+}
+
+func grpcGetMetrics(data []byte) ([]byte, error) {
+	var req api.GetMetricsRequest
+	if err := grpcUnmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	selected, err := selectCollectors(req.Collect)
+	if err != nil {
+		return nil, &grpcError{grpcInvalidArgument, err.Error()}
+	}
+	families, err := metricsGatherer(selected, "").Gather()
+	if err != nil && len(families) == 0 {
+		return nil, &grpcError{grpcInternal, err.Error()}
+	}
+	return grpcMarshal(&api.GetMetricsResponse{MetricFamilies: families})
+}
+
+func grpcListCollectors(data []byte) ([]byte, error) {
+	var req api.ListCollectorsRequest
+	if err := grpcUnmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	var resp api.ListCollectorsResponse
+	for _, s := range collectorStatuses() {
+		c := &api.Collector{Name: s.Name, Enabled: s.Enabled, TtlSeconds: s.ttl.Seconds()}
+		if s.LastRun != nil {
+			c.LastRun = float64(s.LastRun.UnixMilli()) / 1000
+		}
+		if s.LastError != nil {
+			c.LastError = s.LastError.Error
+		}
+		resp.Collectors = append(resp.Collectors, c)
+	}
+	return grpcMarshal(&resp)
+}
+
+func grpcSetCollectorEnabled(data []byte) ([]byte, error) {
+	var req api.SetCollectorEnabledRequest
+	if err := grpcUnmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	if err := setCollectorDisabled(req.Name, !req.Enabled); err != nil {
+		return nil, &grpcError{grpcNotFound, err.Error()}
+	}
+	if req.Enabled {
+		log.Println("Collector", req.Name, "enabled through the gRPC API")
+	} else {
+		log.Println("Collector", req.Name, "disabled through the gRPC API")
+	}
+	return grpcMarshal(&api.SetCollectorEnabledResponse{})
+}
+
+// grpcAddQueryTarget starts querying a target. The fields are merged into
+// the options and decoded like an entry of the queries section.
+func grpcAddQueryTarget(data []byte) ([]byte, error) {
+	var req api.AddQueryTargetRequest
+	if err := grpcUnmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	target := make(map[string]any)
+	if err := yaml.Unmarshal([]byte(req.Options), &target); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "options: " + err.Error()}
+	}
+	fields := map[string]string{
+		"instance": req.Instance,
+		"protocol": req.Protocol,
+		"address":  req.Address,
+		"url":      req.Url,
+		"username": req.Username,
+		"password": req.Password,
+		"mode":     req.Mode,
+	}
+	for key, value := range fields {
+		if value != "" {
+			target[key] = value
+		}
+	}
+	if req.TimeoutSeconds != 0 {
+		target["timeout"] = time.Duration(req.TimeoutSeconds * float64(time.Second)).String()
+	}
+	if len(req.Labels) > 0 {
+		target["labels"] = req.Labels
+	}
+	config, err := yaml.Marshal(target)
+	if err != nil {
+		return nil, &grpcError{grpcInternal, err.Error()}
+	}
+	var c queryConfig
+	if err := yaml.Unmarshal(config, &c); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, err.Error()}
+	}
+	if err := validateQueries([]queryConfig{c}); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, err.Error()}
+	}
+	if slices.ContainsFunc(runningQueries(), func(t *queryTarget) bool { return t.instance == c.Instance }) {
+		return nil, &grpcError{grpcAlreadyExists, fmt.Sprintf("query target %q already running", c.Instance)}
+	}
+	if err := startQuery(c); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, err.Error()}
+	}
+	log.Println("Query target", c.Instance, "added through the gRPC API")
+	return grpcMarshal(&api.AddQueryTargetResponse{})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"game_exporter/api"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// grpcCall calls a method of the gRPC API over cleartext HTTP/2 and returns
+// the gRPC status code, decoding the response into resp if it's OK
+func grpcCall(t *testing.T, url, token, method string, req, resp proto.Message) int {
+	t.Helper()
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(data)))
+	r, err := http.NewRequest(http.MethodPost, url+grpcService+method, bytes.NewReader(append(body, data...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/grpc")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	res, err := (&http.Client{Transport: transport}).Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	frame, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ProtoMajor != 2 {
+		t.Errorf("response over %s, want HTTP/2", res.Proto)
+	}
+	code, err := strconv.Atoi(res.Trailer.Get("Grpc-Status"))
+	if err != nil {
+		t.Fatalf("grpc-status trailer %q", res.Trailer.Get("Grpc-Status"))
+	}
+	if code != grpcOK {
+		return code
+	}
+	if len(frame) < 5 || frame[0] != 0 || int(binary.BigEndian.Uint32(frame[1:])) != len(frame)-5 {
+		t.Fatalf("invalid response frame %q", frame)
+	}
+	if err := proto.Unmarshal(frame[5:], resp); err != nil {
+		t.Fatalf("decoding the %s response: %v", method, err)
+	}
+	return code
+}
+
+func TestGRPC(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(grpcHandler))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+	oldToken := adminToken
+	adminToken = "secret"
+	t.Cleanup(func() { adminToken = oldToken })
+	withQueryDuration(t)
+
+	systemLoad.WithLabelValues("1m").Set(0.5)
+	t.Cleanup(systemLoad.Reset)
+	var metrics api.GetMetricsResponse
+	if code := grpcCall(t, server.URL, "", "GetMetrics", &api.GetMetricsRequest{Collect: []string{"load"}}, &metrics); code != grpcOK {
+		t.Fatalf("GetMetrics status %d", code)
+	}
+	i := slices.IndexFunc(metrics.MetricFamilies, func(f *dto.MetricFamily) bool { return f.GetName() == "game_system_load" })
+	if i < 0 || metrics.MetricFamilies[i].Metric[0].GetGauge().GetValue() != 0.5 {
+		t.Errorf("GetMetrics families = %v, want game_system_load 0.5", metrics.MetricFamilies)
+	}
+	if slices.ContainsFunc(metrics.MetricFamilies, func(f *dto.MetricFamily) bool { return f.GetName() == "game_cpu_usage_percent" }) {
+		t.Error("GetMetrics for the load collector returned game_cpu_usage_percent")
+	}
+	if code := grpcCall(t, server.URL, "", "GetMetrics", &api.GetMetricsRequest{Collect: []string{"nope"}}, &metrics); code != grpcInvalidArgument {
+		t.Errorf("GetMetrics of an unknown collector status %d, want %d", code, grpcInvalidArgument)
+	}
+
+	enabled := func(name string) bool {
+		t.Helper()
+		var list api.ListCollectorsResponse
+		if code := grpcCall(t, server.URL, "", "ListCollectors", &api.ListCollectorsRequest{}, &list); code != grpcOK {
+			t.Fatalf("ListCollectors status %d", code)
+		}
+		if len(list.Collectors) != len(collectors) {
+			t.Errorf("ListCollectors returned %d collectors, want %d", len(list.Collectors), len(collectors))
+		}
+		i := slices.IndexFunc(list.Collectors, func(c *api.Collector) bool { return c.Name == name })
+		if i < 0 {
+			t.Fatalf("ListCollectors has no %s collector", name)
+		}
+		return list.Collectors[i].Enabled
+	}
+	if !enabled("load") {
+		t.Error("load collector disabled at the start")
+	}
+
+	disable := &api.SetCollectorEnabledRequest{Name: "load", Enabled: false}
+	if code := grpcCall(t, server.URL, "", "SetCollectorEnabled", disable, &api.SetCollectorEnabledResponse{}); code != grpcUnauthenticated {
+		t.Errorf("SetCollectorEnabled without a token status %d, want %d", code, grpcUnauthenticated)
+	}
+	if code := grpcCall(t, server.URL, "secret", "SetCollectorEnabled", disable, &api.SetCollectorEnabledResponse{}); code != grpcOK {
+		t.Fatalf("SetCollectorEnabled status %d", code)
+	}
+	t.Cleanup(func() { setCollectorDisabled("load", false) })
+	if enabled("load") {
+		t.Error("load collector still enabled after SetCollectorEnabled")
+	}
+	disable.Name = "nope"
+	if code := grpcCall(t, server.URL, "secret", "SetCollectorEnabled", disable, &api.SetCollectorEnabledResponse{}); code != grpcNotFound {
+		t.Errorf("SetCollectorEnabled of an unknown collector status %d, want %d", code, grpcNotFound)
+	}
+
+	target := &api.AddQueryTargetRequest{Instance: "test", Protocol: "nope", Address: "127.0.0.1:1", Labels: map[string]string{"tier": "a"}}
+	if code := grpcCall(t, server.URL, "secret", "AddQueryTarget", target, &api.AddQueryTargetResponse{}); code != grpcInvalidArgument {
+		t.Errorf("AddQueryTarget with an unknown protocol status %d, want %d", code, grpcInvalidArgument)
+	}
+	target.Protocol, target.Mode, target.TimeoutSeconds, target.Options = "a2s", "scrape", 2.5, `{"rules": ["sv_cheats"]}`
+	if code := grpcCall(t, server.URL, "secret", "AddQueryTarget", target, &api.AddQueryTargetResponse{}); code != grpcOK {
+		t.Fatalf("AddQueryTarget status %d", code)
+	}
+	t.Cleanup(func() { stopQuery("test") })
+	i = slices.IndexFunc(runningQueries(), func(q *queryTarget) bool { return q.instance == "test" })
+	if i < 0 {
+		t.Fatal("AddQueryTarget didn't start the target")
+	}
+	c := runningQueries()[i].config
+	if c.Protocol != "a2s" || c.Mode != "scrape" || c.Timeout != 2500*time.Millisecond || !slices.Equal(runningQueries()[i].querier.(a2sQuerier).Rules, []string{"sv_cheats"}) || c.Labels["tier"] != "a" {
+		t.Errorf("added target config = %+v", c)
+	}
+	if code := grpcCall(t, server.URL, "secret", "AddQueryTarget", target, &api.AddQueryTargetResponse{}); code != grpcAlreadyExists {
+		t.Errorf("AddQueryTarget of a running target status %d, want %d", code, grpcAlreadyExists)
+	}
+	if code := grpcCall(t, server.URL, "", "Nope", &api.ListCollectorsRequest{}, &api.ListCollectorsResponse{}); code != grpcUnimplemented {
+		t.Errorf("unknown method status %d, want %d", code, grpcUnimplemented)
+	}
+}
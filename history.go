@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// historyConfig is the history config section, an in-memory buffer of the
+// recent samples served on /history, to see what happened on the host while
+// Prometheus couldn't scrape it
+type historyConfig struct {
+	Retention time.Duration `yaml:"retention"` // Enables the history
+	Interval  time.Duration `yaml:"interval"`  // Default --collector.query.interval
+	Metrics   []string      `yaml:"metrics"`   // Names or prefixes up to a _, default all
+}
+
+func validateHistory(c historyConfig) error {
+	if c.Retention < 0 || c.Interval < 0 {
+		return errors.New("history: retention and interval can't be negative")
+	}
+	if c.Retention > 0 && c.Interval > c.Retention {
+		return errors.New("history: interval is longer than the retention")
+	}
+	return nil
+}
+
+// historySeries is the buffered samples of one series
+type historySeries struct {
+	labels map[string]string
+	window sampleWindow
+}
+
+var (
+	historyMu        sync.Mutex
+	historyRetention time.Duration
+	// Series by metric name and then by formatted series
+	history = make(map[string]map[string]*historySeries)
+)
+
+// Start recording the history in the background and serve it, if configured
+func startHistory(c historyConfig) {
+	if c.Retention == 0 {
+		return
+	}
+	interval := c.Interval
+	if interval == 0 {
+		interval = *queryInterval
+	}
+	historyRetention = c.Retention
+	http.HandleFunc("/history", historyHandler)
+	go func() {
+		host, _ := os.Hostname()
+		for {
+			time.Sleep(interval)
+			msg, err := gatherSinkMessage(host, c.Metrics)
+			if err != nil {
+				continue
+			}
+			recordHistory(msg)
+		}
+	}()
+}
+
+// recordHistory adds the samples of a cycle and forgets the series without
+// samples within the retention
+func recordHistory(msg sinkMessage) {
+	at := time.UnixMilli(int64(msg.Timestamp * 1000))
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	for _, s := range msg.Metrics {
+		series := history[s.Name]
+		if series == nil {
+			series = make(map[string]*historySeries)
+			history[s.Name] = series
+		}
+		key := formatSeries(s.Name, s.Labels)
+		h := series[key]
+		if h == nil {
+			h = &historySeries{labels: s.Labels}
+			series[key] = h
+		}
+		h.window.addWithin(at, s.Value, historyRetention)
+	}
+	cutoff := at.Add(-historyRetention)
+	for name, series := range history {
+		for key, h := range series {
+			h.window.trim(cutoff)
+			if len(h.window.samples) == 0 {
+				delete(series, key)
+			}
+		}
+		if len(series) == 0 {
+			delete(history, name)
+		}
+	}
+}
+
+type historyResponse struct {
+	Metric string               `json:"metric"`
+	Series []historySeriesValue `json:"series"`
+}
+
+type historySeriesValue struct {
+	Labels  map[string]string `json:"labels"`
+	Samples [][2]float64      `json:"samples"` // Unix time in seconds and value
+}
+
+// historyHandler serves the samples of a metric within range (default the
+// retention) as JSON, and the recorded metric names without a metric
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	since := historyRetention
+	if v := query.Get("range"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid range", http.StatusBadRequest)
+			return
+		}
+		since = d
+	}
+	matchers, err := parseLabelMatchers(query.Get("labels"))
+	if err != nil {
+		http.Error(w, "labels: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	metric := query.Get("metric")
+
+	historyMu.Lock()
+	var body any
+	if metric == "" {
+		names := make([]string, 0, len(history))
+		for name := range history {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		body = map[string][]string{"metrics": names}
+	} else {
+		resp := historyResponse{Metric: metric, Series: []historySeriesValue{}}
+		cutoff := time.Now().Add(-since)
+		keys := make([]string, 0, len(history[metric]))
+		for key := range history[metric] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			h := history[metric][key]
+			if !matchLabels(h.labels, matchers) {
+				continue
+			}
+			v := historySeriesValue{Labels: h.labels, Samples: [][2]float64{}}
+			for _, s := range h.window.samples {
+				if !s.at.Before(cutoff) {
+					v.Samples = append(v.Samples, [2]float64{float64(s.at.UnixMilli()) / 1000, s.value})
+				}
+			}
+			if len(v.Samples) > 0 {
+				resp.Series = append(resp.Series, v)
+			}
+		}
+		body = resp
+	}
+	historyMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Host identity, to join and deduplicate hosts whose scrape address is NAT'd
+// or proxied
+var hostInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "game_host_info",
+	Help: "Identity of the host: hostname, fully qualified domain name and systemd machine-id, always 1",
+}, []string{"hostname", "fqdn", "machine_id"})
+
+// OS and kernel, to find hosts on kernels with known regressions
+var osInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "game_os_info",
+	Help: "Operating system from os-release (PRETTY_NAME), kernel release and machine architecture from uname, always 1",
+}, []string{"os_release", "kernel_version", "arch"})
+
+var (
+	hostInfoSeries = newSeriesGeneration()
+	osInfoSeries   = newSeriesGeneration()
+)
+
+func init() {
+	prometheus.MustRegister(hostInfo)
+	prometheus.MustRegister(osInfo)
+}
+
+func updateHostInfoMetrics() {
+	hostname, err := os.Hostname()
+	if err != nil {
+		logCollectorError("host_info", "Error reading hostname:", err)
+		return
+	}
+	hostInfoSeries.set(hostInfo, 1, hostname, lookupFQDN(hostname), readMachineID())
+	hostInfoSeries.sweep()
+}
+
+// lookupFQDN resolves the hostname's canonical name like hostname -f,
+// falling back to the hostname itself
+func lookupFQDN(hostname string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if cname, err := net.DefaultResolver.LookupCNAME(ctx, hostname); err == nil && cname != "" {
+		return strings.TrimSuffix(cname, ".")
+	}
+	if addrs, err := net.DefaultResolver.LookupHost(ctx, hostname); err == nil {
+		for _, addr := range addrs {
+			if names, err := net.DefaultResolver.LookupAddr(ctx, addr); err == nil && len(names) > 0 {
+				return strings.TrimSuffix(names[0], ".")
+			}
+		}
+	}
+	return hostname
+}
+
+// readMachineID returns the systemd machine-id, or the D-Bus one on older
+// systems; empty where there is none
+func readMachineID() string {
+	for _, path := range []string{"etc/machine-id", "var/lib/dbus/machine-id"} {
+		if data, err := os.ReadFile(rootfsFilePath(path)); err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+func updateOSInfoMetrics() {
+	release, machine, err := uname()
+	if err != nil {
+		logCollectorError("os_info", "Error reading kernel version:", err)
+		return
+	}
+	osInfoSeries.set(osInfo, 1, readOSRelease(), release, machine)
+	osInfoSeries.sweep()
+}
+
+// readOSRelease returns PRETTY_NAME of os-release, or NAME and VERSION
+func readOSRelease() string {
+	for _, path := range []string{"etc/os-release", "usr/lib/os-release"} {
+		data, err := os.ReadFile(rootfsFilePath(path))
+		if err != nil {
+			continue
+		}
+		fields := make(map[string]string)
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+			if !found || strings.HasPrefix(key, "#") {
+				continue
+			}
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			} else {
+				value = strings.Trim(value, "'")
+			}
+			fields[key] = value
+		}
+		if fields["PRETTY_NAME"] != "" {
+			return fields["PRETTY_NAME"]
+		}
+		return strings.TrimSpace(fields["NAME"] + " " + fields["VERSION"])
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// hostnameLabelConfig parses the hostname into labels for every metric with
+// the named groups of a regexp, e.g. game, region and shard of cs2-eu1-03
+type hostnameLabelConfig struct {
+	Pattern string `yaml:"pattern"`
+}
+
+func validateHostnameLabels(configs []hostnameLabelConfig) error {
+	for _, c := range configs {
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return fmt.Errorf("hostname label pattern %q: %w", c.Pattern, err)
+		}
+		names := make(map[string]string)
+		for _, name := range re.SubexpNames() {
+			if name != "" {
+				names[name] = ""
+			}
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("hostname label pattern %q: no named groups, e.g. (?P<region>...)", c.Pattern)
+		}
+		if err := validateTargetLabels(names); err != nil {
+			return fmt.Errorf("hostname label pattern %q: %w", c.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// Labels parsed from the hostname at startup
+var hostnameLabels = make(map[string]string)
+
+// setupHostnameLabels matches the hostname against the patterns. Later
+// patterns override the labels of earlier ones; empty groups are left out.
+func setupHostnameLabels(configs []hostnameLabelConfig) error {
+	if len(configs) == 0 {
+		return nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	matched := false
+	for _, c := range configs {
+		re := regexp.MustCompile(c.Pattern)
+		m := re.FindStringSubmatch(hostname)
+		if m == nil {
+			continue
+		}
+		matched = true
+		for i, name := range re.SubexpNames() {
+			if name != "" && m[i] != "" {
+				hostnameLabels[name] = m[i]
+			}
+		}
+	}
+	if !matched {
+		log.Println("Hostname", hostname, "matches no hostname_labels pattern")
+	}
+	return nil
+}
+
+// hostLabelGatherer adds the hostname labels to every series. Labels a
+// series already has are kept.
+type hostLabelGatherer struct {
+	prometheus.Gatherer
+}
+
+func (g hostLabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	if len(hostnameLabels) == 0 {
+		return families, err
+	}
+	for _, family := range families {
+		for _, m := range family.Metric {
+			have := make(map[string]bool, len(m.Label))
+			for _, l := range m.Label {
+				have[l.GetName()] = true
+			}
+			for name, value := range hostnameLabels {
+				if !have[name] {
+					m.Label = append(m.Label, &dto.LabelPair{Name: &name, Value: &value})
+				}
+			}
+			sort.Slice(m.Label, func(i, j int) bool { return m.Label[i].GetName() < m.Label[j].GetName() })
+		}
+	}
+	return families, err
+}
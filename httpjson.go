@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpJSONConfig is the options of an http-json target, a game or mod with
+// a JSON status endpoint, fetched with basic auth if the target has a
+// username. Paths are dot separated keys and array indexes, e.g.
+// server.players.online; a path to a list or object gives its length.
+type httpJSONConfig struct {
+	URL        string             `yaml:"url"`
+	Name       string             `yaml:"name"` // Path of the server name
+	Map        string             `yaml:"map"`
+	Version    string             `yaml:"version"`
+	Players    string             `yaml:"players"`
+	MaxPlayers string             `yaml:"max_players"`
+	Values     []queryValueConfig `yaml:"values"`
+	timeout    time.Duration
+	username   string
+	password   string
+}
+
+func init() {
+	registerQueryDriver("http-json", func(target queryConfig) (querier, error) {
+		c := httpJSONConfig{timeout: target.timeout(), username: target.Username, password: target.Password}
+		if err := target.decodeOptions(&c); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+			return nil, errors.New("url must be an http or https URL")
+		}
+		if err := validateQueryValues(c.Values); err != nil {
+			return nil, err
+		}
+		for _, v := range c.Values {
+			if v.Path == "" {
+				return nil, fmt.Errorf("value %q needs a path", v.Name)
+			}
+		}
+		return httpJSONQuerier(c), nil
+	})
+}
+
+// httpJSONQuerier fetches the status document; the request time is the
+// latency
+type httpJSONQuerier httpJSONConfig
+
+func (q httpJSONQuerier) query() (*serverInfo, []playerInfo, error) {
+	client := &http.Client{Timeout: q.timeout}
+	req, err := http.NewRequest(http.MethodGet, q.URL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if q.username != "" {
+		req.SetBasicAuth(q.username, q.password)
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var doc any
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+	info := &serverInfo{
+		latency: time.Since(start),
+		name:    jsonPathString(doc, q.Name),
+		mapName: jsonPathString(doc, q.Map),
+		version: jsonPathString(doc, q.Version),
+	}
+	info.players, _ = jsonPathNumber(doc, q.Players)
+	info.maxPlayers, _ = jsonPathNumber(doc, q.MaxPlayers)
+	for _, v := range q.Values {
+		if n, ok := jsonPathNumber(doc, v.Path); ok {
+			if info.values == nil {
+				info.values = make(map[string]float64)
+			}
+			info.values[v.Name] = n * v.scale()
+		}
+	}
+	return info, nil, nil
+}
+
+// jsonPath returns the element of a decoded JSON document at path
+func jsonPath(doc any, path string) (any, bool) {
+	if path == "" {
+		return nil, false
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case map[string]any:
+			var ok bool
+			if doc, ok = v[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func jsonPathString(doc any, path string) string {
+	v, ok := jsonPath(doc, path)
+	if !ok || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// jsonPathNumber returns a number, a numeric string, a boolean as 0 or 1, or
+// the length of a list or object
+func jsonPathNumber(doc any, path string) (float64, bool) {
+	v, ok := jsonPath(doc, path)
+	if !ok {
+		return 0, false
+	}
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case []any:
+		return float64(len(v)), true
+	case map[string]any:
+		return float64(len(v)), true
+	}
+	return 0, false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const httpJSONStatus = `{
+	"server": {"name": "Test Server", "map": "Everholm", "version": 1.2, "tick": "29.5", "online": true},
+	"players": [{"name": "alice"}, {"name": "bob"}],
+	"slots": 64,
+	"mods": {"a": 1, "b": 2, "c": 3},
+	"empty": null
+}`
+
+func TestJSONPath(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(httpJSONStatus), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	stringTests := []struct {
+		path, want string
+	}{
+		{"server.name", "Test Server"},
+		{"server.version", "1.2"},
+		{"players.1.name", "bob"},
+		{"players.2.name", ""},
+		{"players.x", ""},
+		{"server.name.first", ""},
+		{"empty", ""},
+		{"", ""},
+	}
+	for _, tt := range stringTests {
+		if got := jsonPathString(doc, tt.path); got != tt.want {
+			t.Errorf("jsonPathString(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	numberTests := []struct {
+		path string
+		want float64
+		ok   bool
+	}{
+		{"slots", 64, true},
+		{"server.tick", 29.5, true},
+		{"server.online", 1, true},
+		{"players", 2, true},
+		{"mods", 3, true},
+		{"server.name", 0, false},
+		{"empty", 0, false},
+		{"missing", 0, false},
+		{"players.-1", 0, false},
+	}
+	for _, tt := range numberTests {
+		if got, ok := jsonPathNumber(doc, tt.path); got != tt.want || ok != tt.ok {
+			t.Errorf("jsonPathNumber(%q) = %v, %v, want %v, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestHTTPJSONQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); user != "admin" || password != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(httpJSONStatus))
+	}))
+	defer server.Close()
+
+	var configs []queryConfig
+	err := yaml.Unmarshal([]byte(`
+- instance: test
+  protocol: http-json
+  url: `+server.URL+`
+  username: admin
+  password: secret
+  name: server.name
+  map: server.map
+  players: players
+  max_players: slots
+  values:
+    - {name: tick_rate, path: server.tick, scale: 2}
+    - {name: missing, path: server.missing}
+`), &configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := newQuerier(configs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _, err := q.query()
+	if err != nil {
+		t.Fatalf("query() = %v", err)
+	}
+	info.latency = 0
+	want := serverInfo{
+		name:       "Test Server",
+		mapName:    "Everholm",
+		players:    2,
+		maxPlayers: 64,
+		values:     map[string]float64{"tick_rate": 59},
+	}
+	if !reflect.DeepEqual(*info, want) {
+		t.Errorf("info = %+v, want %+v", *info, want)
+	}
+
+	configs[0].Password = "wrong"
+	if q, err = newQuerier(configs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := q.query(); err == nil {
+		t.Error("query() with a wrong password succeeded")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	hugepages = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_memory_hugepages",
+		Help: "Number of explicit hugepages by state (total, free, reserved, surplus)",
+	}, []string{"state"})
+	hugepageSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "game_memory_hugepage_size_bytes",
+		Help: "Default hugepage size in bytes",
+	})
+	anonHugepagesBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "game_memory_anon_hugepages_bytes",
+		Help: "Anonymous memory backed by transparent hugepages in bytes",
+	})
+	thpEnabled = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_memory_thp_enabled",
+		Help: "Transparent hugepage mode, 1 for the active mode",
+	}, []string{"mode"})
+	thpDefrag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_memory_thp_defrag",
+		Help: "Transparent hugepage defrag mode, 1 for the active mode. With always, allocations stall to compact memory",
+	}, []string{"mode"})
+	// Direct compaction stalls the allocating thread, which shows as hitches
+	compactionEvents = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_memory_compaction",
+		Help: "Memory compaction events since boot from /proc/vmstat (stall, fail, success)",
+	}, []string{"event"})
+	thpEvents = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_memory_thp_events",
+		Help: "Transparent hugepage events since boot from /proc/vmstat (fault_alloc, fault_fallback, collapse_alloc, collapse_alloc_failed, split_page)",
+	}, []string{"event"})
+)
+
+// /proc/vmstat counters of compaction and THP events
+var (
+	compactionVmstat = map[string]string{
+		"compact_stall":   "stall",
+		"compact_fail":    "fail",
+		"compact_success": "success",
+	}
+	thpVmstat = map[string]string{
+		"thp_fault_alloc":           "fault_alloc",
+		"thp_fault_fallback":        "fault_fallback",
+		"thp_collapse_alloc":        "collapse_alloc",
+		"thp_collapse_alloc_failed": "collapse_alloc_failed",
+		"thp_split_page":            "split_page",
+	}
+)
+
+func init() {
+	prometheus.MustRegister(hugepages)
+	prometheus.MustRegister(hugepageSize)
+	prometheus.MustRegister(anonHugepagesBytes)
+	prometheus.MustRegister(thpEnabled)
+	prometheus.MustRegister(thpDefrag)
+	prometheus.MustRegister(compactionEvents)
+	prometheus.MustRegister(thpEvents)
+}
+
+// Collect hugepage counters from /proc/meminfo
+func getHugepages() map[string]float64 {
+	data, err := os.ReadFile(procFilePath("meminfo"))
+	if err != nil {
+		logCollectorError("hugepages", "Error reading /proc/meminfo:", err)
+		return nil
+	}
+
+	keys := map[string]string{
+		"HugePages_Total:": "total",
+		"HugePages_Free:":  "free",
+		"HugePages_Rsvd:":  "reserved",
+		"HugePages_Surp:":  "surplus",
+		"Hugepagesize:":    "size",
+		"AnonHugePages:":   "anon",
+	}
+	metrics := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 2 {
+			continue
+		}
+		key, ok := keys[parts[0]]
+		if !ok {
+			continue
+		}
+		value, _ := strconv.ParseFloat(parts[1], 64)
+		if len(parts) == 3 && parts[2] == "kB" {
+			value *= 1024 // Convert KB to bytes
+		}
+		metrics[key] = value
+	}
+	return metrics
+}
+
+// readSysfsMode parses a sysfs selector like "always [madvise] never" into
+// the available modes and the selected one
+func readSysfsMode(name string) ([]string, string, error) {
+	data, err := os.ReadFile(sysFilePath(name))
+	if err != nil {
+		return nil, "", err
+	}
+	var modes []string
+	var selected string
+	for _, field := range strings.Fields(string(data)) {
+		if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+			field = strings.Trim(field, "[]")
+			selected = field
+		}
+		modes = append(modes, field)
+	}
+	return modes, selected, nil
+}
+
+// Collect hugepage and transparent hugepage metrics
+func updateHugepageMetrics() {
+	metrics := getHugepages()
+	for _, state := range []string{"total", "free", "reserved", "surplus"} {
+		if value, ok := metrics[state]; ok {
+			hugepages.WithLabelValues(state).Set(value)
+		}
+	}
+	hugepageSize.Set(metrics["size"])
+	anonHugepagesBytes.Set(metrics["anon"])
+
+	setSysfsMode(thpEnabled, "kernel/mm/transparent_hugepage/enabled")
+	setSysfsMode(thpDefrag, "kernel/mm/transparent_hugepage/defrag")
+
+	data, err := os.ReadFile(procFilePath("vmstat"))
+	if err != nil {
+		logCollectorError("hugepages", "Error reading /proc/vmstat:", err)
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		name, value, found := strings.Cut(line, " ")
+		if !found {
+			continue
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		if event, ok := compactionVmstat[name]; ok {
+			compactionEvents.WithLabelValues(event).Set(v)
+		} else if event, ok := thpVmstat[name]; ok {
+			thpEvents.WithLabelValues(event).Set(v)
+		}
+	}
+}
+
+// setSysfsMode exports a sysfs selector with 1 for the selected mode
+func setSysfsMode(vec *prometheus.GaugeVec, name string) {
+	// THP may be compiled out of the kernel, so a missing file is not an error
+	modes, selected, err := readSysfsMode(name)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logCollectorError("hugepages", "Error reading", name+":", err)
+		}
+		return
+	}
+	for _, mode := range modes {
+		value := 0.0
+		if mode == selected {
+			value = 1
+		}
+		vec.WithLabelValues(mode).Set(value)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// instanceConfig is one game instance in the instances config section. A
+// process belongs to the instance when all of the configured matchers match.
+type instanceConfig struct {
+	Name      string `yaml:"name"`
+	Cmdline   string `yaml:"cmdline"`   // Regexp matched against the command line
+	Port      int    `yaml:"port"`      // Port the process listens on (TCP) or is bound to (UDP)
+	Unit      string `yaml:"unit"`      // systemd unit, e.g. cs2.service
+	Container string `yaml:"container"` // Container ID or ID prefix
+}
+
+// gameInstance is a compiled instance matcher, exported as the instance_name label
+type gameInstance struct {
+	name      string
+	cmdline   *regexp.Regexp
+	port      int
+	unit      string
+	container string
+}
+
+// Monitored game instances, from --process.match and the config file
+var gameInstances []gameInstance
+
+// setupGameInstances compiles the configured instances after the flag ones
+func setupGameInstances(configs []instanceConfig) error {
+	instances := append([]gameInstance(nil), processMatches...)
+	for _, c := range configs {
+		if c.Name == "" {
+			return errors.New("instances: name is required")
+		}
+		if c.Cmdline == "" && c.Port == 0 && c.Unit == "" && c.Container == "" {
+			return fmt.Errorf("instance %q: at least one of cmdline, port, unit and container is required", c.Name)
+		}
+		inst := gameInstance{name: c.Name, port: c.Port, unit: c.Unit, container: c.Container}
+		if c.Cmdline != "" {
+			re, err := regexp.Compile(c.Cmdline)
+			if err != nil {
+				return fmt.Errorf("instance %q: %w", c.Name, err)
+			}
+			inst.cmdline = re
+		}
+		instances = append(instances, inst)
+	}
+
+	names := make(map[string]bool)
+	for _, inst := range instances {
+		if names[inst.name] {
+			return fmt.Errorf("instance %q defined twice", inst.name)
+		}
+		names[inst.name] = true
+	}
+	gameInstances = instances
+	return nil
+}
+
+// matchesCgroup reports whether any of the process' cgroup paths belongs to
+// the instance's systemd unit or container
+func (inst gameInstance) matchesCgroup(cgroups []string) bool {
+	for _, path := range cgroups {
+		segments := strings.Split(path, "/")
+		if inst.unit != "" && !containsString(segments, inst.unit) {
+			continue
+		}
+		// Runtimes name the cgroup docker-<id>.scope, docker/<id>, libpod-<id>, ...
+		if inst.container != "" && !strings.Contains(path, inst.container) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// readProcCgroups returns the cgroup paths of a process from /proc/<pid>/cgroup
+func readProcCgroups(pid int) []string {
+	data, err := os.ReadFile(procFilePath(strconv.Itoa(pid) + "/cgroup"))
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		// hierarchy-ID:controllers:path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) == 3 {
+			paths = append(paths, parts[2])
+		}
+	}
+	return paths
+}
+
+// readProcSocketInodes returns the inodes of the sockets a process has open
+func readProcSocketInodes(pid int) []uint64 {
+	fdDir := procFilePath(strconv.Itoa(pid) + "/fd")
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil
+	}
+	var inodes []uint64
+	for _, entry := range entries {
+		target, err := os.Readlink(fdDir + "/" + entry.Name())
+		if err != nil {
+			continue
+		}
+		// Socket links look like "socket:[12345]"
+		if rest, ok := strings.CutPrefix(target, "socket:["); ok {
+			if inode, err := strconv.ParseUint(strings.TrimSuffix(rest, "]"), 10, 64); err == nil {
+				inodes = append(inodes, inode)
+			}
+		}
+	}
+	return inodes
+}
+
+// Instances of the game processes' sockets by inode, resolved at most once
+// per cycle for the netstat and tcpstat collectors
+var gameSockets map[uint64]string
+
+// gameSocketOwners maps the inodes of the sockets the game processes have
+// open to their instance, through /proc/<pid>/fd
+func gameSocketOwners(processes []gameProcess) map[uint64]string {
+	if gameSockets != nil {
+		return gameSockets
+	}
+	gameSockets = make(map[uint64]string)
+	for _, p := range processes {
+		for _, inode := range readProcSocketInodes(p.pid) {
+			gameSockets[inode] = p.instance
+		}
+	}
+	return gameSockets
+}
+
+// readPortSocketInodes maps the inodes of listening TCP and bound UDP
+// sockets to their local port
+func readPortSocketInodes() map[uint64]int {
+	inodes := make(map[uint64]int)
+	for _, sock := range readTCPSockets() {
+		if sock.state == "LISTEN" {
+			inodes[sock.inode], _ = strconv.Atoi(sock.localPort)
+		}
+	}
+	for _, sock := range readSockets("net/udp", "net/udp6") {
+		inodes[sock.inode], _ = strconv.Atoi(sock.localPort)
+	}
+	return inodes
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// journalUnitConfig is one entry of the journal_units config section
+type journalUnitConfig struct {
+	Unit     string `yaml:"unit"`
+	Instance string `yaml:"instance"`
+}
+
+// Syslog priorities of the PRIORITY journal field
+var journalPriorities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// Unit lifecycle events, mostly as logged by systemd itself for the unit
+var journalEvents = []struct {
+	event   string
+	pattern *regexp.Regexp
+}{
+	{"oom", regexp.MustCompile(`OOM killer|oom-kill|Out of memory`)},
+	{"segfault", regexp.MustCompile(`status=11/SEGV|segfault|Segmentation fault`)},
+	{"started", regexp.MustCompile(`^Started `)},
+	{"stopped", regexp.MustCompile(`^Stopped `)},
+}
+
+var (
+	journalMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "game_journal_messages_total",
+		Help: "Journal messages of the unit by priority since the exporter started (or first started, with --state.dir)",
+	}, []string{"unit", "instance_name", "priority"})
+	journalLastEvent = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_journal_last_event_timestamp_seconds",
+		Help: "Time of the unit's last OOM kill, segfault, start or stop seen in the journal",
+	}, []string{"unit", "instance_name", "event"})
+)
+
+func init() {
+	prometheus.MustRegister(journalMessages)
+	prometheus.MustRegister(journalLastEvent)
+}
+
+// journalEntry holds the fields we use of journalctl's JSON output
+type journalEntry struct {
+	Message   json.RawMessage `json:"MESSAGE"` // A string, or an array of bytes when not UTF-8
+	Priority  string          `json:"PRIORITY"`
+	Timestamp string          `json:"__REALTIME_TIMESTAMP"` // Microseconds
+	Cursor    string          `json:"__CURSOR"`
+}
+
+func (e journalEntry) message() string {
+	var s string
+	if err := json.Unmarshal(e.Message, &s); err == nil {
+		return s
+	}
+	var b []byte
+	json.Unmarshal(e.Message, &b)
+	return string(b)
+}
+
+// Start following the configured units. Recent history is read once so the
+// last events are known right away; only newer messages are counted.
+func startJournalUnits(configs []journalUnitConfig) error {
+	started := time.Now().UnixMicro()
+	for _, c := range configs {
+		if c.Unit == "" {
+			return errors.New("journal_units: unit is required")
+		}
+		for _, priority := range journalPriorities {
+			journalMessages.WithLabelValues(c.Unit, c.Instance, priority)
+		}
+
+		var mu sync.Mutex
+		lastEvents := make(map[string]int64)
+		lastCounted := started
+		var countedCursors []string // Of the messages counted at lastCounted
+		unit, instance := c.Unit, c.Instance
+		go followJournal([]string{"--unit=" + unit}, "json", 1000, func(line string) {
+			var entry journalEntry
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				return
+			}
+			ts, err := strconv.ParseInt(entry.Timestamp, 10, 64)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+
+			// journalctl is restarted with the same history, so skip what was
+			// seen; messages can share a timestamp
+			if ts > lastCounted || ts == lastCounted && !slices.Contains(countedCursors, entry.Cursor) {
+				if ts > lastCounted {
+					lastCounted = ts
+					countedCursors = nil
+				}
+				countedCursors = append(countedCursors, entry.Cursor)
+				if p, err := strconv.Atoi(entry.Priority); err == nil && p >= 0 && p < len(journalPriorities) {
+					journalMessages.WithLabelValues(unit, instance, journalPriorities[p]).Inc()
+				}
+			}
+			message := entry.message()
+			for _, e := range journalEvents {
+				if ts > lastEvents[e.event] && e.pattern.MatchString(message) {
+					lastEvents[e.event] = ts
+					journalLastEvent.WithLabelValues(unit, instance, e.event).Set(float64(ts) / 1e6)
+				}
+			}
+		})
+	}
+	return nil
+}
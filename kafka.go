@@ -0,0 +1,363 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// kafkaConfig is the kafka config section, a sink publishing the metrics of
+// every cycle as one JSON message, keyed by the hostname
+type kafkaConfig struct {
+	Brokers  []string      `yaml:"brokers"` // Bootstrap brokers, host:port
+	Topic    string        `yaml:"topic"`
+	Interval time.Duration `yaml:"interval"` // Default --collector.query.interval
+	Metrics  []string      `yaml:"metrics"`  // Names or prefixes up to a _, default all
+	TLS      bool          `yaml:"tls"`
+	Timeout  time.Duration `yaml:"timeout"` // Default 10s
+}
+
+const defaultKafkaTimeout = 10 * time.Second
+
+// Kafka API keys and the versions used, the oldest still accepted by Kafka 4
+const (
+	kafkaProduce         = 0
+	kafkaProduceVersion  = 3
+	kafkaMetadata        = 3
+	kafkaMetadataVersion = 4
+)
+
+func validateKafka(c kafkaConfig) error {
+	if len(c.Brokers) == 0 && c.Topic == "" {
+		return nil
+	}
+	if len(c.Brokers) == 0 || c.Topic == "" {
+		return errors.New("kafka: brokers and topic are required")
+	}
+	for _, b := range c.Brokers {
+		if _, _, err := net.SplitHostPort(b); err != nil {
+			return fmt.Errorf("kafka: broker %q: %w", b, err)
+		}
+	}
+	return nil
+}
+
+// Start publishing to Kafka in the background, if configured
+func startKafka(c kafkaConfig) {
+	if len(c.Brokers) == 0 {
+		return
+	}
+	p := &kafkaProducer{kafkaConfig: c}
+	go runSink("kafka", c.Interval, c.Metrics, p.publish)
+}
+
+// kafkaProducer is a minimal Kafka client: it looks up the leader of the
+// host's partition and produces to it, uncompressed with acks=1. The
+// connection is kept until an error.
+type kafkaProducer struct {
+	kafkaConfig
+	conn        net.Conn
+	partition   int32
+	correlation int32
+}
+
+func (p *kafkaProducer) publish(msg sinkMessage) (int, error) {
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	if p.conn == nil {
+		if err := p.connect(msg.Host); err != nil {
+			return 0, err
+		}
+	}
+	if err := p.produce([]byte(msg.Host), value); err != nil {
+		p.conn.Close()
+		p.conn = nil
+		return 0, err
+	}
+	return 1, nil
+}
+
+func (p *kafkaProducer) timeout() time.Duration {
+	if p.Timeout == 0 {
+		return defaultKafkaTimeout
+	}
+	return p.Timeout
+}
+
+func (p *kafkaProducer) dial(address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: p.timeout()}
+	if p.TLS {
+		host, _, _ := net.SplitHostPort(address)
+		return tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: host})
+	}
+	return dialer.Dial("tcp", address)
+}
+
+// connect asks the bootstrap brokers for the topic's partitions and connects
+// to the leader of the key's partition
+func (p *kafkaProducer) connect(key string) error {
+	var errs []error
+	for _, broker := range p.Brokers {
+		conn, err := p.dial(broker)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		leader, err := p.metadata(conn, key)
+		conn.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+			continue
+		}
+		if p.conn, err = p.dial(leader); err != nil {
+			return err
+		}
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// metadata picks the key's partition and returns its leader's address
+func (p *kafkaProducer) metadata(conn net.Conn, key string) (string, error) {
+	var req kafkaEncoder
+	req.int32(1)
+	req.string(p.Topic)
+	req.int8(1) // Allow auto topic creation, if the broker does
+	resp, err := p.roundTrip(conn, kafkaMetadata, kafkaMetadataVersion, req)
+	if err != nil {
+		return "", err
+	}
+	d := kafkaDecoder{b: resp}
+	d.int32() // Throttle time
+	brokers := make(map[int32]string)
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // Rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.string() // Cluster ID
+	d.int32()  // Controller
+	leaders := make(map[int32]int32)
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		if code := d.int16(); code != 0 {
+			return "", kafkaError(code)
+		}
+		d.string() // Name
+		d.int8()   // Internal
+		for n := d.int32(); n > 0 && d.err == nil; n-- {
+			d.int16() // Partition error, e.g. an offline replica
+			partition := d.int32()
+			leaders[partition] = d.int32()
+			d.int32s() // Replicas
+			d.int32s() // In-sync replicas
+		}
+	}
+	if d.err != nil {
+		return "", d.err
+	}
+	if len(leaders) == 0 {
+		return "", fmt.Errorf("topic %s has no partitions", p.Topic)
+	}
+	// Each host keeps to one partition, so its messages stay in order
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	p.partition = int32(h.Sum32() % uint32(len(leaders)))
+	leader, ok := brokers[leaders[p.partition]]
+	if !ok {
+		return "", fmt.Errorf("partition %d of %s has no leader", p.partition, p.Topic)
+	}
+	return leader, nil
+}
+
+// produce sends a record batch with one record
+func (p *kafkaProducer) produce(key, value []byte) error {
+	var req kafkaEncoder
+	req.int16(-1) // No transactional ID
+	req.int16(1)  // acks
+	req.int32(int32(p.timeout() / time.Millisecond))
+	req.int32(1)
+	req.string(p.Topic)
+	req.int32(1)
+	req.int32(p.partition)
+	batch := kafkaRecordBatch(key, value, time.Now())
+	req.int32(int32(len(batch)))
+	req.b = append(req.b, batch...)
+	resp, err := p.roundTrip(p.conn, kafkaProduce, kafkaProduceVersion, req)
+	if err != nil {
+		return err
+	}
+	d := kafkaDecoder{b: resp}
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		d.string() // Topic
+		for n := d.int32(); n > 0 && d.err == nil; n-- {
+			d.int32() // Partition
+			if code := d.int16(); code != 0 && d.err == nil {
+				return kafkaError(code)
+			}
+			d.int64() // Base offset
+			d.int64() // Log append time
+		}
+	}
+	return d.err
+}
+
+// kafkaRecordBatch encodes a v2 record batch (magic 2) with one record
+func kafkaRecordBatch(key, value []byte, now time.Time) []byte {
+	var record []byte
+	record = append(record, 0)              // Attributes
+	record = binary.AppendVarint(record, 0) // Timestamp delta
+	record = binary.AppendVarint(record, 0) // Offset delta
+	record = binary.AppendVarint(record, int64(len(key)))
+	record = append(record, key...)
+	record = binary.AppendVarint(record, int64(len(value)))
+	record = append(record, value...)
+	record = binary.AppendVarint(record, 0) // Headers
+
+	// The part covered by the CRC
+	var e kafkaEncoder
+	ms := now.UnixMilli()
+	e.int16(0)  // Attributes: no compression, create time
+	e.int32(0)  // Last offset delta
+	e.int64(ms) // First timestamp
+	e.int64(ms) // Max timestamp
+	e.int64(-1) // Producer ID
+	e.int16(-1) // Producer epoch
+	e.int32(-1) // Base sequence
+	e.int32(1)  // Records
+	e.b = binary.AppendVarint(e.b, int64(len(record)))
+	e.b = append(e.b, record...)
+
+	var batch kafkaEncoder
+	batch.int64(0)                   // Base offset
+	batch.int32(int32(9 + len(e.b))) // Length after this field
+	batch.int32(-1)                  // Partition leader epoch
+	batch.int8(2)                    // Magic
+	batch.int32(int32(crc32.Checksum(e.b, crc32.MakeTable(crc32.Castagnoli))))
+	return append(batch.b, e.b...)
+}
+
+// roundTrip sends a request and returns the response after its header
+func (p *kafkaProducer) roundTrip(conn net.Conn, apiKey, apiVersion int16, body kafkaEncoder) ([]byte, error) {
+	p.correlation++
+	var header kafkaEncoder
+	header.int16(apiKey)
+	header.int16(apiVersion)
+	header.int32(p.correlation)
+	header.string("game_exporter")
+	var frame kafkaEncoder
+	frame.int32(int32(len(header.b) + len(body.b)))
+	frame.b = append(frame.b, header.b...)
+	frame.b = append(frame.b, body.b...)
+
+	conn.SetDeadline(time.Now().Add(p.timeout()))
+	if _, err := conn.Write(frame.b); err != nil {
+		return nil, err
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > 1<<20 {
+		return nil, fmt.Errorf("invalid response size %d", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	if int32(binary.BigEndian.Uint32(resp)) != p.correlation {
+		return nil, errors.New("response to another request")
+	}
+	return resp[4:], nil
+}
+
+func kafkaError(code int16) error {
+	return fmt.Errorf("kafka error code %d", code)
+}
+
+type kafkaEncoder struct{ b []byte }
+
+func (e *kafkaEncoder) int8(v int8)   { e.b = append(e.b, byte(v)) }
+func (e *kafkaEncoder) int16(v int16) { e.b = binary.BigEndian.AppendUint16(e.b, uint16(v)) }
+func (e *kafkaEncoder) int32(v int32) { e.b = binary.BigEndian.AppendUint32(e.b, uint32(v)) }
+func (e *kafkaEncoder) int64(v int64) { e.b = binary.BigEndian.AppendUint64(e.b, uint64(v)) }
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+// kafkaDecoder reads big-endian fields; after a short read, err is set and
+// further reads return zeros
+type kafkaDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errors.New("short response")
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string reads a string, "" for a null one
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *kafkaDecoder) int32s() {
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		d.int32()
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKafkaRecordBatch(t *testing.T) {
+	// A v2 record batch with the record k => {"a":1}, checked against an
+	// independent CRC-32C implementation
+	want := strings.Join([]string{
+		"0000000000000000",      // Base offset
+		"00000040",              // Length
+		"ffffffff",              // Partition leader epoch
+		"02",                    // Magic
+		"b28c368d",              // CRC-32C of the rest
+		"0000",                  // Attributes
+		"00000000",              // Last offset delta
+		"0000018bcfe56800",      // First timestamp
+		"0000018bcfe56800",      // Max timestamp
+		"ffffffffffffffff",      // Producer ID
+		"ffff",                  // Producer epoch
+		"ffffffff",              // Base sequence
+		"00000001",              // Records
+		"1c",                    // Record length
+		"00",                    // Attributes
+		"00",                    // Timestamp delta
+		"00",                    // Offset delta
+		"02" + "6b",             // Key
+		"0e" + "7b2261223a317d", // Value
+		"00",                    // Headers
+	}, "")
+	got := hex.EncodeToString(kafkaRecordBatch([]byte("k"), []byte(`{"a":1}`), time.UnixMilli(1700000000000)))
+	if got != want {
+		t.Errorf("kafkaRecordBatch() =\n%s, want\n%s", got, want)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gameLogConfig is one entry of the game_logs config section
+type gameLogConfig struct {
+	Instance string `yaml:"instance"`
+	Path     string `yaml:"path"`
+}
+
+// Severity keywords, checked in order so each line counts once at its
+// highest level
+var logLevels = []struct {
+	level   string
+	pattern *regexp.Regexp
+}{
+	{"fatal", regexp.MustCompile(`\bFATAL\b|Segmentation fault|SIGSEGV|core dumped`)},
+	{"error", regexp.MustCompile(`\bERROR\b|\bSEVERE\b|Exception\b`)},
+	{"warn", regexp.MustCompile(`\bWARN(ING)?\b`)},
+}
+
+var logErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "game_log_errors_total",
+	Help: "Game log lines with a severity keyword (fatal, error, warn) since the exporter started (or first started, with --state.dir)",
+}, []string{"instance_name", "level"})
+
+func init() {
+	prometheus.MustRegister(logErrors)
+}
+
+// Start following the configured game logs
+func startGameLogs(configs []gameLogConfig) error {
+	for _, c := range configs {
+		if c.Path == "" {
+			return errors.New("game_logs: path is required")
+		}
+		instance := c.Instance
+		for _, l := range logLevels {
+			logErrors.WithLabelValues(instance, l.level)
+		}
+		go tailFile(rootfsFilePath(c.Path), func(line string) {
+			for _, l := range logLevels {
+				if l.pattern.MatchString(line) {
+					logErrors.WithLabelValues(instance, l.level).Inc()
+					return
+				}
+			}
+		})
+	}
+	return nil
+}
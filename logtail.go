@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tailFile calls handle for every line appended to the file, like tail -F:
+// it starts at the end and reopens the file when it is rotated or truncated
+func tailFile(path string, handle func(line string)) {
+	var (
+		f       *os.File
+		reader  *bufio.Reader
+		offset  int64
+		openErr string
+	)
+	for {
+		if f == nil {
+			var err error
+			if f, err = os.Open(path); err != nil {
+				// Log once, e.g. permission denied after dropping privileges
+				if err.Error() != openErr {
+					log.Println("Error opening", path+":", err)
+					openErr = err.Error()
+				}
+				time.Sleep(10 * time.Second)
+				continue
+			}
+			if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+				log.Println("Error reading", path+":", err)
+				f.Close()
+				f = nil
+				time.Sleep(10 * time.Second)
+				continue
+			}
+			reader = bufio.NewReader(f)
+		}
+
+		line, err := reader.ReadString('\n')
+		if err == nil {
+			offset += int64(len(line))
+			handle(line[:len(line)-1])
+			continue
+		}
+		// Keep the partial line for the next read
+		if len(line) > 0 {
+			f.Seek(offset, io.SeekStart)
+			reader.Reset(f)
+		}
+		time.Sleep(time.Second)
+
+		// Rotated (different file at path) or truncated: start over from the beginning
+		cur, statErr := os.Stat(path)
+		old, oldErr := f.Stat()
+		if statErr != nil || oldErr != nil {
+			continue
+		}
+		if !os.SameFile(cur, old) || old.Size() < offset {
+			f.Close()
+			if f, err = os.Open(path); err != nil {
+				f = nil
+				offset = 0
+				continue
+			}
+			offset = 0
+			reader = bufio.NewReader(f)
+		}
+	}
+}
+
+// followJournal calls handle for every journal message matching the
+// journalctl arguments, e.g. --unit=game.service, in the given output format
+// (cat, json). lines is how many messages from before the start to include.
+func followJournal(match []string, output string, lines int, handle func(line string)) {
+	args := append([]string{"--follow", "--lines=" + strconv.Itoa(lines), "--output=" + output}, match...)
+	for {
+		cmd := exec.Command("journalctl", args...)
+		killWithParent(cmd)
+		// Runs for good, so only the sandbox applies, not the exec limits
+		err := sandboxCommand(cmd)
+		var out io.ReadCloser
+		if err == nil {
+			out, err = cmd.StdoutPipe()
+		}
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			log.Println("Error running journalctl:", err)
+			time.Sleep(time.Minute)
+			continue
+		}
+		scanner := bufio.NewScanner(out)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024) // Long JSON entries
+		for scanner.Scan() {
+			handle(scanner.Text())
+		}
+		if err := cmd.Wait(); err != nil {
+			log.Println("journalctl", strings.Join(match, " "), "exited:", err)
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
@@ -2,28 +2,96 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// Filesystem roots, overridable so the exporter can run in a container with
+// the host filesystems mounted elsewhere (e.g. /host/proc).
+var (
+	procPath   = flag.String("path.procfs", "/proc", "procfs mountpoint.")
+	sysPath    = flag.String("path.sysfs", "/sys", "sysfs mountpoint.")
+	rootfsPath = flag.String("path.rootfs", "/", "rootfs mountpoint.")
+)
+
+// Disk collector filters
+var (
+	diskMountPointsInclude = flag.String("collector.disk.mount-points-include", "", "Regexp of mountpoints to include for the disk collector.")
+	diskMountPointsExclude = flag.String("collector.disk.mount-points-exclude",
+		`^/(dev|proc|run|sys|var/lib/docker/.+|var/lib/containers/storage/.+|var/lib/kubelet/.+|snap/.+)($|/)`,
+		"Regexp of mountpoints to exclude for the disk collector.")
+	diskFSTypesInclude = flag.String("collector.disk.fs-types-include", "", "Regexp of filesystem types to include for the disk collector.")
+	diskFSTypesExclude = flag.String("collector.disk.fs-types-exclude",
+		`^(autofs|binfmt_misc|bpf|cgroup2?|configfs|debugfs|devpts|devtmpfs|erofs|fusectl|hugetlbfs|iso9660|mqueue|nsfs|overlay|proc|pstore|rpc_pipefs|securityfs|selinuxfs|squashfs|sysfs|tmpfs|tracefs)$`,
+		"Regexp of filesystem types to exclude for the disk collector.")
+
+	diskMountPointFilter regexFilter
+	diskFSTypeFilter     regexFilter
+)
+
+// Diskstats collector filters
+var (
+	diskstatsDeviceInclude       = flag.String("collector.diskstats.device-include", "", "Regexp of block devices to include for the diskstats collector.")
+	diskstatsDeviceExclude       = flag.String("collector.diskstats.device-exclude", `^(ram|loop)\d+$`, "Regexp of block devices to exclude for the diskstats collector.")
+	diskstatsAggregatePartitions = flag.Bool("collector.diskstats.aggregate-partitions", false, "Report partitions as part of their parent device instead of separately.")
+
+	diskstatsDeviceFilter regexFilter
+)
+
+// Network collector filters
+var (
+	networkDeviceInclude   = flag.String("collector.network.device-include", "", "Regexp of network interfaces to include for the network collector.")
+	networkDeviceExclude   = flag.String("collector.network.device-exclude", "", "Regexp of network interfaces to exclude for the network collector (e.g. '^(veth.*|docker\\d+|br-.*)$').")
+	networkIncludeLoopback = flag.Bool("collector.network.include-loopback", false, "Also export the loopback interface.")
+
+	networkDeviceFilter regexFilter
+)
+
+func procFilePath(name string) string {
+	return filepath.Join(*procPath, name)
+}
+
+func sysFilePath(name string) string {
+	return filepath.Join(*sysPath, name)
+}
+
+func rootfsFilePath(name string) string {
+	return filepath.Join(*rootfsPath, name)
+}
+
 // Define Prometheus metrics
 var (
 	serverUptime = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "game_server_uptime_seconds",
 		Help: "Server uptime in seconds",
 	})
+	serverBootTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "game_server_boot_time_seconds",
+		Help: "Server boot time as a Unix timestamp in seconds",
+	})
+	lastCollectionTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_last_collection_timestamp_seconds",
+		Help: "Unix timestamp of the last completed collection per collector",
+	}, []string{"collector"})
 	systemLoad = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "game_system_load",
 		Help: "System load averages (1m, 5m, 15m)",
 	}, []string{"duration"})
+	systemLoadPerCore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_system_load_per_core",
+		Help: "System load averages (1m, 5m, 15m) divided by the number of online CPUs",
+	}, []string{"duration"})
 	cpuUsage = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "game_cpu_usage_percent",
 		Help: "CPU usage percentage",
@@ -50,7 +118,7 @@ var (
 	})
 	diskTotalSize = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "game_disk_total_size_bytes",
-		Help: "Total size of all disks in bytes",
+		Help: "Total size of all disks in bytes, counting each filesystem once",
 	})
 	diskTotalAvailableBytes = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "game_disk_total_available_bytes",
@@ -86,7 +154,7 @@ var (
 	}, []string{"partition"})
 	diskPerformance = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "game_disk_performance",
-		Help: "Disk performance metrics (read/write bytes and IOPS)",
+		Help: "Disk performance metrics (read/write bytes and IOPS). Bytes are /proc/diskstats sectors times 512, the unit the kernel counts in for every device whatever its logical sector size",
 	}, []string{"device", "activity"})
 	networkActivity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "game_network",
@@ -94,14 +162,17 @@ var (
 	}, []string{"interface", "activity", "metric"})
 	netstatConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "game_netstat",
-		Help: "Network connections by port and state",
-	}, []string{"port", "state"})
+		Help: "Network connections by listening port and state, with the game instance owning the port",
+	}, []string{"port", "state", "instance_name"})
 )
 
 func init() {
 	// Register metrics with Prometheus
 	prometheus.MustRegister(serverUptime)
+	prometheus.MustRegister(serverBootTime)
+	prometheus.MustRegister(lastCollectionTimestamp)
 	prometheus.MustRegister(systemLoad)
+	prometheus.MustRegister(systemLoadPerCore)
 	prometheus.MustRegister(cpuUsage)
 	prometheus.MustRegister(memoryUsagePercent)
 	prometheus.MustRegister(memoryTotalSize)
@@ -124,9 +195,9 @@ func init() {
 
 // Collect server uptime
 func getUptime() float64 {
-	data, err := os.ReadFile("/proc/uptime")
+	data, err := os.ReadFile(procFilePath("uptime"))
 	if err != nil {
-		log.Println("Error reading /proc/uptime:", err)
+		logCollectorError("uptime", "Error reading /proc/uptime:", err)
 		return 0
 	}
 	parts := strings.Fields(string(data))
@@ -137,10 +208,26 @@ func getUptime() float64 {
 	return uptime
 }
 
+// Collect boot time from the btime line of /proc/stat
+func getBootTime() float64 {
+	data, err := os.ReadFile(procFilePath("stat"))
+	if err != nil {
+		logCollectorError("uptime", "Error reading /proc/stat:", err)
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "btime ") {
+			bootTime, _ := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(line, "btime ")), 64)
+			return bootTime
+		}
+	}
+	return 0
+}
+
 func getSystemLoad() map[string]float64 {
-	data, err := os.ReadFile("/proc/loadavg")
+	data, err := os.ReadFile(procFilePath("loadavg"))
 	if err != nil {
-		log.Println("Error reading /proc/loadavg:", err)
+		logCollectorError("load", "Error reading /proc/loadavg:", err)
 		return nil
 	}
 
@@ -160,11 +247,22 @@ func getSystemLoad() map[string]float64 {
 	}
 }
 
+// Count online CPUs, falling back to the CPUs visible to the exporter
+func getOnlineCPUs() int {
+	data, err := os.ReadFile(sysFilePath("devices/system/cpu/online"))
+	if err == nil {
+		if count := countCPUList(string(data)); count > 0 {
+			return count
+		}
+	}
+	return runtime.NumCPU()
+}
+
 // Collect CPU usage
 func getCPUUsage() float64 {
-	data, err := os.ReadFile("/proc/stat")
+	data, err := os.ReadFile(procFilePath("stat"))
 	if err != nil {
-		log.Println("Error reading /proc/stat:", err)
+		logCollectorError("cpu", "Error reading /proc/stat:", err)
 		return 0
 	}
 	lines := strings.Split(string(data), "\n")
@@ -188,9 +286,9 @@ func getCPUUsage() float64 {
 
 // Collect memory usage
 func getMemoryUsage() (float64, float64, float64, float64) {
-	data, err := os.ReadFile("/proc/meminfo")
+	data, err := os.ReadFile(procFilePath("meminfo"))
 	if err != nil {
-		log.Println("Error reading /proc/meminfo:", err)
+		logCollectorError("memory", "Error reading /proc/meminfo:", err)
 		return 0, 0, 0, 0
 	}
 	var memTotal, memFree, memAvailable float64
@@ -217,43 +315,68 @@ func getMemoryUsage() (float64, float64, float64, float64) {
 
 // Collect disk usage
 func getDiskUsage() (map[string]map[string]float64, float64, float64, float64, float64, float64) {
-	cmd := exec.Command("df", "-k") // Use -k to get sizes in KB
-	out, err := cmd.Output()
+	// Prefer init's mount table so we see the host mounts when procfs is the host's
+	data, err := os.ReadFile(procFilePath("1/mounts"))
 	if err != nil {
-		log.Println("Error running df command:", err)
-		return nil, 0, 0, 0, 0, 0
+		data, err = os.ReadFile(procFilePath("mounts"))
+		if err != nil {
+			logCollectorError("disk", "Error reading mounts:", err)
+			return nil, 0, 0, 0, 0, 0
+		}
 	}
 
 	diskMetrics := make(map[string]map[string]float64)
 	var totalSize, totalUsed, totalAvailable float64
-	lines := strings.Split(string(out), "\n")
-	for i, line := range lines {
-		if i == 0 { // Skip header
+	// Bind mounts and container mounts expose the same filesystem many times;
+	// count each device only once in the totals
+	countedDevices := make(map[uint64]bool)
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
 			continue
 		}
-		fields := strings.Fields(line)
-		if len(fields) < 6 {
+		// Mountpoints are octal-escaped in the mount table (e.g. \040 for space)
+		partition := unescapeMountPath(fields[1])
+		fsType := fields[2]
+		if diskMountPointFilter.ignored(partition) || diskFSTypeFilter.ignored(fsType) {
+			continue
+		}
+
+		totalBytes, freeBytes, availableBytes, _, err := statFS(rootfsFilePath(partition))
+		if err != nil {
+			checkPermission("disk", err)
 			continue
 		}
-		partition := fields[5]
-		// Exclude partitions like /dev, /run, and /sys
-		if strings.HasPrefix(partition, "/dev") || strings.HasPrefix(partition, "/run") || strings.HasPrefix(partition, "/sys") {
+		// Skip pseudo filesystems (proc, cgroup, ...) that report no blocks, as df does
+		if totalBytes == 0 {
 			continue
 		}
-		sizeKB, _ := strconv.ParseFloat(fields[1], 64)
-		usedKB, _ := strconv.ParseFloat(fields[2], 64)
-		availableKB, _ := strconv.ParseFloat(fields[3], 64)
-		usePercent, _ := strconv.ParseFloat(strings.TrimSuffix(fields[4], "%"), 64)
+
+		size := float64(totalBytes)
+		used := float64(totalBytes - freeBytes)
+		available := float64(availableBytes)
+		var usePercent float64
+		if used+available > 0 {
+			usePercent = (used / (used + available)) * 100
+		}
 
 		diskMetrics[partition] = map[string]float64{
-			"size":        sizeKB * 1024,      // Convert KB to bytes
-			"used":        usedKB * 1024,      // Convert KB to bytes
-			"available":   availableKB * 1024, // Convert KB to bytes
+			"size":        size,
+			"used":        used,
+			"available":   available,
 			"use_percent": usePercent,
 		}
-		totalSize += sizeKB * 1024
-		totalUsed += usedKB * 1024
-		totalAvailable += availableKB * 1024
+
+		if dev, err := deviceID(rootfsFilePath(partition)); err == nil {
+			if countedDevices[dev] {
+				continue
+			}
+			countedDevices[dev] = true
+		}
+		totalSize += size
+		totalUsed += used
+		totalAvailable += available
 	}
 
 	totalAvailablePercent := (totalAvailable / totalSize) * 100
@@ -261,14 +384,39 @@ func getDiskUsage() (map[string]map[string]float64, float64, float64, float64, f
 	return diskMetrics, totalSize, totalUsed, totalAvailable, totalAvailablePercent, totalUsedPercent
 }
 
+// unescapeMountPath decodes the octal escapes used in /proc/*/mounts
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// The kernel always reports /proc/diskstats sectors in 512-byte units, whatever
+// the device's logical sector size (see Documentation/block/stat.rst), so the
+// conversion must not use /sys/block/<dev>/queue/hw_sector_size.
+const diskstatsSectorSize = 512
+
 func getDiskPerformance() map[string]map[string]float64 {
-	data, err := os.ReadFile("/proc/diskstats")
+	data, err := os.ReadFile(procFilePath("diskstats"))
 	if err != nil {
-		log.Println("Error reading /proc/diskstats:", err)
+		logCollectorError("diskstats", "Error reading /proc/diskstats:", err)
 		return nil
 	}
 
 	diskMetrics := make(map[string]map[string]float64)
+	partitionMetrics := make(map[string]map[string]float64)
 	lines := strings.Split(string(data), "\n")
 	for _, line := range lines {
 		fields := strings.Fields(line)
@@ -277,8 +425,15 @@ func getDiskPerformance() map[string]map[string]float64 {
 		}
 
 		device := fields[2]
-		if strings.HasPrefix(device, "loop") || strings.HasPrefix(device, "ram") {
-			continue // Skip loopback and RAM devices
+		isPartition := false
+		if *diskstatsAggregatePartitions {
+			if parent := partitionParent(device); parent != "" {
+				device = parent
+				isPartition = true
+			}
+		}
+		if diskstatsDeviceFilter.ignored(device) {
+			continue
 		}
 
 		// Parse read/write metrics
@@ -287,180 +442,524 @@ func getDiskPerformance() map[string]map[string]float64 {
 		writeOps, _ := strconv.ParseFloat(fields[7], 64)
 		writeBytes, _ := strconv.ParseFloat(fields[9], 64)
 
-		// Convert sectors to bytes (assuming 512-byte sectors)
-		readBytes *= 512
-		writeBytes *= 512
+		// Convert sectors to bytes
+		readBytes *= diskstatsSectorSize
+		writeBytes *= diskstatsSectorSize
 
-		diskMetrics[device] = map[string]float64{
+		metrics := map[string]float64{
 			"readbytes":  readBytes,
 			"readiops":   readOps,
 			"writebytes": writeBytes,
 			"writeiops":  writeOps,
 		}
+		if !isPartition {
+			diskMetrics[device] = metrics
+			continue
+		}
+		// The parent's own line already counts its partitions' I/O; partition
+		// sums are only used when the parent itself is not listed.
+		sum, ok := partitionMetrics[device]
+		if !ok {
+			sum = make(map[string]float64)
+			partitionMetrics[device] = sum
+		}
+		for k, v := range metrics {
+			sum[k] += v
+		}
+	}
+	for device, metrics := range partitionMetrics {
+		if _, ok := diskMetrics[device]; !ok {
+			diskMetrics[device] = metrics
+		}
 	}
 	return diskMetrics
 }
 
+// partitionParent returns the parent block device of a partition, or "" if
+// the device is not a partition.
+func partitionParent(device string) string {
+	devPath := sysFilePath(filepath.Join("class/block", device))
+	if _, err := os.Stat(filepath.Join(devPath, "partition")); err != nil {
+		return ""
+	}
+	resolved, err := filepath.EvalSymlinks(devPath)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(filepath.Dir(resolved))
+}
+
 // Collect network I/O
 func getNetworkIO() map[string]map[string]float64 {
-	cmd := exec.Command("cat", "/proc/net/dev")
-	out, err := cmd.Output()
+	data, err := os.ReadFile(procFilePath("net/dev"))
 	if err != nil {
-		log.Println("Error reading /proc/net/dev:", err)
+		logCollectorError("network", "Error reading /proc/net/dev:", err)
 		return nil
 	}
 
 	networkMetrics := make(map[string]map[string]float64)
-	lines := strings.Split(string(out), "\n")
+	lines := strings.Split(string(data), "\n")
 	for _, line := range lines {
-		if strings.Contains(line, ":") && !strings.Contains(line, "lo:") {
-			fields := strings.Fields(line)
-			interfaceName := strings.TrimSuffix(fields[0], ":")
-			rxBytes, _ := strconv.ParseFloat(fields[1], 64)
-			txBytes, _ := strconv.ParseFloat(fields[9], 64)
-			rxPackets, _ := strconv.ParseFloat(fields[2], 64)
-			txPackets, _ := strconv.ParseFloat(fields[10], 64)
-
-			networkMetrics[interfaceName] = map[string]float64{
-				"rx_bytes":   rxBytes * 8, // Convert bytes to bits
-				"tx_bytes":   txBytes * 8, // Convert bytes to bits
-				"rx_packets": rxPackets,
-				"tx_packets": txPackets,
-			}
+		// Interface lines are "name: counters...", the name may touch the first counter
+		name, counters, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		interfaceName := strings.TrimSpace(name)
+		if interfaceName == "lo" && !*networkIncludeLoopback {
+			continue
+		}
+		if networkDeviceFilter.ignored(interfaceName) {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 16 {
+			continue
+		}
+		rxBytes, _ := strconv.ParseFloat(fields[0], 64)
+		txBytes, _ := strconv.ParseFloat(fields[8], 64)
+		rxPackets, _ := strconv.ParseFloat(fields[1], 64)
+		txPackets, _ := strconv.ParseFloat(fields[9], 64)
+
+		networkMetrics[interfaceName] = map[string]float64{
+			"rx_bytes":   rxBytes * 8, // Convert bytes to bits
+			"tx_bytes":   txBytes * 8, // Convert bytes to bits
+			"rx_packets": rxPackets,
+			"tx_packets": txPackets,
 		}
 	}
 	return networkMetrics
 }
 
-// Collect listening ports and established connections
-func getNetstat() map[string]map[string]int {
-	cmd := exec.Command("netstat", "-nat")
-	out, err := cmd.Output()
-	if err != nil {
-		log.Println("Error running netstat command:", err)
-		return nil
-	}
+// TCP states as encoded in the "st" column of /proc/net/tcp, named like netstat
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
 
-	listeningPorts := make(map[string]bool)
-	connectionStates := make(map[string]map[string]int)
+// inetSocket is a single entry of /proc/net/tcp, /proc/net/udp or their IPv6
+// variants, which share the same format
+type inetSocket struct {
+	localPort string
+	state     string
+	rxQueue   uint64
+	inode     uint64
+}
 
-	lines := strings.Split(string(out), "\n")
-	for _, line := range lines {
-		fields := strings.Fields(line)
-		if len(fields) < 6 {
+func readTCPSockets() []inetSocket {
+	return readSockets("net/tcp", "net/tcp6")
+}
+
+func readSockets(names ...string) []inetSocket {
+	var sockets []inetSocket
+	for _, name := range names {
+		data, err := os.ReadFile(procFilePath(name))
+		if err != nil {
+			// tcp6 and udp6 are missing on hosts with IPv6 disabled
+			if !os.IsNotExist(err) {
+				logCollectorError("netstat", "Error reading", procFilePath(name)+":", err)
+			}
 			continue
 		}
+		lines := strings.Split(string(data), "\n")
+		for i, line := range lines {
+			if i == 0 { // Skip header
+				continue
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 10 {
+				continue
+			}
+			// Local address is HEXIP:HEXPORT
+			parts := strings.Split(fields[1], ":")
+			if len(parts) != 2 {
+				continue
+			}
+			port, err := strconv.ParseUint(parts[1], 16, 16)
+			if err != nil {
+				continue
+			}
+			state, ok := tcpStates[fields[3]]
+			if !ok {
+				continue
+			}
+			// Queues are TXQUEUE:RXQUEUE in hex
+			var rxQueue uint64
+			if _, rx, found := strings.Cut(fields[4], ":"); found {
+				rxQueue, _ = strconv.ParseUint(rx, 16, 64)
+			}
+			inode, _ := strconv.ParseUint(fields[9], 10, 64)
+			sockets = append(sockets, inetSocket{
+				localPort: strconv.FormatUint(port, 10),
+				state:     state,
+				rxQueue:   rxQueue,
+				inode:     inode,
+			})
+		}
+	}
+	return sockets
+}
 
-		// Extract local address and port
-		localAddr := fields[3]
-		parts := strings.Split(localAddr, ":")
-		if len(parts) < 2 {
+// Collect listening ports and established connections. owners maps socket
+// inodes to game instances; a port belongs to the instance owning its listener.
+func getNetstat(owners map[uint64]string) (map[string]map[string]int, map[string]string) {
+	sockets := readTCPSockets()
+	if sockets == nil {
+		return nil, nil
+	}
+
+	// Track listening ports and who owns them
+	listeningPorts := make(map[string]string)
+	for _, sock := range sockets {
+		if sock.state == "LISTEN" && listeningPorts[sock.localPort] == "" {
+			listeningPorts[sock.localPort] = owners[sock.inode]
+		}
+	}
+
+	connectionStates := make(map[string]map[string]int)
+	for _, sock := range sockets {
+		// Check if the port is in listeningPorts
+		if _, ok := listeningPorts[sock.localPort]; !ok {
 			continue
 		}
-		port := parts[len(parts)-1]
 
-		// Track listening ports
-		if strings.Contains(line, "LISTEN") {
-			listeningPorts[port] = true
+		// Initialize map for the port if not already present
+		if _, exists := connectionStates[sock.localPort]; !exists {
+			connectionStates[sock.localPort] = make(map[string]int)
 		}
 
-		// Check if the port is in listeningPorts
-		if listeningPorts[port] {
-			// Extract connection state
-			state := fields[5]
-			if state == "" {
-				continue
-			}
+		// Increment the count for the specific state
+		connectionStates[sock.localPort][sock.state]++
+	}
 
-			// Initialize map for the port if not already present
-			if _, exists := connectionStates[port]; !exists {
-				connectionStates[port] = make(map[string]int)
-			}
+	return connectionStates, listeningPorts
+}
 
-			// Increment the count for the specific state
-			connectionStates[port][state]++
+func updateUptimeMetrics() {
+	serverUptime.Set(getUptime())
+	if bootTime := getBootTime(); bootTime > 0 {
+		serverBootTime.Set(bootTime)
+	}
+}
+
+func updateCPUMetrics() {
+	cpuUsage.Set(getCPUUsage())
+}
+
+func updateLoadMetrics() {
+	systemLoadMetrics := getSystemLoad()
+	onlineCPUs := float64(getOnlineCPUs())
+	for duration, load := range systemLoadMetrics {
+		systemLoad.WithLabelValues(duration).Set(load)
+		systemLoadPerCore.WithLabelValues(duration).Set(load / onlineCPUs)
+	}
+}
+
+func updateMemoryMetrics() {
+	memUsagePercent, memTotal, memUsed, memFreePercent := getMemoryUsage()
+	memoryUsagePercent.Set(memUsagePercent)
+	memoryTotalSize.Set(memTotal)
+	memoryUsageBytes.Set(memUsed)
+	memoryFreeBytes.Set(memTotal - memUsed)
+	memoryFreePercent.Set(memFreePercent)
+}
+
+// Series of the last cycle of the per-device collectors, to drop devices that
+// went away
+var (
+	diskSeries      = newSeriesGeneration()
+	diskstatsSeries = newSeriesGeneration()
+	networkSeries   = newSeriesGeneration()
+	netstatSeries   = newSeriesGeneration()
+)
+
+func updateDiskMetrics() {
+	diskMetrics, totalSize, totalUsed, totalAvailable, totalAvailablePercent, totalUsedPercent := getDiskUsage()
+	diskTotalSize.Set(totalSize)
+	diskTotalUsedBytes.Set(totalUsed)
+	diskTotalUsedPercent.Set(totalUsedPercent)
+	diskTotalAvailableBytes.Set(totalAvailable)
+	diskTotalAvailablePercent.Set(totalAvailablePercent)
+
+	for partition, metrics := range diskMetrics {
+		diskSeries.set(diskUsagePercent, metrics["use_percent"], partition)
+		diskSeries.set(diskSize, metrics["size"], partition)
+		diskSeries.set(diskUsed, metrics["used"], partition)
+		diskSeries.set(diskAvailable, metrics["available"], partition)
+	}
+	diskSeries.sweep()
+}
+
+func updateDiskstatsMetrics() {
+	diskPerformanceMetrics := getDiskPerformance()
+	for device, metrics := range diskPerformanceMetrics {
+		diskstatsSeries.set(diskPerformance, metrics["readbytes"], device, "readbytes")
+		diskstatsSeries.set(diskPerformance, metrics["readiops"], device, "readiops")
+		diskstatsSeries.set(diskPerformance, metrics["writebytes"], device, "writebytes")
+		diskstatsSeries.set(diskPerformance, metrics["writeiops"], device, "writeiops")
+	}
+	diskstatsSeries.sweep()
+}
+
+func updateNetworkMetrics() {
+	networkMetrics := getNetworkIO()
+	for iface, metrics := range networkMetrics {
+		networkSeries.set(networkActivity, metrics["rx_bytes"], iface, "in", "bps")
+		networkSeries.set(networkActivity, metrics["tx_bytes"], iface, "out", "bps")
+		networkSeries.set(networkActivity, metrics["rx_packets"], iface, "in", "pps")
+		networkSeries.set(networkActivity, metrics["tx_packets"], iface, "out", "pps")
+	}
+	networkSeries.sweep()
+}
+
+func updateNetstatMetrics(processes []gameProcess) {
+	connectionStates, portInstances := getNetstat(gameSocketOwners(processes))
+
+	// Update netstat metrics for each port and state; ports and states no
+	// longer seen are removed
+	for port, states := range connectionStates {
+		for state, count := range states {
+			netstatSeries.set(netstatConnections, float64(count), port, state, portInstances[port])
 		}
 	}
+	netstatSeries.sweep()
+}
+
+// collector is a named group of metrics refreshed on every collection cycle,
+// or once its TTL has passed for the expensive ones
+type collector struct {
+	name    string
+	enabled *bool // nil means always enabled
+	update  func()
+	ttl     time.Duration // Default TTL, overridden by --collector.ttl
+	metrics []string      // Metric names or name prefixes up to a "_", for ?collect[]
+}
 
-	return connectionStates
+// The procfs and sysfs collectors only work on Linux
+var procfsAvailable = runtime.GOOS == "linux"
+
+// Monitored game processes, resolved once per cycle for the process collectors
+var gameProcesses []gameProcess
+
+var collectors = []collector{
+	{name: "uptime", enabled: &procfsAvailable, update: updateUptimeMetrics, metrics: []string{"game_server_uptime_seconds", "game_server_boot_time_seconds"}},
+	{name: "cpu", enabled: &procfsAvailable, update: updateCPUMetrics, metrics: []string{"game_cpu_usage_percent"}},
+	{name: "softirq", enabled: &procfsAvailable, update: updateSoftirqMetrics, metrics: []string{"game_cpu_interrupt_seconds_total", "game_softirqs_total"}},
+	{name: "load", enabled: &procfsAvailable, update: updateLoadMetrics, metrics: []string{"game_system_load"}},
+	{name: "memory", enabled: &procfsAvailable, update: updateMemoryMetrics, metrics: []string{"game_memory_total_size_bytes", "game_memory_usage_bytes", "game_memory_usage_percent", "game_memory_free_bytes", "game_memory_free_percent"}},
+	{name: "hugepages", enabled: &procfsAvailable, update: updateHugepageMetrics, metrics: []string{"game_memory_hugepages", "game_memory_hugepage_size_bytes", "game_memory_anon_hugepages_bytes", "game_memory_thp_enabled", "game_memory_thp_defrag", "game_memory_compaction", "game_memory_thp_events"}},
+	{name: "numa", enabled: &procfsAvailable, update: updateNUMAMetrics, metrics: []string{"game_numa"}},
+	{name: "pressure", enabled: &procfsAvailable, update: updatePressureMetrics, metrics: []string{"game_pressure", "game_cgroup_pressure"}},
+	{name: "disk", enabled: &procfsAvailable, update: updateDiskMetrics, ttl: 30 * time.Second, metrics: []string{"game_disk_usage_percent", "game_disk_size_bytes", "game_disk_used_bytes", "game_disk_available_bytes", "game_disk_total"}},
+	{name: "diskstats", enabled: &procfsAvailable, update: updateDiskstatsMetrics, metrics: []string{"game_disk_performance"}},
+	{name: "network", enabled: &procfsAvailable, update: updateNetworkMetrics, metrics: []string{"game_network"}},
+	{name: "routes", enabled: &procfsAvailable, update: updateRouteMetrics, metrics: []string{"game_route", "game_routes"}},
+	{name: "tc", enabled: &procfsAvailable, update: updateTCMetrics, metrics: []string{"game_tc"}},
+	{name: "ethtool", enabled: ethtoolEnabled, update: updateEthtoolMetrics, metrics: []string{"game_nic"}},
+	{name: "gpu", enabled: gpuCollectorEnabled, update: updateGPUMetrics, metrics: []string{"game_gpu"}},
+	{name: "port_traffic", enabled: portTrafficEnabled, update: updatePortTrafficMetrics, metrics: []string{"game_port_traffic", "game_port_tcp_flag_packets"}},
+	{name: "process", enabled: &procfsAvailable, update: func() { updateProcessMetrics(gameProcesses) }, metrics: []string{"game_process_up", "game_process_start_time_seconds", "game_process_restarts_total", "game_process_cpu_seconds_total", "game_process_threads", "game_process_thread_states"}},
+	{name: "process_fds", enabled: &procfsAvailable, update: func() { updateProcessFDMetrics(gameProcesses) }, metrics: []string{"game_process_fds"}},
+	{name: "process_io", enabled: &procfsAvailable, update: func() { updateProcessIOMetrics(gameProcesses) }, metrics: []string{"game_process_io"}},
+	{name: "process_memory", enabled: &procfsAvailable, update: func() { updateProcessMemoryMetrics(gameProcesses) }, metrics: []string{"game_process_memory_bytes"}},
+	{name: "process_limits", enabled: &procfsAvailable, update: func() { updateProcessLimitMetrics(gameProcesses) }, metrics: []string{"game_process_limit"}},
+	{name: "schedstat", enabled: &procfsAvailable, update: func() { updateSchedstatMetrics(gameProcesses) }, metrics: []string{"game_sched", "game_process_sched"}},
+	{name: "netstat", enabled: &procfsAvailable, update: func() { updateNetstatMetrics(gameProcesses) }, metrics: []string{"game_netstat"}},
+	{name: "tcpstat", enabled: &procfsAvailable, update: func() { updateTCPStatMetrics(gameProcesses) }, metrics: []string{"game_tcp_accept_queue", "game_tcp_connection_events", "game_tcp_listen", "game_tcp_syn_recv"}},
+	{name: "sysctl", enabled: &procfsAvailable, update: updateSysctlMetrics, metrics: []string{"game_sysctl"}},
+	{name: "file_age", update: updateFileAgeMetrics, metrics: []string{"game_file_age_seconds", "game_file_matches"}},
+	{name: "backup", update: updateBackupMetrics, ttl: time.Minute, metrics: []string{"game_backup"}},
+	{name: "fail2ban", enabled: fail2banEnabled, update: updateFail2banMetrics, ttl: 30 * time.Second, metrics: []string{"game_fail2ban"}},
+	{name: "service", update: updateServiceMetrics, metrics: []string{"game_service"}},
+	{name: "supervisord", enabled: supervisordEnabled, update: updateSupervisordMetrics, metrics: []string{"game_procmanager"}},
+	{name: "pm2", enabled: pm2Enabled, update: updatePM2Metrics, metrics: []string{"game_procmanager"}},
+	{name: "security_module", enabled: &procfsAvailable, update: func() { updateSecurityModuleMetrics(gameProcesses) }, metrics: []string{"game_security_module_info", "game_process_security_context_info"}},
+	{name: "sessions", enabled: &procfsAvailable, update: updateSessionMetrics, metrics: []string{"game_session"}},
+	{name: "steam", update: updateSteamMetrics, ttl: time.Minute, metrics: []string{"game_steam", "game_update_available"}},
+	{name: "host_info", update: updateHostInfoMetrics, ttl: 5 * time.Minute, metrics: []string{"game_host_info"}},
+	{name: "os_info", enabled: &procfsAvailable, update: updateOSInfoMetrics, ttl: 5 * time.Minute, metrics: []string{"game_os_info"}},
+	{name: "public_ip", enabled: publicIPEnabled, update: updatePublicIPMetrics, ttl: 5 * time.Minute, metrics: []string{"game_public_ip"}},
+	{name: "build_info", update: updateBuildInfoMetrics, metrics: []string{"game_build_info"}},
+	{name: "wine", enabled: wineEnabled, update: func() { updateWineMetrics(gameProcesses) }, metrics: []string{"game_wine", "game_wineserver_up"}},
 }
 
 // Collect metrics periodically
 func collectMetrics() {
+	sleepJitter()
 	for {
-		serverUptime.Set(getUptime())
-		cpuUsage.Set(getCPUUsage())
-
-		// System load metrics
-		systemLoadMetrics := getSystemLoad()
-		for duration, load := range systemLoadMetrics {
-			systemLoad.WithLabelValues(duration).Set(load)
-		}
-
-		// Memory metrics
-		memUsagePercent, memTotal, memUsed, memFreePercent := getMemoryUsage()
-		memoryUsagePercent.Set(memUsagePercent)
-		memoryTotalSize.Set(memTotal)
-		memoryUsageBytes.Set(memUsed)
-		memoryFreeBytes.Set(memTotal - memUsed)
-		memoryFreePercent.Set(memFreePercent)
-
-		// Disk Usage metrics
-		diskMetrics, totalSize, totalUsed, totalUsedPercent, totalAvailable, totalAvailablePercent := getDiskUsage()
-		diskTotalSize.Set(totalSize)
-		diskTotalUsedBytes.Set(totalUsed)
-		diskTotalUsedPercent.Set(totalUsedPercent)
-		diskTotalAvailableBytes.Set(totalAvailable)
-		diskTotalAvailablePercent.Set(totalAvailablePercent)
-
-		for partition, metrics := range diskMetrics {
-			diskUsagePercent.WithLabelValues(partition).Set(metrics["use_percent"])
-			diskSize.WithLabelValues(partition).Set(metrics["size"])
-			diskUsed.WithLabelValues(partition).Set(metrics["used"])
-			diskAvailable.WithLabelValues(partition).Set(metrics["available"])
-		}
-
-		// Disk performance metrics
-		diskPerformanceMetrics := getDiskPerformance()
-		for device, metrics := range diskPerformanceMetrics {
-			diskPerformance.WithLabelValues(device, "readbytes").Set(metrics["readbytes"])
-			diskPerformance.WithLabelValues(device, "readiops").Set(metrics["readiops"])
-			diskPerformance.WithLabelValues(device, "writebytes").Set(metrics["writebytes"])
-			diskPerformance.WithLabelValues(device, "writeiops").Set(metrics["writeiops"])
-		}
-
-		// Network metrics
-		networkMetrics := getNetworkIO()
-		for iface, metrics := range networkMetrics {
-			networkActivity.WithLabelValues(iface, "in", "bps").Set(metrics["rx_bytes"])
-			networkActivity.WithLabelValues(iface, "out", "bps").Set(metrics["tx_bytes"])
-			networkActivity.WithLabelValues(iface, "in", "pps").Set(metrics["rx_packets"])
-			networkActivity.WithLabelValues(iface, "out", "pps").Set(metrics["tx_packets"])
-		}
-
-		// Netstat metrics
-		connectionStates := getNetstat()
-
-		// Reset all netstat metrics before updating
-		netstatConnections.Reset()
-
-		// Update netstat metrics for each port and state
-		for port, states := range connectionStates {
-			for state, count := range states {
-				netstatConnections.WithLabelValues(port, state).Set(float64(count))
-			}
-		}
-
+		collect(collector.cached)
 		time.Sleep(5 * time.Second)
 	}
 }
 
+// Serialises collection cycles between the background loop and scrapes
+// demanding fresh data
+var collectionMu sync.Mutex
+
+// collect runs one collection cycle, skipping the collectors whose values
+// are still fresh
+func collect(fresh func(c collector, now time.Time) bool) {
+	collectionMu.Lock()
+	defer collectionMu.Unlock()
+	gameProcesses = findGameProcesses()
+	gameSockets = nil
+
+	for _, c := range collectors {
+		if c.enabled != nil && !*c.enabled || collectorDisabled(c.name) {
+			continue
+		}
+		now := time.Now()
+		if fresh(c, now) {
+			continue
+		}
+		collectorRefreshed[c.name] = now
+		c.update()
+		updatePermissionMetric(c.name)
+		setCollectorRun(c.name, now)
+		lastCollectionTimestamp.WithLabelValues(c.name).Set(float64(time.Now().UnixNano()) / 1e9)
+	}
+	evaluateRules()
+}
+
+// setupFilters compiles the include and exclude flags of the collectors
+func setupFilters() {
+	diskMountPointFilter = mustNewRegexFilter("collector.disk.mount-points", *diskMountPointsInclude, *diskMountPointsExclude)
+	diskFSTypeFilter = mustNewRegexFilter("collector.disk.fs-types", *diskFSTypesInclude, *diskFSTypesExclude)
+	diskstatsDeviceFilter = mustNewRegexFilter("collector.diskstats.device", *diskstatsDeviceInclude, *diskstatsDeviceExclude)
+	networkDeviceFilter = mustNewRegexFilter("collector.network.device", *networkDeviceInclude, *networkDeviceExclude)
+	gpuProcessFilter = mustNewRegexFilter("collector.gpu.process", *gpuProcessInclude, "")
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == sandboxSubcommand {
+		os.Exit(runSandboxExec(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:]))
+	}
+	flag.Parse()
+	if err := validateCollectorTTLs(); err != nil {
+		log.Fatalln("Invalid flag:", err)
+	}
+	registerQueryDuration()
+
+	if *configFile != "" {
+		var err error
+		if cfg, err = loadConfig(*configFile); err != nil {
+			log.Fatalln("Error loading config:", err)
+		}
+	}
+	if err := setupGameInstances(cfg.Instances); err != nil {
+		log.Fatalln("Error loading config:", err)
+	}
+	if err := setupSessions(cfg.Sessions); err != nil {
+		log.Fatalln("Error loading config:", err)
+	}
+	if err := setupHostnameLabels(cfg.HostnameLabels); err != nil {
+		log.Fatalln("Error loading config:", err)
+	}
+	if err := setupSandbox(cfg.Sandbox); err != nil {
+		log.Fatalln("Error loading config:", err)
+	}
+	setupRelabeling(cfg.Relabel)
+	if err := registerAlertMetrics(cfg.AlertMetrics); err != nil {
+		log.Fatalln("Error loading config:", err)
+	}
+	if err := registerDerivedMetrics(cfg.DerivedMetrics); err != nil {
+		log.Fatalln("Error loading config:", err)
+	}
+	registerRecordingRules(cfg.RecordingRules)
+	setupSNMP(cfg.SNMP)
+	if err := startGameLogs(cfg.GameLogs); err != nil {
+		log.Fatalln("Error loading config:", err)
+	}
+	if err := startJournalUnits(cfg.JournalUnits); err != nil {
+		log.Fatalln("Error loading config:", err)
+	}
+	if *authLogEnabled {
+		if err := startAuthLogs(cfg.AuthLogs); err != nil {
+			log.Fatalln("Error loading config:", err)
+		}
+	}
+
+	setupFilters()
+
+	if *portTrafficEnabled {
+		if err := startPortTraffic(); err != nil {
+			log.Println("Error starting port traffic collector, disabling it:", err)
+			*portTrafficEnabled = false
+			checkPermission("port_traffic", err)
+			updatePermissionMetric("port_traffic")
+		}
+	}
+
+	if *tcpRTTEnabled {
+		if err := startTCPRTT(); err != nil {
+			log.Println("Error starting TCP RTT collector, disabling it:", err)
+			*tcpRTTEnabled = false
+			checkPermission("tcp_rtt", err)
+			updatePermissionMetric("tcp_rtt")
+		}
+	}
+
+	// Everything that needs root has been set up
+	if *dropPrivilegesUser != "" {
+		if err := dropPrivileges(*dropPrivilegesUser); err != nil {
+			log.Fatalln("Error dropping privileges:", err)
+		}
+		log.Println("Dropped privileges to user", *dropPrivilegesUser)
+	}
+	updatePrivilegeMetrics()
+
+	if err := startState(); err != nil {
+		log.Fatalln("Error restoring state:", err)
+	}
+
 	// Start collecting metrics in the background
 	go collectMetrics()
+	go runSampler()
+	if len(cfg.Directories) > 0 {
+		go runDirSizes(cfg.Directories)
+	}
+	if *steamLibraries != "" {
+		go runSteamChecks()
+	}
+	startQueries(cfg.queryConfigs())
+	startVoice(cfg.Voice)
+	startProbes(cfg.Probes)
+	startPathProbes(cfg.PathProbes)
+	startBandwidthTests(cfg.BandwidthTests)
+	startPlugins(cfg.Plugins)
+	startKafka(cfg.Kafka)
+	startMQTT(cfg.MQTT)
+	startSNMP(cfg.SNMP)
+	startZabbix(cfg.Zabbix)
+	if err := startDump(cfg.Dump); err != nil {
+		log.Fatalln("Error starting dump:", err)
+	}
+	startHistory(cfg.History)
 
 	// Serve metrics on /metrics endpoint
-	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, maxAgeHandler(requestedCollectors, metricsHandler())))
+	http.Handle("/metrics/fast", maxAgeHandler(fastCollectors, fastMetricsHandler()))
+	http.HandleFunc("/status", statusHandler)
+	http.HandleFunc("/debug/config", debugConfigHandler)
+	startUI()
+	if err := startAdmin(); err != nil {
+		log.Fatalln("Error starting admin API:", err)
+	}
+	if err := startGRPC(); err != nil {
+		log.Fatalln("Error starting gRPC API:", err)
+	}
 	log.Println("Game server exporter started on :9108")
 	log.Fatal(http.ListenAndServe(":9108", nil))
 }
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// withFixture points a path flag at a temporary tree holding files, by path
+// relative to its root
+func withFixture(t *testing.T, flagValue *string, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := *flagValue
+	*flagValue = root
+	t.Cleanup(func() { *flagValue = old })
+	return root
+}
+
+const procNetTCPHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+func TestReadSockets(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []inetSocket
+	}{
+		{
+			name: "listen and syn_recv",
+			files: map[string]string{"net/tcp": procNetTCPHeader +
+				"   0: 00000000:6987 00000000:0000 0A 00000000:00000003 00:00000000 00000000  1000        0 4242 1 0000000000000000 100 0 0 10 0\n" +
+				"   1: 0100007F:6987 0200007F:D431 03 00000000:00000000 00:00000000 00000000  1000        0 0 1 0000000000000000 100 0 0 10 0\n"},
+			want: []inetSocket{
+				{localPort: "27015", state: "LISTEN", rxQueue: 3, inode: 4242},
+				{localPort: "27015", state: "SYN_RECV"},
+			},
+		},
+		{
+			name: "ipv6",
+			files: map[string]string{"net/tcp": procNetTCPHeader, "net/tcp6": procNetTCPHeader +
+				"   0: 00000000000000000000000000000000:63DD 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 77 1 0000000000000000 100 0 0 10 0\n"},
+			want: []inetSocket{{localPort: "25565", state: "LISTEN", inode: 77}},
+		},
+		{
+			name: "malformed and unknown state lines",
+			files: map[string]string{"net/tcp": procNetTCPHeader +
+				"   0: 00000000 00000000:0000 0A 00000000:00000000 00:00000000 00000000 0 0 1 1\n" +
+				"   1: 00000000:0050 00000000:0000 FF 00000000:00000000 00:00000000 00000000 0 0 1 1\n" +
+				"garbage\n"},
+		},
+		{
+			name: "missing files",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withFixture(t, procPath, tt.files)
+			if got := readTCPSockets(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readTCPSockets() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/", "/"},
+		{`/srv/game\040data`, "/srv/game data"},
+		{`/mnt/tab\011name`, "/mnt/tab\tname"},
+		{`/back\134slash`, `/back\slash`},
+		{`/trailing\04`, `/trailing\04`},
+		{`/not\999octal`, `/not\999octal`},
+	}
+	for _, tt := range tests {
+		if got := unescapeMountPath(tt.in); got != tt.want {
+			t.Errorf("unescapeMountPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGetDiskUsage(t *testing.T) {
+	if !procfsAvailable {
+		t.Skip("statfs of the mountpoints needs Linux")
+	}
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "init mount table",
+			files: map[string]string{
+				"1/mounts": "/dev/sda1 / ext4 rw 0 0\n" +
+					"/dev/sdb1 /srv/game\\040data ext4 rw 0 0\n" +
+					"/dev/sdc1 /missing ext4 rw 0 0\n",
+				"mounts": "/dev/sda1 /only-in-self ext4 rw 0 0\n",
+			},
+			want: []string{"/", "/srv/game data"},
+		},
+		{
+			name:  "fallback to the exporter's mount table",
+			files: map[string]string{"mounts": "/dev/sda1 / ext4 rw 0 0\n"},
+			want:  []string{"/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withFixture(t, procPath, tt.files)
+			root := withFixture(t, rootfsPath, nil)
+			if err := os.MkdirAll(filepath.Join(root, "srv/game data"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			disks, totalSize, _, _, _, _ := getDiskUsage()
+			var got []string
+			for partition := range disks {
+				got = append(got, partition)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("partitions = %q, want %q", got, tt.want)
+			}
+			for _, partition := range tt.want {
+				if disks[partition]["size"] <= 0 {
+					t.Errorf("partition %q: size %v", partition, disks[partition]["size"])
+				}
+			}
+			// Both partitions are the same filesystem of the temporary tree
+			if totalSize != disks["/"]["size"] {
+				t.Errorf("total size %v, want %v counted once", totalSize, disks["/"]["size"])
+			}
+		})
+	}
+}
+
+func TestGetNetworkIO(t *testing.T) {
+	withFixture(t, procPath, map[string]string{"net/dev": "Inter-|   Receive                                                |  Transmit\n" +
+		" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n" +
+		"    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0\n" +
+		"  eth0:12345678  100    0    0    0     0          0         0      500       5    0    0    0     0       0          0\n" +
+		"  bad0: 1 2 3\n"})
+	want := map[string]map[string]float64{
+		"eth0": {"rx_bytes": 12345678 * 8, "tx_bytes": 500 * 8, "rx_packets": 100, "tx_packets": 5},
+	}
+	if got := getNetworkIO(); !reflect.DeepEqual(got, want) {
+		t.Errorf("getNetworkIO() = %v, want %v", got, want)
+	}
+}
+
+func TestGetSystemLoad(t *testing.T) {
+	tests := []struct {
+		loadavg string
+		want    map[string]float64
+	}{
+		{"0.57 0.26 0.22 1/345 6789\n", map[string]float64{"1m": 0.57, "5m": 0.26, "15m": 0.22}},
+		{"0.57\n", nil},
+	}
+	for _, tt := range tests {
+		withFixture(t, procPath, map[string]string{"loadavg": tt.loadavg})
+		if got := getSystemLoad(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("getSystemLoad() with %q = %v, want %v", tt.loadavg, got, tt.want)
+		}
+	}
+}
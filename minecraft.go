@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// minecraftConfig is the options of a minecraft target. The server
+// list ping on the game port gives the basic status; with RCON configured the
+// exact player count, TPS and loaded chunks are read from the console.
+type minecraftConfig struct {
+	Instance     string `yaml:"instance"`
+	Edition      string `yaml:"edition"`       // java (default) or bedrock
+	Address      string `yaml:"address"`       // host:port of the game port
+	RCONAddress  string `yaml:"rcon_address"`  // host:port of the RCON port, optional
+	RCONPassword string `yaml:"rcon_password"` // rcon.password from server.properties
+	timeout      time.Duration
+}
+
+var (
+	minecraftTPS = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_minecraft_tps",
+		Help: "Ticks per second averaged over the window, from the tps command (Paper/Spigot)",
+	}, []string{"instance_name", "window"})
+	minecraftChunks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_minecraft_loaded_chunks",
+		Help: "Chunks loaded in the world, from the paper chunkinfo command (Paper)",
+	}, []string{"instance_name", "world"})
+)
+
+func init() {
+	prometheus.MustRegister(minecraftTPS)
+	prometheus.MustRegister(minecraftChunks)
+}
+
+func init() {
+	registerQueryDriver("minecraft", func(target queryConfig) (querier, error) {
+		c := minecraftConfig{timeout: target.timeout()}
+		if err := target.decodeOptions(&c); err != nil {
+			return nil, err
+		}
+		return newMinecraftQuerier(c)
+	})
+	// Bedrock edition servers only, which answer the RakNet ping
+	registerQueryDriver("raknet", func(target queryConfig) (querier, error) {
+		c := minecraftConfig{timeout: target.timeout()}
+		if err := target.decodeOptions(&c); err != nil {
+			return nil, err
+		}
+		if c.Edition != "" && c.Edition != "bedrock" {
+			return nil, errors.New("raknet targets are Bedrock edition servers")
+		}
+		c.Edition = "bedrock"
+		return newMinecraftQuerier(c)
+	})
+}
+
+func newMinecraftQuerier(c minecraftConfig) (querier, error) {
+	if c.Address == "" {
+		return nil, errors.New("address is required")
+	}
+	if c.Edition != "" && c.Edition != "java" && c.Edition != "bedrock" {
+		return nil, fmt.Errorf("unknown edition %q", c.Edition)
+	}
+	if c.Edition == "bedrock" && c.RCONAddress != "" {
+		return nil, errors.New("Bedrock servers have no RCON")
+	}
+	if (c.RCONAddress == "") != (c.RCONPassword == "") {
+		return nil, errors.New("rcon_address and rcon_password go together")
+	}
+	t := &minecraftTarget{minecraftConfig: c}
+	if c.RCONAddress != "" {
+		t.rcon = &rconClient{address: c.RCONAddress, password: c.RCONPassword, timeout: c.timeout}
+	}
+	return t, nil
+}
+
+// minecraftTarget is one configured server and its RCON state
+type minecraftTarget struct {
+	minecraftConfig
+	rcon   *rconClient
+	worlds map[string]bool // Worlds with a loaded chunks series
+}
+
+// query pings the server and reads the console over RCON if configured
+func (t *minecraftTarget) query() (*serverInfo, []playerInfo, error) {
+	ping := pingMinecraft
+	if t.Edition == "bedrock" {
+		ping = pingBedrock
+	}
+	info, err := ping(t.Address, t.timeout)
+	if err != nil {
+		t.clearRCON()
+		return nil, nil, err
+	}
+	if t.rcon != nil {
+		if err := t.queryRCON(info); err != nil {
+			log.Println("Error querying", t.Instance, "over RCON:", err)
+			t.clearRCON()
+		}
+	}
+	return info, nil, nil
+}
+
+func (t *minecraftTarget) clearRCON() {
+	minecraftTPS.DeletePartialMatch(prometheus.Labels{"instance_name": t.Instance})
+	minecraftChunks.DeletePartialMatch(prometheus.Labels{"instance_name": t.Instance})
+	t.worlds = nil
+}
+
+// VarInts of the Minecraft protocol
+func appendVarInt(b []byte, v int32) []byte {
+	u := uint32(v)
+	for u >= 0x80 {
+		b = append(b, byte(u)|0x80)
+		u >>= 7
+	}
+	return append(b, byte(u))
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint32(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(v), nil
+		}
+	}
+	return 0, errors.New("VarInt too long")
+}
+
+// minecraftPacket frames a packet with its length and ID
+func minecraftPacket(id int32, data []byte) []byte {
+	body := append(appendVarInt(nil, id), data...)
+	return append(appendVarInt(nil, int32(len(body))), body...)
+}
+
+// readMinecraftPacket returns the ID and data of the next packet
+func readMinecraftPacket(r *bufio.Reader) (int32, []byte, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if length <= 0 || length > 1<<21 {
+		return 0, nil, fmt.Errorf("invalid packet length %d", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	br := bytes.NewReader(data)
+	id, err := readVarInt(br)
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, data[len(data)-br.Len():], nil
+}
+
+// minecraftStatus is the server list ping status JSON
+type minecraftStatus struct {
+	Version struct {
+		Name string `json:"name"`
+	} `json:"version"`
+	Players struct {
+		Max    float64 `json:"max"`
+		Online float64 `json:"online"`
+	} `json:"players"`
+	Description json.RawMessage `json:"description"` // A string or a chat component
+}
+
+// minecraftText flattens a chat component to plain text
+func minecraftText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var component struct {
+		Text  string            `json:"text"`
+		Extra []json.RawMessage `json:"extra"`
+	}
+	if json.Unmarshal(raw, &component) != nil {
+		return ""
+	}
+	text := component.Text
+	for _, extra := range component.Extra {
+		text += minecraftText(extra)
+	}
+	return text
+}
+
+// Formatting codes like §a in MOTDs and command output
+var minecraftFormatting = regexp.MustCompile("§.")
+
+// pingMinecraft runs the server list ping handshake of Java edition 1.7+
+func pingMinecraft(address string, timeout time.Duration) (*serverInfo, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, _ := strconv.Atoi(portStr)
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// Handshake with protocol -1 (any) and next state status, then a status request
+	handshake := appendVarInt(nil, -1)
+	handshake = appendVarInt(handshake, int32(len(host)))
+	handshake = append(handshake, host...)
+	handshake = binary.BigEndian.AppendUint16(handshake, uint16(port))
+	handshake = appendVarInt(handshake, 1)
+	request := append(minecraftPacket(0, handshake), minecraftPacket(0, nil)...)
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	id, data, err := readMinecraftPacket(r)
+	if err != nil {
+		return nil, err
+	}
+	if id != 0 {
+		return nil, fmt.Errorf("unexpected packet 0x%02x", id)
+	}
+	br := bytes.NewReader(data)
+	if _, err := readVarInt(br); err != nil {
+		return nil, err
+	}
+	var status minecraftStatus
+	if err := json.Unmarshal(data[len(data)-br.Len():], &status); err != nil {
+		return nil, fmt.Errorf("parsing status: %w", err)
+	}
+
+	// Ping with a payload the server echoes back
+	start := time.Now()
+	if _, err := conn.Write(minecraftPacket(1, binary.BigEndian.AppendUint64(nil, uint64(start.UnixNano())))); err != nil {
+		return nil, err
+	}
+	if id, _, err := readMinecraftPacket(r); err != nil || id != 1 {
+		return nil, fmt.Errorf("no pong: %v", err)
+	}
+
+	return &serverInfo{
+		name:       strings.TrimSpace(minecraftFormatting.ReplaceAllString(minecraftText(status.Description), "")),
+		game:       "Minecraft",
+		version:    status.Version.Name,
+		players:    status.Players.Online,
+		maxPlayers: status.Players.Max,
+		latency:    time.Since(start),
+	}, nil
+}
+
+var (
+	// "There are 3 of a max of 20 players online: ..."
+	minecraftListRegexp = regexp.MustCompile(`There are (\d+) of a max(?: of)? (\d+) players online`)
+	// "TPS from last 1m, 5m, 15m: 20.0, 20.0, *20.0"
+	minecraftTPSRegexp = regexp.MustCompile(`TPS from last 1m, 5m, 15m: \*?([\d.]+), \*?([\d.]+), \*?([\d.]+)`)
+	// "Chunks in world:" followed by "Total: 625 Inactive: 0 ..."
+	minecraftChunksRegexp = regexp.MustCompile(`Chunks in ([^:\n]+):\s*Total: (\d+)`)
+)
+
+// queryRCON reads the exact player count, TPS and loaded chunks from the
+// console. Commands a server doesn't know (tps and chunkinfo on vanilla)
+// export nothing.
+func (t *minecraftTarget) queryRCON(info *serverInfo) error {
+	out, err := t.rcon.command("list")
+	if err != nil {
+		return err
+	}
+	// The ping's count can be hidden or faked by plugins
+	if m := minecraftListRegexp.FindStringSubmatch(minecraftFormatting.ReplaceAllString(out, "")); m != nil {
+		info.players, _ = strconv.ParseFloat(m[1], 64)
+		info.maxPlayers, _ = strconv.ParseFloat(m[2], 64)
+	}
+
+	out, err = t.rcon.command("tps")
+	if err != nil {
+		return err
+	}
+	if m := minecraftTPSRegexp.FindStringSubmatch(minecraftFormatting.ReplaceAllString(out, "")); m != nil {
+		for i, window := range []string{"1m", "5m", "15m"} {
+			tps, _ := strconv.ParseFloat(m[i+1], 64)
+			minecraftTPS.WithLabelValues(t.Instance, window).Set(tps)
+		}
+	}
+
+	out, err = t.rcon.command("paper chunkinfo *")
+	if err != nil {
+		return err
+	}
+	worlds := make(map[string]bool)
+	for _, m := range minecraftChunksRegexp.FindAllStringSubmatch(minecraftFormatting.ReplaceAllString(out, ""), -1) {
+		if m[1] == "all listed worlds" {
+			continue
+		}
+		chunks, _ := strconv.ParseFloat(m[2], 64)
+		minecraftChunks.WithLabelValues(t.Instance, m[1]).Set(chunks)
+		worlds[m[1]] = true
+	}
+	for world := range t.worlds {
+		if !worlds[world] {
+			minecraftChunks.DeleteLabelValues(t.Instance, world)
+		}
+	}
+	t.worlds = worlds
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestVarInt(t *testing.T) {
+	tests := []struct {
+		v    int32
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7F}},
+		{128, []byte{0x80, 0x01}},
+		{25565, []byte{0xDD, 0xC7, 0x01}},
+		{2147483647, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x07}},
+		{-1, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x0F}},
+	}
+	for _, tt := range tests {
+		got := appendVarInt(nil, tt.v)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("appendVarInt(%d) = % x, want % x", tt.v, got, tt.want)
+		}
+		if v, err := readVarInt(bytes.NewReader(got)); err != nil || v != tt.v {
+			t.Errorf("readVarInt(% x) = %d, %v, want %d", got, v, err, tt.v)
+		}
+	}
+
+	if _, err := readVarInt(bytes.NewReader([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01})); err == nil {
+		t.Error("readVarInt() of 6 bytes read without an error")
+	}
+	if _, err := readVarInt(bytes.NewReader([]byte{0x80})); err == nil {
+		t.Error("readVarInt() of a truncated VarInt read without an error")
+	}
+}
+
+func TestReadMinecraftPacket(t *testing.T) {
+	stream := append(minecraftPacket(0, []byte(`{"a":1}`)), minecraftPacket(1, nil)...)
+	r := bufio.NewReader(bytes.NewReader(stream))
+	if id, data, err := readMinecraftPacket(r); err != nil || id != 0 || string(data) != `{"a":1}` {
+		t.Errorf("first packet = %d, %q, %v", id, data, err)
+	}
+	if id, data, err := readMinecraftPacket(r); err != nil || id != 1 || len(data) != 0 {
+		t.Errorf("second packet = %d, %q, %v", id, data, err)
+	}
+	if _, _, err := readMinecraftPacket(r); err == nil {
+		t.Error("read past the end without an error")
+	}
+
+	for _, bad := range [][]byte{
+		{0x00},                   // Empty packet
+		{0xFF, 0xFF, 0xFF, 0x07}, // Longer than the protocol allows
+		{0x05, 0x00, 0x01},       // Truncated
+	} {
+		if _, _, err := readMinecraftPacket(bufio.NewReader(bytes.NewReader(bad))); err == nil {
+			t.Errorf("readMinecraftPacket(% x) read without an error", bad)
+		}
+	}
+}
+
+func TestMinecraftText(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{`"A Minecraft Server"`, "A Minecraft Server"},
+		{`{"text":"Hello"}`, "Hello"},
+		{`{"text":"","extra":[{"text":"§aGreen "},"plain ",{"text":"nested","extra":[{"text":"!"}]}]}`, "§aGreen plain nested!"},
+		{`42`, ""},
+		{``, ""},
+	}
+	for _, tt := range tests {
+		if got := minecraftText(json.RawMessage(tt.raw)); got != tt.want {
+			t.Errorf("minecraftText(%s) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// mqttConfig is the mqtt config section, a sink publishing every metric
+// family to its own topic, e.g. for dashboards at LAN events
+type mqttConfig struct {
+	Broker string `yaml:"broker"` // host:port
+	// Topics are <topic>/<metric>; {host} is replaced with the hostname
+	Topic    string        `yaml:"topic"`    // Default gamesvr/{host}
+	Interval time.Duration `yaml:"interval"` // Default --collector.query.interval
+	Metrics  []string      `yaml:"metrics"`  // Names or prefixes up to a _, default all
+	Retain   bool          `yaml:"retain"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	TLS      bool          `yaml:"tls"`
+}
+
+const (
+	defaultMQTTTopic = "gamesvr/{host}"
+	mqttTimeout      = 10 * time.Second
+)
+
+func validateMQTT(c mqttConfig) error {
+	if c.Broker == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(c.Broker); err != nil {
+		return fmt.Errorf("mqtt: broker: %w", err)
+	}
+	if strings.ContainsAny(c.Topic, "+#") {
+		return errors.New("mqtt: topic can't contain wildcards")
+	}
+	return nil
+}
+
+// Start publishing to the MQTT broker in the background, if configured
+func startMQTT(c mqttConfig) {
+	if c.Broker == "" {
+		return
+	}
+	p := &mqttPublisher{mqttConfig: c}
+	go runSink("mqtt", c.Interval, c.Metrics, p.publish)
+}
+
+// mqttPublisher is a minimal MQTT 3.1.1 client publishing with QoS 0. The
+// connection is kept until an error.
+type mqttPublisher struct {
+	mqttConfig
+	conn net.Conn
+}
+
+// mqttSample is a series in the payload of a metric's message
+type mqttSample struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// publish sends each metric as a JSON array of its series
+func (p *mqttPublisher) publish(msg sinkMessage) (int, error) {
+	topic := p.Topic
+	if topic == "" {
+		topic = defaultMQTTTopic
+	}
+	topic = strings.TrimSuffix(strings.ReplaceAll(topic, "{host}", msg.Host), "/")
+	var names []string
+	series := make(map[string][]mqttSample)
+	for _, s := range msg.Metrics {
+		if _, ok := series[s.Name]; !ok {
+			names = append(names, s.Name)
+		}
+		series[s.Name] = append(series[s.Name], mqttSample{s.Labels, s.Value})
+	}
+
+	if p.conn == nil {
+		if err := p.connect(msg.Host); err != nil {
+			return 0, err
+		}
+	}
+	p.conn.SetWriteDeadline(time.Now().Add(mqttTimeout))
+	for i, name := range names {
+		payload, err := json.Marshal(series[name])
+		if err != nil {
+			return i, err
+		}
+		if err := p.send(topic+"/"+name, payload); err != nil {
+			p.conn.Close()
+			p.conn = nil
+			return i, err
+		}
+	}
+	return len(names), nil
+}
+
+// connect opens the connection and sends CONNECT with a clean session
+func (p *mqttPublisher) connect(host string) error {
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	var conn net.Conn
+	var err error
+	if p.TLS {
+		serverName, _, _ := net.SplitHostPort(p.Broker)
+		conn, err = tls.DialWithDialer(dialer, "tcp", p.Broker, &tls.Config{ServerName: serverName})
+	} else {
+		conn, err = dialer.Dial("tcp", p.Broker)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Keep alive over the interval, as the publications are the only traffic
+	keepAlive := max(int(p.interval().Seconds())*2, 60)
+	var body []byte
+	body = mqttAppendString(body, "MQTT")
+	body = append(body, 4) // Protocol level 3.1.1
+	flags := byte(0x02)    // Clean session
+	if p.Username != "" {
+		flags |= 0x80
+		if p.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body = append(body, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(min(keepAlive, 65535)))
+	body = mqttAppendString(body, "game_exporter-"+host)
+	if p.Username != "" {
+		body = mqttAppendString(body, p.Username)
+		if p.Password != "" {
+			body = mqttAppendString(body, p.Password)
+		}
+	}
+	conn.SetDeadline(time.Now().Add(mqttTimeout))
+	if _, err := conn.Write(mqttPacket(0x10, body)); err != nil {
+		conn.Close()
+		return err
+	}
+	var connack [4]byte
+	if _, err := io.ReadFull(conn, connack[:]); err != nil {
+		conn.Close()
+		return err
+	}
+	if connack[0] != 0x20 || connack[1] != 2 {
+		conn.Close()
+		return errors.New("expected CONNACK")
+	}
+	if connack[3] != 0 {
+		conn.Close()
+		return fmt.Errorf("connection refused, return code %d", connack[3])
+	}
+	conn.SetDeadline(time.Time{})
+	p.conn = conn
+	return nil
+}
+
+func (p *mqttPublisher) interval() time.Duration {
+	if p.Interval == 0 {
+		return *queryInterval
+	}
+	return p.Interval
+}
+
+// send publishes with QoS 0
+func (p *mqttPublisher) send(topic string, payload []byte) error {
+	header := byte(0x30)
+	if p.Retain {
+		header |= 0x01
+	}
+	body := mqttAppendString(nil, topic)
+	body = append(body, payload...)
+	_, err := p.conn.Write(mqttPacket(header, body))
+	return err
+}
+
+// mqttPacket prefixes the body with the fixed header
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+func mqttAppendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
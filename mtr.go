@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var mtrPath = flag.String("collector.path-probe.mtr-path", "mtr", "Path to the mtr binary, for the path_probes config section (mtr needs CAP_NET_RAW, usually through its setuid mtr-packet helper).")
+
+// pathProbeConfig is one entry of the path_probes config section, a
+// destination whose network path is traced with mtr, e.g. a region gateway
+// or an anti-DDoS scrubbing center
+type pathProbeConfig struct {
+	Name        string        `yaml:"name"`
+	Destination string        `yaml:"destination"` // Host name or IP
+	Protocol    string        `yaml:"protocol"`    // icmp (default), udp or tcp
+	Port        int           `yaml:"port"`        // For udp and tcp
+	Count       int           `yaml:"count"`       // Pings per hop, default 10
+	Interval    time.Duration `yaml:"interval"`    // Default 5m
+}
+
+const (
+	defaultPathProbeCount    = 10
+	defaultPathProbeInterval = 5 * time.Minute
+	minPathProbeInterval     = time.Minute
+)
+
+var (
+	pathProbeSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_path_probe_success",
+		Help: "Whether the last trace of the path ran",
+	}, []string{"destination"})
+	pathHops = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_path_hops",
+		Help: "Hops on the path to the destination in the last trace",
+	}, []string{"destination"})
+	pathHopLoss = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_path_hop_loss_ratio",
+		Help: "Share of the pings to the hop that got no reply in the last trace; loss that doesn't carry on to later hops is usually rate limiting of the router",
+	}, []string{"destination", "hop", "host"})
+	pathHopLatency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_path_hop_latency_seconds",
+		Help: "Round trip time to the hop in the last trace by statistic: last, avg, best, worst and stddev",
+	}, []string{"destination", "hop", "host", "stat"})
+)
+
+func init() {
+	prometheus.MustRegister(pathProbeSuccess)
+	prometheus.MustRegister(pathHops)
+	prometheus.MustRegister(pathHopLoss)
+	prometheus.MustRegister(pathHopLatency)
+}
+
+func validatePathProbes(configs []pathProbeConfig) error {
+	names := make(map[string]bool)
+	for _, c := range configs {
+		if c.Name == "" || c.Destination == "" {
+			return errors.New("path_probes: name and destination are required")
+		}
+		switch c.Protocol {
+		case "", "icmp":
+		case "udp", "tcp":
+			if c.Port <= 0 || c.Port > 65535 {
+				return fmt.Errorf("path probe %q: port is required for %s", c.Name, c.Protocol)
+			}
+		default:
+			return fmt.Errorf("path probe %q: protocol must be icmp, udp or tcp", c.Name)
+		}
+		if c.Interval != 0 && c.Interval < minPathProbeInterval {
+			return fmt.Errorf("path probe %q: interval must be at least %s", c.Name, minPathProbeInterval)
+		}
+		if c.Count < 0 {
+			return fmt.Errorf("path probe %q: count must be positive", c.Name)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("path probe %q defined twice", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return nil
+}
+
+// Start tracing the configured paths in the background
+func startPathProbes(configs []pathProbeConfig) {
+	for _, c := range configs {
+		go runPathProbes(c)
+	}
+}
+
+// runPathProbes traces one path every interval
+func runPathProbes(c pathProbeConfig) {
+	interval := c.Interval
+	if interval == 0 {
+		interval = defaultPathProbeInterval
+	}
+	sleepJitter()
+	for {
+		hops, err := c.trace()
+		if err != nil {
+			log.Println("Error tracing the path to", c.Name+":", err)
+			pathProbeSuccess.WithLabelValues(c.Name).Set(0)
+		} else {
+			pathProbeSuccess.WithLabelValues(c.Name).Set(1)
+			setPathHops(c.Name, hops)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// mtrHop is one entry of the hubs of mtr's JSON report
+type mtrHop struct {
+	Count json.RawMessage `json:"count"` // A string before mtr 0.94
+	Host  string          `json:"host"`
+	Loss  float64         `json:"Loss%"`
+	Last  float64         `json:"Last"`
+	Avg   float64         `json:"Avg"`
+	Best  float64         `json:"Best"`
+	Worst float64         `json:"Wrst"`
+	StDev float64         `json:"StDev"`
+}
+
+// trace runs mtr in report mode and returns the hops
+func (c pathProbeConfig) trace() ([]mtrHop, error) {
+	count := c.Count
+	if count == 0 {
+		count = defaultPathProbeCount
+	}
+	args := []string{"--json", "--report-cycles", strconv.Itoa(count), "--no-dns"}
+	switch c.Protocol {
+	case "udp":
+		args = append(args, "--udp", "--port", strconv.Itoa(c.Port))
+	case "tcp":
+		args = append(args, "--tcp", "--port", strconv.Itoa(c.Port))
+	}
+	args = append(args, c.Destination)
+	// One cycle a second, plus time for the last replies
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(count)*time.Second+30*time.Second)
+	defer cancel()
+	out, err := execOutput(exec.CommandContext(ctx, *mtrPath, args...))
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	var report struct {
+		Report struct {
+			Hubs []mtrHop `json:"hubs"`
+		} `json:"report"`
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		return nil, err
+	}
+	return report.Report.Hubs, nil
+}
+
+// setPathHops replaces the hop series of the destination, as the route
+// changes
+func setPathHops(destination string, hops []mtrHop) {
+	pathHopLoss.DeletePartialMatch(prometheus.Labels{"destination": destination})
+	pathHopLatency.DeletePartialMatch(prometheus.Labels{"destination": destination})
+	pathHops.WithLabelValues(destination).Set(float64(len(hops)))
+	for i, h := range hops {
+		hop := strings.Trim(string(h.Count), `"`)
+		if hop == "" {
+			hop = strconv.Itoa(i + 1)
+		}
+		pathHopLoss.WithLabelValues(destination, hop, h.Host).Set(h.Loss / 100)
+		// A hop without replies ("???") has no times
+		if h.Loss >= 100 {
+			continue
+		}
+		for stat, ms := range map[string]float64{"last": h.Last, "avg": h.Avg, "best": h.Best, "worst": h.Worst, "stddev": h.StDev} {
+			pathHopLatency.WithLabelValues(destination, hop, h.Host, stat).Set(ms / 1000)
+		}
+	}
+}
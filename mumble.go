@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// pingMumble sends the UDP ping Mumble clients use for the server list. The
+// reply carries the version, users, max users and per client bandwidth limit.
+// Murmur's Ice and gRPC interfaces would give channels and traffic too, but
+// gRPC was removed in 1.4 and Ice has no Go implementation.
+func pingMumble(address string) ([]voiceServer, error) {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("udp", address, *queryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(*queryTimeout))
+
+	// A zero request type followed by an identifier the server echoes back
+	request := make([]byte, 12)
+	rand.Read(request[4:])
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 64)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Version (0, major, minor, patch), identifier, users, max users, bandwidth
+		if n < 24 || string(buf[4:12]) != string(request[4:]) {
+			continue
+		}
+		if buf[0] != 0 {
+			return nil, errors.New("unexpected ping reply")
+		}
+		return []voiceServer{{
+			id:                   port,
+			version:              fmt.Sprintf("%d.%d.%d", buf[1], buf[2], buf[3]),
+			clients:              float64(binary.BigEndian.Uint32(buf[12:16])),
+			maxClients:           float64(binary.BigEndian.Uint32(buf[16:20])),
+			clientBandwidthLimit: float64(binary.BigEndian.Uint32(buf[20:24])),
+			channels:             -1,
+			sentPerSecond:        -1,
+			recvPerSecond:        -1,
+			sentBytes:            -1,
+			recvBytes:            -1,
+		}}, nil
+	}
+}
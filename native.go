@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Native histograms have exponential buckets created as observations need
+// them, in a single series per histogram instead of one per bucket
+var nativeHistograms = flag.Bool("collector.native-histograms", false, "Export the latency histograms (game_query_duration_seconds, game_tcp_rtt_seconds) as native histograms only, without classic buckets. Needs a Prometheus with native histograms enabled, scraping protobuf.")
+
+const (
+	nativeHistogramBucketFactor     = 1.1 // Schema 3, buckets about 9% wide
+	nativeHistogramMaxBuckets       = 100
+	nativeHistogramMinResetDuration = time.Hour
+)
+
+// histogramOpts turns opts into those of a native histogram with
+// --collector.native-histograms
+func histogramOpts(opts prometheus.HistogramOpts) prometheus.HistogramOpts {
+	if !*nativeHistograms {
+		return opts
+	}
+	opts.Buckets = []float64{} // Non-nil, or the default buckets are added
+	opts.NativeHistogramBucketFactor = nativeHistogramBucketFactor
+	opts.NativeHistogramMaxBucketNumber = nativeHistogramMaxBuckets
+	opts.NativeHistogramMinResetDuration = nativeHistogramMinResetDuration
+	return opts
+}
+
+// Native TCP RTT buckets are the powers of two from 2^-17s (7.6µs) to 2^3s
+// (8s), schema 0, so the eBPF program can count them with fixed bounds
+const (
+	tcpRTTNativeMinExp = -17
+	tcpRTTNativeMaxExp = 3
+)
+
+// tcpRTTNativeBuckets returns the bucket bounds for the eBPF program, which
+// counts samples below a bound in whole microseconds
+func tcpRTTNativeBuckets() []int32 {
+	var bounds []int32
+	for exp := tcpRTTNativeMinExp; exp <= tcpRTTNativeMaxExp; exp++ {
+		// A sample of v µs is within 2^exp s if v < floor(2^exp*1e6)+1
+		bounds = append(bounds, int32(math.Floor(math.Ldexp(1e6, exp)))+1)
+	}
+	return bounds
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// nftables mode of the port traffic collector, for kernels without cgroup
+// eBPF: named counters per port, counted by rules in the input, output and
+// forward hooks. Like the GPU collector runs nvidia-smi, it runs nft.
+var (
+	portTrafficMode      = flag.String("collector.port-traffic.mode", "ebpf", "How to account port traffic: ebpf, or nftables for kernels without cgroup eBPF (requires nft and root or CAP_NET_ADMIN, also after startup).")
+	portTrafficNftPath   = flag.String("collector.port-traffic.nft-path", "nft", "Path to the nft binary.")
+	portTrafficNftTable  = flag.String("collector.port-traffic.nft-table", "inet game_exporter", "nftables table of the port counters, as \"family name\".")
+	portTrafficNftCreate = flag.Bool("collector.port-traffic.nft-create", true, "Create the table with its counters and rules at startup, replacing an existing one. Disable to read the counters of a table managed elsewhere, named port_<port>_<protocol>_<in|out|syn|rst>.")
+)
+
+// nftCounterName names the counter of a port, e.g. port_27015_udp_in
+func nftCounterName(p trafficPort, kind string) string {
+	return fmt.Sprintf("port_%d_%s_%s", p.port, p.protocol, kind)
+}
+
+// nftPortTrafficRuleset is the table with a counter per port and direction,
+// and for TCP per incoming SYN and RST. Forwarded packets are counted too,
+// for game servers in containers behind DNAT.
+func nftPortTrafficRuleset(table string, ports []trafficPort) string {
+	var b strings.Builder
+	// Adding then deleting the table replaces it, whether it exists or not
+	fmt.Fprintf(&b, "table %s {}\ndelete table %s\ntable %s {\n", table, table, table)
+	for _, p := range ports {
+		fmt.Fprintf(&b, "\tcounter %s {}\n\tcounter %s {}\n", nftCounterName(p, "in"), nftCounterName(p, "out"))
+		if p.protocol == "tcp" {
+			fmt.Fprintf(&b, "\tcounter %s {}\n\tcounter %s {}\n", nftCounterName(p, "syn"), nftCounterName(p, "rst"))
+		}
+	}
+	for _, chain := range []string{"input", "output", "forward"} {
+		fmt.Fprintf(&b, "\tchain %s {\n\t\ttype filter hook %s priority -300; policy accept;\n", chain, chain)
+		for _, p := range ports {
+			if chain != "output" {
+				fmt.Fprintf(&b, "\t\t%s dport %d counter name %s\n", p.protocol, p.port, nftCounterName(p, "in"))
+			}
+			if chain != "input" {
+				fmt.Fprintf(&b, "\t\t%s sport %d counter name %s\n", p.protocol, p.port, nftCounterName(p, "out"))
+			}
+			if p.protocol == "tcp" && chain != "output" {
+				fmt.Fprintf(&b, "\t\ttcp dport %d tcp flags & (syn | ack) == syn counter name %s\n", p.port, nftCounterName(p, "syn"))
+				fmt.Fprintf(&b, "\t\ttcp dport %d tcp flags & rst == rst counter name %s\n", p.port, nftCounterName(p, "rst"))
+			}
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// startNftPortTraffic creates the table, or checks that the existing one can
+// be read
+func startNftPortTraffic(ports []trafficPort) error {
+	if len(strings.Fields(*portTrafficNftTable)) != 2 {
+		return fmt.Errorf("invalid nftables table %q, expected \"family name\"", *portTrafficNftTable)
+	}
+	if *portTrafficNftCreate {
+		cmd := exec.Command(*portTrafficNftPath, "-f", "-")
+		cmd.Stdin = strings.NewReader(nftPortTrafficRuleset(*portTrafficNftTable, ports))
+		if out, err := execCombinedOutput(cmd); err != nil {
+			return fmt.Errorf("creating table %s: %w: %s", *portTrafficNftTable, err, bytes.TrimSpace(out))
+		}
+	}
+	_, err := readNftCounters()
+	return err
+}
+
+// readNftCounters lists the named counters of the table as
+// name -> [bytes, packets]
+func readNftCounters() (map[string][2]float64, error) {
+	args := append([]string{"-j", "list", "counters", "table"}, strings.Fields(*portTrafficNftTable)...)
+	out, err := execOutput(exec.Command(*portTrafficNftPath, args...))
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Nftables []struct {
+			Counter *struct {
+				Name    string  `json:"name"`
+				Bytes   float64 `json:"bytes"`
+				Packets float64 `json:"packets"`
+			} `json:"counter"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, err
+	}
+	counters := make(map[string][2]float64)
+	for _, item := range list.Nftables {
+		if item.Counter != nil {
+			counters[item.Counter.Name] = [2]float64{item.Counter.Bytes, item.Counter.Packets}
+		}
+	}
+	return counters, nil
+}
+
+// Collect per-port traffic from the nftables counters. Counters missing
+// from a table managed elsewhere are skipped.
+func updateNftPortTrafficMetrics() {
+	counters, err := readNftCounters()
+	if err != nil {
+		logCollectorError("port_traffic", "Error reading nftables counters:", err)
+		return
+	}
+	for _, p := range trafficPorts {
+		port := strconv.Itoa(int(p.port))
+		for _, direction := range []string{"in", "out"} {
+			if c, ok := counters[nftCounterName(p, direction)]; ok {
+				portTrafficCounters.set(portTrafficBytes, c[0], port, p.protocol, direction)
+				portTrafficCounters.set(portTrafficPackets, c[1], port, p.protocol, direction)
+			}
+		}
+		if p.protocol != "tcp" {
+			continue
+		}
+		for _, flag := range []string{"syn", "rst"} {
+			if c, ok := counters[nftCounterName(p, flag)]; ok {
+				portTrafficCounters.set(portTCPFlagPackets, c[1], port, flag)
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	numaMemory = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_numa_memory_bytes",
+		Help: "NUMA node memory in bytes by state (total, free, used)",
+	}, []string{"node", "state"})
+	numaStat = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_numa_stat",
+		Help: "NUMA allocation counters since boot (numa_hit, numa_miss, numa_foreign, ...)",
+	}, []string{"node", "stat"})
+	numaCPUs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_numa_cpus",
+		Help: "Number of CPUs on the NUMA node",
+	}, []string{"node"})
+)
+
+func init() {
+	prometheus.MustRegister(numaMemory)
+	prometheus.MustRegister(numaStat)
+	prometheus.MustRegister(numaCPUs)
+}
+
+// getNUMANodes returns the node directory names (node0, node1, ...)
+func getNUMANodes() []string {
+	matches, err := filepath.Glob(sysFilePath("devices/system/node/node[0-9]*"))
+	if err != nil {
+		return nil
+	}
+	nodes := make([]string, 0, len(matches))
+	for _, match := range matches {
+		nodes = append(nodes, filepath.Base(match))
+	}
+	return nodes
+}
+
+// Parse "Node 0 MemTotal:  4685560 kB" lines from a node's meminfo
+func getNUMAMemory(node string) map[string]float64 {
+	data, err := os.ReadFile(sysFilePath(filepath.Join("devices/system/node", node, "meminfo")))
+	if err != nil {
+		logCollectorError("numa", "Error reading NUMA meminfo:", err)
+		return nil
+	}
+	metrics := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		value, _ := strconv.ParseFloat(fields[3], 64)
+		switch fields[2] {
+		case "MemTotal:":
+			metrics["total"] = value * 1024 // Convert KB to bytes
+		case "MemFree:":
+			metrics["free"] = value * 1024 // Convert KB to bytes
+		case "MemUsed:":
+			metrics["used"] = value * 1024 // Convert KB to bytes
+		}
+	}
+	return metrics
+}
+
+func getNUMAStat(node string) map[string]float64 {
+	data, err := os.ReadFile(sysFilePath(filepath.Join("devices/system/node", node, "numastat")))
+	if err != nil {
+		logCollectorError("numa", "Error reading numastat:", err)
+		return nil
+	}
+	metrics := make(map[string]float64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, _ := strconv.ParseFloat(fields[1], 64)
+		metrics[fields[0]] = value
+	}
+	return metrics
+}
+
+// countCPUList counts the CPUs in a kernel cpulist such as "0-3,8-11"
+func countCPUList(list string) int {
+	count := 0
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		if !isRange {
+			count++
+			continue
+		}
+		start, err1 := strconv.Atoi(lo)
+		end, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || end < start {
+			continue
+		}
+		count += end - start + 1
+	}
+	return count
+}
+
+// Collect per-node NUMA metrics
+func updateNUMAMetrics() {
+	for _, node := range getNUMANodes() {
+		id := strings.TrimPrefix(node, "node")
+		for state, value := range getNUMAMemory(node) {
+			numaMemory.WithLabelValues(id, state).Set(value)
+		}
+		for stat, value := range getNUMAStat(node) {
+			numaStat.WithLabelValues(id, stat).Set(value)
+		}
+		if data, err := os.ReadFile(sysFilePath(filepath.Join("devices/system/node", node, "cpulist"))); err == nil {
+			numaCPUs.WithLabelValues(id).Set(float64(countCPUList(string(data))))
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// A minimal Parquet writer: required columns, PLAIN encoded and uncompressed,
+// one data page per column chunk. Each appended row group rewrites the footer
+// after it, so the file stays readable between cycles.
+
+// Parquet physical and converted types, as in parquet.thrift
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetNoConversion    = -1
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+)
+
+type parquetColumn struct {
+	name      string
+	kind      int32
+	converted int32
+}
+
+type parquetChunk struct {
+	offset, size int64
+}
+
+type parquetRowGroup struct {
+	rows   int64
+	chunks []parquetChunk
+}
+
+type parquetWriter struct {
+	f         *os.File
+	columns   []parquetColumn
+	end       int64 // Offset of the footer
+	rowGroups []parquetRowGroup
+}
+
+// createParquet creates a new, empty Parquet file
+func createParquet(path string, columns []parquetColumn) (*parquetWriter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	w := &parquetWriter{f: f, columns: columns, end: 4}
+	if _, err := f.WriteAt([]byte("PAR1"), 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := w.writeFooter(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *parquetWriter) Close() error {
+	return w.f.Close()
+}
+
+// appendRowGroup writes a row group from the PLAIN encoded values of each
+// column and the footer after it
+func (w *parquetWriter) appendRowGroup(rows int, values [][]byte) error {
+	if len(values) != len(w.columns) {
+		return errors.New("parquet: wrong number of columns")
+	}
+	group := parquetRowGroup{rows: int64(rows)}
+	offset := w.end
+	for _, data := range values {
+		chunk := append(parquetPageHeader(rows, len(data)), data...)
+		if _, err := w.f.WriteAt(chunk, offset); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, parquetChunk{offset, int64(len(chunk))})
+		offset += int64(len(chunk))
+	}
+	w.end = offset
+	w.rowGroups = append(w.rowGroups, group)
+	return w.writeFooter()
+}
+
+func (w *parquetWriter) writeFooter() error {
+	meta := w.fileMetaData()
+	footer := binary.LittleEndian.AppendUint32(meta, uint32(len(meta)))
+	footer = append(footer, "PAR1"...)
+	if _, err := w.f.WriteAt(footer, w.end); err != nil {
+		return err
+	}
+	return w.f.Truncate(w.end + int64(len(footer)))
+}
+
+func parquetPageHeader(rows, size int) []byte {
+	var t thriftWriter
+	t.begin()
+	t.i32(1, 0) // Data page
+	t.i32(2, int32(size))
+	t.i32(3, int32(size))
+	t.beginStruct(5)
+	t.i32(1, int32(rows))
+	t.i32(2, 0) // PLAIN
+	t.i32(3, 3) // RLE definition levels, absent as the columns are required
+	t.i32(4, 3) // RLE repetition levels, absent too
+	t.end()
+	t.end()
+	return t.b
+}
+
+func (w *parquetWriter) fileMetaData() []byte {
+	var t thriftWriter
+	t.begin()
+	t.i32(1, 1) // Version
+	t.list(2, thriftStruct, len(w.columns)+1)
+	t.begin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(w.columns)))
+	t.end()
+	for _, c := range w.columns {
+		t.begin()
+		t.i32(1, c.kind)
+		t.i32(3, 0) // Required
+		t.binary(4, c.name)
+		if c.converted != parquetNoConversion {
+			t.i32(6, c.converted)
+		}
+		t.end()
+	}
+	var rows int64
+	for _, g := range w.rowGroups {
+		rows += g.rows
+	}
+	t.i64(3, rows)
+	t.list(4, thriftStruct, len(w.rowGroups))
+	for _, g := range w.rowGroups {
+		t.begin()
+		t.list(1, thriftStruct, len(g.chunks))
+		var size int64
+		for i, chunk := range g.chunks {
+			c := w.columns[i]
+			t.begin()
+			t.i64(2, chunk.offset)
+			t.beginStruct(3)
+			t.i32(1, c.kind)
+			t.list(2, thriftI32, 1)
+			t.listI32(0) // PLAIN
+			t.list(3, thriftBinary, 1)
+			t.listBinary(c.name)
+			t.i32(4, 0) // Uncompressed
+			t.i64(5, g.rows)
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.end()
+			t.end()
+			size += chunk.size
+		}
+		t.i64(2, size)
+		t.i64(3, g.rows)
+		t.end()
+	}
+	t.binary(6, "game_exporter")
+	t.end()
+	return t.b
+}
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in the Thrift compact protocol. Structs are
+// opened with begin or beginStruct and closed with end.
+type thriftWriter struct {
+	b    []byte
+	last []int16 // Last field ID of each open struct
+}
+
+func (t *thriftWriter) begin() {
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftWriter) end() {
+	t.b = append(t.b, 0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) field(id int16, kind byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.b = append(t.b, byte(delta)<<4|kind)
+	} else {
+		t.b = append(t.b, kind)
+		t.b = binary.AppendVarint(t.b, int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.b = binary.AppendVarint(t.b, int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.b = binary.AppendVarint(t.b, v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.listBinary(s)
+}
+
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// list starts a list field of n elements, written next with begin and end,
+// listI32 or listBinary
+func (t *thriftWriter) list(id int16, kind byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.b = append(t.b, byte(n)<<4|kind)
+	} else {
+		t.b = append(t.b, 0xf0|kind)
+		t.b = binary.AppendUvarint(t.b, uint64(n))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.b = binary.AppendVarint(t.b, int64(v))
+}
+
+func (t *thriftWriter) listBinary(s string) {
+	t.b = binary.AppendUvarint(t.b, uint64(len(s)))
+	t.b = append(t.b, s...)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// thriftReader decodes the Thrift compact protocol into maps of field IDs to
+// int64, string, []any and map values, independently of thriftWriter
+type thriftReader struct {
+	b   []byte
+	err error
+}
+
+func (r *thriftReader) byte() byte {
+	if len(r.b) == 0 {
+		r.err = fmt.Errorf("short Thrift data")
+		return 0
+	}
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = fmt.Errorf("invalid varint")
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(kind byte) any {
+	switch kind {
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := int(r.uvarint())
+		if n > len(r.b) {
+			r.err = fmt.Errorf("short Thrift binary")
+			return ""
+		}
+		s := string(r.b[:n])
+		r.b = r.b[n:]
+		return s
+	case thriftList:
+		header := r.byte()
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := []any{}
+		for range n {
+			if r.err != nil {
+				break
+			}
+			list = append(list, r.value(header&0x0f))
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	r.err = fmt.Errorf("unexpected Thrift type %d", kind)
+	return nil
+}
+
+func (r *thriftReader) structure() map[int16]any {
+	fields := make(map[int16]any)
+	var id int16
+	for r.err == nil {
+		header := r.byte()
+		if header == 0 {
+			break
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.varint())
+		}
+		fields[id] = r.value(header & 0x0f)
+	}
+	return fields
+}
+
+// parquetRows reads the rows of a dump, checking the file structure on the way
+func parquetRows(t *testing.T, data []byte) [][]any {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) || len(data) < 12 {
+		t.Fatalf("no PAR1 magic around %q", data)
+	}
+	n := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if n > len(data)-12 {
+		t.Fatalf("footer length %d in a file of %d bytes", n, len(data))
+	}
+	r := thriftReader{b: data[len(data)-8-n : len(data)-8]}
+	meta := r.structure()
+	if r.err != nil || len(r.b) != 0 {
+		t.Fatalf("file metadata: %v, %d bytes left", r.err, len(r.b))
+	}
+	if meta[1] != int64(1) {
+		t.Errorf("version = %v", meta[1])
+	}
+	schema := meta[2].([]any)
+	if root := schema[0].(map[int16]any); root[5] != int64(len(dumpColumns)) {
+		t.Errorf("schema root = %v", root)
+	}
+	for i, c := range dumpColumns {
+		want := map[int16]any{1: int64(c.kind), 3: int64(0), 4: c.name}
+		if c.converted != parquetNoConversion {
+			want[6] = int64(c.converted)
+		}
+		if got := schema[i+1].(map[int16]any); !reflect.DeepEqual(got, want) {
+			t.Errorf("schema element %d = %v, want %v", i+1, got, want)
+		}
+	}
+
+	var rows [][]any
+	for _, g := range meta[4].([]any) {
+		group := g.(map[int16]any)
+		n := int(group[3].(int64))
+		groupRows := make([][]any, n)
+		for i, c := range group[1].([]any) {
+			chunk := c.(map[int16]any)[3].(map[int16]any)
+			if chunk[5] != int64(n) {
+				t.Errorf("column %d has %v values in a group of %d rows", i, chunk[5], n)
+			}
+			offset := int(chunk[9].(int64))
+			r := thriftReader{b: data[offset:]}
+			page := r.structure()
+			if r.err != nil || page[1] != int64(0) || page[5].(map[int16]any)[1] != int64(n) {
+				t.Fatalf("page header %v: %v", page, r.err)
+			}
+			size := int(page[2].(int64))
+			if header := len(data[offset:]) - len(r.b); int64(header+size) != chunk[6] {
+				t.Errorf("column %d chunk of %d bytes, metadata says %v", i, header+size, chunk[6])
+			}
+			values := r.b[:size]
+			for row := range n {
+				switch dumpColumns[i].kind {
+				case parquetInt64:
+					groupRows[row] = append(groupRows[row], int64(binary.LittleEndian.Uint64(values)))
+					values = values[8:]
+				case parquetDouble:
+					groupRows[row] = append(groupRows[row], math.Float64frombits(binary.LittleEndian.Uint64(values)))
+					values = values[8:]
+				case parquetByteArray:
+					length := binary.LittleEndian.Uint32(values)
+					groupRows[row] = append(groupRows[row], string(values[4:4+length]))
+					values = values[4+length:]
+				}
+			}
+			if len(values) != 0 {
+				t.Errorf("column %d has %d bytes after its values", i, len(values))
+			}
+		}
+		rows = append(rows, groupRows...)
+	}
+	if meta[3] != int64(len(rows)) {
+		t.Errorf("num_rows = %v, row groups have %d rows", meta[3], len(rows))
+	}
+	return rows
+}
+
+func TestParquetDump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.parquet")
+	w, err := createParquet(path, dumpColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	read := func() [][]any {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parquetRows(t, data)
+	}
+	if rows := read(); len(rows) != 0 {
+		t.Errorf("new file rows = %v", rows)
+	}
+
+	d := &dumpWriter{parquet: w}
+	at := time.UnixMilli(1700000000123)
+	err = d.writeParquet(at, sinkMessage{Host: "vm", Metrics: []sinkSample{
+		{Name: "game_query_players", Labels: map[string]string{"instance_name": "cs2-1"}, Value: 12},
+		{Name: "game_cpu_usage_percent", Value: 3.5},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.writeParquet(at.Add(time.Minute), sinkMessage{Host: "vm", Metrics: []sinkSample{
+		{Name: "game_cpu_usage_percent", Value: -0.25},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]any{
+		{int64(1700000000123), "vm", "game_query_players", `{"instance_name":"cs2-1"}`, 12.0},
+		{int64(1700000000123), "vm", "game_cpu_usage_percent", "{}", 3.5},
+		{int64(1700000060123), "vm", "game_cpu_usage_percent", "{}", -0.25},
+	}
+	if got := read(); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
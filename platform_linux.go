@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Thin wrappers around the Linux-only syscalls, so the exporter also builds
+// on Windows where the procfs collectors are disabled
+
+// statFS returns the size, free and available bytes and the type of a
+// mounted filesystem
+func statFS(path string) (size, free, available uint64, fsType int64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	bsize := uint64(st.Bsize)
+	return st.Blocks * bsize, st.Bfree * bsize, st.Bavail * bsize, int64(st.Type), nil
+}
+
+// deviceID returns the ID of the device holding the file
+func deviceID(path string) (uint64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Dev), nil
+}
+
+// checkWritable reports whether the exporter's user may write to the file
+func checkWritable(path string) error {
+	return syscall.Access(path, 2 /* W_OK */)
+}
+
+// killWithParent makes the command exit when the exporter does
+func killWithParent(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+}
+
+// socketProtocolName reads the protocol of a socket FD from sockfs' xattr,
+// e.g. "TCP", "UDPv6", "UNIX-STREAM" or "NETLINK"
+func socketProtocolName(fdPath string) (string, error) {
+	buf := make([]byte, 32)
+	n, err := syscall.Getxattr(fdPath, "system.sockprotoname", buf)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(buf[:n]), "\x00"), nil
+}
+
+// setCredentials switches the whole process to the groups, gid and uid
+func setCredentials(uid, gid int, groups []int) error {
+	// Groups first, they can't be changed once the uid is dropped
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+	return nil
+}
+
+// uname returns the kernel release and machine hardware name
+func uname() (release, machine string, err error) {
+	var u unix.Utsname
+	if err := unix.Uname(&u); err != nil {
+		return "", "", err
+	}
+	return unix.ByteSliceToString(u.Release[:]), unix.ByteSliceToString(u.Machine[:]), nil
+}
+
+// setCommandCredentials makes the command run as the user
+func setCommandCredentials(cmd *exec.Cmd, uid, gid int, groups []int) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	credential := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	for _, g := range groups {
+		credential.Groups = append(credential.Groups, uint32(g))
+	}
+	cmd.SysProcAttr.Credential = credential
+	return nil
+}
+
+// execRestricted applies the limits to the process and replaces it with the
+// command. The caller must be locked to its thread, as no_new_privs is a
+// thread attribute.
+func execRestricted(limits sandboxLimits, noNewPrivs bool, path string, args []string) error {
+	if noNewPrivs {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("no_new_privs: %w", err)
+		}
+	}
+	for resource, limit := range map[int]uint64{
+		unix.RLIMIT_CPU:    limits.cpuSeconds,
+		unix.RLIMIT_AS:     limits.memoryBytes,
+		unix.RLIMIT_NPROC:  limits.processes,
+		unix.RLIMIT_NOFILE: limits.openFiles,
+	} {
+		if limit == 0 {
+			continue
+		}
+		if err := unix.Setrlimit(resource, &unix.Rlimit{Cur: limit, Max: limit}); err != nil {
+			return fmt.Errorf("setrlimit: %w", err)
+		}
+	}
+	return syscall.Exec(path, args, os.Environ())
+}
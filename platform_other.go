@@ -0,0 +1,42 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func statFS(path string) (size, free, available uint64, fsType int64, err error) {
+	return 0, 0, 0, 0, errors.ErrUnsupported
+}
+
+func deviceID(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func checkWritable(path string) error {
+	return nil
+}
+
+func killWithParent(cmd *exec.Cmd) {}
+
+func socketProtocolName(fdPath string) (string, error) {
+	return "", errors.ErrUnsupported
+}
+
+func setCredentials(uid, gid int, groups []int) error {
+	return errors.ErrUnsupported
+}
+
+func uname() (release, machine string, err error) {
+	return "", "", errors.ErrUnsupported
+}
+
+func setCommandCredentials(cmd *exec.Cmd, uid, gid int, groups []int) error {
+	return errors.ErrUnsupported
+}
+
+func execRestricted(limits sandboxLimits, noNewPrivs bool, path string, args []string) error {
+	return errors.ErrUnsupported
+}
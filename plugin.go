@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// pluginConfig is one entry of the plugins config section, an external
+// collector. With only a command, the command is run every interval and
+// prints the metrics. With only a socket, the plugin is a service that
+// writes the metrics to every connection and closes it. With both, the
+// command is such a service, started and restarted by the exporter. With a
+// URL, the plugin is another exporter on the host, e.g. the JMX exporter or
+// cAdvisor, scraped and re-exposed so the host has a single scrape endpoint.
+type pluginConfig struct {
+	Name     string            `yaml:"name"`
+	Command  []string          `yaml:"command"`
+	Socket   string            `yaml:"socket"`   // Unix socket path
+	URL      string            `yaml:"url"`      // Metrics endpoint of an exporter
+	Labels   map[string]string `yaml:"labels"`   // Added to every series, e.g. instance_name
+	Format   string            `yaml:"format"`   // prometheus (text exposition, default) or json
+	Interval time.Duration     `yaml:"interval"` // Default --collector.query.interval
+	Timeout  time.Duration     `yaml:"timeout"`  // Default 10s
+}
+
+const (
+	defaultPluginTimeout = 10 * time.Second
+	pluginRestartDelay   = 10 * time.Second
+	maxPluginOutput      = 16 << 20
+)
+
+var (
+	pluginUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_plugin_up",
+		Help: "Whether the last run of the plugin succeeded",
+	}, []string{"plugin"})
+	pluginDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_plugin_duration_seconds",
+		Help: "Time taken by the last run of the plugin",
+	}, []string{"plugin"})
+	pluginSeries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_plugin_series",
+		Help: "Series exported from the last run of the plugin",
+	}, []string{"plugin"})
+	pluginErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "game_plugin_errors_total",
+		Help: "Failed runs of the plugin (timeouts, exit codes, unparseable output) and series it sent that were dropped",
+	}, []string{"plugin", "reason"})
+	pluginRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "game_plugin_restarts_total",
+		Help: "Times the plugin service was restarted after it exited",
+	}, []string{"plugin"})
+)
+
+func init() {
+	prometheus.MustRegister(pluginUp)
+	prometheus.MustRegister(pluginDuration)
+	prometheus.MustRegister(pluginSeries)
+	prometheus.MustRegister(pluginErrors)
+	prometheus.MustRegister(pluginRestarts)
+	prometheus.MustRegister(pluginCollector{})
+}
+
+func validatePlugins(configs []pluginConfig) error {
+	names := make(map[string]bool)
+	for _, c := range configs {
+		if c.Name == "" {
+			return errors.New("plugins: name is required")
+		}
+		if c.URL != "" {
+			if len(c.Command) > 0 || c.Socket != "" {
+				return fmt.Errorf("plugin %q: url excludes command and socket", c.Name)
+			}
+			if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+				return fmt.Errorf("plugin %q: url must be an http or https URL", c.Name)
+			}
+		} else if len(c.Command) == 0 && c.Socket == "" {
+			return fmt.Errorf("plugin %q: command, socket or url is required", c.Name)
+		}
+		for name := range c.Labels {
+			if !model.LabelName(name).IsValidLegacy() || name == "plugin" {
+				return fmt.Errorf("plugin %q: invalid label name %q", c.Name, name)
+			}
+		}
+		switch c.Format {
+		case "", "prometheus", "json":
+		default:
+			return fmt.Errorf("plugin %q: format must be prometheus or json", c.Name)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("plugin %q defined twice", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return nil
+}
+
+// pluginFamily is a metric family from a plugin
+type pluginFamily struct {
+	name, help string
+	kind       dto.MetricType
+	metrics    []*dto.Metric
+}
+
+// pluginFamilyInfo is the help and type a family is exported with
+type pluginFamilyInfo struct {
+	help string
+	kind dto.MetricType
+}
+
+// Families of the last successful run of every plugin
+var (
+	pluginMu       sync.Mutex
+	pluginFamilies = make(map[string][]pluginFamily)
+	pluginWarned   = make(map[string]bool) // Dropped families, logged once
+	// Configured labels of every plugin, set before the plugins start
+	pluginLabels = make(map[string]map[string]string)
+	// Families the exporter exports itself, e.g. go_goroutines. A plugin's
+	// family of the same name takes their help, as the registry requires one
+	// help per family.
+	exporterFamilies = make(map[string]pluginFamilyInfo)
+)
+
+// Start the configured plugins in the background
+func startPlugins(configs []pluginConfig) {
+	if len(configs) == 0 {
+		return
+	}
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		log.Println("Error gathering the exporter's metrics:", err)
+	}
+	for _, f := range families {
+		exporterFamilies[f.GetName()] = pluginFamilyInfo{f.GetHelp(), f.GetType()}
+	}
+	for _, c := range configs {
+		pluginLabels[c.Name] = c.Labels
+	}
+	for _, c := range configs {
+		if len(c.Command) > 0 && c.Socket != "" {
+			go supervisePlugin(c)
+		}
+		go runPlugins(c)
+	}
+}
+
+// supervisePlugin keeps a plugin service running
+func supervisePlugin(c pluginConfig) {
+	for {
+		cmd := exec.Command(c.Command[0], c.Command[1:]...)
+		killWithParent(cmd)
+		// The service's log goes to the exporter's
+		cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+		err := sandboxCommand(cmd)
+		if err == nil {
+			err = cmd.Run()
+		}
+		if err != nil {
+			log.Println("Plugin", c.Name, "exited:", err)
+		} else {
+			log.Println("Plugin", c.Name, "exited")
+		}
+		pluginErrors.WithLabelValues(c.Name, "exited").Inc()
+		time.Sleep(pluginRestartDelay)
+		pluginRestarts.WithLabelValues(c.Name).Inc()
+	}
+}
+
+// runPlugins reads the plugin's metrics every interval
+func runPlugins(c pluginConfig) {
+	interval := c.Interval
+	if interval == 0 {
+		interval = *queryInterval
+	}
+	// The counters exist from the start, so increase() sees the first error
+	for _, reason := range []string{"run", "parse", "dropped"} {
+		pluginErrors.WithLabelValues(c.Name, reason)
+	}
+	sleepJitter()
+	for {
+		c.run()
+		time.Sleep(interval)
+	}
+}
+
+// run reads and parses the plugin's output once
+func (c pluginConfig) run() {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = defaultPluginTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	out, err := c.read(ctx)
+	pluginDuration.WithLabelValues(c.Name).Set(time.Since(start).Seconds())
+
+	var families []pluginFamily
+	reason := "run"
+	if err == nil {
+		reason = "parse"
+		if c.Format == "json" {
+			families, err = parsePluginJSON(out)
+		} else {
+			families, err = parsePluginText(out)
+		}
+	}
+	if err != nil {
+		log.Println("Error running plugin", c.Name+":", err)
+		pluginErrors.WithLabelValues(c.Name, reason).Inc()
+		pluginUp.WithLabelValues(c.Name).Set(0)
+		pluginSeries.WithLabelValues(c.Name).Set(0)
+		pluginMu.Lock()
+		delete(pluginFamilies, c.Name)
+		pluginMu.Unlock()
+		return
+	}
+
+	families, dropped := checkPluginFamilies(c.Name, families)
+	if dropped > 0 {
+		pluginErrors.WithLabelValues(c.Name, "dropped").Add(float64(dropped))
+	}
+	series := 0
+	for _, f := range families {
+		series += len(f.metrics)
+	}
+	pluginUp.WithLabelValues(c.Name).Set(1)
+	pluginSeries.WithLabelValues(c.Name).Set(float64(series))
+	pluginMu.Lock()
+	pluginFamilies[c.Name] = families
+	pluginMu.Unlock()
+}
+
+// read runs the command, reads the socket or scrapes the URL
+func (c pluginConfig) read(ctx context.Context) ([]byte, error) {
+	if c.URL != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		// The text format, not protobuf or OpenMetrics
+		req.Header.Set("Accept", "text/plain;version=0.0.4")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("status %s", resp.Status)
+		}
+		return readPluginOutput(resp.Body)
+	}
+	if c.Socket != "" {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", c.Socket)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		deadline, _ := ctx.Deadline()
+		conn.SetDeadline(deadline)
+		return readPluginOutput(conn)
+	}
+	cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+	killWithParent(cmd)
+	// Children of a killed script may keep its stdout open
+	cmd.WaitDelay = time.Second
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := execOutput(cmd)
+	if err != nil {
+		if line := lastLine(stderr.String()); line != "" {
+			return nil, fmt.Errorf("%w: %s", err, line)
+		}
+		return nil, err
+	}
+	if len(out) > maxPluginOutput {
+		return nil, fmt.Errorf("output larger than %d bytes", maxPluginOutput)
+	}
+	return out, nil
+}
+
+func readPluginOutput(r io.Reader) ([]byte, error) {
+	out, err := io.ReadAll(io.LimitReader(r, maxPluginOutput+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxPluginOutput {
+		return nil, fmt.Errorf("output larger than %d bytes", maxPluginOutput)
+	}
+	return out, nil
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	return s[strings.LastIndex(s, "\n")+1:]
+}
+
+// parsePluginText parses the Prometheus text exposition format
+func parsePluginText(out []byte) ([]pluginFamily, error) {
+	var parser expfmt.TextParser
+	parsed, err := parser.TextToMetricFamilies(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+	var families []pluginFamily
+	for name, f := range parsed {
+		families = append(families, pluginFamily{name: name, help: f.GetHelp(), kind: f.GetType(), metrics: f.Metric})
+	}
+	return families, nil
+}
+
+// pluginJSON is the JSON format of plugins:
+// {"metrics": [{"name": "...", "help": "...", "type": "gauge", "labels": {...}, "value": 1}]}
+type pluginJSON struct {
+	Metrics []struct {
+		Name   string            `json:"name"`
+		Help   string            `json:"help"`
+		Type   string            `json:"type"` // gauge (default), counter or untyped
+		Labels map[string]string `json:"labels"`
+		Value  float64           `json:"value"`
+	} `json:"metrics"`
+}
+
+func parsePluginJSON(out []byte) ([]pluginFamily, error) {
+	var doc pluginJSON
+	if err := json.Unmarshal(out, &doc); err != nil {
+		return nil, err
+	}
+	kinds := map[string]dto.MetricType{"": dto.MetricType_GAUGE, "gauge": dto.MetricType_GAUGE, "counter": dto.MetricType_COUNTER, "untyped": dto.MetricType_UNTYPED}
+	byName := make(map[string]*pluginFamily)
+	var names []string
+	for _, m := range doc.Metrics {
+		kind, ok := kinds[m.Type]
+		if !ok {
+			return nil, fmt.Errorf("metric %q: unknown type %q", m.Name, m.Type)
+		}
+		f, ok := byName[m.Name]
+		if !ok {
+			f = &pluginFamily{name: m.Name, help: m.Help, kind: kind}
+			byName[m.Name] = f
+			names = append(names, m.Name)
+		}
+		if f.kind != kind {
+			return nil, fmt.Errorf("metric %q: type %q differs from an earlier sample", m.Name, m.Type)
+		}
+		metric := &dto.Metric{}
+		for name, value := range m.Labels {
+			metric.Label = append(metric.Label, &dto.LabelPair{Name: &name, Value: &value})
+		}
+		value := m.Value
+		switch kind {
+		case dto.MetricType_COUNTER:
+			metric.Counter = &dto.Counter{Value: &value}
+		case dto.MetricType_GAUGE:
+			metric.Gauge = &dto.Gauge{Value: &value}
+		default:
+			metric.Untyped = &dto.Untyped{Value: &value}
+		}
+		f.metrics = append(f.metrics, metric)
+	}
+	families := make([]pluginFamily, 0, len(names))
+	for _, name := range names {
+		families = append(families, *byName[name])
+	}
+	return families, nil
+}
+
+// checkPluginFamilies drops what would make gathering fail: invalid names,
+// the exporter's game_ namespace, the reserved plugin label, the plugin's
+// configured labels and duplicate series. It returns the families left and the number of series dropped.
+func checkPluginFamilies(plugin string, families []pluginFamily) ([]pluginFamily, int) {
+	dropped := 0
+	var kept []pluginFamily
+	for _, f := range families {
+		if !model.IsValidLegacyMetricName(f.name) || strings.HasPrefix(f.name, "game_") {
+			pluginMu.Lock()
+			if !pluginWarned[plugin+"\xff"+f.name] {
+				pluginWarned[plugin+"\xff"+f.name] = true
+				log.Println("Plugin", plugin, "sent metric", f.name+", dropping it: names must be valid and outside the game_ namespace")
+			}
+			pluginMu.Unlock()
+			dropped += len(f.metrics)
+			continue
+		}
+		seen := make(map[string]bool)
+		var metrics []*dto.Metric
+		for _, m := range f.metrics {
+			key, ok := pluginSeriesKey(plugin, m)
+			if !ok || seen[key] {
+				dropped++
+				continue
+			}
+			seen[key] = true
+			metrics = append(metrics, m)
+		}
+		if len(metrics) > 0 {
+			f.metrics = metrics
+			kept = append(kept, f)
+		}
+	}
+	return kept, dropped
+}
+
+// pluginSeriesKey identifies a series by its sorted labels, or returns false
+// for invalid labels
+func pluginSeriesKey(plugin string, m *dto.Metric) (string, bool) {
+	var pairs []string
+	for _, l := range m.Label {
+		if _, ok := pluginLabels[plugin][l.GetName()]; ok {
+			return "", false
+		}
+		if !model.LabelName(l.GetName()).IsValidLegacy() || l.GetName() == "plugin" {
+			return "", false
+		}
+		pairs = append(pairs, l.GetName()+"\xff"+l.GetValue())
+	}
+	sort.Strings(pairs)
+	for i := 1; i < len(pairs); i++ {
+		if strings.Split(pairs[i], "\xff")[0] == strings.Split(pairs[i-1], "\xff")[0] {
+			return "", false
+		}
+	}
+	return strings.Join(pairs, "\xfe"), true
+}
+
+// pluginCollector exports the families of the plugins with a plugin label.
+// It is unchecked, as the families are only known at runtime.
+type pluginCollector struct{}
+
+func (pluginCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (pluginCollector) Collect(ch chan<- prometheus.Metric) {
+	pluginMu.Lock()
+	defer pluginMu.Unlock()
+	plugins := make([]string, 0, len(pluginFamilies))
+	for plugin := range pluginFamilies {
+		plugins = append(plugins, plugin)
+	}
+	slices.Sort(plugins)
+
+	// Plugins exporting the same family share the exporter's or the first
+	// plugin's help and type
+	infos := maps.Clone(exporterFamilies)
+	for _, plugin := range plugins {
+		for _, f := range pluginFamilies[plugin] {
+			info, ok := infos[f.name]
+			if !ok {
+				info = pluginFamilyInfo{f.help, f.kind}
+				infos[f.name] = info
+			}
+			if info.kind != f.kind {
+				continue
+			}
+			for _, m := range f.metrics {
+				if metric, err := pluginMetric(plugin, f.name, info.help, f.kind, m); err == nil {
+					ch <- metric
+				}
+			}
+		}
+	}
+}
+
+// pluginMetric converts a parsed sample into a constant metric
+func pluginMetric(plugin, name, help string, kind dto.MetricType, m *dto.Metric) (prometheus.Metric, error) {
+	labelNames := []string{"plugin"}
+	labelValues := []string{plugin}
+	for label, value := range pluginLabels[plugin] {
+		labelNames = append(labelNames, label)
+		labelValues = append(labelValues, value)
+	}
+	for _, l := range m.Label {
+		labelNames = append(labelNames, l.GetName())
+		labelValues = append(labelValues, l.GetValue())
+	}
+	if help == "" {
+		help = "Exported by a plugin"
+	}
+	desc := prometheus.NewDesc(name, help, labelNames, nil)
+	switch kind {
+	case dto.MetricType_COUNTER:
+		return prometheus.NewConstMetric(desc, prometheus.CounterValue, m.GetCounter().GetValue(), labelValues...)
+	case dto.MetricType_GAUGE:
+		return prometheus.NewConstMetric(desc, prometheus.GaugeValue, m.GetGauge().GetValue(), labelValues...)
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		buckets := make(map[float64]uint64)
+		for _, b := range h.GetBucket() {
+			buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+		}
+		return prometheus.NewConstHistogram(desc, h.GetSampleCount(), h.GetSampleSum(), buckets, labelValues...)
+	case dto.MetricType_SUMMARY:
+		s := m.GetSummary()
+		quantiles := make(map[float64]float64)
+		for _, q := range s.GetQuantile() {
+			quantiles[q.GetQuantile()] = q.GetValue()
+		}
+		return prometheus.NewConstSummary(desc, s.GetSampleCount(), s.GetSampleSum(), quantiles, labelValues...)
+	default:
+		return prometheus.NewConstMetric(desc, prometheus.UntypedValue, m.GetUntyped().GetValue(), labelValues...)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/rlimit"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Per-port traffic accounting with cgroup_skb eBPF programs attached to the
+// root cgroup, so bytes are attributed to the socket's local port
+var (
+	portTrafficEnabled    = flag.Bool("collector.port-traffic", false, "Enable per-port traffic accounting, with eBPF (requires root or CAP_BPF and cgroup v2) or nftables, see --collector.port-traffic.mode.")
+	portTrafficPorts      = flag.String("collector.port-traffic.ports", "", "Comma-separated game ports to account, as port/protocol (e.g. 27015/udp,27015/tcp).")
+	portTrafficCgroupPath = flag.String("collector.port-traffic.cgroup-path", "", "cgroup v2 mountpoint to attach to (default autodetect under the sysfs path).")
+)
+
+var (
+	portTrafficBytes = prometheus.NewDesc("game_port_traffic_bytes_total",
+		"Bytes sent/received by sockets bound to the game port since the exporter started",
+		[]string{"port", "protocol", "direction"}, nil)
+	portTrafficPackets = prometheus.NewDesc("game_port_traffic_packets_total",
+		"Packets sent/received by sockets bound to the game port since the exporter started",
+		[]string{"port", "protocol", "direction"}, nil)
+	portTCPFlagPackets = prometheus.NewDesc("game_port_tcp_flag_packets_total",
+		"Incoming TCP SYN (without ACK) and RST packets to the game port since the exporter started",
+		[]string{"port", "flag"}, nil)
+
+	portTrafficCounters = newCounterSeries(portTrafficBytes, portTrafficPackets, portTCPFlagPackets)
+)
+
+func init() {
+	prometheus.MustRegister(portTrafficCounters)
+}
+
+const (
+	// Key kinds: traffic per direction, and ingress TCP flag counts
+	directionIngress = 0
+	directionEgress  = 1
+	kindSYN          = 2
+	kindRST          = 3
+
+	// Offsets into struct __sk_buff and struct bpf_sock (include/uapi/linux/bpf.h)
+	skbLenOffset          = 0
+	skbSkOffset           = 168
+	bpfSockProtocolOffset = 12
+	bpfSockSrcPortOffset  = 44
+
+	cgroup2SuperMagic = 0x63677270
+)
+
+var ipProtocols = map[string]uint32{"tcp": syscall.IPPROTO_TCP, "udp": syscall.IPPROTO_UDP}
+
+// trafficPort is a configured port/protocol pair
+type trafficPort struct {
+	port     uint16
+	protocol string
+}
+
+// Counters map key: port | protocol << 16 | kind << 24
+func portTrafficKey(p trafficPort, kind uint32) uint32 {
+	return uint32(p.port) | ipProtocols[p.protocol]<<16 | kind<<24
+}
+
+var (
+	trafficPorts   []trafficPort
+	trafficCounter *ebpf.Map
+	trafficLinks   []link.Link
+)
+
+func parseTrafficPorts(s string) ([]trafficPort, error) {
+	var ports []trafficPort
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		portStr, protocol, found := strings.Cut(item, "/")
+		if !found {
+			return nil, fmt.Errorf("expected port/protocol, got %q", item)
+		}
+		protocol = strings.ToLower(protocol)
+		if _, ok := ipProtocols[protocol]; !ok {
+			return nil, fmt.Errorf("unknown protocol in %q", item)
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in %q", item)
+		}
+		ports = append(ports, trafficPort{port: uint16(port), protocol: protocol})
+	}
+	if len(ports) == 0 {
+		return nil, errors.New("no ports configured")
+	}
+	return ports, nil
+}
+
+// portTrafficProgram counts packets whose socket is bound to a configured port.
+// Only keys pre-populated in the map are counted; packets always pass. On
+// ingress, TCP SYN and RST packets are also counted under their own keys.
+func portTrafficProgram(counters *ebpf.Map, direction uint32) asm.Instructions {
+	insns := asm.Instructions{
+		asm.Mov.Reg(asm.R6, asm.R1),
+		// sk = bpf_sk_fullsock(skb->sk)
+		asm.LoadMem(asm.R1, asm.R6, skbSkOffset, asm.DWord),
+		asm.JEq.Imm(asm.R1, 0, "out"),
+		asm.FnSkFullsock.Call(),
+		asm.JEq.Imm(asm.R0, 0, "out"),
+		// key = sk->src_port | sk->protocol << 16 | direction << 24
+		asm.LoadMem(asm.R8, asm.R0, bpfSockSrcPortOffset, asm.Word),
+		asm.LoadMem(asm.R7, asm.R0, bpfSockProtocolOffset, asm.Word),
+		asm.LSh.Imm(asm.R7, 16),
+		asm.Or.Reg(asm.R8, asm.R7), // R8 = port | protocol << 16
+		asm.Mov.Reg(asm.R2, asm.R8),
+		asm.Or.Imm(asm.R2, int32(direction<<24)),
+	}
+	// value->bytes += skb->len; value->packets += 1
+	insns = append(insns, portTrafficLookup(counters)...)
+	insns = append(insns,
+		asm.LoadMem(asm.R1, asm.R6, skbLenOffset, asm.Word),
+		asm.StoreXAdd(asm.R0, asm.R1, asm.DWord),
+		asm.Add.Imm(asm.R0, 8),
+		asm.Mov.Imm(asm.R1, 1),
+		asm.StoreXAdd(asm.R0, asm.R1, asm.DWord),
+	)
+
+	if direction == directionIngress {
+		insns = append(insns,
+			asm.RSh.Imm(asm.R7, 16),
+			asm.JNE.Imm(asm.R7, syscall.IPPROTO_TCP, "out"),
+			// skb data starts at the IP header: find the TCP header offset
+			asm.Mov.Imm(asm.R2, 0),
+			asm.Mov.Imm(asm.R4, 1),
+		)
+		insns = append(insns, portTrafficLoadByte()...)
+		insns = append(insns,
+			asm.Mov.Reg(asm.R2, asm.R9),
+			asm.RSh.Imm(asm.R2, 4),
+			asm.JEq.Imm(asm.R2, 6, "ipv6"),
+			asm.JNE.Imm(asm.R2, 4, "out"),
+			asm.And.Imm(asm.R9, 0x0f), // IPv4 header length in words
+			asm.LSh.Imm(asm.R9, 2),
+			asm.Ja.Label("flags"),
+			asm.Mov.Imm(asm.R9, 40).WithSymbol("ipv6"), // Extension headers are not followed
+			// TCP flags are at offset 13 of the TCP header
+			asm.Mov.Reg(asm.R2, asm.R9).WithSymbol("flags"),
+			asm.Add.Imm(asm.R2, 13),
+			asm.Mov.Imm(asm.R4, 1),
+		)
+		insns = append(insns, portTrafficLoadByte()...)
+		// SYN without ACK: a new connection attempt
+		insns = append(insns,
+			asm.Mov.Reg(asm.R2, asm.R9),
+			asm.And.Imm(asm.R2, 0x12),
+			asm.JNE.Imm(asm.R2, 0x02, "rst"),
+			asm.Mov.Reg(asm.R2, asm.R8),
+			asm.Or.Imm(asm.R2, kindSYN<<24),
+		)
+		insns = append(insns, portTrafficLookup(counters)...)
+		insns = append(insns,
+			asm.Add.Imm(asm.R0, 8),
+			asm.Mov.Imm(asm.R1, 1),
+			asm.StoreXAdd(asm.R0, asm.R1, asm.DWord),
+			asm.Mov.Reg(asm.R2, asm.R9).WithSymbol("rst"),
+			asm.And.Imm(asm.R2, 0x04),
+			asm.JEq.Imm(asm.R2, 0, "out"),
+			asm.Mov.Reg(asm.R2, asm.R8),
+			asm.Or.Imm(asm.R2, kindRST<<24),
+		)
+		insns = append(insns, portTrafficLookup(counters)...)
+		insns = append(insns,
+			asm.Add.Imm(asm.R0, 8),
+			asm.Mov.Imm(asm.R1, 1),
+			asm.StoreXAdd(asm.R0, asm.R1, asm.DWord),
+		)
+	}
+
+	return append(insns,
+		asm.Mov.Imm(asm.R0, 1).WithSymbol("out"), // Allow the packet
+		asm.Return(),
+	)
+}
+
+// portTrafficLookup looks up the key in R2, leaving the value pointer in R0
+// and jumping to "out" when the key isn't configured
+func portTrafficLookup(counters *ebpf.Map) asm.Instructions {
+	return asm.Instructions{
+		asm.StoreMem(asm.RFP, -4, asm.R2, asm.Word),
+		asm.LoadMapPtr(asm.R1, counters.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -4),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "out"),
+	}
+}
+
+// portTrafficLoadByte loads the packet byte at offset R2 into R9
+func portTrafficLoadByte() asm.Instructions {
+	return asm.Instructions{
+		asm.Mov.Reg(asm.R1, asm.R6),
+		asm.Mov.Reg(asm.R3, asm.RFP),
+		asm.Add.Imm(asm.R3, -8),
+		asm.FnSkbLoadBytes.Call(),
+		asm.JNE.Imm(asm.R0, 0, "out"),
+		asm.LoadMem(asm.R9, asm.RFP, -8, asm.Byte),
+	}
+}
+
+// findCgroup2Path returns the cgroup v2 mountpoint, handling hybrid hierarchies
+func findCgroup2Path(override string) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+	for _, name := range []string{"fs/cgroup", "fs/cgroup/unified"} {
+		if _, _, _, fsType, err := statFS(sysFilePath(name)); err == nil && fsType == cgroup2SuperMagic {
+			return sysFilePath(name), nil
+		}
+	}
+	return "", errors.New("no cgroup v2 hierarchy found")
+}
+
+// Load and attach the eBPF programs
+func startPortTraffic() error {
+	ports, err := parseTrafficPorts(*portTrafficPorts)
+	if err != nil {
+		return err
+	}
+	switch *portTrafficMode {
+	case "ebpf":
+	case "nftables":
+		if err := startNftPortTraffic(ports); err != nil {
+			return err
+		}
+		trafficPorts = ports
+		return nil
+	default:
+		return fmt.Errorf("unknown mode %q", *portTrafficMode)
+	}
+	cgroupPath, err := findCgroup2Path(*portTrafficCgroupPath)
+	if err != nil {
+		return err
+	}
+	// Kernels before 5.11 account BPF memory against RLIMIT_MEMLOCK
+	if err := rlimit.RemoveMemlock(); err != nil {
+		return err
+	}
+
+	counters, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "game_port_bytes",
+		Type:       ebpf.Hash,
+		KeySize:    4,
+		ValueSize:  16,
+		MaxEntries: uint32(len(ports) * 4),
+	})
+	if err != nil {
+		return fmt.Errorf("creating map: %w", err)
+	}
+	zero := make([]byte, 16)
+	for _, p := range ports {
+		kinds := []uint32{directionIngress, directionEgress}
+		if p.protocol == "tcp" {
+			kinds = append(kinds, kindSYN, kindRST)
+		}
+		for _, kind := range kinds {
+			if err := counters.Put(portTrafficKey(p, kind), zero); err != nil {
+				counters.Close()
+				return fmt.Errorf("populating map: %w", err)
+			}
+		}
+	}
+
+	var links []link.Link
+	for _, attach := range []struct {
+		direction uint32
+		attach    ebpf.AttachType
+	}{
+		{directionIngress, ebpf.AttachCGroupInetIngress},
+		{directionEgress, ebpf.AttachCGroupInetEgress},
+	} {
+		prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+			Name:         "game_port_bytes",
+			Type:         ebpf.CGroupSKB,
+			AttachType:   attach.attach,
+			Instructions: portTrafficProgram(counters, attach.direction),
+			License:      "GPL",
+		})
+		if err != nil {
+			err = fmt.Errorf("loading program: %w", err)
+		} else {
+			var l link.Link
+			l, err = link.AttachCgroup(link.CgroupOptions{Path: cgroupPath, Attach: attach.attach, Program: prog})
+			// The link holds its own reference to the program
+			prog.Close()
+			if err == nil {
+				links = append(links, l)
+				continue
+			}
+			err = fmt.Errorf("attaching to %s: %w", cgroupPath, err)
+		}
+		for _, l := range links {
+			l.Close()
+		}
+		counters.Close()
+		return err
+	}
+
+	trafficPorts = ports
+	trafficCounter = counters
+	trafficLinks = links
+	return nil
+}
+
+// Collect per-port traffic counters from the eBPF map
+func updatePortTrafficMetrics() {
+	defer portTrafficCounters.sweep()
+	if *portTrafficMode == "nftables" {
+		updateNftPortTrafficMetrics()
+		return
+	}
+	if trafficCounter == nil {
+		return
+	}
+	value := make([]byte, 16)
+	for _, p := range trafficPorts {
+		for direction, name := range []string{"in", "out"} {
+			if err := trafficCounter.Lookup(portTrafficKey(p, uint32(direction)), &value); err != nil {
+				logCollectorError("port_traffic", "Error reading port traffic map:", err)
+				return
+			}
+			port := strconv.Itoa(int(p.port))
+			portTrafficCounters.set(portTrafficBytes, float64(binary.NativeEndian.Uint64(value[0:8])), port, p.protocol, name)
+			portTrafficCounters.set(portTrafficPackets, float64(binary.NativeEndian.Uint64(value[8:16])), port, p.protocol, name)
+		}
+		if p.protocol != "tcp" {
+			continue
+		}
+		for kind, flag := range map[uint32]string{kindSYN: "syn", kindRST: "rst"} {
+			if err := trafficCounter.Lookup(portTrafficKey(p, kind), &value); err != nil {
+				logCollectorError("port_traffic", "Error reading port traffic map:", err)
+				return
+			}
+			portTrafficCounters.set(portTCPFlagPackets, float64(binary.NativeEndian.Uint64(value[8:16])), strconv.Itoa(int(p.port)), flag)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Pressure stall information, system-wide from /proc/pressure and per cgroup
+// so a stalled game server can be told apart from its neighbours
+var pressureCgroups = flag.String("collector.pressure.cgroups", "", "Comma-separated cgroup v2 paths to export PSI for, relative to the cgroup mountpoint (e.g. system.slice/cs2.service).")
+
+var pressureResources = []string{"cpu", "memory", "io"}
+
+var (
+	pressureStall = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_pressure_stall_seconds",
+		Help: "Time tasks were stalled on the resource since boot (some: at least one task, full: all non-idle tasks)",
+	}, []string{"resource", "kind"})
+	pressureAvg = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_pressure_percent",
+		Help: "Share of time tasks were stalled on the resource, averaged over the window",
+	}, []string{"resource", "kind", "window"})
+	cgroupPressureStall = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_cgroup_pressure_stall_seconds",
+		Help: "Time tasks of the cgroup were stalled on the resource since the cgroup was created",
+	}, []string{"cgroup", "resource", "kind"})
+	cgroupPressureAvg = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_cgroup_pressure_percent",
+		Help: "Share of time tasks of the cgroup were stalled on the resource, averaged over the window",
+	}, []string{"cgroup", "resource", "kind", "window"})
+)
+
+func init() {
+	prometheus.MustRegister(pressureStall)
+	prometheus.MustRegister(pressureAvg)
+	prometheus.MustRegister(cgroupPressureStall)
+	prometheus.MustRegister(cgroupPressureAvg)
+}
+
+// readPressure parses a PSI file, lines like
+// "some avg10=0.00 avg60=0.00 avg300=0.00 total=0", into kind -> field -> value
+func readPressure(path string) (map[string]map[string]float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pressure := make(map[string]map[string]float64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		values := make(map[string]float64)
+		for _, field := range fields[1:] {
+			name, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			if v, err := strconv.ParseFloat(value, 64); err == nil {
+				values[name] = v
+			}
+		}
+		pressure[fields[0]] = values
+	}
+	return pressure, nil
+}
+
+// setPressure exports one PSI file; labels are prepended to resource and kind
+func setPressure(stall, avg *prometheus.GaugeVec, pressure map[string]map[string]float64, labels ...string) {
+	for kind, values := range pressure {
+		stall.WithLabelValues(append(labels, kind)...).Set(values["total"] / 1e6) // Convert microseconds to seconds
+		for _, window := range []string{"avg10", "avg60", "avg300"} {
+			avg.WithLabelValues(append(labels, kind, strings.TrimPrefix(window, "avg")+"s")...).Set(values[window])
+		}
+	}
+}
+
+// Collect system-wide and per-cgroup pressure
+func updatePressureMetrics() {
+	for _, resource := range pressureResources {
+		pressure, err := readPressure(procFilePath(filepath.Join("pressure", resource)))
+		if err != nil {
+			// Kernels without CONFIG_PSI or booted with psi=0
+			if !os.IsNotExist(err) {
+				logCollectorError("pressure", "Error reading pressure:", err)
+			}
+			continue
+		}
+		setPressure(pressureStall, pressureAvg, pressure, resource)
+	}
+
+	if *pressureCgroups == "" {
+		return
+	}
+	root, err := findCgroup2Path("")
+	if err != nil {
+		logCollectorError("pressure", "Error reading cgroup pressure:", err)
+		return
+	}
+	// Cgroups disappear when their service stops
+	cgroupPressureStall.Reset()
+	cgroupPressureAvg.Reset()
+	for _, cgroup := range strings.Split(*pressureCgroups, ",") {
+		cgroup = strings.Trim(strings.TrimSpace(cgroup), "/")
+		if cgroup == "" {
+			continue
+		}
+		for _, resource := range pressureResources {
+			pressure, err := readPressure(filepath.Join(root, cgroup, resource+".pressure"))
+			if err != nil {
+				if !os.IsNotExist(err) {
+					logCollectorError("pressure", "Error reading cgroup pressure:", err)
+				}
+				continue
+			}
+			setPressure(cgroupPressureStall, cgroupPressureAvg, pressure, cgroup, resource)
+		}
+	}
+}
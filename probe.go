@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// probeConfig is one entry of the probes config section, a backend URL the
+// game host depends on, e.g. the matchmaker API, the auth service or a
+// remote-write endpoint
+type probeConfig struct {
+	Name     string        `yaml:"name"`
+	URL      string        `yaml:"url"`
+	Method   string        `yaml:"method"`   // Default GET
+	Timeout  time.Duration `yaml:"timeout"`  // Default 5s
+	Interval time.Duration `yaml:"interval"` // Default --collector.query.interval
+	// Status codes counted as success, default any 2xx. E.g. 405 for a GET
+	// to a remote-write endpoint.
+	ValidStatusCodes   []int  `yaml:"valid_status_codes"`
+	BearerToken        string `yaml:"bearer_token"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+const defaultProbeTimeout = 5 * time.Second
+
+var (
+	probeSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_probe_success",
+		Help: "Whether the backend answered the last probe with a valid status code",
+	}, []string{"probe"})
+	probeReachable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_probe_reachable",
+		Help: "Whether the last probe got an HTTP response at all; 1 with game_probe_success 0 means the backend is reachable but failing",
+	}, []string{"probe"})
+	probeStatusCode = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_probe_status_code",
+		Help: "HTTP status code of the last probe, 0 without a response",
+	}, []string{"probe"})
+	probeDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_probe_duration_seconds",
+		Help: "Time taken by the last probe, including failed ones",
+	}, []string{"probe"})
+	probePhaseDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_probe_phase_duration_seconds",
+		Help: "Time taken by each phase of the last probe: dns, connect, tls, processing (until the first response byte) and transfer",
+	}, []string{"probe", "phase"})
+)
+
+func init() {
+	prometheus.MustRegister(probeSuccess)
+	prometheus.MustRegister(probeReachable)
+	prometheus.MustRegister(probeStatusCode)
+	prometheus.MustRegister(probeDuration)
+	prometheus.MustRegister(probePhaseDuration)
+}
+
+func validateProbes(configs []probeConfig) error {
+	names := make(map[string]bool)
+	for _, c := range configs {
+		if c.Name == "" || c.URL == "" {
+			return errors.New("probes: name and url are required")
+		}
+		if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+			return fmt.Errorf("probe %q: url must be an http or https URL", c.Name)
+		}
+		if _, err := http.NewRequest(c.method(), c.URL, nil); err != nil {
+			return fmt.Errorf("probe %q: %w", c.Name, err)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("probe %q defined twice", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return nil
+}
+
+func (c probeConfig) method() string {
+	if c.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(c.Method)
+}
+
+func (c probeConfig) validStatus(code int) bool {
+	if len(c.ValidStatusCodes) == 0 {
+		return code >= 200 && code < 300
+	}
+	return slices.Contains(c.ValidStatusCodes, code)
+}
+
+// Start probing the configured backends in the background
+func startProbes(configs []probeConfig) {
+	for _, c := range configs {
+		go runProbes(c)
+	}
+}
+
+// runProbes probes one backend every interval
+func runProbes(c probeConfig) {
+	interval := c.Interval
+	if interval == 0 {
+		interval = *queryInterval
+	}
+	for {
+		probe(c)
+		time.Sleep(interval)
+	}
+}
+
+// probe requests the URL over a new connection, so DNS, connect and TLS
+// are measured every time
+func probe(c probeConfig) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = defaultProbeTimeout
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify},
+		},
+		// A redirect is an answer of the backend, not followed
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	// The dial callbacks may still run after a timeout
+	var mu sync.Mutex
+	var dnsStart, dnsDone, connectStart, connectDone, tlsStart, tlsDone, firstByte time.Time
+	at := func(t *time.Time) {
+		mu.Lock()
+		*t = time.Now()
+		mu.Unlock()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { at(&dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { at(&dnsDone) },
+		ConnectStart:         func(string, string) { at(&connectStart) },
+		ConnectDone:          func(string, string, error) { at(&connectDone) },
+		TLSHandshakeStart:    func() { at(&tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { at(&tlsDone) },
+		GotFirstResponseByte: func() { at(&firstByte) },
+	}
+	req, err := http.NewRequest(c.method(), c.URL, nil)
+	if err != nil {
+		log.Println("Error probing", c.Name+":", err)
+		return
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	if c.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	}
+
+	start := time.Now()
+	status := 0
+	resp, err := client.Do(req)
+	if err == nil {
+		status = resp.StatusCode
+		_, err = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	end := time.Now()
+
+	if err != nil {
+		log.Println("Error probing", c.Name+":", err)
+	}
+	reachable, success := 0.0, 0.0
+	if status != 0 {
+		reachable = 1
+	}
+	if err == nil && c.validStatus(status) {
+		success = 1
+	}
+	probeReachable.WithLabelValues(c.Name).Set(reachable)
+	probeSuccess.WithLabelValues(c.Name).Set(success)
+	probeStatusCode.WithLabelValues(c.Name).Set(float64(status))
+	probeDuration.WithLabelValues(c.Name).Set(end.Sub(start).Seconds())
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Phases that didn't happen, e.g. DNS for an IP or TLS for http, are 0
+	phase := func(name string, from, to time.Time) {
+		d := 0.0
+		if !from.IsZero() && !to.IsZero() {
+			d = to.Sub(from).Seconds()
+		}
+		probePhaseDuration.WithLabelValues(c.Name, name).Set(d)
+	}
+	phase("dns", dnsStart, dnsDone)
+	phase("connect", connectStart, connectDone)
+	phase("tls", tlsStart, tlsDone)
+	requestSent := connectDone
+	if !tlsDone.IsZero() {
+		requestSent = tlsDone
+	}
+	phase("processing", requestSent, firstByte)
+	phase("transfer", firstByte, end)
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// processMatchFlag collects repeated --process.match=name=regexp flags
+type processMatchFlag []gameInstance
+
+func (f *processMatchFlag) String() string {
+	var parts []string
+	for _, m := range *f {
+		parts = append(parts, m.name+"="+m.cmdline.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *processMatchFlag) Set(value string) error {
+	name, pattern, found := strings.Cut(value, "=")
+	if !found || name == "" {
+		return fmt.Errorf("expected name=regexp, got %q", value)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, gameInstance{name: name, cmdline: re})
+	return nil
+}
+
+var processMatches processMatchFlag
+
+// Clock ticks per second used by /proc/<pid>/stat times; fixed at 100 on Linux
+const userHZ = 100
+
+var (
+	processUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_process_up",
+		Help: "Whether the game process is running (1) or not (0)",
+	}, []string{"instance_name"})
+	processStartTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_process_start_time_seconds",
+		Help: "Start time of the game process as a Unix timestamp in seconds",
+	}, []string{"instance_name"})
+	processRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "game_process_restarts_total",
+		Help: "Number of times the game process was seen with a new start time",
+	}, []string{"instance_name"})
+	processThreads = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_process_threads",
+		Help: "Number of threads of the game process",
+	}, []string{"instance_name"})
+	processThreadStates = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_process_thread_states",
+		Help: "Number of threads of the game process by scheduler state",
+	}, []string{"instance_name", "state"})
+)
+
+var processCPUDesc = prometheus.NewDesc("game_process_cpu_seconds_total",
+	"CPU time consumed by the game process since it started, by mode (user, system)",
+	[]string{"instance_name", "mode"}, nil)
+
+// utime and stime of the game processes in the last cycle, by instance
+var (
+	processCPUMu    sync.Mutex
+	processCPUTimes map[string]procStat
+)
+
+// processCPUCollector exports the CPU times as counters, which reset when the
+// process restarts
+type processCPUCollector struct{}
+
+func (processCPUCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- processCPUDesc
+}
+
+func (processCPUCollector) Collect(ch chan<- prometheus.Metric) {
+	processCPUMu.Lock()
+	defer processCPUMu.Unlock()
+	for instance, st := range processCPUTimes {
+		ch <- prometheus.MustNewConstMetric(processCPUDesc, prometheus.CounterValue, float64(st.utime)/userHZ, instance, "user")
+		ch <- prometheus.MustNewConstMetric(processCPUDesc, prometheus.CounterValue, float64(st.stime)/userHZ, instance, "system")
+	}
+}
+
+// Thread states from the state field of /proc/<pid>/task/<tid>/stat
+var threadStates = map[string]string{
+	"R": "running",
+	"S": "sleeping",
+	"D": "disk_sleep",
+	"T": "stopped",
+	"t": "tracing_stop",
+	"Z": "zombie",
+	"X": "dead",
+	"I": "idle",
+}
+
+func init() {
+	flag.Var(&processMatches, "process.match", "Game instance to monitor as name=regexp, matched against the command line. Repeatable; see also instances in the config file.")
+
+	prometheus.MustRegister(processUp)
+	prometheus.MustRegister(processStartTime)
+	prometheus.MustRegister(processRestarts)
+	prometheus.MustRegister(processCPUCollector{})
+	prometheus.MustRegister(processThreads)
+	prometheus.MustRegister(processThreadStates)
+}
+
+// gameProcess is the main process of a monitored game instance
+type gameProcess struct {
+	instance  string
+	pid       int
+	comm      string
+	startTime uint64 // Clock ticks after boot
+}
+
+// procStat holds the fields of /proc/<pid>/stat we care about
+type procStat struct {
+	comm       string
+	state      string
+	ppid       int
+	utime      uint64
+	stime      uint64
+	numThread  int
+	startTime  uint64
+	rtPriority int // 0 for processes not under a real-time policy
+}
+
+func readProcStat(pid int) (procStat, error) {
+	data, err := os.ReadFile(procFilePath(strconv.Itoa(pid) + "/stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+	// comm is wrapped in parentheses and may itself contain spaces or ")"
+	start := bytes.IndexByte(data, '(')
+	end := bytes.LastIndexByte(data, ')')
+	if start < 0 || end < start {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 20 {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	var st procStat
+	st.comm = string(data[start+1 : end])
+	st.state = fields[0]
+	st.ppid, _ = strconv.Atoi(fields[1])
+	st.utime, _ = strconv.ParseUint(fields[11], 10, 64)
+	st.stime, _ = strconv.ParseUint(fields[12], 10, 64)
+	st.numThread, _ = strconv.Atoi(fields[17])
+	st.startTime, _ = strconv.ParseUint(fields[19], 10, 64)
+	if len(fields) > 37 {
+		st.rtPriority, _ = strconv.Atoi(fields[37])
+	}
+	return st, nil
+}
+
+// readCmdline returns the command line with arguments separated by spaces
+func readCmdline(pid int) string {
+	data, err := os.ReadFile(procFilePath(strconv.Itoa(pid) + "/cmdline"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(bytes.ReplaceAll(data, []byte{0}, []byte{' '})))
+}
+
+// listPIDs returns all process IDs in procfs
+func listPIDs() []int {
+	entries, err := os.ReadDir(*procPath)
+	if err != nil {
+		logCollectorError("process", "Error reading procfs:", err)
+		return nil
+	}
+	var pids []int
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// Find the monitored game processes. When several processes match an
+// instance, the oldest one is taken as the game's main process.
+func findGameProcesses() []gameProcess {
+	if len(gameInstances) == 0 || !procfsAvailable {
+		return nil
+	}
+	var portInodes map[uint64]int
+	for _, inst := range gameInstances {
+		if inst.port != 0 {
+			portInodes = readPortSocketInodes()
+			break
+		}
+	}
+
+	found := make(map[string]gameProcess)
+	self := os.Getpid()
+	for _, pid := range listPIDs() {
+		if pid == self {
+			continue
+		}
+		cmdline := readCmdline(pid)
+		if cmdline == "" {
+			continue // Kernel thread or already exited
+		}
+		// cgroups and ports are only read when an instance needs them
+		var (
+			cgroups     []string
+			ports       map[int]bool
+			cgroupsRead bool
+		)
+		for _, inst := range gameInstances {
+			if inst.cmdline != nil && !inst.cmdline.MatchString(cmdline) {
+				continue
+			}
+			if inst.unit != "" || inst.container != "" {
+				if !cgroupsRead {
+					cgroups = readProcCgroups(pid)
+					cgroupsRead = true
+				}
+				if !inst.matchesCgroup(cgroups) {
+					continue
+				}
+			}
+			if inst.port != 0 {
+				if ports == nil {
+					ports = make(map[int]bool)
+					for _, inode := range readProcSocketInodes(pid) {
+						if port, ok := portInodes[inode]; ok {
+							ports[port] = true
+						}
+					}
+				}
+				if !ports[inst.port] {
+					continue
+				}
+			}
+			st, err := readProcStat(pid)
+			if err != nil {
+				continue
+			}
+			if prev, ok := found[inst.name]; ok && prev.startTime <= st.startTime {
+				continue
+			}
+			found[inst.name] = gameProcess{instance: inst.name, pid: pid, comm: st.comm, startTime: st.startTime}
+		}
+	}
+
+	processes := make([]gameProcess, 0, len(found))
+	for _, inst := range gameInstances {
+		if p, ok := found[inst.name]; ok {
+			processes = append(processes, p)
+		}
+	}
+	return processes
+}
+
+// listThreads returns the thread IDs of a process
+func listThreads(pid int) []int {
+	entries, err := os.ReadDir(procFilePath(strconv.Itoa(pid) + "/task"))
+	if err != nil {
+		return nil
+	}
+	var tids []int
+	for _, entry := range entries {
+		if tid, err := strconv.Atoi(entry.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	return tids
+}
+
+// Last seen start time per instance, used to detect restarts
+var lastProcessStartTimes = make(map[string]uint64)
+
+// Series of the running processes, to drop those of exited ones
+var processSeries = newSeriesGeneration()
+
+// Collect game process lifecycle metrics
+func updateProcessMetrics(processes []gameProcess) {
+	bootTime := getBootTime()
+
+	for _, inst := range gameInstances {
+		processUp.WithLabelValues(inst.name).Set(0)
+	}
+
+	cpuTimes := make(map[string]procStat)
+	for _, p := range processes {
+		processUp.WithLabelValues(p.instance).Set(1)
+		processSeries.set(processStartTime, bootTime+float64(p.startTime)/userHZ, p.instance)
+
+		// Make the counter visible before the first restart
+		restarts := processRestarts.WithLabelValues(p.instance)
+		if last, ok := lastProcessStartTimes[p.instance]; ok && last != p.startTime {
+			restarts.Inc()
+		}
+		lastProcessStartTimes[p.instance] = p.startTime
+
+		// utime and stime cover all threads of the process
+		if st, err := readProcStat(p.pid); err == nil {
+			cpuTimes[p.instance] = st
+		}
+
+		// Thread counts, e.g. plugins leaking threads
+		states := make(map[string]float64)
+		for _, state := range threadStates {
+			states[state] = 0
+		}
+		tids := listThreads(p.pid)
+		for _, tid := range tids {
+			st, err := readProcStat(tid)
+			if err != nil {
+				continue // Thread exited
+			}
+			if state, ok := threadStates[st.state]; ok {
+				states[state]++
+			}
+		}
+		processSeries.set(processThreads, float64(len(tids)), p.instance)
+		for state, count := range states {
+			processSeries.set(processThreadStates, count, p.instance, state)
+		}
+	}
+	processSeries.sweep()
+	processCPUMu.Lock()
+	processCPUTimes = cpuTimes
+	processCPUMu.Unlock()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var processFDs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "game_process_fds",
+	Help: "Open file descriptors of the game process by type (tcp, udp, unix, socket, file, pipe, eventfd, epoll, timerfd, signalfd, inotify, anon_inode, other)",
+}, []string{"instance_name", "type"})
+
+func init() {
+	prometheus.MustRegister(processFDs)
+}
+
+// Anonymous inode FDs, e.g. "anon_inode:[eventfd]"
+var anonInodeTypes = map[string]string{
+	"[eventfd]":   "eventfd",
+	"[eventpoll]": "epoll",
+	"[timerfd]":   "timerfd",
+	"[signalfd]":  "signalfd",
+	"inotify":     "inotify",
+}
+
+// socketProtocol reads the protocol of a socket FD from sockfs' xattr, which
+// unlike /proc/net also covers unbound sockets and other network namespaces
+func socketProtocol(fdPath string) string {
+	name, err := socketProtocolName(fdPath)
+	if err != nil {
+		return "socket"
+	}
+	switch {
+	case strings.HasPrefix(name, "TCP"):
+		return "tcp"
+	case strings.HasPrefix(name, "UDP"):
+		return "udp"
+	case strings.HasPrefix(name, "UNIX"):
+		return "unix"
+	}
+	return "socket" // netlink, raw, packet, ...
+}
+
+// fdType classifies a /proc/<pid>/fd entry by its link target
+func fdType(fdPath, target string) string {
+	if strings.HasPrefix(target, "socket:") {
+		return socketProtocol(fdPath)
+	}
+	if strings.HasPrefix(target, "pipe:") {
+		return "pipe"
+	}
+	if kind, ok := strings.CutPrefix(target, "anon_inode:"); ok {
+		if t, ok := anonInodeTypes[kind]; ok {
+			return t
+		}
+		return "anon_inode"
+	}
+	if strings.HasPrefix(target, "/") {
+		return "file"
+	}
+	return "other"
+}
+
+var processFDSeries = newSeriesGeneration()
+
+// Collect open file descriptors of the game processes by type
+func updateProcessFDMetrics(processes []gameProcess) {
+	for _, p := range processes {
+		fdDir := procFilePath(strconv.Itoa(p.pid) + "/fd")
+		entries, err := os.ReadDir(fdDir)
+		if err != nil {
+			checkPermission("process_fds", err)
+			continue
+		}
+		counts := map[string]float64{"tcp": 0, "udp": 0, "unix": 0, "file": 0, "pipe": 0}
+		for _, entry := range entries {
+			fdPath := fdDir + "/" + entry.Name()
+			target, err := os.Readlink(fdPath)
+			if err != nil {
+				continue // Closed meanwhile
+			}
+			counts[fdType(fdPath, target)]++
+		}
+		for t, count := range counts {
+			processFDSeries.set(processFDs, count, p.instance, t)
+		}
+	}
+	processFDSeries.sweep()
+}
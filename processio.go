@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Counters of the running game processes, which reset when a process restarts
+var (
+	processIOBytes = prometheus.NewDesc("game_process_io_bytes_total",
+		"Bytes the game process caused to be read from or written to storage since it started",
+		[]string{"instance_name", "direction"}, nil)
+	processIOSyscalls = prometheus.NewDesc("game_process_io_syscalls_total",
+		"Read and write syscalls of the game process since it started",
+		[]string{"instance_name", "direction"}, nil)
+
+	processIOSeries = newCounterSeries(processIOBytes, processIOSyscalls)
+)
+
+func init() {
+	prometheus.MustRegister(processIOSeries)
+}
+
+// readProcIO parses /proc/<pid>/io "name: value" lines
+func readProcIO(pid int) (map[string]float64, error) {
+	data, err := os.ReadFile(procFilePath(strconv.Itoa(pid) + "/io"))
+	if err != nil {
+		return nil, err
+	}
+	counters := make(map[string]float64)
+	for _, line := range strings.Split(string(data), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		counters[name], _ = strconv.ParseFloat(strings.TrimSpace(value), 64)
+	}
+	return counters, nil
+}
+
+// Collect disk I/O of the game processes. /proc/<pid>/io needs ptrace access
+// to the process, i.e. the same user or root.
+func updateProcessIOMetrics(processes []gameProcess) {
+	for _, p := range processes {
+		counters, err := readProcIO(p.pid)
+		if err != nil {
+			checkPermission("process_io", err)
+			continue
+		}
+		processIOSeries.set(processIOBytes, counters["read_bytes"], p.instance, "read")
+		processIOSeries.set(processIOBytes, counters["write_bytes"], p.instance, "write")
+		processIOSeries.set(processIOSyscalls, counters["syscr"], p.instance, "read")
+		processIOSeries.set(processIOSyscalls, counters["syscw"], p.instance, "write")
+	}
+	processIOSeries.sweep()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Resource limits of the game processes next to their usage, as a default
+// nofile of 1024 is a common cause of servers failing under load
+var (
+	processLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_process_limit",
+		Help: "Resource limit of the game process by limit (nofile, memlock bytes, rtprio) and type (soft, hard), +Inf when unlimited",
+	}, []string{"instance_name", "limit", "type"})
+	processLimitUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_process_limit_usage",
+		Help: "Current usage of the limited resource by the game process: open files, locked memory bytes, real-time priority",
+	}, []string{"instance_name", "limit"})
+)
+
+func init() {
+	prometheus.MustRegister(processLimit)
+	prometheus.MustRegister(processLimitUsage)
+}
+
+// Rows of /proc/<pid>/limits by limit name
+var processLimitNames = map[string]string{
+	"Max open files":        "nofile",
+	"Max locked memory":     "memlock",
+	"Max realtime priority": "rtprio",
+}
+
+var processLimitsSeries = newSeriesGeneration()
+
+func updateProcessLimitMetrics(processes []gameProcess) {
+	for _, p := range processes {
+		limits, err := readProcLimits(p.pid)
+		if err != nil {
+			continue // Exited since it was found
+		}
+		for limit, values := range limits {
+			processLimitsSeries.set(processLimit, values[0], p.instance, limit, "soft")
+			processLimitsSeries.set(processLimit, values[1], p.instance, limit, "hard")
+		}
+
+		pid := strconv.Itoa(p.pid)
+		if fds, err := os.ReadDir(procFilePath(pid + "/fd")); err == nil {
+			processLimitsSeries.set(processLimitUsage, float64(len(fds)), p.instance, "nofile")
+		} else {
+			checkPermission("process_limits", err)
+		}
+		usage := make(map[string]float64)
+		if err := readProcMemory(p.pid, "status", map[string]string{"VmLck:": "memlock"}, usage); err == nil {
+			processLimitsSeries.set(processLimitUsage, usage["memlock"], p.instance, "memlock")
+		}
+		if st, err := readProcStat(p.pid); err == nil {
+			processLimitsSeries.set(processLimitUsage, float64(st.rtPriority), p.instance, "rtprio")
+		}
+	}
+	processLimitsSeries.sweep()
+}
+
+// readProcLimits returns the soft and hard values of the limits we export
+func readProcLimits(pid int) (map[string][2]float64, error) {
+	data, err := os.ReadFile(procFilePath(strconv.Itoa(pid) + "/limits"))
+	if err != nil {
+		return nil, err
+	}
+	limits := make(map[string][2]float64)
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		for prefix, limit := range processLimitNames {
+			rest, ok := strings.CutPrefix(line, prefix+" ")
+			if !ok {
+				continue
+			}
+			fields := strings.Fields(rest)
+			if len(fields) < 2 {
+				continue
+			}
+			limits[limit] = [2]float64{parseLimit(fields[0]), parseLimit(fields[1])}
+		}
+	}
+	return limits, nil
+}
+
+func parseLimit(s string) float64 {
+	if s == "unlimited" {
+		return math.Inf(1)
+	}
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
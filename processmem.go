@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var processMemory = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "game_process_memory_bytes",
+	Help: "Memory of the game process by type (rss, anon, file, shmem, swap, virtual, rss_peak, pss)",
+}, []string{"instance_name", "type"})
+
+func init() {
+	prometheus.MustRegister(processMemory)
+}
+
+// readProcMemory parses "Key:   1234 kB" lines of a /proc/<pid> file,
+// keeping the keys present in the map under their new names
+func readProcMemory(pid int, name string, keys map[string]string, metrics map[string]float64) error {
+	data, err := os.ReadFile(procFilePath(strconv.Itoa(pid) + "/" + name))
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) != 3 || parts[2] != "kB" {
+			continue
+		}
+		key, ok := keys[parts[0]]
+		if !ok {
+			continue
+		}
+		value, _ := strconv.ParseFloat(parts[1], 64)
+		metrics[key] = value * 1024 // Convert KB to bytes
+	}
+	return nil
+}
+
+var processMemorySeries = newSeriesGeneration()
+
+// Collect memory usage of the game processes
+func updateProcessMemoryMetrics(processes []gameProcess) {
+	for _, p := range processes {
+		metrics := make(map[string]float64)
+		err := readProcMemory(p.pid, "status", map[string]string{
+			"VmRSS:":    "rss",
+			"RssAnon:":  "anon",
+			"RssFile:":  "file",
+			"RssShmem:": "shmem",
+			"VmSwap:":   "swap",
+			"VmSize:":   "virtual",
+			"VmHWM:":    "rss_peak",
+		}, metrics)
+		if err != nil {
+			continue // Exited since it was found
+		}
+		// Proportional set size, shared pages split between their users. Needs
+		// ptrace access to the process, and kernel 4.14+.
+		err = readProcMemory(p.pid, "smaps_rollup", map[string]string{"Pss:": "pss"}, metrics)
+		checkPermission("process_memory", err)
+
+		for memType, value := range metrics {
+			processMemorySeries.set(processMemory, value, p.instance, memType)
+		}
+	}
+	processMemorySeries.sweep()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Public IP collector, for community servers on dynamic IPs whose DNS
+// records break silently when the address changes
+var (
+	publicIPEnabled   = flag.Bool("collector.public-ip", false, "Enable the public IP collector, which looks up the host's public IP every 5 minutes (see --collector.ttl).")
+	publicIPURL       = flag.String("collector.public-ip.url", "https://api.ipify.org", "URL of a lookup service answering with the caller's IP as plain text.")
+	publicIPInterface = flag.String("collector.public-ip.interface", "", "Take the public IP from the global addresses of this interface instead of a lookup service, for hosts without NAT.")
+)
+
+var (
+	publicIPInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_public_ip_info",
+		Help: "Public IP of the host, always 1",
+	}, []string{"ip"})
+	publicIPChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "game_public_ip_changes_total",
+		Help: "Number of times the public IP was seen to change since the exporter started (or first started, with --state.dir)",
+	}, nil)
+)
+
+func init() {
+	prometheus.MustRegister(publicIPInfo)
+	prometheus.MustRegister(publicIPChanges)
+}
+
+var lastPublicIP string
+
+// Look up the public IP and count changes
+func updatePublicIPMetrics() {
+	var ip string
+	var err error
+	if *publicIPInterface != "" {
+		ip, err = interfacePublicIP(*publicIPInterface)
+	} else {
+		ip, err = lookupPublicIP(*publicIPURL)
+	}
+	if err != nil {
+		logCollectorError("public_ip", "Error determining the public IP:", err)
+		return
+	}
+	// The counter exists from the start, so increase() sees the first change
+	publicIPChanges.WithLabelValues()
+	if ip == lastPublicIP {
+		return
+	}
+	// Set the new address before removing the old one, so a scrape always
+	// sees one
+	publicIPInfo.WithLabelValues(ip).Set(1)
+	if lastPublicIP != "" {
+		log.Println("Public IP changed from", lastPublicIP, "to", ip)
+		publicIPChanges.WithLabelValues().Inc()
+		publicIPInfo.DeleteLabelValues(lastPublicIP)
+	}
+	lastPublicIP = ip
+}
+
+// lookupPublicIP asks the lookup service for the address it sees
+func lookupPublicIP(url string) (string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: status %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return "", fmt.Errorf("%s: no IP in the answer %q", url, body)
+	}
+	return ip.String(), nil
+}
+
+// interfacePublicIP returns the interface's first global unicast address
+// outside the private ranges, preferring IPv4
+func interfacePublicIP(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	var v6 string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !ipNet.IP.IsGlobalUnicast() || ipNet.IP.IsPrivate() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP.String(), nil
+		}
+		if v6 == "" {
+			v6 = ipNet.IP.String()
+		}
+	}
+	if v6 != "" {
+		return v6, nil
+	}
+	return "", errors.New("no public address on " + name)
+}
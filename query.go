@@ -0,0 +1,503 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"gopkg.in/yaml.v3"
+)
+
+// Game query collectors ask the game servers themselves over their query
+// protocols, in the background since a server can take seconds to answer
+var (
+	queryInterval   = flag.Duration("collector.query.interval", 15*time.Second, "Interval between game server queries.")
+	queryTimeout    = flag.Duration("collector.query.timeout", 2*time.Second, "Timeout of a single game server query.")
+	queryPlayers    = flag.Bool("collector.query.players", false, "Export per-player metrics (score, connection time) of servers that list their players. Adds a series per player.")
+	queryMaxPlayers = flag.Int("collector.query.max-players", 64, "Maximum number of players per server to export per-player metrics for.")
+)
+
+var (
+	queryUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_query_up",
+		Help: "Whether the game server answered the last query",
+	}, []string{"instance_name"})
+	queryLatency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_query_latency_seconds",
+		Help: "Round-trip time of the last query",
+	}, []string{"instance_name"})
+	queryInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_query_info",
+		Help: "Server name, map, game and version reported by the game server, always 1",
+	}, []string{"instance_name", "name", "map", "game", "version"})
+	queryPlayersOnline = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_query_players",
+		Help: "Players online reported by the game server",
+	}, []string{"instance_name"})
+	queryPlayersMax = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_query_max_players",
+		Help: "Player slots reported by the game server",
+	}, []string{"instance_name"})
+	queryBots = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_query_bots",
+		Help: "Bots reported by the game server",
+	}, []string{"instance_name"})
+	queryPlayerScore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_query_player_score",
+		Help: "Score of the player, with --collector.query.players",
+	}, []string{"instance_name", "player"})
+	queryPlayerConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_query_player_connected_seconds",
+		Help: "Time the player has been connected, with --collector.query.players",
+	}, []string{"instance_name", "player"})
+	queryRuleInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_query_rule_info",
+		Help: "Value of a configured server rule (cvar), always 1",
+	}, []string{"instance_name", "rule", "value"})
+	queryValue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_query_value",
+		Help: "Value extracted from the game server's reply by a configured pattern or path",
+	}, []string{"instance_name", "name"})
+	// Slow answers are an early sign of an overloaded server, so every
+	// query's time goes into a histogram, failed ones included. Created by
+	// registerQueryDuration once the flags are parsed.
+	queryDuration *prometheus.HistogramVec
+)
+
+// registerQueryDuration creates game_query_duration_seconds, as a native
+// histogram with --collector.native-histograms
+func registerQueryDuration() {
+	queryDuration = prometheus.NewHistogramVec(histogramOpts(prometheus.HistogramOpts{
+		Name:    "game_query_duration_seconds",
+		Help:    "Time taken by game server queries, including failed ones",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}), []string{"protocol", "instance_name"})
+	prometheus.MustRegister(queryDuration)
+}
+
+func init() {
+	prometheus.MustRegister(queryUp)
+	prometheus.MustRegister(queryLatency)
+	prometheus.MustRegister(queryInfo)
+	prometheus.MustRegister(queryPlayersOnline)
+	prometheus.MustRegister(queryPlayersMax)
+	prometheus.MustRegister(queryBots)
+	prometheus.MustRegister(queryPlayerScore)
+	prometheus.MustRegister(queryPlayerConnected)
+	prometheus.MustRegister(queryRuleInfo)
+	prometheus.MustRegister(queryValue)
+}
+
+// querier is a protocol driver's client for one game server
+type querier interface {
+	query() (*serverInfo, []playerInfo, error)
+}
+
+// queryDriver creates the querier of a target from its config entry,
+// validating the protocol's options
+type queryDriver func(target queryConfig) (querier, error)
+
+// Protocol drivers by name, registered by the driver files
+var queryDrivers = make(map[string]queryDriver)
+
+func registerQueryDriver(protocol string, driver queryDriver) {
+	queryDrivers[protocol] = driver
+}
+
+// queryConfig is one entry of the queries config section. Everything besides
+// these fields is an option of the protocol driver, e.g. address and rules for
+// a2s.
+type queryConfig struct {
+	Instance string            `yaml:"instance"`
+	Protocol string            `yaml:"protocol"`
+	Username string            `yaml:"username"` // Credentials for protocols with a login
+	Password string            `yaml:"password"`
+	Timeout  time.Duration     `yaml:"timeout"` // Default --collector.query.timeout
+	Labels   map[string]string `yaml:"labels"`  // Added to every metric of the instance
+	// background (default) queries every --collector.query.interval, scrape
+	// queries while /metrics is served
+	Mode string `yaml:"mode"`
+	// Background results older than this are dropped instead of served
+	MaxStaleness time.Duration `yaml:"max_staleness"`
+	options      yaml.Node
+}
+
+func (c *queryConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain queryConfig
+	if err := node.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	c.options = *node
+	return nil
+}
+
+// decodeOptions decodes the target's driver options into v
+func (c *queryConfig) decodeOptions(v any) error {
+	return c.options.Decode(v)
+}
+
+// timeout returns the timeout of a single query of the target
+func (c *queryConfig) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return *queryTimeout
+}
+
+// newQuerier creates the querier of a target with its protocol's driver
+func newQuerier(c queryConfig) (querier, error) {
+	driver, ok := queryDrivers[c.Protocol]
+	if !ok {
+		protocols := make([]string, 0, len(queryDrivers))
+		for protocol := range queryDrivers {
+			protocols = append(protocols, protocol)
+		}
+		sort.Strings(protocols)
+		return nil, fmt.Errorf("query %q: unknown protocol %q, one of %v", c.Instance, c.Protocol, protocols)
+	}
+	q, err := driver(c)
+	if err != nil {
+		return nil, fmt.Errorf("%s %q: %w", c.Protocol, c.Instance, err)
+	}
+	return q, nil
+}
+
+func validateQueries(configs []queryConfig) error {
+	instances := make(map[string]bool)
+	for _, c := range configs {
+		if c.Instance == "" {
+			return errors.New("query targets need an instance")
+		}
+		if err := validateTargetLabels(c.Labels); err != nil {
+			return fmt.Errorf("query %q: %w", c.Instance, err)
+		}
+		switch c.Mode {
+		case "", "background":
+		case "scrape":
+			if c.MaxStaleness != 0 {
+				return fmt.Errorf("query %q: max_staleness is for background targets", c.Instance)
+			}
+		default:
+			return fmt.Errorf("query %q: mode must be background or scrape", c.Instance)
+		}
+		if _, err := newQuerier(c); err != nil {
+			return err
+		}
+		if instances[c.Instance] {
+			return fmt.Errorf("query target %q defined twice", c.Instance)
+		}
+		instances[c.Instance] = true
+	}
+	return nil
+}
+
+// Running query targets by instance, changed at runtime by the admin API
+var (
+	queryTargetsMu sync.Mutex
+	queryTargets   = make(map[string]*queryTarget)
+)
+
+// Start querying the configured game servers in the background, or set them
+// up to be queried at scrape time
+func startQueries(configs []queryConfig) {
+	for _, c := range configs {
+		if err := startQuery(c); err != nil {
+			log.Println("Error starting query of", c.Instance+":", err)
+		}
+	}
+}
+
+func startQuery(c queryConfig) error {
+	q, err := newQuerier(c)
+	if err != nil {
+		return err
+	}
+	t := &queryTarget{
+		config:       c,
+		instance:     c.Instance,
+		protocol:     c.Protocol,
+		querier:      q,
+		maxStaleness: c.MaxStaleness,
+		stop:         make(chan struct{}),
+	}
+	queryTargetsMu.Lock()
+	defer queryTargetsMu.Unlock()
+	if _, ok := queryTargets[c.Instance]; ok {
+		return fmt.Errorf("query target %q already running", c.Instance)
+	}
+	queryTargets[c.Instance] = t
+	setTargetLabels(c.Instance, c.Labels)
+	queryUp.WithLabelValues(c.Instance).Set(0)
+	if c.Mode != "scrape" {
+		go runQueries(t)
+	}
+	return nil
+}
+
+// stopQuery stops querying the instance and removes its series
+func stopQuery(instance string) error {
+	queryTargetsMu.Lock()
+	t, ok := queryTargets[instance]
+	delete(queryTargets, instance)
+	queryTargetsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("no query target %q", instance)
+	}
+	close(t.stop)
+
+	// Waits for a query in progress
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removed = true
+	t.set(nil, nil, errors.New("removed"))
+	queryUp.DeleteLabelValues(instance)
+	queryDuration.DeletePartialMatch(prometheus.Labels{"instance_name": instance})
+	setTargetLabels(instance, nil)
+	return nil
+}
+
+// runningQueries returns the running targets sorted by instance
+func runningQueries() []*queryTarget {
+	queryTargetsMu.Lock()
+	defer queryTargetsMu.Unlock()
+	targets := make([]*queryTarget, 0, len(queryTargets))
+	for _, t := range queryTargets {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].instance < targets[j].instance })
+	return targets
+}
+
+// serverInfo is what a game server reported about itself
+type serverInfo struct {
+	name, mapName, game, version string
+	players, maxPlayers, bots    float64
+	latency                      time.Duration
+	rules                        map[string]string  // Configured rules the server reported
+	values                       map[string]float64 // Configured values for game_query_value
+}
+
+// playerInfo is one entry of a server's player list
+type playerInfo struct {
+	name      string
+	score     float64
+	connected time.Duration
+}
+
+// queryTarget is one queried game server and its exported state, to remove
+// series whose labels changed since the last query
+type queryTarget struct {
+	config       queryConfig
+	instance     string
+	protocol     string
+	querier      querier
+	maxStaleness time.Duration
+	stop         chan struct{} // Closed when the target is removed
+
+	mu       sync.Mutex // Held while querying and exporting
+	answered time.Time  // Last successful query
+	stale    bool       // Series dropped for being older than maxStaleness
+	removed  bool       // No longer queried, e.g. a scrape still running it
+
+	info    []string          // Labels of game_query_info
+	players map[string]bool   // Players with per-player series
+	rules   map[string]string // Exported rule values
+	values  map[string]bool   // Names with a game_query_value series
+}
+
+// Series of the instance that only exist while the server answers
+var queryInstanceVecs = []*prometheus.GaugeVec{queryLatency, queryInfo, queryPlayersOnline, queryPlayersMax, queryBots, queryPlayerScore, queryPlayerConnected, queryRuleInfo, queryValue}
+
+// set exports a successful query, or clears the instance's series when it
+// failed
+func (t *queryTarget) set(info *serverInfo, players []playerInfo, err error) {
+	if err != nil {
+		for _, g := range queryInstanceVecs {
+			g.DeletePartialMatch(prometheus.Labels{"instance_name": t.instance})
+		}
+		t.info, t.players, t.rules, t.values = nil, nil, nil, nil
+		queryUp.WithLabelValues(t.instance).Set(0)
+		return
+	}
+	queryUp.WithLabelValues(t.instance).Set(1)
+	queryLatency.WithLabelValues(t.instance).Set(info.latency.Seconds())
+	queryPlayersOnline.WithLabelValues(t.instance).Set(info.players)
+	queryBots.WithLabelValues(t.instance).Set(info.bots)
+	// Protocols that only count players don't know the slots or server info
+	if info.maxPlayers > 0 {
+		queryPlayersMax.WithLabelValues(t.instance).Set(info.maxPlayers)
+	}
+
+	labels := []string{t.instance, info.name, info.mapName, info.game, info.version}
+	if t.info != nil && !slices.Equal(t.info, labels) {
+		queryInfo.DeleteLabelValues(t.info...)
+	}
+	t.info = nil
+	if info.name != "" || info.mapName != "" || info.game != "" || info.version != "" {
+		queryInfo.WithLabelValues(labels...).Set(1)
+		t.info = labels
+	}
+
+	for rule, value := range t.rules {
+		if info.rules[rule] != value {
+			queryRuleInfo.DeleteLabelValues(t.instance, rule, value)
+		}
+	}
+	for rule, value := range info.rules {
+		queryRuleInfo.WithLabelValues(t.instance, rule, value).Set(1)
+	}
+	t.rules = info.rules
+
+	for name := range t.values {
+		if _, ok := info.values[name]; !ok {
+			queryValue.DeleteLabelValues(t.instance, name)
+		}
+	}
+	t.values = make(map[string]bool)
+	for name, value := range info.values {
+		queryValue.WithLabelValues(t.instance, name).Set(value)
+		t.values[name] = true
+	}
+
+	t.setPlayers(players)
+}
+
+// setPlayers exports the per-player metrics, capped at --collector.query.max-players
+func (t *queryTarget) setPlayers(players []playerInfo) {
+	seen := make(map[string]bool)
+	for _, p := range players {
+		if len(seen) >= *queryMaxPlayers {
+			break
+		}
+		// Players still connecting have no name yet
+		if p.name == "" || seen[p.name] {
+			continue
+		}
+		seen[p.name] = true
+		queryPlayerScore.WithLabelValues(t.instance, p.name).Set(p.score)
+		queryPlayerConnected.WithLabelValues(t.instance, p.name).Set(p.connected.Seconds())
+	}
+	for name := range t.players {
+		if !seen[name] {
+			queryPlayerScore.DeleteLabelValues(t.instance, name)
+			queryPlayerConnected.DeleteLabelValues(t.instance, name)
+		}
+	}
+	t.players = seen
+}
+
+// run queries the server once and exports the result. traceID is the trace
+// of the scrape running the query, if any.
+func (t *queryTarget) run(traceID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.removed {
+		return
+	}
+	start := time.Now()
+	info, players, err := t.querier.query()
+	observeQuery(t.protocol, t.instance, time.Since(start), err, traceID)
+	if err != nil {
+		log.Println("Error querying", t.instance+":", err)
+	} else {
+		t.answered = time.Now()
+	}
+	// A failed query drops the series too
+	t.stale = err != nil
+	t.set(info, players, err)
+}
+
+// expire drops the series once the last answer is older than maxStaleness.
+// A query in progress ends within its timeout, so it isn't waited for.
+func (t *queryTarget) expire() {
+	if !t.mu.TryLock() {
+		return
+	}
+	defer t.mu.Unlock()
+	if t.removed || t.stale || t.answered.IsZero() || time.Since(t.answered) <= t.maxStaleness {
+		return
+	}
+	log.Println("Dropping stale query results of", t.instance)
+	t.set(nil, nil, errors.New("stale"))
+	t.stale = true
+}
+
+// observeQuery records the duration of a query, failed ones included, with
+// an exemplar of the instance, the result and the trace of the scrape that
+// ran it, if it was traced. Exemplars are exposed to OpenMetrics scrapes.
+func observeQuery(protocol, instance string, elapsed time.Duration, err error, traceID string) {
+	exemplar := prometheus.Labels{"instance_name": instance, "result": "success"}
+	if err != nil {
+		exemplar["result"] = "failure"
+	}
+	if traceID != "" {
+		exemplar["trace_id"] = traceID
+	}
+	queryDuration.WithLabelValues(protocol, instance).(prometheus.ExemplarObserver).ObserveWithExemplar(elapsed.Seconds(), exemplar)
+}
+
+// requestTraceID returns the trace ID of a W3C traceparent header, set by
+// scrapers with tracing enabled, or "" without a valid one
+func requestTraceID(r *http.Request) string {
+	// version-traceid-parentid-flags, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || parts[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil {
+		return ""
+	}
+	return strings.ToLower(parts[1])
+}
+
+// runQueries queries one game server every interval
+func runQueries(t *queryTarget) {
+	for {
+		t.run("")
+		select {
+		case <-t.stop:
+			return
+		case <-time.After(*queryInterval):
+		}
+	}
+}
+
+// queryGatherer runs the scrape time queries and drops stale results before
+// gathering
+type queryGatherer struct {
+	prometheus.Gatherer
+	lastResults bool   // Serve the last results of scrape time queries instead
+	traceID     string // Trace of the scrape, for the exemplars of its queries
+}
+
+func (g queryGatherer) Gather() ([]*dto.MetricFamily, error) {
+	targets := runningQueries()
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		if g.lastResults || t.config.Mode != "scrape" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.run(g.traceID)
+		}()
+	}
+	wg.Wait()
+	for _, t := range targets {
+		if t.config.Mode != "scrape" && t.maxStaleness > 0 {
+			t.expire()
+		}
+	}
+	return g.Gatherer.Gather()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidateQueries(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "valid targets",
+			config: `
+- {instance: cs2, protocol: a2s, address: "127.0.0.1:27015", rules: [sv_maxrate]}
+- {instance: mc, protocol: minecraft, address: "127.0.0.1:25565", rcon_address: "127.0.0.1:25575", rcon_password: secret}
+- {instance: bedrock, protocol: raknet, address: "127.0.0.1:19132"}
+- {instance: status, protocol: http-json, url: "http://127.0.0.1/status", values: [{name: tick, path: server.tick}], mode: scrape}
+`,
+		},
+		{
+			name:    "missing instance",
+			config:  `[{protocol: a2s, address: "127.0.0.1:27015"}]`,
+			wantErr: "need an instance",
+		},
+		{
+			name:    "unknown protocol",
+			config:  `[{instance: x, protocol: gopher}]`,
+			wantErr: `unknown protocol "gopher"`,
+		},
+		{
+			name:    "a2s without address",
+			config:  `[{instance: x, protocol: a2s}]`,
+			wantErr: "address is required",
+		},
+		{
+			name:    "a2s address without port",
+			config:  `[{instance: x, protocol: a2s, address: 127.0.0.1}]`,
+			wantErr: "missing port",
+		},
+		{
+			name: "instance defined twice",
+			config: `
+- {instance: x, protocol: a2s, address: "127.0.0.1:27015"}
+- {instance: x, protocol: a2s, address: "127.0.0.1:27016"}
+`,
+			wantErr: "defined twice",
+		},
+		{
+			name:    "bad mode",
+			config:  `[{instance: x, protocol: a2s, address: "127.0.0.1:27015", mode: sometimes}]`,
+			wantErr: "mode must be",
+		},
+		{
+			name:    "max_staleness of a scrape target",
+			config:  `[{instance: x, protocol: a2s, address: "127.0.0.1:27015", mode: scrape, max_staleness: 1m}]`,
+			wantErr: "max_staleness is for background targets",
+		},
+		{
+			name:    "minecraft rcon without password",
+			config:  `[{instance: x, protocol: minecraft, address: "127.0.0.1:25565", rcon_address: "127.0.0.1:25575"}]`,
+			wantErr: "go together",
+		},
+		{
+			name:    "minecraft unknown edition",
+			config:  `[{instance: x, protocol: minecraft, address: "127.0.0.1:25565", edition: pocket}]`,
+			wantErr: `unknown edition "pocket"`,
+		},
+		{
+			name:    "raknet java edition",
+			config:  `[{instance: x, protocol: raknet, address: "127.0.0.1:19132", edition: java}]`,
+			wantErr: "Bedrock edition",
+		},
+		{
+			name:    "http-json without scheme",
+			config:  `[{instance: x, protocol: http-json, url: "127.0.0.1/status"}]`,
+			wantErr: "http or https URL",
+		},
+		{
+			name:    "http-json value without path",
+			config:  `[{instance: x, protocol: http-json, url: "http://127.0.0.1/", values: [{name: tick}]}]`,
+			wantErr: `value "tick" needs a path`,
+		},
+		{
+			name:    "http-json value defined twice",
+			config:  `[{instance: x, protocol: http-json, url: "http://127.0.0.1/", values: [{name: a, path: a}, {name: a, path: b}]}]`,
+			wantErr: `value "a" defined twice`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var configs []queryConfig
+			if err := yaml.Unmarshal([]byte(tt.config), &configs); err != nil {
+				t.Fatal(err)
+			}
+			err := validateQueries(configs)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("validateQueries() = %v, want no error", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("validateQueries() = %v, want an error with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// withQueryDuration creates an unregistered queryDuration for the test, as
+// registerQueryDuration only runs in main
+func withQueryDuration(t *testing.T) {
+	old := queryDuration
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "game_query_duration_seconds"}, []string{"protocol", "instance_name"})
+	t.Cleanup(func() { queryDuration = old })
+}
+
+func TestObserveQueryExemplar(t *testing.T) {
+	withQueryDuration(t)
+
+	tests := []struct {
+		traceparent string
+		err         error
+		want        map[string]string
+	}{
+		{
+			traceparent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			want:        map[string]string{"instance_name": "exemplar-test", "result": "success", "trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"},
+		},
+		{
+			traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			err:         errors.New("timeout"),
+			want:        map[string]string{"instance_name": "exemplar-test", "result": "failure"},
+		},
+		{
+			traceparent: "00-not-hex",
+			want:        map[string]string{"instance_name": "exemplar-test", "result": "success"},
+		},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		r.Header.Set("traceparent", tt.traceparent)
+		observeQuery("test", "exemplar-test", 10*time.Millisecond, tt.err, requestTraceID(r))
+
+		m := &dto.Metric{}
+		if err := queryDuration.WithLabelValues("test", "exemplar-test").(prometheus.Metric).Write(m); err != nil {
+			t.Fatal(err)
+		}
+		var exemplar *dto.Exemplar
+		for _, b := range m.GetHistogram().GetBucket() {
+			if b.GetExemplar() != nil {
+				exemplar = b.GetExemplar()
+				break
+			}
+		}
+		got := make(map[string]string)
+		for _, l := range exemplar.GetLabel() {
+			got[l.GetName()] = l.GetValue()
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("traceparent %q: exemplar labels %v, want %v", tt.traceparent, got, tt.want)
+		}
+	}
+}
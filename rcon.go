@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// rconConfig is the options of an rcon target, a game with a Source RCON
+// console (Source games, Rust, ARK, Palworld, Minecraft). The command's output
+// is matched like a telnet console's.
+type rconConfig struct {
+	Address    string             `yaml:"address"`
+	Command    string             `yaml:"command"`
+	Players    string             `yaml:"players"`     // Pattern of the player count for game_query_players
+	MaxPlayers string             `yaml:"max_players"` // Pattern of the slots for game_query_max_players
+	Values     []queryValueConfig `yaml:"values"`
+}
+
+func init() {
+	registerQueryDriver("rcon", func(target queryConfig) (querier, error) {
+		var c rconConfig
+		if err := target.decodeOptions(&c); err != nil {
+			return nil, err
+		}
+		if c.Address == "" || target.Password == "" || c.Command == "" {
+			return nil, errors.New("address, password and command are required")
+		}
+		patterns, err := newOutputPatterns(c.Players, c.MaxPlayers, c.Values)
+		if err != nil {
+			return nil, err
+		}
+		return &rconQuerier{
+			client:   &rconClient{address: c.Address, password: target.Password, timeout: target.timeout()},
+			command:  c.Command,
+			patterns: patterns,
+		}, nil
+	})
+}
+
+// rconQuerier runs a command over RCON; its round trip is the latency
+type rconQuerier struct {
+	client   *rconClient
+	command  string
+	patterns *outputPatterns
+}
+
+func (q *rconQuerier) query() (*serverInfo, []playerInfo, error) {
+	if q.client.conn == nil {
+		if err := q.client.connect(); err != nil {
+			q.client.close()
+			return nil, nil, err
+		}
+	}
+	start := time.Now()
+	out, err := q.client.command(q.command)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := &serverInfo{latency: time.Since(start)}
+	q.patterns.apply(info, []byte(out))
+	return info, nil, nil
+}
+
+// Source RCON packet types, also used by Minecraft
+const (
+	rconAuth          = 3
+	rconExecCommand   = 2
+	rconResponseValue = 0
+)
+
+// rconClient is a Source RCON connection, kept open between queries so game
+// servers don't log a new client every interval
+type rconClient struct {
+	address  string
+	password string
+	timeout  time.Duration
+	conn     net.Conn
+	id       int32
+}
+
+// write sends one packet: length, request ID, type, body and two NULs
+func (c *rconClient) write(packetType int32, body string) (int32, error) {
+	c.id++
+	packet := binary.LittleEndian.AppendUint32(nil, uint32(10+len(body)))
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(c.id))
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(packetType))
+	packet = append(packet, body...)
+	packet = append(packet, 0, 0)
+	_, err := c.conn.Write(packet)
+	return c.id, err
+}
+
+// read reads one packet and returns its request ID, type and body
+func (c *rconClient) read() (int32, int32, string, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(c.conn, header[:]); err != nil {
+		return 0, 0, "", err
+	}
+	length := int(binary.LittleEndian.Uint32(header[0:4]))
+	if length < 10 || length > 1<<20 {
+		return 0, 0, "", fmt.Errorf("invalid RCON packet length %d", length)
+	}
+	body := make([]byte, length-8)
+	if _, err := io.ReadFull(c.conn, body); err != nil {
+		return 0, 0, "", err
+	}
+	id := int32(binary.LittleEndian.Uint32(header[4:8]))
+	packetType := int32(binary.LittleEndian.Uint32(header[8:12]))
+	return id, packetType, string(body[:len(body)-2]), nil
+}
+
+// connect opens the connection and authenticates
+func (c *rconClient) connect() error {
+	conn, err := net.DialTimeout("tcp", c.address, c.timeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	id, err := c.write(rconAuth, c.password)
+	if err != nil {
+		return err
+	}
+	// Source servers send an empty response value before the auth response
+	for {
+		replyID, packetType, _, err := c.read()
+		if err != nil {
+			return err
+		}
+		if packetType != rconExecCommand {
+			continue
+		}
+		if replyID == -1 || replyID != id {
+			return errors.New("RCON authentication failed")
+		}
+		return nil
+	}
+}
+
+// command runs a console command and returns its output, reconnecting if
+// the connection was lost
+func (c *rconClient) command(cmd string) (string, error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			c.close()
+			return "", err
+		}
+	}
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	id, err := c.write(rconExecCommand, cmd)
+	if err != nil {
+		c.close()
+		return "", err
+	}
+	for {
+		replyID, packetType, body, err := c.read()
+		if err != nil {
+			c.close()
+			return "", err
+		}
+		if replyID == id && packetType == rconResponseValue {
+			return body, nil
+		}
+	}
+}
+
+func (c *rconClient) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
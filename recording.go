@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// recordingRuleConfig defines a gauge game_recorded_<name> aggregating each
+// matching series over a rolling window, e.g. the 5m average tick rate, for
+// dashboards fed by systems that can't run PromQL
+type recordingRuleConfig struct {
+	Name           string `yaml:"name"`
+	metricSelector `yaml:",inline"`
+	Function       string        `yaml:"function"` // avg, min, max or rate
+	Window         time.Duration `yaml:"window"`
+}
+
+// recordingRule keeps the samples of the rule's series within its window,
+// by the series' formatted labels
+type recordingRule struct {
+	recordingRuleConfig
+	desc   string
+	series map[string]*recordedSeries
+}
+
+type recordedSeries struct {
+	labels map[string]string
+	window sampleWindow
+}
+
+var (
+	recordingMu    sync.Mutex
+	recordingRules []*recordingRule
+)
+
+func validateRecordingRules(configs []recordingRuleConfig) error {
+	names := make(map[string]bool)
+	for _, c := range configs {
+		if c.Name == "" || c.Metric == "" {
+			return errors.New("recording_rules: name and metric are required")
+		}
+		if !model.IsValidLegacyMetricName("game_recorded_" + c.Name) {
+			return fmt.Errorf("recording rule %q: invalid name", c.Name)
+		}
+		if !slices.Contains([]string{"avg", "min", "max", "rate"}, c.Function) {
+			return fmt.Errorf("recording rule %q: function must be avg, min, max or rate", c.Name)
+		}
+		if c.Window <= 0 {
+			return fmt.Errorf("recording rule %q: window is required", c.Name)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("recording rule %q defined twice", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return nil
+}
+
+// Set up the recording rules; their series are exported by a collector, as
+// the labels are those of the source series
+func registerRecordingRules(configs []recordingRuleConfig) {
+	if len(configs) == 0 {
+		return
+	}
+	for _, c := range configs {
+		recordingRules = append(recordingRules, &recordingRule{
+			recordingRuleConfig: c,
+			desc:                fmt.Sprintf("%s of %s over %s", c.Function, formatSeries(c.Metric, c.Labels), c.Window),
+			series:              make(map[string]*recordedSeries),
+		})
+	}
+	prometheus.MustRegister(recordingCollector{})
+}
+
+// Add the current values to the windows; series gone for a whole window are
+// forgotten
+func updateRecordingRules(families []*dto.MetricFamily) {
+	recordingMu.Lock()
+	defer recordingMu.Unlock()
+	now := time.Now()
+	for _, r := range recordingRules {
+		seen := make(map[string]bool)
+		for _, s := range r.selectSamples(families) {
+			key := formatSeries("", s.labels)
+			series, ok := r.series[key]
+			if !ok {
+				series = &recordedSeries{labels: s.labels}
+				r.series[key] = series
+			}
+			series.window.addWithin(now, s.value, r.Window)
+			seen[key] = true
+		}
+		for key, series := range r.series {
+			if seen[key] {
+				continue
+			}
+			series.window.trim(now.Add(-r.Window))
+			if len(series.window.samples) == 0 {
+				delete(r.series, key)
+			}
+		}
+	}
+}
+
+// value aggregates the window, false if there are too few samples
+func (r *recordingRule) value(w sampleWindow) (float64, bool) {
+	if len(w.samples) == 0 {
+		return 0, false
+	}
+	min, max, avg := w.stats()
+	switch r.Function {
+	case "min":
+		return min, true
+	case "max":
+		return max, true
+	case "rate":
+		return counterRate(w.samples)
+	}
+	return avg, true
+}
+
+// counterRate is the per-second increase of a counter over the samples,
+// treating a decrease as a reset to 0
+func counterRate(samples []timedValue) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	var increase float64
+	for i := 1; i < len(samples); i++ {
+		delta := samples[i].value - samples[i-1].value
+		if delta < 0 {
+			delta = samples[i].value
+		}
+		increase += delta
+	}
+	elapsed := samples[len(samples)-1].at.Sub(samples[0].at).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return increase / elapsed, true
+}
+
+// recordingCollector exports the recording rules' series. It is unchecked,
+// as the labels are only known at runtime.
+type recordingCollector struct{}
+
+func (recordingCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (recordingCollector) Collect(ch chan<- prometheus.Metric) {
+	recordingMu.Lock()
+	defer recordingMu.Unlock()
+	for _, r := range recordingRules {
+		for _, series := range r.series {
+			value, ok := r.value(series.window)
+			if !ok {
+				continue
+			}
+			names := make([]string, 0, len(series.labels))
+			for name := range series.labels {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			values := make([]string, len(names))
+			for i, name := range names {
+				values[i] = series.labels[name]
+			}
+			desc := prometheus.NewDesc("game_recorded_"+r.Name, r.desc, names, nil)
+			metric, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, value, values...)
+			if err != nil {
+				log.Println("Error exporting recording rule", r.Name+":", err)
+				continue
+			}
+			ch <- metric
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/proto"
+)
+
+// relabelConfig is a rule of the relabel config section, like Prometheus'
+// metric_relabel_configs, applied to the series before exposition. The
+// metric name is the __name__ label.
+type relabelConfig struct {
+	// replace (default), keep, drop, labelmap, labeldrop or labelkeep
+	Action       string   `yaml:"action"`
+	SourceLabels []string `yaml:"source_labels"`
+	Separator    *string  `yaml:"separator"` // Default ;
+	Regex        *string  `yaml:"regex"`     // Anchored, default (.*)
+	TargetLabel  string   `yaml:"target_label"`
+	Replacement  *string  `yaml:"replacement"` // Default $1
+}
+
+// relabelRule is a relabelConfig with its defaults and compiled regexp
+type relabelRule struct {
+	action       string
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	targetLabel  string
+	replacement  string
+}
+
+var relabelRules []relabelRule
+
+func validateRelabeling(configs []relabelConfig) error {
+	for i, c := range configs {
+		if _, err := newRelabelRule(c); err != nil {
+			return fmt.Errorf("relabel %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func newRelabelRule(c relabelConfig) (relabelRule, error) {
+	r := relabelRule{action: c.Action, sourceLabels: c.SourceLabels, separator: ";", targetLabel: c.TargetLabel, replacement: "$1"}
+	if r.action == "" {
+		r.action = "replace"
+	}
+	if c.Separator != nil {
+		r.separator = *c.Separator
+	}
+	if c.Replacement != nil {
+		r.replacement = *c.Replacement
+	}
+	pattern := "(.*)"
+	if c.Regex != nil {
+		pattern = *c.Regex
+	}
+	var err error
+	if r.regex, err = regexp.Compile("^(?:" + pattern + ")$"); err != nil {
+		return r, err
+	}
+	switch r.action {
+	case "replace":
+		if r.targetLabel == "" {
+			return r, errors.New("replace needs a target_label")
+		}
+		if !model.LabelName(r.targetLabel).IsValidLegacy() {
+			return r, fmt.Errorf("invalid target_label %q", r.targetLabel)
+		}
+	case "keep", "drop":
+		if len(r.sourceLabels) == 0 {
+			return r, fmt.Errorf("%s needs source_labels", r.action)
+		}
+	case "labelmap", "labeldrop", "labelkeep":
+	default:
+		return r, fmt.Errorf("unknown action %q", r.action)
+	}
+	return r, nil
+}
+
+// setupRelabeling compiles the validated rules
+func setupRelabeling(configs []relabelConfig) {
+	for _, c := range configs {
+		r, _ := newRelabelRule(c)
+		relabelRules = append(relabelRules, r)
+	}
+}
+
+// apply relabels a series' labels in place and tells whether it's kept
+func (r relabelRule) apply(labels map[string]string) bool {
+	values := make([]string, len(r.sourceLabels))
+	for i, name := range r.sourceLabels {
+		values[i] = labels[name]
+	}
+	value := strings.Join(values, r.separator)
+	switch r.action {
+	case "keep":
+		return r.regex.MatchString(value)
+	case "drop":
+		return !r.regex.MatchString(value)
+	case "replace":
+		m := r.regex.FindStringSubmatchIndex(value)
+		if m == nil {
+			return true
+		}
+		result := string(r.regex.ExpandString(nil, r.replacement, value, m))
+		if result == "" {
+			delete(labels, r.targetLabel)
+		} else {
+			labels[r.targetLabel] = result
+		}
+	case "labelmap":
+		for name, v := range maps.Clone(labels) {
+			if m := r.regex.FindStringSubmatchIndex(name); m != nil && name != model.MetricNameLabel {
+				labels[string(r.regex.ExpandString(nil, r.replacement, name, m))] = v
+			}
+		}
+	case "labeldrop", "labelkeep":
+		for name := range maps.Clone(labels) {
+			if name != model.MetricNameLabel && r.regex.MatchString(name) == (r.action == "labeldrop") {
+				delete(labels, name)
+			}
+		}
+	}
+	return true
+}
+
+// relabelGatherer applies the relabel rules to copies of the gathered series.
+// Series renamed into another family join it if the types match and are
+// dropped otherwise; series that end up with the same labels are merged, the
+// first is kept.
+type relabelGatherer struct {
+	prometheus.Gatherer
+}
+
+func (g relabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	if len(relabelRules) == 0 {
+		return families, err
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	seen := make(map[string]bool)
+	var result []*dto.MetricFamily
+	for _, f := range families {
+		for _, m := range f.Metric {
+			labels := map[string]string{model.MetricNameLabel: f.GetName()}
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if slices.ContainsFunc(relabelRules, func(r relabelRule) bool { return !r.apply(labels) }) {
+				continue
+			}
+			name := labels[model.MetricNameLabel]
+			delete(labels, model.MetricNameLabel)
+			if !model.IsValidLegacyMetricName(name) {
+				continue
+			}
+			target := byName[name]
+			if target == nil {
+				target = &dto.MetricFamily{Name: proto.String(name), Help: f.Help, Type: f.Type, Unit: f.Unit}
+				byName[name] = target
+				result = append(result, target)
+			} else if target.GetType() != f.GetType() {
+				continue
+			}
+			key := formatSeries(name, labels)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			relabeled := proto.Clone(m).(*dto.Metric)
+			relabeled.Label = relabeledPairs(labels)
+			target.Metric = append(target.Metric, relabeled)
+		}
+	}
+	result = slices.DeleteFunc(result, func(f *dto.MetricFamily) bool { return len(f.Metric) == 0 })
+	sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+	return result, err
+}
+
+func relabeledPairs(labels map[string]string) []*dto.LabelPair {
+	pairs := make([]*dto.LabelPair, 0, len(labels))
+	for name, value := range labels {
+		if model.LabelName(name).IsValidLegacy() && value != "" {
+			pairs = append(pairs, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].GetName() < pairs[j].GetName() })
+	return pairs
+}
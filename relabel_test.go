@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+// withRelabeling sets the relabel rules of a relabel config section for the
+// test
+func withRelabeling(t *testing.T, config string) {
+	t.Helper()
+	var configs []relabelConfig
+	if err := yaml.Unmarshal([]byte(config), &configs); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateRelabeling(configs); err != nil {
+		t.Fatal(err)
+	}
+	old := relabelRules
+	relabelRules = nil
+	setupRelabeling(configs)
+	t.Cleanup(func() { relabelRules = old })
+}
+
+// gatheredSeries returns the gathered gauge series as "name{labels} value"
+func gatheredSeries(t *testing.T, g prometheus.Gatherer) []string {
+	t.Helper()
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var series []string
+	for _, f := range families {
+		for _, m := range f.Metric {
+			labels := make(map[string]string)
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			series = append(series, fmt.Sprintf("%s %g", formatSeries(f.GetName(), labels), m.GetGauge().GetValue()))
+		}
+	}
+	slices.Sort(series)
+	return series
+}
+
+func TestRelabelGatherer(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	disk := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "game_test_disk_usage_percent", Help: "test"}, []string{"partition"})
+	players := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "game_test_players", Help: "test"}, []string{"instance_name"})
+	registry.MustRegister(disk, players)
+	disk.WithLabelValues("/").Set(50)
+	disk.WithLabelValues("/var/lib/docker").Set(10)
+	players.WithLabelValues("survival").Set(3)
+	original := gatheredSeries(t, registry)
+
+	tests := []struct {
+		name, config string
+		want         []string
+	}{
+		{"none", `[]`, original},
+		{"replace name", `
+- source_labels: [__name__]
+  regex: game_test_(.*)
+  target_label: __name__
+  replacement: game_$1
+`, []string{
+			`game_disk_usage_percent{partition="/"} 50`,
+			`game_disk_usage_percent{partition="/var/lib/docker"} 10`,
+			`game_players{instance_name="survival"} 3`,
+		}},
+		{"replace label", `
+- source_labels: [partition]
+  regex: /(.+)
+  target_label: mount
+`, []string{
+			`game_test_disk_usage_percent{mount="var/lib/docker",partition="/var/lib/docker"} 10`,
+			`game_test_disk_usage_percent{partition="/"} 50`,
+			`game_test_players{instance_name="survival"} 3`,
+		}},
+		{"replace empty deletes", `
+- source_labels: [__name__]
+  regex: game_test_players
+  target_label: instance_name
+  replacement: ""
+`, []string{
+			`game_test_disk_usage_percent{partition="/"} 50`,
+			`game_test_disk_usage_percent{partition="/var/lib/docker"} 10`,
+			`game_test_players 3`,
+		}},
+		{"keep", `
+- action: keep
+  source_labels: [__name__]
+  regex: game_test_disk_.*
+`, []string{
+			`game_test_disk_usage_percent{partition="/"} 50`,
+			`game_test_disk_usage_percent{partition="/var/lib/docker"} 10`,
+		}},
+		{"drop", `
+- action: drop
+  source_labels: [__name__, partition]
+  regex: game_test_disk_usage_percent;/var/.*
+`, []string{
+			`game_test_disk_usage_percent{partition="/"} 50`,
+			`game_test_players{instance_name="survival"} 3`,
+		}},
+		{"labelmap", `
+- action: labelmap
+  regex: instance_(.*)
+  replacement: server_$1
+`, []string{
+			`game_test_disk_usage_percent{partition="/"} 50`,
+			`game_test_disk_usage_percent{partition="/var/lib/docker"} 10`,
+			`game_test_players{instance_name="survival",server_name="survival"} 3`,
+		}},
+		{"merge into one series", `
+- action: labeldrop
+  regex: partition
+`, []string{
+			`game_test_disk_usage_percent 50`,
+			`game_test_players{instance_name="survival"} 3`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withRelabeling(t, tt.config)
+			if got := gatheredSeries(t, relabelGatherer{registry}); !slices.Equal(got, tt.want) {
+				t.Errorf("series = %q, want %q", got, tt.want)
+			}
+			if got := gatheredSeries(t, registry); !slices.Equal(got, original) {
+				t.Errorf("source series = %q, want them unchanged %q", got, original)
+			}
+		})
+	}
+}
+
+func TestRelabelHandlers(t *testing.T) {
+	withRelabeling(t, `
+- source_labels: [__name__]
+  regex: game_cpu_usage_percent
+  target_label: tier
+  replacement: fast
+- action: drop
+  source_labels: [__name__]
+  regex: game_system_load
+`)
+	cpuUsage.Set(42)
+	systemLoad.WithLabelValues("1m").Set(0.5)
+	t.Cleanup(systemLoad.Reset)
+
+	for path, handler := range map[string]http.Handler{
+		"/metrics":      metricsHandler(),
+		"/metrics/fast": fastMetricsHandler(),
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		body := w.Body.String()
+		if !strings.Contains(body, "\ngame_cpu_usage_percent{tier=\"fast\"} 42\n") {
+			t.Errorf("%s has no relabeled game_cpu_usage_percent series:\n%s", path, body)
+		}
+		if strings.Contains(body, "\ngame_system_load{") {
+			t.Errorf("%s has the dropped game_system_load series:\n%s", path, body)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// route is one entry of the routing tables, as listed by
+// "ip route show table all"
+type route struct {
+	family    string // ipv4 or ipv6
+	table     uint32
+	routeType string // unicast, blackhole, unreachable, ...
+	dstLen    int
+}
+
+var (
+	routeDefault = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_route_default",
+		Help: "Whether there is a unicast default route in any routing table",
+	}, []string{"family"})
+	routeCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_routes",
+		Help: "Routes per routing table and route type, e.g. blackhole and unreachable routes",
+	}, []string{"family", "table", "type"})
+)
+
+func init() {
+	prometheus.MustRegister(routeDefault)
+	prometheus.MustRegister(routeCount)
+}
+
+// Names of the reserved routing tables, as in /etc/iproute2/rt_tables
+var routeTableNames = map[uint32]string{253: "default", 254: "main", 255: "local"}
+
+var routeSeries = newSeriesGeneration()
+
+// Collect default route presence and route counts
+func updateRouteMetrics() {
+	defer routeSeries.sweep()
+	routes, err := listRoutes()
+	if err != nil {
+		logCollectorError("routes", "Error listing routes:", err)
+		return
+	}
+	defaults := map[string]float64{"ipv4": 0, "ipv6": 0}
+	counts := make(map[[3]string]float64)
+	for _, r := range routes {
+		table, ok := routeTableNames[r.table]
+		if !ok {
+			table = strconv.FormatUint(uint64(r.table), 10)
+		}
+		counts[[3]string{r.family, table, r.routeType}]++
+		if r.dstLen == 0 && r.routeType == "unicast" {
+			defaults[r.family] = 1
+		}
+	}
+	for family, present := range defaults {
+		routeSeries.set(routeDefault, present, family)
+	}
+	for labels, n := range counts {
+		routeSeries.set(routeCount, n, labels[:]...)
+	}
+}
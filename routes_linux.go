@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/binary"
+	"syscall"
+	"unsafe"
+)
+
+// Route types of rtmsg, from linux/rtnetlink.h
+var routeTypes = map[uint8]string{
+	syscall.RTN_UNICAST:     "unicast",
+	syscall.RTN_LOCAL:       "local",
+	syscall.RTN_BROADCAST:   "broadcast",
+	syscall.RTN_ANYCAST:     "anycast",
+	syscall.RTN_MULTICAST:   "multicast",
+	syscall.RTN_BLACKHOLE:   "blackhole",
+	syscall.RTN_UNREACHABLE: "unreachable",
+	syscall.RTN_PROHIBIT:    "prohibit",
+	syscall.RTN_THROW:       "throw",
+	syscall.RTN_NAT:         "nat",
+}
+
+// listRoutes dumps the routes of all tables over rtnetlink
+func listRoutes() ([]route, error) {
+	data, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	var routes []route
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWROUTE || len(m.Data) < syscall.SizeofRtMsg {
+			continue
+		}
+		msg := (*syscall.RtMsg)(unsafe.Pointer(&m.Data[0]))
+		r := route{table: uint32(msg.Table), dstLen: int(msg.Dst_len), routeType: routeTypes[msg.Type]}
+		switch msg.Family {
+		case syscall.AF_INET:
+			r.family = "ipv4"
+		case syscall.AF_INET6:
+			r.family = "ipv6"
+		default:
+			continue
+		}
+		if r.routeType == "" {
+			continue
+		}
+		// Tables above 255 are only in the RTA_TABLE attribute
+		attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range attrs {
+			if a.Attr.Type == syscall.RTA_TABLE && len(a.Value) >= 4 {
+				r.table = binary.NativeEndian.Uint32(a.Value)
+			}
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Bursty metrics are sampled more often than the collection cycle and
+// summarised over a window, so short spikes survive a 15s scrape
+var (
+	samplingInterval = flag.Duration("collector.sampling.interval", time.Second, "Interval for sub-interval sampling of CPU, network and disk rates (0 disables).")
+	samplingWindow   = flag.Duration("collector.sampling.window", 15*time.Second, "Window over which sampled rates are summarised as min/max/avg, usually the scrape interval.")
+)
+
+var (
+	cpuUsageMin = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "game_cpu_usage_percent_min",
+		Help: "Minimum CPU usage percentage sampled over the sampling window",
+	})
+	cpuUsageMax = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "game_cpu_usage_percent_max",
+		Help: "Maximum CPU usage percentage sampled over the sampling window",
+	})
+	cpuUsageAvg = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "game_cpu_usage_percent_avg",
+		Help: "Average CPU usage percentage sampled over the sampling window",
+	})
+	networkActivityMin = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_network_min",
+		Help: "Minimum network rate (bps, pps) sampled over the sampling window",
+	}, []string{"interface", "activity", "metric"})
+	networkActivityMax = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_network_max",
+		Help: "Maximum network rate (bps, pps) sampled over the sampling window",
+	}, []string{"interface", "activity", "metric"})
+	networkActivityAvg = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_network_avg",
+		Help: "Average network rate (bps, pps) sampled over the sampling window",
+	}, []string{"interface", "activity", "metric"})
+	diskActivityMin = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_disk_performance_min",
+		Help: "Minimum disk rate (bytes and operations per second) sampled over the sampling window",
+	}, []string{"device", "activity"})
+	diskActivityMax = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_disk_performance_max",
+		Help: "Maximum disk rate (bytes and operations per second) sampled over the sampling window",
+	}, []string{"device", "activity"})
+	diskActivityAvg = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_disk_performance_avg",
+		Help: "Average disk rate (bytes and operations per second) sampled over the sampling window",
+	}, []string{"device", "activity"})
+)
+
+func init() {
+	prometheus.MustRegister(cpuUsageMin)
+	prometheus.MustRegister(cpuUsageMax)
+	prometheus.MustRegister(cpuUsageAvg)
+	prometheus.MustRegister(networkActivityMin)
+	prometheus.MustRegister(networkActivityMax)
+	prometheus.MustRegister(networkActivityAvg)
+	prometheus.MustRegister(diskActivityMin)
+	prometheus.MustRegister(diskActivityMax)
+	prometheus.MustRegister(diskActivityAvg)
+}
+
+type timedValue struct {
+	at    time.Time
+	value float64
+}
+
+// sampleWindow keeps the samples of one series within the sampling window
+type sampleWindow struct {
+	samples []timedValue
+}
+
+func (w *sampleWindow) add(at time.Time, value float64) {
+	w.addWithin(at, value, *samplingWindow)
+}
+
+// addWithin adds a sample and drops the ones older than window
+func (w *sampleWindow) addWithin(at time.Time, value float64, window time.Duration) {
+	w.samples = append(w.samples, timedValue{at: at, value: value})
+	w.trim(at.Add(-window))
+}
+
+// trim drops the samples before cutoff
+func (w *sampleWindow) trim(cutoff time.Time) {
+	drop := 0
+	for drop < len(w.samples) && w.samples[drop].at.Before(cutoff) {
+		drop++
+	}
+	w.samples = w.samples[drop:]
+}
+
+func (w *sampleWindow) stats() (min, max, avg float64) {
+	if len(w.samples) == 0 {
+		return 0, 0, 0
+	}
+	min, max = w.samples[0].value, w.samples[0].value
+	var sum float64
+	for _, s := range w.samples {
+		if s.value < min {
+			min = s.value
+		}
+		if s.value > max {
+			max = s.value
+		}
+		sum += s.value
+	}
+	return min, max, sum / float64(len(w.samples))
+}
+
+// Read the aggregate busy and total CPU time from /proc/stat, in clock ticks
+func readCPUTimes() (busy, total float64, ok bool) {
+	data, err := os.ReadFile(procFilePath("stat"))
+	if err != nil {
+		logCollectorError("cpu", "Error reading /proc/stat:", err)
+		return 0, 0, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "cpu ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			return 0, 0, false
+		}
+		// user nice system idle iowait irq softirq steal; guest time is already in user
+		var idle float64
+		for i := 1; i < len(fields) && i <= 8; i++ {
+			v, _ := strconv.ParseFloat(fields[i], 64)
+			total += v
+			if i == 4 || i == 5 { // idle and iowait
+				idle += v
+			}
+		}
+		return total - idle, total, true
+	}
+	return 0, 0, false
+}
+
+// rawSample is a snapshot of the cumulative counters rates are derived from
+type rawSample struct {
+	at       time.Time
+	cpuBusy  float64
+	cpuTotal float64
+	network  map[string]map[string]float64
+	disk     map[string]map[string]float64
+}
+
+func takeRawSample() rawSample {
+	s := rawSample{at: time.Now(), network: getNetworkIO(), disk: getDiskPerformance()}
+	s.cpuBusy, s.cpuTotal, _ = readCPUTimes()
+	return s
+}
+
+// Latest raw sample, checkpointed to the state dir
+var (
+	lastSampleMu sync.Mutex
+	lastSample   rawSample
+)
+
+func setLastSample(s rawSample) {
+	lastSampleMu.Lock()
+	lastSample = s
+	lastSampleMu.Unlock()
+}
+
+// savedSample is a rawSample in sample.json
+type savedSample struct {
+	BootTime float64                       `json:"boot_time"`
+	At       time.Time                     `json:"at"`
+	CPUBusy  float64                       `json:"cpu_busy"`
+	CPUTotal float64                       `json:"cpu_total"`
+	Network  map[string]map[string]float64 `json:"network"`
+	Disk     map[string]map[string]float64 `json:"disk"`
+}
+
+func sampleFile() string {
+	return filepath.Join(*stateDir, "sample.json")
+}
+
+// saveSample checkpoints the latest raw sample
+func saveSample() error {
+	lastSampleMu.Lock()
+	s := lastSample
+	lastSampleMu.Unlock()
+	if s.at.IsZero() {
+		return nil
+	}
+	data, err := json.Marshal(savedSample{
+		BootTime: getBootTime(),
+		At:       s.at,
+		CPUBusy:  s.cpuBusy,
+		CPUTotal: s.cpuTotal,
+		Network:  s.network,
+		Disk:     s.disk,
+	})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(sampleFile(), data)
+}
+
+// restoreSample returns the checkpointed raw sample if it's from this boot.
+// The first rates after a restart then average over the downtime.
+func restoreSample() (rawSample, bool) {
+	if *stateDir == "" {
+		return rawSample{}, false
+	}
+	data, err := os.ReadFile(sampleFile())
+	if err != nil {
+		return rawSample{}, false
+	}
+	var saved savedSample
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Println("Error restoring sample:", err)
+		return rawSample{}, false
+	}
+	if saved.BootTime != getBootTime() {
+		return rawSample{}, false
+	}
+	return rawSample{at: saved.At, cpuBusy: saved.CPUBusy, cpuTotal: saved.CPUTotal, network: saved.Network, disk: saved.Disk}, true
+}
+
+// followsSample tells whether no counter of cur went back since prev, which
+// a restored sample needs to be used: counters of the same boot only go back
+// when an interface or device is re-created, or the clock jumped back
+func followsSample(prev, cur rawSample) bool {
+	if !cur.at.After(prev.at) || cur.cpuBusy < prev.cpuBusy || cur.cpuTotal < prev.cpuTotal {
+		return false
+	}
+	for _, counters := range []struct{ prev, cur map[string]map[string]float64 }{
+		{prev.network, cur.network},
+		{prev.disk, cur.disk},
+	} {
+		for name, values := range counters.cur {
+			for counter, v := range values {
+				if old, ok := counters.prev[name][counter]; ok && v < old {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// Sample CPU and network rates every sampling interval
+func runSampler() {
+	if *samplingInterval <= 0 || !procfsAvailable {
+		return
+	}
+	var cpuWindow sampleWindow
+	networkWindows := make(map[[3]string]*sampleWindow)
+	diskWindows := make(map[[2]string]*sampleWindow)
+
+	update := func(prev, cur rawSample) {
+		elapsed := cur.at.Sub(prev.at).Seconds()
+
+		if deltaTotal := cur.cpuTotal - prev.cpuTotal; deltaTotal > 0 {
+			cpuWindow.add(cur.at, (cur.cpuBusy-prev.cpuBusy)/deltaTotal*100)
+			min, max, avg := cpuWindow.stats()
+			cpuUsageMin.Set(min)
+			cpuUsageMax.Set(max)
+			cpuUsageAvg.Set(avg)
+		}
+
+		seen := make(map[[3]string]bool)
+		for iface, metrics := range cur.network {
+			prevMetrics, ok := prev.network[iface]
+			if !ok || elapsed <= 0 {
+				continue
+			}
+			for _, series := range []struct{ counter, activity, metric string }{
+				{"rx_bytes", "in", "bps"},
+				{"tx_bytes", "out", "bps"},
+				{"rx_packets", "in", "pps"},
+				{"tx_packets", "out", "pps"},
+			} {
+				key := [3]string{iface, series.activity, series.metric}
+				seen[key] = true
+				w, ok := networkWindows[key]
+				if !ok {
+					w = &sampleWindow{}
+					networkWindows[key] = w
+				}
+				delta := metrics[series.counter] - prevMetrics[series.counter]
+				if delta < 0 {
+					// Counter reset, e.g. interface re-created: start the
+					// window over, keeping the series until the next rate
+					w.samples = nil
+					continue
+				}
+				w.add(cur.at, delta/elapsed)
+				min, max, avg := w.stats()
+				networkActivityMin.WithLabelValues(key[:]...).Set(min)
+				networkActivityMax.WithLabelValues(key[:]...).Set(max)
+				networkActivityAvg.WithLabelValues(key[:]...).Set(avg)
+			}
+		}
+
+		// Forget interfaces that went away
+		for key := range networkWindows {
+			if seen[key] {
+				continue
+			}
+			delete(networkWindows, key)
+			networkActivityMin.DeleteLabelValues(key[:]...)
+			networkActivityMax.DeleteLabelValues(key[:]...)
+			networkActivityAvg.DeleteLabelValues(key[:]...)
+		}
+
+		seenDisks := make(map[[2]string]bool)
+		for device, metrics := range cur.disk {
+			prevMetrics, ok := prev.disk[device]
+			if !ok || elapsed <= 0 {
+				continue
+			}
+			for _, activity := range []string{"readbytes", "readiops", "writebytes", "writeiops"} {
+				key := [2]string{device, activity}
+				seenDisks[key] = true
+				w, ok := diskWindows[key]
+				if !ok {
+					w = &sampleWindow{}
+					diskWindows[key] = w
+				}
+				delta := metrics[activity] - prevMetrics[activity]
+				if delta < 0 {
+					// Counter reset, e.g. a device re-attached
+					w.samples = nil
+					continue
+				}
+				w.add(cur.at, delta/elapsed)
+				min, max, avg := w.stats()
+				diskActivityMin.WithLabelValues(key[:]...).Set(min)
+				diskActivityMax.WithLabelValues(key[:]...).Set(max)
+				diskActivityAvg.WithLabelValues(key[:]...).Set(avg)
+			}
+		}
+		for key := range diskWindows {
+			if seenDisks[key] {
+				continue
+			}
+			delete(diskWindows, key)
+			diskActivityMin.DeleteLabelValues(key[:]...)
+			diskActivityMax.DeleteLabelValues(key[:]...)
+			diskActivityAvg.DeleteLabelValues(key[:]...)
+		}
+		setLastSample(cur)
+	}
+
+	// A sample checkpointed before a restart gives rates right away
+	saved, restored := restoreSample()
+	prev := takeRawSample()
+	if restored && followsSample(saved, prev) {
+		update(saved, prev)
+	}
+	ticker := time.NewTicker(*samplingInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		cur := takeRawSample()
+		update(prev, cur)
+		prev = cur
+	}
+}
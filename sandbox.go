@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sandboxConfig is an entry of the sandbox config section, restricting the
+// commands the collectors and plugins run, so a broken or compromised helper
+// can't take down the game host
+type sandboxConfig struct {
+	Commands   []string      `yaml:"commands"` // Base names, default all commands
+	User       string        `yaml:"user"`     // Needs the exporter to run as root
+	CPUTime    time.Duration `yaml:"cpu_time"`
+	MemoryMB   uint64        `yaml:"memory_mb"` // Address space
+	Processes  uint64        `yaml:"processes"` // Of the user
+	OpenFiles  uint64        `yaml:"open_files"`
+	NoNewPrivs bool          `yaml:"no_new_privs"`
+	// Only keep PATH, the variables the collector sets and environment
+	CleanEnv bool `yaml:"clean_env"`
+	// NAME to keep with clean_env, NAME=value to set
+	Environment []string `yaml:"environment"`
+}
+
+// sandboxLimits are the rlimits of a command, 0 for unlimited
+type sandboxLimits struct {
+	cpuSeconds, memoryBytes, processes, openFiles uint64
+}
+
+// sandbox is a sandboxConfig with its user looked up
+type sandbox struct {
+	sandboxConfig
+	uid, gid int
+	groups   []int
+}
+
+// The subcommand the sandboxed commands are started through; it applies the
+// limits to itself and execs the command
+const sandboxSubcommand = "sandbox-exec"
+
+const sandboxPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+var sandboxes []sandbox
+
+func validateSandbox(configs []sandboxConfig) error {
+	if len(configs) > 0 && runtime.GOOS != "linux" {
+		return errors.New("sandbox: only supported on Linux")
+	}
+	for i, c := range configs {
+		if c.CPUTime < 0 || c.CPUTime > 0 && c.CPUTime < time.Second {
+			return fmt.Errorf("sandbox %d: cpu_time must be at least 1s", i)
+		}
+		for _, e := range c.Environment {
+			if name, _, _ := strings.Cut(e, "="); name == "" {
+				return fmt.Errorf("sandbox %d: invalid environment entry %q", i, e)
+			}
+		}
+	}
+	return nil
+}
+
+// setupSandbox looks up the users of the sandboxes
+func setupSandbox(configs []sandboxConfig) error {
+	sandboxes = nil
+	for _, c := range configs {
+		s := sandbox{sandboxConfig: c}
+		if c.User != "" {
+			var err error
+			if s.uid, s.gid, s.groups, err = lookupCredentials(c.User); err != nil {
+				return fmt.Errorf("sandbox: %w", err)
+			}
+		}
+		sandboxes = append(sandboxes, s)
+	}
+	return nil
+}
+
+// sandboxCommand makes the command start through the sandbox of the first
+// entry matching its base name, if any
+func sandboxCommand(cmd *exec.Cmd) error {
+	if cmd.Err != nil {
+		return nil // Fails to start anyway
+	}
+	name := filepath.Base(cmd.Args[0])
+	i := slices.IndexFunc(sandboxes, func(s sandbox) bool {
+		return len(s.Commands) == 0 || slices.Contains(s.Commands, name)
+	})
+	if i < 0 {
+		return nil
+	}
+	s := sandboxes[i]
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := []string{self, sandboxSubcommand}
+	if s.CPUTime > 0 {
+		args = append(args, fmt.Sprintf("--cpu=%d", int64((s.CPUTime+time.Second-1)/time.Second)))
+	}
+	if s.MemoryMB > 0 {
+		args = append(args, fmt.Sprintf("--memory=%d", s.MemoryMB<<20))
+	}
+	if s.Processes > 0 {
+		args = append(args, fmt.Sprintf("--processes=%d", s.Processes))
+	}
+	if s.OpenFiles > 0 {
+		args = append(args, fmt.Sprintf("--open-files=%d", s.OpenFiles))
+	}
+	if s.NoNewPrivs {
+		args = append(args, "--no-new-privs")
+	}
+	args = append(args, "--", cmd.Path)
+	args = append(args, cmd.Args...)
+	cmd.Env = s.environment(cmd.Env)
+	cmd.Path, cmd.Args = self, args
+	if s.User != "" {
+		return setCommandCredentials(cmd, s.uid, s.gid, s.groups)
+	}
+	return nil
+}
+
+// environment returns the command's environment given the one the collector
+// set, nil for the exporter's
+func (s sandbox) environment(env []string) []string {
+	base := os.Environ()
+	if env == nil {
+		env = base
+	}
+	if s.CleanEnv {
+		// Keep what the collector added, e.g. PM2_HOME
+		added := slices.DeleteFunc(slices.Clone(env), func(e string) bool { return slices.Contains(base, e) })
+		env = append([]string{sandboxPath}, added...)
+		for _, e := range s.Environment {
+			if !strings.Contains(e, "=") {
+				if v, ok := os.LookupEnv(e); ok {
+					env = append(env, e+"="+v)
+				}
+			}
+		}
+	}
+	for _, e := range s.Environment {
+		if strings.Contains(e, "=") {
+			env = append(env, e)
+		}
+	}
+	return env
+}
+
+// runSandboxExec is the sandbox-exec subcommand: it applies the limits
+// given as flags and execs the command after --, as path argv0 args...
+func runSandboxExec(args []string) int {
+	fs := flag.NewFlagSet(sandboxSubcommand, flag.ContinueOnError)
+	var limits sandboxLimits
+	fs.Uint64Var(&limits.cpuSeconds, "cpu", 0, "CPU time limit in seconds.")
+	fs.Uint64Var(&limits.memoryBytes, "memory", 0, "Address space limit in bytes.")
+	fs.Uint64Var(&limits.processes, "processes", 0, "Process limit of the user.")
+	fs.Uint64Var(&limits.openFiles, "open-files", 0, "Open file limit.")
+	noNewPrivs := fs.Bool("no-new-privs", false, "Set no_new_privs.")
+	if err := fs.Parse(args); err != nil {
+		return 126
+	}
+	if fs.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "usage: sandbox-exec [limits] -- path argv0 [args...]")
+		return 126
+	}
+	runtime.LockOSThread()
+	err := execRestricted(limits, *noNewPrivs, fs.Arg(0), fs.Args()[1:])
+	fmt.Fprintln(os.Stderr, "sandbox-exec:", err)
+	return 126
+}
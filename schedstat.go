@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	schedRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_sched_running_seconds",
+		Help: "Time spent running tasks per CPU in seconds since boot",
+	}, []string{"cpu"})
+	schedRunDelay = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_sched_run_delay_seconds",
+		Help: "Time tasks spent runnable but waiting for the CPU, per CPU in seconds since boot",
+	}, []string{"cpu"})
+	processSchedRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_process_sched_running_seconds",
+		Help: "Time the game process threads spent running in seconds",
+	}, []string{"instance_name"})
+	processSchedRunDelay = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_process_sched_run_delay_seconds",
+		Help: "Time the game process threads spent runnable but waiting for the CPU in seconds",
+	}, []string{"instance_name"})
+	processSchedTimeslices = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_process_sched_timeslices",
+		Help: "Number of timeslices the game process threads ran",
+	}, []string{"instance_name"})
+)
+
+func init() {
+	prometheus.MustRegister(schedRunning)
+	prometheus.MustRegister(schedRunDelay)
+	prometheus.MustRegister(processSchedRunning)
+	prometheus.MustRegister(processSchedRunDelay)
+	prometheus.MustRegister(processSchedTimeslices)
+}
+
+// Collect per-CPU running and run-delay times from /proc/schedstat
+func getSchedstat() map[string]map[string]float64 {
+	data, err := os.ReadFile(procFilePath("schedstat"))
+	if err != nil {
+		// Missing when the kernel is built without CONFIG_SCHEDSTATS
+		if !os.IsNotExist(err) {
+			logCollectorError("schedstat", "Error reading /proc/schedstat:", err)
+		}
+		return nil
+	}
+
+	metrics := make(map[string]map[string]float64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		// cpuN yld_count legacy sched_count sched_goidle ttwu_count ttwu_local running_ns run_delay_ns timeslices
+		if len(fields) < 10 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		running, _ := strconv.ParseFloat(fields[7], 64)
+		runDelay, _ := strconv.ParseFloat(fields[8], 64)
+		metrics[strings.TrimPrefix(fields[0], "cpu")] = map[string]float64{
+			"running":   running / 1e9, // Convert ns to seconds
+			"run_delay": runDelay / 1e9,
+		}
+	}
+	return metrics
+}
+
+// Sum /proc/<pid>/task/<tid>/schedstat over all threads of a process
+func getProcessSchedstat(pid int) (map[string]float64, bool) {
+	metrics := map[string]float64{}
+	found := false
+	for _, tid := range listThreads(pid) {
+		data, err := os.ReadFile(procFilePath(strconv.Itoa(pid) + "/task/" + strconv.Itoa(tid) + "/schedstat"))
+		if err != nil {
+			continue // Thread exited
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) < 3 {
+			continue
+		}
+		running, _ := strconv.ParseFloat(fields[0], 64)
+		runDelay, _ := strconv.ParseFloat(fields[1], 64)
+		timeslices, _ := strconv.ParseFloat(fields[2], 64)
+		metrics["running"] += running / 1e9 // Convert ns to seconds
+		metrics["run_delay"] += runDelay / 1e9
+		metrics["timeslices"] += timeslices
+		found = true
+	}
+	return metrics, found
+}
+
+var processSchedSeries = newSeriesGeneration()
+
+// Collect system and game process scheduler metrics
+func updateSchedstatMetrics(processes []gameProcess) {
+	for cpu, metrics := range getSchedstat() {
+		schedRunning.WithLabelValues(cpu).Set(metrics["running"])
+		schedRunDelay.WithLabelValues(cpu).Set(metrics["run_delay"])
+	}
+
+	for _, p := range processes {
+		metrics, ok := getProcessSchedstat(p.pid)
+		if !ok {
+			continue
+		}
+		processSchedSeries.set(processSchedRunning, metrics["running"], p.instance)
+		processSchedSeries.set(processSchedRunDelay, metrics["run_delay"], p.instance)
+		processSchedSeries.set(processSchedTimeslices, metrics["timeslices"], p.instance)
+	}
+	processSchedSeries.sweep()
+}
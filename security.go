@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Privileged setup (loading eBPF programs) runs as root, then the exporter
+// switches to an unprivileged user for the collection loop
+var dropPrivilegesUser = flag.String("security.drop-privileges", "", "User to switch to after privileged setup such as loading eBPF programs (default keep running as the current user).")
+
+var (
+	exporterPrivileged = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "game_exporter_privileged",
+		Help: "Whether the exporter runs as root",
+	})
+	collectorPermissionDenied = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_collector_permission_denied",
+		Help: "Whether the collector's last run (or startup) was denied access to a resource",
+	}, []string{"collector"})
+)
+
+func init() {
+	prometheus.MustRegister(exporterPrivileged)
+	prometheus.MustRegister(collectorPermissionDenied)
+}
+
+// Collectors that hit a permission error during their current run; the
+// background checks of some collectors record them too
+var (
+	deniedCollectorsMu sync.Mutex
+	deniedCollectors   = make(map[string]bool)
+)
+
+// checkPermission records err against the collector when it is a permission
+// error, so the collector reports degraded data instead of failing silently.
+// Any error is kept as the collector's last error for /status.
+func checkPermission(collector string, err error) {
+	if err == nil {
+		return
+	}
+	setCollectorError(collector, err)
+	if errors.Is(err, fs.ErrPermission) {
+		deniedCollectorsMu.Lock()
+		deniedCollectors[collector] = true
+		deniedCollectorsMu.Unlock()
+	}
+}
+
+// updatePermissionMetric exports and clears what checkPermission recorded
+func updatePermissionMetric(collector string) {
+	deniedCollectorsMu.Lock()
+	denied := deniedCollectors[collector]
+	delete(deniedCollectors, collector)
+	deniedCollectorsMu.Unlock()
+	if denied {
+		collectorPermissionDenied.WithLabelValues(collector).Set(1)
+	} else {
+		collectorPermissionDenied.WithLabelValues(collector).Set(0)
+	}
+}
+
+// dropPrivileges switches the whole process to the user and its groups
+func dropPrivileges(name string) error {
+	uid, gid, groups, err := lookupCredentials(name)
+	if err != nil {
+		return err
+	}
+	return setCredentials(uid, gid, groups)
+}
+
+// lookupCredentials returns the uid, gid and groups of a user
+func lookupCredentials(name string) (uid, gid int, groups []int, err error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if uid, err = strconv.Atoi(u.Uid); err != nil {
+		return 0, 0, nil, fmt.Errorf("user %s: invalid uid %q", name, u.Uid)
+	}
+	if gid, err = strconv.Atoi(u.Gid); err != nil {
+		return 0, 0, nil, fmt.Errorf("user %s: invalid gid %q", name, u.Gid)
+	}
+	groupIDs, err := u.GroupIds()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	for _, g := range groupIDs {
+		if id, err := strconv.Atoi(g); err == nil {
+			groups = append(groups, id)
+		}
+	}
+	return uid, gid, groups, nil
+}
+
+// updatePrivilegeMetrics reports whether the exporter still runs as root
+func updatePrivilegeMetrics() {
+	if os.Geteuid() == 0 {
+		exporterPrivileged.Set(1)
+	} else {
+		exporterPrivileged.Set(0)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SELinux and AppArmor status of the host and the confinement of the game
+// processes, for auditing without logging in to every host
+var (
+	securityModuleInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_security_module_info",
+		Help: "Status of the Linux security module: enforcing, permissive or disabled for SELinux, enabled or disabled for AppArmor, always 1",
+	}, []string{"module", "mode"})
+	processSecurityContext = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_process_security_context_info",
+		Help: "SELinux context or AppArmor profile confining the game process, with the AppArmor profile mode (enforce, complain), always 1",
+	}, []string{"instance_name", "context", "mode"})
+)
+
+var securityModuleSeries = newSeriesGeneration()
+
+func init() {
+	prometheus.MustRegister(securityModuleInfo)
+	prometheus.MustRegister(processSecurityContext)
+}
+
+func updateSecurityModuleMetrics(processes []gameProcess) {
+	selinux, apparmor := selinuxMode(), apparmorMode()
+	securityModuleSeries.set(securityModuleInfo, 1, "selinux", selinux)
+	securityModuleSeries.set(securityModuleInfo, 1, "apparmor", apparmor)
+
+	// Without either, the context is just what other modules report
+	if selinux == "disabled" && apparmor == "disabled" {
+		processes = nil
+	}
+	for _, p := range processes {
+		context, mode, err := processConfinement(p.pid)
+		if err != nil {
+			checkPermission("security_module", err)
+			continue
+		}
+		securityModuleSeries.set(processSecurityContext, 1, p.instance, context, mode)
+	}
+	securityModuleSeries.sweep()
+}
+
+// selinuxMode reads the enforce switch of selinuxfs, which is only there
+// when SELinux is enabled
+func selinuxMode() string {
+	data, err := os.ReadFile(sysFilePath("fs/selinux/enforce"))
+	if err != nil {
+		return "disabled"
+	}
+	if strings.TrimSpace(string(data)) == "1" {
+		return "enforcing"
+	}
+	return "permissive"
+}
+
+func apparmorMode() string {
+	data, err := os.ReadFile(sysFilePath("module/apparmor/parameters/enabled"))
+	if err == nil && strings.TrimSpace(string(data)) == "Y" {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+// processConfinement returns the security context of a process. AppArmor
+// reports "profile (mode)" or "unconfined", SELinux a context like
+// system_u:system_r:unconfined_t:s0.
+func processConfinement(pid int) (context, mode string, err error) {
+	dir := procFilePath(strconv.Itoa(pid) + "/attr")
+	// Kernels with stacked security modules have a file per module
+	data, err := os.ReadFile(dir + "/apparmor/current")
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = os.ReadFile(dir + "/current")
+	}
+	if err != nil {
+		return "", "", err
+	}
+	context = strings.TrimRight(string(data), "\x00\n")
+	if name, rest, found := strings.Cut(context, " ("); found {
+		return name, strings.TrimSuffix(rest, ")"), nil
+	}
+	return context, "", nil
+}
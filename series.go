@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// seriesGeneration removes the series of a collector that weren't set in its
+// latest cycle, e.g. of unmounted partitions, removed interfaces and exited
+// processes. Unlike Reset, the series that remain never disappear between
+// two scrapes.
+type seriesGeneration struct {
+	generation uint64
+	series     map[seriesKey]*trackedSeries
+}
+
+type seriesKey struct {
+	vec    *prometheus.GaugeVec
+	labels string
+}
+
+type trackedSeries struct {
+	labels     []string
+	generation uint64
+}
+
+func newSeriesGeneration() *seriesGeneration {
+	return &seriesGeneration{series: make(map[seriesKey]*trackedSeries)}
+}
+
+// set sets a series and marks it as seen in the current cycle
+func (g *seriesGeneration) set(vec *prometheus.GaugeVec, value float64, labels ...string) {
+	vec.WithLabelValues(labels...).Set(value)
+	key := seriesKey{vec, strings.Join(labels, "\xff")}
+	if s, ok := g.series[key]; ok {
+		s.generation = g.generation
+		return
+	}
+	g.series[key] = &trackedSeries{labels: labels, generation: g.generation}
+}
+
+// sweep deletes the series not set since the last sweep and starts a new
+// cycle
+func (g *seriesGeneration) sweep() {
+	for key, s := range g.series {
+		if s.generation != g.generation {
+			key.vec.DeleteLabelValues(s.labels...)
+			delete(g.series, key)
+		}
+	}
+	g.generation++
+}
+
+// counterSeries exports cumulative values read every cycle, e.g. from /proc
+// or an eBPF map, as counters. Like seriesGeneration, the series not set in
+// the latest cycle are dropped.
+type counterSeries struct {
+	descs   []*prometheus.Desc
+	pending []prometheus.Metric
+
+	mu      sync.Mutex
+	metrics []prometheus.Metric
+}
+
+func newCounterSeries(descs ...*prometheus.Desc) *counterSeries {
+	return &counterSeries{descs: descs}
+}
+
+// set sets a counter for the current cycle
+func (c *counterSeries) set(desc *prometheus.Desc, value float64, labels ...string) {
+	c.pending = append(c.pending, prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, labels...))
+}
+
+// sweep exports the counters set since the last sweep and starts a new cycle
+func (c *counterSeries) sweep() {
+	c.mu.Lock()
+	c.metrics, c.pending = c.pending, nil
+	c.mu.Unlock()
+}
+
+func (c *counterSeries) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+func (c *counterSeries) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range c.metrics {
+		ch <- m
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// serviceConfig is one entry of the services config section: a systemd unit
+// on Linux or a Windows service
+type serviceConfig struct {
+	Name     string `yaml:"name"`
+	Instance string `yaml:"instance"`
+}
+
+// serviceStatus is a service as reported by the platform's service manager
+type serviceStatus struct {
+	state     string    // One of serviceStates
+	startType string    // e.g. enabled/disabled on Linux, auto/manual on Windows
+	startTime time.Time // Zero when not running
+}
+
+var (
+	serviceState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_service_state",
+		Help: "Whether the service is in the state (1) or not (0)",
+	}, []string{"service", "instance_name", "state"})
+	serviceStartType = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_service_start_type",
+		Help: "Start type of the service, always 1",
+	}, []string{"service", "instance_name", "start_type"})
+	serviceUptime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_service_uptime_seconds",
+		Help: "Time since the service was started, absent when it isn't running",
+	}, []string{"service", "instance_name"})
+)
+
+func init() {
+	prometheus.MustRegister(serviceState)
+	prometheus.MustRegister(serviceStartType)
+	prometheus.MustRegister(serviceUptime)
+}
+
+func validateServices(configs []serviceConfig) error {
+	names := make(map[string]bool)
+	for _, s := range configs {
+		if s.Name == "" {
+			return errors.New("services: name is required")
+		}
+		if names[s.Name] {
+			return fmt.Errorf("service %q defined twice", s.Name)
+		}
+		names[s.Name] = true
+	}
+	return nil
+}
+
+// Collect the state of the configured services
+func updateServiceMetrics() {
+	if len(cfg.Services) == 0 {
+		return
+	}
+	names := make([]string, len(cfg.Services))
+	for i, s := range cfg.Services {
+		names[i] = s.Name
+	}
+	statuses, err := queryServices(names)
+	if err != nil {
+		logCollectorError("service", "Error querying services:", err)
+		checkPermission("service", err)
+		return
+	}
+
+	serviceStartType.Reset()
+	for _, s := range cfg.Services {
+		status, ok := statuses[s.Name]
+		if !ok {
+			continue
+		}
+		for _, state := range serviceStates {
+			value := 0.0
+			if state == status.state {
+				value = 1
+			}
+			serviceState.WithLabelValues(s.Name, s.Instance, state).Set(value)
+		}
+		if status.startType != "" {
+			serviceStartType.WithLabelValues(s.Name, s.Instance, status.startType).Set(1)
+		}
+		if status.startTime.IsZero() {
+			serviceUptime.DeleteLabelValues(s.Name, s.Instance)
+		} else {
+			serviceUptime.WithLabelValues(s.Name, s.Instance).Set(time.Since(status.startTime).Seconds())
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemd ActiveState values
+var serviceStates = []string{"active", "reloading", "inactive", "failed", "activating", "deactivating"}
+
+// queryServices reads the units' state from systemctl show, which prints one
+// block of properties per unit in the order given
+func queryServices(names []string) (map[string]serviceStatus, error) {
+	args := append([]string{"show", "--property=Id,LoadState,ActiveState,UnitFileState,ActiveEnterTimestampMonotonic", "--"}, names...)
+	out, err := execOutput(exec.Command("systemctl", args...))
+	if err != nil {
+		return nil, err
+	}
+	uptime := getUptime()
+	statuses := make(map[string]serviceStatus)
+	for i, block := range strings.Split(strings.TrimSpace(string(out)), "\n\n") {
+		if i >= len(names) {
+			break
+		}
+		props := make(map[string]string)
+		for _, line := range strings.Split(block, "\n") {
+			if key, value, ok := strings.Cut(line, "="); ok {
+				props[key] = value
+			}
+		}
+		if props["LoadState"] == "not-found" {
+			continue
+		}
+		status := serviceStatus{state: props["ActiveState"], startType: props["UnitFileState"]}
+		// Monotonic microseconds since boot, so compare with the uptime
+		if status.state == "active" || status.state == "reloading" {
+			if since, err := strconv.ParseFloat(props["ActiveEnterTimestampMonotonic"], 64); err == nil && since > 0 {
+				status.startTime = time.Now().Add(-time.Duration((uptime - since/1e6) * float64(time.Second)))
+			}
+		}
+		statuses[names[i]] = status
+	}
+	return statuses, nil
+}
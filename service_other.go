@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+
+package main
+
+import "errors"
+
+var serviceStates []string
+
+func queryServices(names []string) (map[string]serviceStatus, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Service Control Manager states
+var serviceStates = []string{"stopped", "start_pending", "stop_pending", "running", "continue_pending", "pause_pending", "paused"}
+
+var serviceStartTypes = map[uint32]string{
+	windows.SERVICE_BOOT_START:   "boot",
+	windows.SERVICE_SYSTEM_START: "system",
+	windows.SERVICE_AUTO_START:   "auto",
+	windows.SERVICE_DEMAND_START: "manual",
+	windows.SERVICE_DISABLED:     "disabled",
+}
+
+// queryServices asks the Service Control Manager for the services' state.
+// Only query access is requested, so this works without administrator rights.
+func queryServices(names []string) (map[string]serviceStatus, error) {
+	scm, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_CONNECT)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseServiceHandle(scm)
+
+	statuses := make(map[string]serviceStatus)
+	for _, name := range names {
+		namePtr, err := windows.UTF16PtrFromString(name)
+		if err != nil {
+			continue
+		}
+		h, err := windows.OpenService(scm, namePtr, windows.SERVICE_QUERY_STATUS|windows.SERVICE_QUERY_CONFIG)
+		if err != nil {
+			continue // Not installed
+		}
+		status, err := queryService(&mgr.Service{Name: name, Handle: h})
+		windows.CloseServiceHandle(h)
+		if err != nil {
+			return nil, err
+		}
+		statuses[name] = status
+	}
+	return statuses, nil
+}
+
+func queryService(s *mgr.Service) (serviceStatus, error) {
+	var status serviceStatus
+	st, err := s.Query()
+	if err != nil {
+		return status, err
+	}
+	if int(st.State) >= 1 && int(st.State) <= len(serviceStates) {
+		status.state = serviceStates[st.State-1]
+	}
+	if c, err := s.Config(); err == nil {
+		status.startType = serviceStartTypes[c.StartType]
+		if c.StartType == windows.SERVICE_AUTO_START && c.DelayedAutoStart {
+			status.startType = "auto_delayed"
+		}
+	}
+	if st.State == windows.SERVICE_RUNNING && st.ProcessId != 0 {
+		status.startTime = serviceProcessStartTime(st.ProcessId)
+	}
+	return status, nil
+}
+
+// serviceProcessStartTime returns when the service's process was created, zero if
+// it can't be opened
+func serviceProcessStartTime(pid uint32) time.Time {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return time.Time{}
+	}
+	defer windows.CloseHandle(h)
+	var created, exited, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(h, &created, &exited, &kernel, &user); err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, created.Nanoseconds())
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sessionConfig is one entry of the sessions config section: screen or tmux
+// sessions a game server was started in by hand
+type sessionConfig struct {
+	Name     string `yaml:"name"`     // Regexp matched against the session name
+	Instance string `yaml:"instance"` // Exported as instance_name
+	Type     string `yaml:"type"`     // screen or tmux, both when empty
+}
+
+// sessionMatcher is a compiled sessions config entry
+type sessionMatcher struct {
+	name        *regexp.Regexp
+	instance    string
+	sessionType string
+}
+
+var sessionMatchers []sessionMatcher
+
+// Directories screen keeps its per-user socket directories (S-<user>) in,
+// depending on how it was built
+var screenDirs = []string{"/run/screen", "/var/run/screen", "/tmp/screens", "/tmp/uscreens"}
+
+var (
+	sessionUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_session_up",
+		Help: "Whether a screen/tmux session matching the instance's pattern exists",
+	}, []string{"instance_name"})
+	sessionAttached = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_session_attached",
+		Help: "Clients attached to the session (screen only reports 0 or 1)",
+	}, []string{"instance_name", "type", "session"})
+	sessionChildPID = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_session_child_pid",
+		Help: "PID of the process running in the session's first window, following single wrappers like start scripts",
+	}, []string{"instance_name", "type", "session"})
+)
+
+func init() {
+	prometheus.MustRegister(sessionUp)
+	prometheus.MustRegister(sessionAttached)
+	prometheus.MustRegister(sessionChildPID)
+}
+
+// setupSessions compiles the sessions config section
+func setupSessions(configs []sessionConfig) error {
+	for _, c := range configs {
+		if c.Name == "" || c.Instance == "" {
+			return errors.New("sessions: name and instance are required")
+		}
+		if c.Type != "" && c.Type != "screen" && c.Type != "tmux" {
+			return fmt.Errorf("session %q: unknown type %q", c.Instance, c.Type)
+		}
+		re, err := regexp.Compile(c.Name)
+		if err != nil {
+			return fmt.Errorf("session %q: %w", c.Instance, err)
+		}
+		sessionMatchers = append(sessionMatchers, sessionMatcher{name: re, instance: c.Instance, sessionType: c.Type})
+	}
+	return nil
+}
+
+// terminalSession is a running screen or tmux session
+type terminalSession struct {
+	sessionType string
+	name        string
+	attached    float64
+	pid         int // Process of the first window, the tmux pane
+	screenPID   int // Backend SCREEN process, the parent of the windows
+}
+
+// readScreenSessions lists the screen sessions of all users from their socket
+// files, named <pid>.<name>. screen marks attached sessions by setting the
+// owner execute bit on the socket.
+func readScreenSessions() []terminalSession {
+	var sessions []terminalSession
+	for _, dir := range screenDirs {
+		sockets, _ := filepath.Glob(rootfsFilePath(filepath.Join(dir, "S-*", "*")))
+		for _, socket := range sockets {
+			info, err := os.Stat(socket)
+			if err != nil || info.Mode().Type() != fs.ModeSocket {
+				continue
+			}
+			pidStr, name, ok := strings.Cut(filepath.Base(socket), ".")
+			if !ok {
+				continue
+			}
+			pid, err := strconv.Atoi(pidStr)
+			if err != nil {
+				continue
+			}
+			// Sockets of crashed sessions stay until "screen -wipe"
+			if _, err := os.Stat(procFilePath(pidStr)); err != nil {
+				continue
+			}
+			s := terminalSession{sessionType: "screen", name: name, screenPID: pid}
+			if info.Mode().Perm()&0100 != 0 {
+				s.attached = 1
+			}
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions
+}
+
+// readTmuxSessions lists the sessions of the tmux servers of all users, one
+// per socket in /tmp/tmux-<uid>
+func readTmuxSessions() []terminalSession {
+	sockets, _ := filepath.Glob(rootfsFilePath("/tmp/tmux-*/*"))
+	var sessions []terminalSession
+	for _, socket := range sockets {
+		if info, err := os.Stat(socket); err != nil || info.Mode().Type() != fs.ModeSocket {
+			continue
+		}
+		// Panes are listed in session, window and pane order
+		out, err := execOutput(exec.Command("tmux", "-S", socket, "list-panes", "-a", "-F", "#{session_name}\t#{session_attached}\t#{pane_pid}"))
+		if err != nil {
+			if errors.Is(err, exec.ErrNotFound) {
+				return nil
+			}
+			continue // Stale socket of a server that exited, or another user's without root
+		}
+		seen := make(map[string]bool)
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			parts := strings.Split(line, "\t")
+			if len(parts) != 3 || seen[parts[0]] {
+				continue
+			}
+			seen[parts[0]] = true
+			attached, _ := strconv.ParseFloat(parts[1], 64)
+			pid, _ := strconv.Atoi(parts[2])
+			sessions = append(sessions, terminalSession{sessionType: "tmux", name: parts[0], attached: attached, pid: pid})
+		}
+	}
+	return sessions
+}
+
+// childProcesses maps each PID to its children, oldest first
+func childProcesses() map[int][]int {
+	children := make(map[int][]int)
+	startTimes := make(map[int]uint64)
+	for _, pid := range listPIDs() {
+		st, err := readProcStat(pid)
+		if err != nil {
+			continue
+		}
+		startTimes[pid] = st.startTime
+		siblings := children[st.ppid]
+		i := len(siblings)
+		for i > 0 && startTimes[siblings[i-1]] > st.startTime {
+			i--
+		}
+		children[st.ppid] = append(siblings[:i], append([]int{pid}, siblings[i:]...)...)
+	}
+	return children
+}
+
+// sessionChild follows a session's first window down through processes with
+// a single child, e.g. a shell running a start script running the server
+func sessionChild(pid int, children map[int][]int) int {
+	for len(children[pid]) == 1 {
+		pid = children[pid][0]
+	}
+	return pid
+}
+
+// Collect the screen and tmux sessions matching the sessions config
+func updateSessionMetrics() {
+	if len(sessionMatchers) == 0 {
+		return
+	}
+	sessions := append(readScreenSessions(), readTmuxSessions()...)
+	var children map[int][]int
+	if len(sessions) > 0 {
+		children = childProcesses()
+	}
+
+	sessionAttached.Reset()
+	sessionChildPID.Reset()
+	for _, m := range sessionMatchers {
+		up := 0.0
+		for _, s := range sessions {
+			if m.sessionType != "" && m.sessionType != s.sessionType || !m.name.MatchString(s.name) {
+				continue
+			}
+			up = 1
+			sessionAttached.WithLabelValues(m.instance, s.sessionType, s.name).Set(s.attached)
+			pid := s.pid
+			if s.screenPID != 0 && len(children[s.screenPID]) > 0 {
+				pid = children[s.screenPID][0]
+			}
+			if pid == 0 {
+				continue
+			}
+			sessionChildPID.WithLabelValues(m.instance, s.sessionType, s.name).Set(float64(sessionChild(pid, children)))
+		}
+		sessionUp.WithLabelValues(m.instance).Set(up)
+	}
+}
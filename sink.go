@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Sinks push the metrics to systems that don't scrape Prometheus endpoints
+
+var (
+	sinkMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "game_sink_messages_total",
+		Help: "Messages published by the sink",
+	}, []string{"sink"})
+	sinkErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "game_sink_errors_total",
+		Help: "Failed publications of the sink; the metrics of the cycle are lost",
+	}, []string{"sink"})
+)
+
+func init() {
+	prometheus.MustRegister(sinkMessages)
+	prometheus.MustRegister(sinkErrors)
+}
+
+// sinkSample is one series in a sink message, in the JSON format of plugins
+type sinkSample struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// sinkMessage is the metrics of one collection cycle
+type sinkMessage struct {
+	Host      string       `json:"host"`
+	Timestamp float64      `json:"timestamp"`
+	Metrics   []sinkSample `json:"metrics"`
+}
+
+// runSink calls publish with the gathered metrics every interval. publish
+// returns the number of messages it published.
+func runSink(name string, interval time.Duration, metrics []string, publish func(sinkMessage) (int, error)) {
+	if interval == 0 {
+		interval = *queryInterval
+	}
+	// The counters exist from the start, so increase() sees the first error
+	sinkMessages.WithLabelValues(name)
+	sinkErrors.WithLabelValues(name)
+	host, _ := os.Hostname()
+	for {
+		time.Sleep(interval)
+		msg, err := gatherSinkMessage(host, metrics)
+		if err == nil {
+			var n int
+			n, err = publish(msg)
+			sinkMessages.WithLabelValues(name).Add(float64(n))
+		}
+		if err != nil {
+			log.Println("Error publishing to", name+":", err)
+			sinkErrors.WithLabelValues(name).Inc()
+		}
+	}
+}
+
+// gatherSinkMessage flattens the families named by metrics (names or
+// prefixes up to a _, all if empty) into samples like the text format's
+func gatherSinkMessage(host string, metrics []string) (sinkMessage, error) {
+	msg := sinkMessage{Host: host, Timestamp: float64(time.Now().UnixNano()) / 1e9}
+	families, err := relabelGatherer{hostLabelGatherer{targetLabelGatherer{prometheus.DefaultGatherer}}}.Gather()
+	if err != nil && len(families) == 0 {
+		return msg, err
+	}
+	for _, f := range families {
+		if len(metrics) > 0 && !slices.ContainsFunc(metrics, func(m string) bool {
+			return f.GetName() == m || strings.HasPrefix(f.GetName(), m+"_")
+		}) {
+			continue
+		}
+		for _, m := range f.Metric {
+			labels := make(map[string]string, len(m.Label))
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			msg.Metrics = append(msg.Metrics, flattenSinkSamples(f.GetName(), f.GetType(), labels, m)...)
+		}
+	}
+	return msg, nil
+}
+
+func flattenSinkSamples(name string, kind dto.MetricType, labels map[string]string, m *dto.Metric) []sinkSample {
+	with := func(label, value string) map[string]string {
+		l := make(map[string]string, len(labels)+1)
+		for k, v := range labels {
+			l[k] = v
+		}
+		l[label] = value
+		return l
+	}
+	var samples []sinkSample
+	switch kind {
+	case dto.MetricType_COUNTER:
+		samples = append(samples, sinkSample{name, labels, m.GetCounter().GetValue()})
+	case dto.MetricType_GAUGE:
+		samples = append(samples, sinkSample{name, labels, m.GetGauge().GetValue()})
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		for _, b := range h.GetBucket() {
+			if math.IsInf(b.GetUpperBound(), 1) {
+				continue
+			}
+			samples = append(samples, sinkSample{name + "_bucket", with("le", fmt.Sprint(b.GetUpperBound())), float64(b.GetCumulativeCount())})
+		}
+		samples = append(samples, sinkSample{name + "_bucket", with("le", "+Inf"), float64(h.GetSampleCount())})
+		samples = append(samples, sinkSample{name + "_sum", labels, h.GetSampleSum()})
+		samples = append(samples, sinkSample{name + "_count", labels, float64(h.GetSampleCount())})
+	case dto.MetricType_SUMMARY:
+		s := m.GetSummary()
+		for _, q := range s.GetQuantile() {
+			samples = append(samples, sinkSample{name, with("quantile", fmt.Sprint(q.GetQuantile())), q.GetValue()})
+		}
+		samples = append(samples, sinkSample{name + "_sum", labels, s.GetSampleSum()})
+		samples = append(samples, sinkSample{name + "_count", labels, float64(s.GetSampleCount())})
+	default:
+		samples = append(samples, sinkSample{name, labels, m.GetUntyped().GetValue()})
+	}
+	// JSON has no NaN or infinities
+	return slices.DeleteFunc(samples, func(s sinkSample) bool {
+		return math.IsNaN(s.Value) || math.IsInf(s.Value, 0)
+	})
+}
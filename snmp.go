@@ -0,0 +1,495 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// snmpConfig is the snmp config section. The exporter registers as an
+// AgentX sub-agent with the host's snmpd, which serves the mapped metrics
+// read-only under base_oid, for NOC tooling that only speaks SNMP. snmpd
+// needs `master agentx` in snmpd.conf.
+type snmpConfig struct {
+	// Master agent socket: a Unix socket path such as /var/agentx/master,
+	// or tcp:host:port
+	AgentX  string             `yaml:"agentx"`
+	BaseOID string             `yaml:"base_oid"` // Default 1.3.6.1.4.1.8072.9999.9108
+	Objects []snmpObjectConfig `yaml:"objects"`  // Default the core metrics
+}
+
+// snmpObjectConfig maps the sum of the matching series, times scale, to the
+// scalar <base_oid>.<index>.0. Counters are Counter64, others Gauge32,
+// clamped to 0..4294967295.
+type snmpObjectConfig struct {
+	Index          uint32 `yaml:"index"`
+	metricSelector `yaml:",inline"`
+	Scale          float64 `yaml:"scale"` // Default 1, e.g. 100 for hundredths of a percent
+}
+
+// netSnmpPlaypen.9108, net-snmp's enterprise subtree for private use
+const defaultSNMPBaseOID = "1.3.6.1.4.1.8072.9999.9108"
+
+var defaultSNMPObjects = []snmpObjectConfig{
+	{Index: 1, metricSelector: metricSelector{Metric: "game_cpu_usage_percent"}, Scale: 100},
+	{Index: 2, metricSelector: metricSelector{Metric: "game_system_load", Labels: map[string]string{"duration": "1m"}}, Scale: 100},
+	{Index: 3, metricSelector: metricSelector{Metric: "game_memory_usage_percent"}, Scale: 100},
+	{Index: 4, metricSelector: metricSelector{Metric: "game_disk_usage_percent", Labels: map[string]string{"partition": "/"}}, Scale: 100},
+	{Index: 5, metricSelector: metricSelector{Metric: "game_server_uptime_seconds"}},
+	{Index: 6, metricSelector: metricSelector{Metric: "game_process_up"}},
+	{Index: 7, metricSelector: metricSelector{Metric: "game_query_players"}},
+	{Index: 8, metricSelector: metricSelector{Metric: "game_query_max_players"}},
+}
+
+const snmpReconnectDelay = 10 * time.Second
+
+// AgentX PDU types, flags, varbind types and errors (RFC 2741)
+const (
+	agentxOpen     = 1
+	agentxClose    = 2
+	agentxRegister = 3
+	agentxGet      = 5
+	agentxGetNext  = 6
+	agentxGetBulk  = 7
+	agentxTestSet  = 8
+	agentxResponse = 18
+
+	agentxNonDefaultContext = 0x08
+	agentxNetworkByteOrder  = 0x10
+
+	agentxCounter64     = 70
+	agentxGauge32       = 66
+	agentxNoSuchObject  = 128
+	agentxEndOfMibView  = 130
+	agentxNotWritable   = 17
+	agentxHeaderSize    = 20
+	agentxMaxPacketSize = 1 << 16
+)
+
+// snmpValue is the current value of an object
+type snmpValue struct {
+	oid     []uint32
+	counter bool
+	value   float64
+}
+
+var (
+	snmpMu      sync.Mutex
+	snmpBase    []uint32
+	snmpObjects []snmpObjectConfig
+	snmpValues  []snmpValue // Objects with matching series, sorted by OID
+)
+
+func validateSNMP(c snmpConfig) error {
+	if c.AgentX == "" {
+		return nil
+	}
+	if c.BaseOID != "" {
+		if _, err := parseOID(c.BaseOID); err != nil {
+			return fmt.Errorf("snmp: base_oid: %w", err)
+		}
+	}
+	indexes := make(map[uint32]bool)
+	for _, o := range c.Objects {
+		if o.Index == 0 || o.Metric == "" {
+			return errors.New("snmp objects: index and metric are required")
+		}
+		if indexes[o.Index] {
+			return fmt.Errorf("snmp object %d defined twice", o.Index)
+		}
+		indexes[o.Index] = true
+	}
+	return nil
+}
+
+func parseOID(s string) ([]uint32, error) {
+	var oid []uint32
+	for _, part := range strings.Split(strings.TrimPrefix(s, "."), ".") {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		oid = append(oid, uint32(n))
+	}
+	return oid, nil
+}
+
+// Set up the SNMP objects, before the collection starts updating them
+func setupSNMP(c snmpConfig) {
+	if c.AgentX == "" {
+		return
+	}
+	base := c.BaseOID
+	if base == "" {
+		base = defaultSNMPBaseOID
+	}
+	snmpBase, _ = parseOID(base)
+	snmpObjects = c.Objects
+	if len(snmpObjects) == 0 {
+		snmpObjects = defaultSNMPObjects
+	}
+}
+
+// Start the AgentX sub-agent in the background, if configured
+func startSNMP(c snmpConfig) {
+	if c.AgentX == "" {
+		return
+	}
+	go runSNMP(c.AgentX)
+}
+
+// updateSNMPValues takes the objects' values from the metrics of a cycle
+func updateSNMPValues(families []*dto.MetricFamily) {
+	if len(snmpObjects) == 0 {
+		return
+	}
+	var values []snmpValue
+	for _, o := range snmpObjects {
+		samples := o.selectSamples(families)
+		if len(samples) == 0 {
+			continue
+		}
+		sum := 0.0
+		for _, s := range samples {
+			sum += s.value
+		}
+		scale := o.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		counter := slices.ContainsFunc(families, func(f *dto.MetricFamily) bool {
+			return f.GetName() == o.Metric && f.GetType() == dto.MetricType_COUNTER
+		})
+		oid := append(slices.Clone(snmpBase), o.Index, 0)
+		values = append(values, snmpValue{oid: oid, counter: counter, value: sum * scale})
+	}
+	slices.SortFunc(values, func(a, b snmpValue) int { return slices.Compare(a.oid, b.oid) })
+	snmpMu.Lock()
+	snmpValues = values
+	snmpMu.Unlock()
+}
+
+// runSNMP keeps a session with the master agent
+func runSNMP(address string) {
+	for {
+		if err := serveAgentX(address); err != nil {
+			log.Println("Error in the AgentX session:", err)
+		}
+		time.Sleep(snmpReconnectDelay)
+	}
+}
+
+// serveAgentX opens a session, registers the subtree and answers requests
+// until the connection fails or the master closes the session
+func serveAgentX(address string) error {
+	network := "unix"
+	if strings.HasPrefix(address, "tcp:") {
+		network, address = "tcp", strings.TrimPrefix(address, "tcp:")
+	}
+	conn, err := net.DialTimeout(network, address, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var open agentxEncoder
+	open.b = append(open.b, 0, 0, 0, 0) // Default timeout, reserved
+	open.oid(nil, false)
+	open.octets("game_exporter")
+	if err := writeAgentX(conn, agentxOpen, 0, 0, 1, open.b); err != nil {
+		return err
+	}
+	h, payload, err := readAgentX(conn)
+	if err != nil {
+		return err
+	}
+	if err := agentxResponseError(h, payload); err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	session := h.session
+
+	var register agentxEncoder
+	register.b = append(register.b, 0, 127, 0, 0) // Default timeout, priority, no range
+	register.oid(snmpBase, false)
+	if err := writeAgentX(conn, agentxRegister, session, 0, 2, register.b); err != nil {
+		return err
+	}
+	if h, payload, err = readAgentX(conn); err != nil {
+		return err
+	}
+	if err := agentxResponseError(h, payload); err != nil {
+		return fmt.Errorf("register: %w", err)
+	}
+	log.Println("Registered", formatOID(snmpBase), "with the AgentX master agent")
+
+	for {
+		h, payload, err := readAgentX(conn)
+		if err != nil {
+			return err
+		}
+		var response []byte
+		switch h.kind {
+		case agentxGet, agentxGetNext, agentxGetBulk:
+			response = answerAgentX(h, payload)
+		case agentxTestSet:
+			response = agentxResponsePayload(agentxNotWritable, 1, nil)
+		case agentxClose:
+			return errors.New("session closed by the master agent")
+		default:
+			// Set phases after a failed test, and responses to nothing
+			continue
+		}
+		if err := writeAgentX(conn, agentxResponse, h.session, h.transaction, h.packet, response); err != nil {
+			return err
+		}
+	}
+}
+
+// answerAgentX answers a Get, GetNext or GetBulk
+func answerAgentX(h agentxHeader, payload []byte) []byte {
+	d := agentxDecoder{b: payload, order: h.order}
+	if h.flags&agentxNonDefaultContext != 0 {
+		d.octets()
+	}
+	nonRepeaters, repetitions := 0, 1
+	if h.kind == agentxGetBulk {
+		nonRepeaters = int(d.uint16())
+		repetitions = int(d.uint16())
+	}
+	type searchRange struct {
+		start, end []uint32
+		include    bool
+	}
+	var ranges []searchRange
+	for len(d.b) > 0 && d.err == nil {
+		start, include := d.oid()
+		end, _ := d.oid()
+		ranges = append(ranges, searchRange{start, end, include})
+	}
+
+	snmpMu.Lock()
+	values := snmpValues
+	snmpMu.Unlock()
+
+	var e agentxEncoder
+	switch h.kind {
+	case agentxGet:
+		for _, r := range ranges {
+			i := slices.IndexFunc(values, func(v snmpValue) bool { return slices.Equal(v.oid, r.start) })
+			if i < 0 {
+				e.varbind(snmpValue{oid: r.start}, agentxNoSuchObject)
+				continue
+			}
+			e.value(values[i])
+		}
+	default:
+		// GetNext is GetBulk without non-repeaters and with one repetition
+		next := func(start, end []uint32, include bool) (snmpValue, bool) {
+			for _, v := range values {
+				c := slices.Compare(v.oid, start)
+				if c < 0 || c == 0 && !include {
+					continue
+				}
+				if len(end) > 0 && slices.Compare(v.oid, end) >= 0 {
+					break
+				}
+				return v, true
+			}
+			return snmpValue{}, false
+		}
+		for i, r := range ranges {
+			n := repetitions
+			if i < nonRepeaters {
+				n = 1
+			}
+			start, include := r.start, r.include
+			for range n {
+				v, ok := next(start, r.end, include)
+				if !ok {
+					e.varbind(snmpValue{oid: start}, agentxEndOfMibView)
+					break
+				}
+				e.value(v)
+				start, include = v.oid, false
+			}
+		}
+	}
+	return agentxResponsePayload(0, 0, e.b)
+}
+
+func agentxResponsePayload(code, index uint16, varbinds []byte) []byte {
+	var e agentxEncoder
+	e.uint32(0) // sysUpTime, filled in by the master
+	e.uint16(code)
+	e.uint16(index)
+	return append(e.b, varbinds...)
+}
+
+func agentxResponseError(h agentxHeader, payload []byte) error {
+	if h.kind != agentxResponse {
+		return fmt.Errorf("expected a response, got PDU type %d", h.kind)
+	}
+	d := agentxDecoder{b: payload, order: h.order}
+	d.uint32()
+	if code := d.uint16(); code != 0 || d.err != nil {
+		return fmt.Errorf("error %d", code)
+	}
+	return nil
+}
+
+func formatOID(oid []uint32) string {
+	parts := make([]string, len(oid))
+	for i, n := range oid {
+		parts[i] = strconv.FormatUint(uint64(n), 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+type agentxHeader struct {
+	kind, flags                  byte
+	session, transaction, packet uint32
+	order                        binary.ByteOrder
+}
+
+func writeAgentX(w io.Writer, kind byte, session, transaction, packet uint32, payload []byte) error {
+	header := []byte{1, kind, agentxNetworkByteOrder, 0}
+	header = binary.BigEndian.AppendUint32(header, session)
+	header = binary.BigEndian.AppendUint32(header, transaction)
+	header = binary.BigEndian.AppendUint32(header, packet)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(payload)))
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+func readAgentX(r io.Reader) (agentxHeader, []byte, error) {
+	var buf [agentxHeaderSize]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return agentxHeader{}, nil, err
+	}
+	h := agentxHeader{kind: buf[1], flags: buf[2], order: binary.LittleEndian}
+	if buf[0] != 1 {
+		return h, nil, fmt.Errorf("unsupported AgentX version %d", buf[0])
+	}
+	if h.flags&agentxNetworkByteOrder != 0 {
+		h.order = binary.BigEndian
+	}
+	h.session = h.order.Uint32(buf[4:])
+	h.transaction = h.order.Uint32(buf[8:])
+	h.packet = h.order.Uint32(buf[12:])
+	n := h.order.Uint32(buf[16:])
+	if n > agentxMaxPacketSize {
+		return h, nil, fmt.Errorf("PDU of %d bytes", n)
+	}
+	payload := make([]byte, n)
+	_, err := io.ReadFull(r, payload)
+	return h, payload, err
+}
+
+// agentxEncoder writes PDU fields in network byte order
+type agentxEncoder struct{ b []byte }
+
+func (e *agentxEncoder) uint16(v uint16) { e.b = binary.BigEndian.AppendUint16(e.b, v) }
+func (e *agentxEncoder) uint32(v uint32) { e.b = binary.BigEndian.AppendUint32(e.b, v) }
+
+func (e *agentxEncoder) oid(oid []uint32, include bool) {
+	flag := byte(0)
+	if include {
+		flag = 1
+	}
+	e.b = append(e.b, byte(len(oid)), 0, flag, 0)
+	for _, n := range oid {
+		e.uint32(n)
+	}
+}
+
+// octets writes an octet string padded to 4 bytes
+func (e *agentxEncoder) octets(s string) {
+	e.uint32(uint32(len(s)))
+	e.b = append(e.b, s...)
+	for len(e.b)%4 != 0 {
+		e.b = append(e.b, 0)
+	}
+}
+
+func (e *agentxEncoder) varbind(v snmpValue, kind uint16) {
+	e.uint16(kind)
+	e.uint16(0)
+	e.oid(v.oid, false)
+}
+
+func (e *agentxEncoder) value(v snmpValue) {
+	if v.counter {
+		e.varbind(v, agentxCounter64)
+		e.b = binary.BigEndian.AppendUint64(e.b, uint64(max(v.value, 0)))
+		return
+	}
+	e.varbind(v, agentxGauge32)
+	e.uint32(uint32(math.Min(math.Max(v.value, 0), math.MaxUint32)))
+}
+
+// agentxDecoder reads PDU fields; after a short read, err is set and
+// further reads return zeros
+type agentxDecoder struct {
+	b     []byte
+	order binary.ByteOrder
+	err   error
+}
+
+func (d *agentxDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.b) < n {
+		d.err = errors.New("short PDU")
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *agentxDecoder) uint16() uint16 {
+	if b := d.next(2); b != nil {
+		return d.order.Uint16(b)
+	}
+	return 0
+}
+
+func (d *agentxDecoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return d.order.Uint32(b)
+	}
+	return 0
+}
+
+// oid reads an OID, expanding the 1.3.6.1.<prefix> compression
+func (d *agentxDecoder) oid() ([]uint32, bool) {
+	b := d.next(4)
+	if b == nil {
+		return nil, false
+	}
+	var oid []uint32
+	if b[1] != 0 {
+		oid = []uint32{1, 3, 6, 1, uint32(b[1])}
+	}
+	for range int(b[0]) {
+		oid = append(oid, d.uint32())
+	}
+	return oid, b[2] != 0
+}
+
+func (d *agentxDecoder) octets() {
+	n := int(d.uint32())
+	d.next((n + 3) &^ 3)
+}
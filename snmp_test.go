@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAgentXPDU(t *testing.T) {
+	var e agentxEncoder
+	e.oid([]uint32{1, 3, 6, 1, 4, 1, 8072}, true)
+	e.octets("ctx")
+	var buf bytes.Buffer
+	if err := writeAgentX(&buf, agentxGetNext, 7, 8, 9, e.b); err != nil {
+		t.Fatal(err)
+	}
+	h, payload, err := readAgentX(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.kind != agentxGetNext || h.session != 7 || h.transaction != 8 || h.packet != 9 || h.order != binary.BigEndian {
+		t.Errorf("header = %+v", h)
+	}
+	d := agentxDecoder{b: payload, order: h.order}
+	if oid, include := d.oid(); !slices.Equal(oid, []uint32{1, 3, 6, 1, 4, 1, 8072}) || !include {
+		t.Errorf("oid() = %v, %v", oid, include)
+	}
+	d.octets()
+	if len(d.b) != 0 || d.err != nil {
+		t.Errorf("%d bytes left after the PDU, error %v", len(d.b), d.err)
+	}
+
+	// A little-endian PDU with a 1.3.6.1.4 prefixed OID
+	pdu := []byte{1, agentxGet, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 12, 0, 0, 0, 2, 4, 0, 0, 1, 0, 0, 0, 0x84, 0x1f, 0, 0}
+	h, payload, err = readAgentX(bytes.NewReader(pdu))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.kind != agentxGet || h.session != 1 || h.transaction != 2 || h.packet != 3 || h.order != binary.LittleEndian {
+		t.Errorf("header = %+v", h)
+	}
+	d = agentxDecoder{b: payload, order: h.order}
+	if oid, include := d.oid(); !slices.Equal(oid, []uint32{1, 3, 6, 1, 4, 1, 8068}) || include {
+		t.Errorf("oid() = %v, %v", oid, include)
+	}
+	if _, _, err := readAgentX(bytes.NewReader(pdu[:len(pdu)-1])); err == nil {
+		t.Error("readAgentX() of a truncated PDU succeeded")
+	}
+}
+
+// agentxVarbinds decodes the varbinds of a response as "oid type value"
+func agentxVarbinds(t *testing.T, payload []byte) []string {
+	t.Helper()
+	d := agentxDecoder{b: payload, order: binary.BigEndian}
+	d.uint32()
+	if code := d.uint16(); code != 0 {
+		t.Errorf("response error %d", code)
+	}
+	d.uint16()
+	var varbinds []string
+	for len(d.b) > 0 && d.err == nil {
+		kind := d.uint16()
+		d.uint16()
+		oid, _ := d.oid()
+		varbind := formatOID(oid)
+		switch kind {
+		case agentxGauge32:
+			varbind += fmt.Sprint(" gauge ", d.uint32())
+		case agentxCounter64:
+			varbind += fmt.Sprint(" counter ", uint64(d.uint32())<<32|uint64(d.uint32()))
+		case agentxNoSuchObject:
+			varbind += " noSuchObject"
+		case agentxEndOfMibView:
+			varbind += " endOfMibView"
+		default:
+			t.Fatalf("unexpected varbind type %d", kind)
+		}
+		varbinds = append(varbinds, varbind)
+	}
+	if d.err != nil {
+		t.Fatal(d.err)
+	}
+	return varbinds
+}
+
+// withSNMPValues sets up objects 1 and 2 as gauges and 10 as a counter,
+// configured out of order
+func withSNMPValues(t *testing.T) {
+	oldBase, oldObjects, oldValues := snmpBase, snmpObjects, snmpValues
+	t.Cleanup(func() { snmpBase, snmpObjects, snmpValues = oldBase, oldObjects, oldValues })
+	snmpBase = []uint32{1, 3, 6, 1, 4, 1, 9999}
+	snmpObjects = []snmpObjectConfig{
+		{Index: 10, metricSelector: metricSelector{Metric: "game_test_bytes_total"}},
+		{Index: 2, metricSelector: metricSelector{Metric: "game_test_players"}, Scale: 2},
+		{Index: 3, metricSelector: metricSelector{Metric: "game_test_missing"}},
+		{Index: 1, metricSelector: metricSelector{Metric: "game_test_players"}},
+	}
+
+	registry := prometheus.NewRegistry()
+	players := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "game_test_players", Help: "test"}, []string{"instance_name"})
+	sent := prometheus.NewCounter(prometheus.CounterOpts{Name: "game_test_bytes_total", Help: "test"})
+	registry.MustRegister(players, sent)
+	players.WithLabelValues("a").Set(5)
+	players.WithLabelValues("b").Set(7)
+	sent.Add(1 << 40)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateSNMPValues(families)
+}
+
+func TestAnswerAgentX(t *testing.T) {
+	withSNMPValues(t)
+	type searchRange struct {
+		start, end []uint32
+		include    bool
+	}
+	oid := func(sub ...uint32) []uint32 { return append([]uint32{1, 3, 6, 1, 4, 1, 9999}, sub...) }
+	tests := []struct {
+		name                      string
+		kind                      byte
+		nonRepeaters, repetitions uint16
+		ranges                    []searchRange
+		want                      []string
+	}{
+		{"get", agentxGet, 0, 0, []searchRange{{start: oid(2, 0)}, {start: oid(3, 0)}}, []string{
+			"1.3.6.1.4.1.9999.2.0 gauge 24",
+			"1.3.6.1.4.1.9999.3.0 noSuchObject",
+		}},
+		{"getnext from the base", agentxGetNext, 0, 0, []searchRange{{start: oid()}}, []string{
+			"1.3.6.1.4.1.9999.1.0 gauge 12",
+		}},
+		{"getnext skips the start", agentxGetNext, 0, 0, []searchRange{{start: oid(1, 0)}, {start: oid(2)}}, []string{
+			"1.3.6.1.4.1.9999.2.0 gauge 24",
+			"1.3.6.1.4.1.9999.2.0 gauge 24",
+		}},
+		{"getnext includes the start", agentxGetNext, 0, 0, []searchRange{{start: oid(1, 0), include: true}}, []string{
+			"1.3.6.1.4.1.9999.1.0 gauge 12",
+		}},
+		{"getnext orders numerically", agentxGetNext, 0, 0, []searchRange{{start: oid(2, 0)}}, []string{
+			"1.3.6.1.4.1.9999.10.0 counter 1099511627776",
+		}},
+		{"getnext past the end", agentxGetNext, 0, 0, []searchRange{{start: oid(10, 0)}}, []string{
+			"1.3.6.1.4.1.9999.10.0 endOfMibView",
+		}},
+		{"getnext up to the end of the range", agentxGetNext, 0, 0, []searchRange{{start: oid(1, 0), end: oid(2, 0)}}, []string{
+			"1.3.6.1.4.1.9999.1.0 endOfMibView",
+		}},
+		{"getbulk", agentxGetBulk, 1, 5, []searchRange{{start: oid()}, {start: oid(1, 0)}}, []string{
+			"1.3.6.1.4.1.9999.1.0 gauge 12",
+			"1.3.6.1.4.1.9999.2.0 gauge 24",
+			"1.3.6.1.4.1.9999.10.0 counter 1099511627776",
+			"1.3.6.1.4.1.9999.10.0 endOfMibView",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e agentxEncoder
+			if tt.kind == agentxGetBulk {
+				e.uint16(tt.nonRepeaters)
+				e.uint16(tt.repetitions)
+			}
+			for _, r := range tt.ranges {
+				e.oid(r.start, r.include)
+				e.oid(r.end, false)
+			}
+			h := agentxHeader{kind: tt.kind, order: binary.BigEndian}
+			if got := agentxVarbinds(t, answerAgentX(h, e.b)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("varbinds = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeAgentX(t *testing.T) {
+	withSNMPValues(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	done := make(chan error, 1)
+	go func() { done <- serveAgentX("tcp:" + listener.Addr().String()) }()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	expect := func(kind byte) (agentxHeader, []byte) {
+		t.Helper()
+		h, payload, err := readAgentX(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.kind != kind {
+			t.Fatalf("PDU type %d, want %d", h.kind, kind)
+		}
+		return h, payload
+	}
+	expect(agentxOpen)
+	if err := writeAgentX(conn, agentxResponse, 42, 0, 1, agentxResponsePayload(0, 0, nil)); err != nil {
+		t.Fatal(err)
+	}
+	h, payload := expect(agentxRegister)
+	if h.session != 42 {
+		t.Errorf("register session = %d, want 42", h.session)
+	}
+	d := agentxDecoder{b: payload[4:], order: h.order}
+	if oid, _ := d.oid(); !slices.Equal(oid, snmpBase) {
+		t.Errorf("registered %v, want %v", oid, snmpBase)
+	}
+	if err := writeAgentX(conn, agentxResponse, 42, 0, 2, agentxResponsePayload(0, 0, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	var e agentxEncoder
+	e.oid(snmpBase, false)
+	e.oid(nil, false)
+	if err := writeAgentX(conn, agentxGetNext, 42, 5, 6, e.b); err != nil {
+		t.Fatal(err)
+	}
+	h, payload = expect(agentxResponse)
+	if h.session != 42 || h.transaction != 5 || h.packet != 6 {
+		t.Errorf("response header = %+v", h)
+	}
+	if got, want := agentxVarbinds(t, payload), []string{"1.3.6.1.4.1.9999.1.0 gauge 12"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("varbinds = %q, want %q", got, want)
+	}
+
+	if err := writeAgentX(conn, agentxClose, 42, 0, 7, []byte{1, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err == nil {
+		t.Error("serveAgentX() returned no error after the master closed the session")
+	}
+}
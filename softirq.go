@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Interrupt time and network softirqs per CPU, to check that RSS and IRQ
+// affinity spread packet processing across cores instead of saturating one
+var (
+	cpuInterruptSeconds = prometheus.NewDesc("game_cpu_interrupt_seconds_total",
+		"Time the CPU spent servicing interrupts since boot by mode (irq, softirq)",
+		[]string{"cpu", "mode"}, nil)
+	networkSoftirqs = prometheus.NewDesc("game_softirqs_total",
+		"Network softirqs handled by the CPU since boot by type (NET_RX, NET_TX)",
+		[]string{"cpu", "type"}, nil)
+
+	// CPUs going offline drop out of both files
+	softirqSeries = newCounterSeries(cpuInterruptSeconds, networkSoftirqs)
+)
+
+func init() {
+	prometheus.MustRegister(softirqSeries)
+}
+
+func updateSoftirqMetrics() {
+	defer softirqSeries.sweep()
+
+	data, err := os.ReadFile(procFilePath("stat"))
+	if err != nil {
+		logCollectorError("softirq", "Error reading /proc/stat:", err)
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		// Per-CPU lines only: cpu0 user nice system idle iowait irq softirq ...
+		if len(fields) < 8 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		cpu := strings.TrimPrefix(fields[0], "cpu")
+		irq, _ := strconv.ParseFloat(fields[6], 64)
+		softirq, _ := strconv.ParseFloat(fields[7], 64)
+		softirqSeries.set(cpuInterruptSeconds, irq/userHZ, cpu, "irq")
+		softirqSeries.set(cpuInterruptSeconds, softirq/userHZ, cpu, "softirq")
+	}
+
+	data, err = os.ReadFile(procFilePath("softirqs"))
+	if err != nil {
+		logCollectorError("softirq", "Error reading /proc/softirqs:", err)
+		return
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) == 0 {
+		return
+	}
+	// The header names the online CPUs, e.g. "CPU0 CPU1 CPU3"
+	cpus := strings.Fields(lines[0])
+	for _, line := range lines[1:] {
+		name, counts, found := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !found || name != "NET_RX" && name != "NET_TX" {
+			continue
+		}
+		for i, count := range strings.Fields(counts) {
+			if i >= len(cpus) {
+				break
+			}
+			v, _ := strconv.ParseFloat(count, 64)
+			softirqSeries.set(networkSoftirqs, v, strings.TrimPrefix(cpus[i], "CPU"), name)
+		}
+	}
+}
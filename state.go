@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var stateDir = flag.String("state.dir", "", "Directory to keep state in across exporter restarts, e.g. /var/lib/game_exporter. Counters the exporter accumulates (restarts, log messages, auth failures, public IP changes) continue from their saved values, and CPU, network and disk rates resume from the last sample of the same boot. Disabled by default.")
+
+// Interval between saves of the state; it is also saved on SIGINT and SIGTERM
+const stateSaveInterval = time.Minute
+
+// Counters accumulated by the exporter, as opposed to read from the system
+var persistedCounters = map[string]*prometheus.CounterVec{
+	"game_process_restarts_total":     processRestarts,
+	"game_journal_messages_total":     journalMessages,
+	"game_log_errors_total":           logErrors,
+	"game_auth_failures_total":        authFailures,
+	"game_alert_webhook_errors_total": alertWebhookErrors,
+	"game_public_ip_changes_total":    publicIPChanges,
+}
+
+// savedCounter is one series in counters.json
+type savedCounter struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+func countersFile() string {
+	return filepath.Join(*stateDir, "counters.json")
+}
+
+// restoreCounters adds the saved values to the counters
+func restoreCounters() error {
+	data, err := os.ReadFile(countersFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved map[string][]savedCounter
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	for name, series := range saved {
+		vec, ok := persistedCounters[name]
+		if !ok {
+			continue
+		}
+		for _, s := range series {
+			c, err := vec.GetMetricWith(s.Labels)
+			if err != nil {
+				log.Println("Error restoring", name+":", err)
+				continue
+			}
+			c.Add(s.Value)
+		}
+	}
+	return nil
+}
+
+// saveCounters writes the counters' values, replacing the file atomically
+func saveCounters() error {
+	saved := make(map[string][]savedCounter)
+	for name, vec := range persistedCounters {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			vec.Collect(ch)
+			close(ch)
+		}()
+		for m := range ch {
+			var pb dto.Metric
+			if err := m.Write(&pb); err != nil {
+				continue
+			}
+			s := savedCounter{Labels: make(map[string]string), Value: pb.GetCounter().GetValue()}
+			for _, l := range pb.Label {
+				s.Labels[l.GetName()] = l.GetValue()
+			}
+			saved[name] = append(saved[name], s)
+		}
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(countersFile(), data)
+}
+
+// writeFileAtomic writes a file through a temporary file and a rename, so a
+// crash never leaves a truncated file
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// saveState saves the counters and the last raw sample of the rates
+func saveState() {
+	if err := saveCounters(); err != nil {
+		log.Println("Error saving state:", err)
+	}
+	if err := saveSample(); err != nil {
+		log.Println("Error saving state:", err)
+	}
+}
+
+// startState restores the saved state and saves it every interval and on
+// shutdown
+func startState() error {
+	if *stateDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(*stateDir, 0o755); err != nil {
+		return err
+	}
+	if err := restoreCounters(); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			time.Sleep(stateSaveInterval)
+			saveState()
+		}
+	}()
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		saveState()
+		os.Exit(0)
+	}()
+	return nil
+}
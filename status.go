@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runtime state of the collectors for /status, updated by the collection
+// cycle and read by the handler
+var (
+	collectorStatusMu sync.Mutex
+	collectorLastRun  = make(map[string]time.Time)
+	collectorLastErr  = make(map[string]collectorError)
+)
+
+type collectorError struct {
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// setCollectorRun records a run started at the given time. A run that
+// logged no error clears the last error, so a collector that recovered no
+// longer shows as failing.
+func setCollectorRun(name string, at time.Time) {
+	collectorStatusMu.Lock()
+	collectorLastRun[name] = at
+	if e, ok := collectorLastErr[name]; ok && e.Time.Before(at) {
+		delete(collectorLastErr, name)
+	}
+	collectorStatusMu.Unlock()
+}
+
+func setCollectorError(name string, err error) {
+	collectorStatusMu.Lock()
+	collectorLastErr[name] = collectorError{Error: err.Error(), Time: time.Now()}
+	collectorStatusMu.Unlock()
+}
+
+// logCollectorError logs a collector's error like log.Println and keeps the
+// message as the collector's last error for /status
+func logCollectorError(name string, v ...any) {
+	msg := strings.TrimSuffix(fmt.Sprintln(v...), "\n")
+	log.Print(msg)
+	setCollectorError(name, errors.New(msg))
+}
+
+type collectorStatus struct {
+	Name      string          `json:"name"`
+	Enabled   bool            `json:"enabled"`
+	TTL       string          `json:"ttl,omitempty"`
+	LastRun   *time.Time      `json:"last_run"`
+	LastError *collectorError `json:"last_error"`
+	ttl       time.Duration
+}
+
+// collectorStatuses returns the state of every collector
+func collectorStatuses() []collectorStatus {
+	statuses := []collectorStatus{}
+	collectorStatusMu.Lock()
+	for _, c := range collectors {
+		s := collectorStatus{Name: c.name, Enabled: (c.enabled == nil || *c.enabled) && !collectorDisabled(c.name)}
+		ttl := c.ttl
+		if v, ok := collectorTTLs[c.name]; ok {
+			ttl = v
+		}
+		if ttl > 0 {
+			s.TTL = ttl.String()
+			s.ttl = ttl
+		}
+		if at, ok := collectorLastRun[c.name]; ok {
+			s.LastRun = &at
+		}
+		if e, ok := collectorLastErr[c.name]; ok {
+			s.LastError = &e
+		}
+		statuses = append(statuses, s)
+	}
+	collectorStatusMu.Unlock()
+	return statuses
+}
+
+type targetStatus struct {
+	Instance string            `json:"instance"`
+	Protocol string            `json:"protocol"`
+	Address  string            `json:"address,omitempty"`
+	Mode     string            `json:"mode,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+type exporterStatus struct {
+	Collectors []collectorStatus `json:"collectors"`
+	Instances  []string          `json:"instances"`
+	Queries    []targetStatus    `json:"queries"`
+	Voice      []targetStatus    `json:"voice"`
+}
+
+// statusHandler serves /status, the collectors and running targets as JSON
+// for tooling auditing the exporter's configuration. Credentials are left
+// out.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	status := exporterStatus{
+		Collectors: collectorStatuses(),
+		Instances:  []string{},
+		Queries:    []targetStatus{},
+		Voice:      []targetStatus{},
+	}
+
+	for _, inst := range cfg.Instances {
+		status.Instances = append(status.Instances, inst.Name)
+	}
+	for _, t := range runningQueries() {
+		c := t.config
+		var addr struct {
+			Address string `yaml:"address"`
+			URL     string `yaml:"url"`
+		}
+		c.decodeOptions(&addr)
+		if u, err := url.Parse(addr.URL); err == nil && addr.Address == "" {
+			u.User = nil
+			addr.Address = u.String()
+		}
+		mode := c.Mode
+		if mode == "" {
+			mode = "background"
+		}
+		status.Queries = append(status.Queries, targetStatus{Instance: c.Instance, Protocol: c.Protocol, Address: addr.Address, Mode: mode, Labels: c.Labels})
+	}
+	for _, c := range cfg.Voice {
+		status.Voice = append(status.Voice, targetStatus{Instance: c.Instance, Protocol: c.Type, Address: c.Address})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(status)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Steam update status. Installed builds are read from the app manifests every
+// cycle; the latest builds are looked up with steamcmd, which takes several
+// seconds, on a slow schedule in the background.
+var (
+	steamLibraries     = flag.String("collector.steam.libraries", "", "Comma-separated steamapps directories holding the appmanifest_<appid>.acf files of installed game servers (empty disables).")
+	steamcmdPath       = flag.String("collector.steam.steamcmd-path", "steamcmd", "Path to the steamcmd binary.")
+	steamCheckInterval = flag.Duration("collector.steam.check-interval", time.Hour, "Interval between checks for new builds with steamcmd.")
+)
+
+var (
+	steamUpdateAvailable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_update_available",
+		Help: "Whether a newer build of the app is available on its branch",
+	}, []string{"app_id"})
+	steamAppInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_steam_app_info",
+		Help: "Installed Steam app with its build ID, always 1",
+	}, []string{"app_id", "name", "branch", "build_id", "library"})
+	steamLatestBuildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_steam_latest_build_info",
+		Help: "Latest build ID of the app's branch on Steam, always 1",
+	}, []string{"app_id", "branch", "build_id"})
+	steamLastCheck = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "game_steam_last_check_timestamp_seconds",
+		Help: "Time of the last successful steamcmd check for new builds",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(steamUpdateAvailable)
+	prometheus.MustRegister(steamAppInfo)
+	prometheus.MustRegister(steamLatestBuildInfo)
+	prometheus.MustRegister(steamLastCheck)
+}
+
+// steamApp is an installed app from an appmanifest file
+type steamApp struct {
+	id, name, branch, buildID, library string
+}
+
+// Latest build ID per app and branch, from the last steamcmd check
+var (
+	steamLatestMu     sync.Mutex
+	steamLatestBuilds = make(map[string]map[string]string)
+)
+
+// parseVDF parses Valve's KeyValues text format as used by app manifests and
+// app info into nested maps. Keys are lowercased, Steam treats them case
+// insensitively.
+func parseVDF(data []byte) (map[string]any, error) {
+	var tokens []string
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '{' || c == '}':
+			tokens = append(tokens, string(c))
+		case c == '"':
+			var b strings.Builder
+			for i++; i < len(data) && data[i] != '"'; i++ {
+				if data[i] == '\\' && i+1 < len(data) {
+					i++
+				}
+				b.WriteByte(data[i])
+			}
+			// Quote marks a token apart from the braces
+			tokens = append(tokens, "\""+b.String())
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		}
+	}
+
+	var parse func() (map[string]any, error)
+	parse = func() (map[string]any, error) {
+		m := make(map[string]any)
+		for len(tokens) > 0 {
+			key := tokens[0]
+			tokens = tokens[1:]
+			if key == "}" {
+				return m, nil
+			}
+			if key == "{" || len(tokens) == 0 {
+				return nil, errors.New("malformed VDF")
+			}
+			key = strings.ToLower(key[1:])
+			value := tokens[0]
+			tokens = tokens[1:]
+			switch value {
+			case "{":
+				sub, err := parse()
+				if err != nil {
+					return nil, err
+				}
+				m[key] = sub
+			case "}":
+				return nil, errors.New("malformed VDF")
+			default:
+				m[key] = value[1:]
+			}
+		}
+		return m, nil
+	}
+	return parse()
+}
+
+// vdfString looks up a string value by its path of keys
+func vdfString(m map[string]any, keys ...string) string {
+	parent, ok := vdfMap(m, keys[:len(keys)-1]...)
+	if !ok {
+		return ""
+	}
+	s, _ := parent[keys[len(keys)-1]].(string)
+	return s
+}
+
+// vdfMap looks up a nested map by its path of keys
+func vdfMap(m map[string]any, keys ...string) (map[string]any, bool) {
+	for _, key := range keys {
+		var ok bool
+		if m, ok = m[key].(map[string]any); !ok {
+			return nil, false
+		}
+	}
+	return m, true
+}
+
+// readSteamApps reads the app manifests of the configured libraries
+func readSteamApps() []steamApp {
+	var apps []steamApp
+	for _, library := range strings.Split(*steamLibraries, ",") {
+		library = strings.TrimSpace(library)
+		if library == "" {
+			continue
+		}
+		manifests, _ := filepath.Glob(rootfsFilePath(filepath.Join(library, "appmanifest_*.acf")))
+		for _, path := range manifests {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				checkPermission("steam", err)
+				continue
+			}
+			m, err := parseVDF(data)
+			if err != nil {
+				logCollectorError("steam", "Error parsing", path+":", err)
+				continue
+			}
+			app := steamApp{
+				id:      vdfString(m, "appstate", "appid"),
+				name:    vdfString(m, "appstate", "name"),
+				branch:  vdfString(m, "appstate", "userconfig", "betakey"),
+				buildID: vdfString(m, "appstate", "buildid"),
+				library: library,
+			}
+			if app.id == "" {
+				continue
+			}
+			if app.branch == "" {
+				app.branch = "public"
+			}
+			apps = append(apps, app)
+		}
+	}
+	return apps
+}
+
+// checkSteamBuilds asks steamcmd for the branches' latest build IDs of the apps
+func checkSteamBuilds(appIDs []string) (map[string]map[string]string, error) {
+	args := []string{"+login", "anonymous", "+app_info_update", "1"}
+	for _, id := range appIDs {
+		args = append(args, "+app_info_print", id)
+	}
+	args = append(args, "+quit")
+	out, err := execOutput(exec.Command(*steamcmdPath, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	builds := make(map[string]map[string]string)
+	for _, id := range appIDs {
+		// The app info follows steamcmd's log output as "<appid>" { ... }
+		start := bytes.Index(out, []byte("\""+id+"\"\n"))
+		if start < 0 {
+			start = bytes.Index(out, []byte("\""+id+"\"\r\n"))
+		}
+		if start < 0 {
+			return nil, fmt.Errorf("no app info for app %s", id)
+		}
+		m, err := parseVDF(vdfBlock(out[start:]))
+		if err != nil {
+			return nil, fmt.Errorf("app %s: %w", id, err)
+		}
+		info, _ := m[id].(map[string]any)
+		branches, _ := vdfMap(info, "depots", "branches")
+		builds[id] = make(map[string]string)
+		for branch, b := range branches {
+			if b, ok := b.(map[string]any); ok {
+				builds[id][branch] = vdfString(b, "buildid")
+			}
+		}
+	}
+	return builds, nil
+}
+
+// vdfBlock cuts a key and its braced value from the start of data
+func vdfBlock(data []byte) []byte {
+	depth := 0
+	quoted := false
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == '{' && !quoted:
+			depth++
+		case c == '}' && !quoted:
+			if depth--; depth == 0 {
+				return data[:i+1]
+			}
+		}
+	}
+	return data
+}
+
+// Check for new builds of the installed apps every interval
+func runSteamChecks() {
+	sleepJitter()
+	for {
+		ids := make(map[string]bool)
+		var appIDs []string
+		for _, app := range readSteamApps() {
+			if !ids[app.id] {
+				ids[app.id] = true
+				appIDs = append(appIDs, app.id)
+			}
+		}
+		if len(appIDs) > 0 {
+			builds, err := checkSteamBuilds(appIDs)
+			if err != nil {
+				logCollectorError("steam", "Error checking Steam builds:", err)
+			} else {
+				steamLatestMu.Lock()
+				steamLatestBuilds = builds
+				steamLatestMu.Unlock()
+				steamLastCheck.SetToCurrentTime()
+			}
+		}
+		time.Sleep(*steamCheckInterval)
+	}
+}
+
+// Series of the installed apps, to drop those of uninstalled ones
+var steamSeries = newSeriesGeneration()
+
+// Collect installed builds and compare them with the latest ones
+func updateSteamMetrics() {
+	if *steamLibraries == "" {
+		return
+	}
+	steamLatestMu.Lock()
+	latest := steamLatestBuilds
+	steamLatestMu.Unlock()
+
+	available := make(map[string]float64)
+	for _, app := range readSteamApps() {
+		steamSeries.set(steamAppInfo, 1, app.id, app.name, app.branch, app.buildID, app.library)
+		build, ok := latest[app.id][app.branch]
+		if !ok {
+			continue // Not checked yet, or a password protected branch
+		}
+		steamSeries.set(steamLatestBuildInfo, 1, app.id, app.branch, build)
+		// Any outdated install of the app counts
+		if build != app.buildID {
+			available[app.id] = 1
+		} else if _, ok := available[app.id]; !ok {
+			available[app.id] = 0 // Up to date unless another install is outdated
+		}
+	}
+	for id, v := range available {
+		steamSeries.set(steamUpdateAvailable, v, id)
+	}
+	steamSeries.sweep()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var sysctlNames = flag.String("collector.sysctl.names", "net.core.rmem_max,net.core.wmem_max,net.core.netdev_max_backlog,net.core.somaxconn,net.ipv4.udp_mem,vm.max_map_count,vm.swappiness,fs.file-max",
+	"Comma-separated sysctls to export as game_sysctl, empty to disable.")
+
+var sysctlValue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "game_sysctl",
+	Help: "Value of a sysctl tunable; sysctls with several values have a series per index",
+}, []string{"name", "index"})
+
+func init() {
+	prometheus.MustRegister(sysctlValue)
+}
+
+var sysctlSeries = newSeriesGeneration()
+
+func updateSysctlMetrics() {
+	for _, name := range strings.Split(*sysctlNames, ",") {
+		name = strings.TrimSpace(name)
+		// Dots separate the path components, the names themselves have none
+		if name == "" || strings.Contains(name, "/") {
+			continue
+		}
+		data, err := os.ReadFile(procFilePath("sys/" + strings.ReplaceAll(name, ".", "/")))
+		if err != nil {
+			checkPermission("sysctl", err)
+			continue
+		}
+		for i, field := range strings.Fields(string(data)) {
+			if v, err := strconv.ParseFloat(field, 64); err == nil {
+				sysctlSeries.set(sysctlValue, v, name, strconv.Itoa(i))
+			}
+		}
+	}
+	sysctlSeries.sweep()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Extra labels of query targets by instance name
+var (
+	targetLabelsMu sync.RWMutex
+	targetLabels   = make(map[string]map[string]string)
+)
+
+// setTargetLabels sets the extra labels of the instance, removing them if
+// there are none
+func setTargetLabels(instance string, labels map[string]string) {
+	targetLabelsMu.Lock()
+	defer targetLabelsMu.Unlock()
+	if len(labels) == 0 {
+		delete(targetLabels, instance)
+		return
+	}
+	targetLabels[instance] = labels
+}
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func validateTargetLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNameRegexp.MatchString(name) || len(name) >= 2 && name[:2] == "__" {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if name == "instance_name" {
+			return errors.New("instance_name can't be set as a label")
+		}
+	}
+	return nil
+}
+
+// targetLabelGatherer adds the extra labels of query targets to every series
+// with their instance_name. Labels a series already has are kept.
+type targetLabelGatherer struct {
+	prometheus.Gatherer
+}
+
+func (g targetLabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	targetLabelsMu.RLock()
+	defer targetLabelsMu.RUnlock()
+	if len(targetLabels) == 0 {
+		return families, err
+	}
+	for _, family := range families {
+		for _, m := range family.Metric {
+			labels := seriesTargetLabels(m)
+			if labels == nil {
+				continue
+			}
+			have := make(map[string]bool, len(m.Label))
+			for _, l := range m.Label {
+				have[l.GetName()] = true
+			}
+			for name, value := range labels {
+				if !have[name] {
+					m.Label = append(m.Label, &dto.LabelPair{Name: &name, Value: &value})
+				}
+			}
+			sort.Slice(m.Label, func(i, j int) bool { return m.Label[i].GetName() < m.Label[j].GetName() })
+		}
+	}
+	return families, err
+}
+
+// seriesTargetLabels returns the extra labels for the series' instance
+func seriesTargetLabels(m *dto.Metric) map[string]string {
+	for _, l := range m.Label {
+		if l.GetName() == "instance_name" {
+			return targetLabels[l.GetValue()]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// qdisc is the statistics of one queueing discipline, as shown by
+// "tc -s qdisc"
+type qdisc struct {
+	ifindex        int
+	kind           string
+	handle         string
+	parent         string
+	bytes          uint64
+	packets        uint64
+	drops          uint32
+	overlimits     uint32
+	requeues       uint32
+	backlogBytes   uint32
+	backlogPackets uint32
+}
+
+var (
+	tcQdiscBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_tc_qdisc_bytes",
+		Help: "Bytes sent by the qdisc",
+	}, []string{"interface", "kind", "handle", "parent"})
+	tcQdiscPackets = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_tc_qdisc_packets",
+		Help: "Packets sent by the qdisc",
+	}, []string{"interface", "kind", "handle", "parent"})
+	tcQdiscDrops = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_tc_qdisc_drops",
+		Help: "Packets dropped by the qdisc",
+	}, []string{"interface", "kind", "handle", "parent"})
+	tcQdiscOverlimits = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_tc_qdisc_overlimits",
+		Help: "Times the qdisc throttled because traffic was over its rate",
+	}, []string{"interface", "kind", "handle", "parent"})
+	tcQdiscRequeues = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_tc_qdisc_requeues",
+		Help: "Packets the qdisc requeued because the device was busy",
+	}, []string{"interface", "kind", "handle", "parent"})
+	tcQdiscBacklogBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_tc_qdisc_backlog_bytes",
+		Help: "Bytes currently queued in the qdisc",
+	}, []string{"interface", "kind", "handle", "parent"})
+	tcQdiscBacklogPackets = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_tc_qdisc_backlog_packets",
+		Help: "Packets currently queued in the qdisc",
+	}, []string{"interface", "kind", "handle", "parent"})
+)
+
+func init() {
+	prometheus.MustRegister(tcQdiscBytes)
+	prometheus.MustRegister(tcQdiscPackets)
+	prometheus.MustRegister(tcQdiscDrops)
+	prometheus.MustRegister(tcQdiscOverlimits)
+	prometheus.MustRegister(tcQdiscRequeues)
+	prometheus.MustRegister(tcQdiscBacklogBytes)
+	prometheus.MustRegister(tcQdiscBacklogPackets)
+}
+
+var tcSeries = newSeriesGeneration()
+
+// Collect the statistics of the qdiscs, e.g. whether an fq or cake shaper
+// drops game traffic
+func updateTCMetrics() {
+	defer tcSeries.sweep()
+	qdiscs, err := listQdiscs()
+	if err != nil {
+		logCollectorError("tc", "Error listing qdiscs:", err)
+		return
+	}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		logCollectorError("tc", "Error listing interfaces:", err)
+		return
+	}
+	names := make(map[int]string)
+	for _, iface := range interfaces {
+		names[iface.Index] = iface.Name
+	}
+	for _, q := range qdiscs {
+		name, ok := names[q.ifindex]
+		// noqueue, e.g. of loopback and veths, has no statistics
+		if !ok || q.kind == "noqueue" {
+			continue
+		}
+		if name == "lo" && !*networkIncludeLoopback {
+			continue
+		}
+		if networkDeviceFilter.ignored(name) {
+			continue
+		}
+		labels := []string{name, q.kind, q.handle, q.parent}
+		tcSeries.set(tcQdiscBytes, float64(q.bytes), labels...)
+		tcSeries.set(tcQdiscPackets, float64(q.packets), labels...)
+		tcSeries.set(tcQdiscDrops, float64(q.drops), labels...)
+		tcSeries.set(tcQdiscOverlimits, float64(q.overlimits), labels...)
+		tcSeries.set(tcQdiscRequeues, float64(q.requeues), labels...)
+		tcSeries.set(tcQdiscBacklogBytes, float64(q.backlogBytes), labels...)
+		tcSeries.set(tcQdiscBacklogPackets, float64(q.backlogPackets), labels...)
+	}
+}
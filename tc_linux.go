@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+)
+
+// rtnetlink traffic control attributes, from linux/rtnetlink.h and
+// linux/gen_stats.h
+const (
+	rtmGetQdisc   = 0x26
+	sizeofTcMsg   = 20
+	tcaKind       = 1
+	tcaStats      = 3
+	tcaStats2     = 7
+	tcaStatsBasic = 1
+	tcaStatsQueue = 3
+	tcaStatsPkt64 = 8
+	tcHandleRoot  = 0xffffffff
+	tcHandleIngr  = 0xfffffff1
+)
+
+// listQdiscs dumps the qdiscs of all interfaces over rtnetlink, like
+// "tc -s qdisc show"
+func listQdiscs() ([]qdisc, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	// nlmsghdr followed by an all-zero tcmsg, matching every interface
+	req := make([]byte, syscall.NLMSG_HDRLEN+sizeofTcMsg)
+	binary.NativeEndian.PutUint32(req[0:4], uint32(len(req)))
+	binary.NativeEndian.PutUint16(req[4:6], rtmGetQdisc)
+	binary.NativeEndian.PutUint16(req[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	binary.NativeEndian.PutUint32(req[8:12], 1)
+	if err := syscall.Sendto(fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	var qdiscs []qdisc
+	buf := make([]byte, 1<<16)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return qdiscs, nil
+			case syscall.NLMSG_ERROR:
+				if len(m.Data) >= 4 {
+					if errno := int32(binary.NativeEndian.Uint32(m.Data[0:4])); errno != 0 {
+						return nil, syscall.Errno(-errno)
+					}
+				}
+				return qdiscs, nil
+			}
+			if len(m.Data) < sizeofTcMsg {
+				continue
+			}
+			qdiscs = append(qdiscs, parseQdisc(m.Data))
+		}
+	}
+}
+
+// parseQdisc reads a tcmsg and its attributes
+func parseQdisc(data []byte) qdisc {
+	q := qdisc{
+		ifindex: int(int32(binary.NativeEndian.Uint32(data[4:8]))),
+		handle:  formatTcHandle(binary.NativeEndian.Uint32(data[8:12])),
+		parent:  formatTcHandle(binary.NativeEndian.Uint32(data[12:16])),
+	}
+	attrs := parseNetlinkAttrs(data[sizeofTcMsg:])
+	if kind, ok := attrs[tcaKind]; ok && len(kind) > 0 {
+		q.kind = string(kind[:len(kind)-1]) // NUL terminated
+	}
+	if stats, ok := attrs[tcaStats2]; ok {
+		nested := parseNetlinkAttrs(stats)
+		// struct gnet_stats_basic { __u64 bytes; __u32 packets; }
+		if b := nested[tcaStatsBasic]; len(b) >= 12 {
+			q.bytes = binary.NativeEndian.Uint64(b[0:8])
+			q.packets = uint64(binary.NativeEndian.Uint32(b[8:12]))
+		}
+		// The 32-bit packet counter wraps, newer kernels add a 64-bit one
+		if b := nested[tcaStatsPkt64]; len(b) >= 8 {
+			q.packets = binary.NativeEndian.Uint64(b[0:8])
+		}
+		// struct gnet_stats_queue { qlen, backlog, drops, requeues, overlimits }
+		if b := nested[tcaStatsQueue]; len(b) >= 20 {
+			q.backlogPackets = binary.NativeEndian.Uint32(b[0:4])
+			q.backlogBytes = binary.NativeEndian.Uint32(b[4:8])
+			q.drops = binary.NativeEndian.Uint32(b[8:12])
+			q.requeues = binary.NativeEndian.Uint32(b[12:16])
+			q.overlimits = binary.NativeEndian.Uint32(b[16:20])
+		}
+	} else if b := attrs[tcaStats]; len(b) >= 32 {
+		// struct tc_stats of old kernels: bytes, packets, drops,
+		// overlimits, bps, pps, qlen, backlog
+		q.bytes = binary.NativeEndian.Uint64(b[0:8])
+		q.packets = uint64(binary.NativeEndian.Uint32(b[8:12]))
+		q.drops = binary.NativeEndian.Uint32(b[12:16])
+		q.overlimits = binary.NativeEndian.Uint32(b[16:20])
+		q.backlogPackets = binary.NativeEndian.Uint32(b[24:28])
+		q.backlogBytes = binary.NativeEndian.Uint32(b[28:32])
+	}
+	return q
+}
+
+// parseNetlinkAttrs splits a sequence of rtattrs by type
+func parseNetlinkAttrs(b []byte) map[uint16][]byte {
+	attrs := make(map[uint16][]byte)
+	for len(b) >= syscall.SizeofRtAttr {
+		length := int(binary.NativeEndian.Uint16(b[0:2]))
+		if length < syscall.SizeofRtAttr || length > len(b) {
+			break
+		}
+		// Strip the NLA_F_NESTED and NLA_F_NET_BYTEORDER flags
+		attrs[binary.NativeEndian.Uint16(b[2:4])&0x3fff] = b[syscall.SizeofRtAttr:length]
+		aligned := (length + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+		if aligned > len(b) {
+			break
+		}
+		b = b[aligned:]
+	}
+	return attrs
+}
+
+// formatTcHandle formats a handle like tc, "major:minor" in hex
+func formatTcHandle(h uint32) string {
+	switch h {
+	case tcHandleRoot:
+		return "root"
+	case tcHandleIngr:
+		return "ingress"
+	}
+	if h&0xffff == 0 {
+		return fmt.Sprintf("%x:", h>>16)
+	}
+	return fmt.Sprintf("%x:%x", h>>16, h&0xffff)
+}
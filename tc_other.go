@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func listQdiscs() ([]qdisc, error) {
+	return nil, errors.ErrUnsupported
+}
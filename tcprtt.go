@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/rlimit"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TCP RTT and retransmissions of connections accepted on game ports, from a
+// sock_ops eBPF program attached to the root cgroup
+var (
+	tcpRTTEnabled    = flag.Bool("collector.tcp-rtt", false, "Enable eBPF TCP RTT and retransmission metrics for game ports (requires root or CAP_BPF and cgroup v2).")
+	tcpRTTPorts      = flag.String("collector.tcp-rtt.ports", "", "Comma-separated TCP game ports to measure (e.g. 25565,27015).")
+	tcpRTTCgroupPath = flag.String("collector.tcp-rtt.cgroup-path", "", "cgroup v2 mountpoint to attach to (default autodetect under the sysfs path).")
+)
+
+const (
+	// struct bpf_sock_ops offsets and sock_ops constants (include/uapi/linux/bpf.h)
+	sockOpsOpOffset        = 0
+	sockOpsLocalPortOffset = 68
+	sockOpsSrttOffset      = 80
+
+	sockOpsPassiveEstablishedCB = 5
+	sockOpsRetransCB            = 9
+	sockOpsRTTCB                = 12
+
+	sockOpsRetransCBFlag = 1 << 1
+	sockOpsRTTCBFlag     = 1 << 3
+
+	// Map key slots per port, stored in the upper 16 bits of the key
+	rttSlotRetrans = 0
+	rttSlotSum     = 1
+	rttSlotBucket  = 2 // First histogram bucket
+)
+
+// RTT histogram bucket upper bounds in microseconds
+var tcpRTTBuckets = []int32{1000, 2500, 5000, 10000, 25000, 50000, 100000, 250000, 500000, 1000000}
+
+var (
+	tcpRTTPortList []uint16
+	tcpRTTMap      *ebpf.Map
+	tcpRTTStarted  time.Time // Created timestamp of the native histograms
+	tcpRTTLink     link.Link
+)
+
+var (
+	tcpRTTDesc = prometheus.NewDesc("game_tcp_rtt_seconds",
+		"Smoothed RTT samples of TCP connections accepted on the game port",
+		[]string{"port"}, nil)
+	tcpRetransmitsDesc = prometheus.NewDesc("game_tcp_retransmits_total",
+		"TCP retransmissions on connections accepted on the game port",
+		[]string{"port"}, nil)
+)
+
+func rttKey(port uint16, slot int) uint32 {
+	return uint32(port) | uint32(slot)<<16
+}
+
+// tcpRTTProgram enables RTT and retransmit callbacks on connections accepted
+// on a configured port, then accumulates them into the map
+func tcpRTTProgram(counters *ebpf.Map) asm.Instructions {
+	insns := asm.Instructions{
+		asm.Mov.Reg(asm.R6, asm.R1),
+		asm.LoadMem(asm.R7, asm.R6, sockOpsOpOffset, asm.Word),
+		asm.LoadMem(asm.R8, asm.R6, sockOpsLocalPortOffset, asm.Word),
+		asm.JEq.Imm(asm.R7, sockOpsPassiveEstablishedCB, "established"),
+		asm.JEq.Imm(asm.R7, sockOpsRTTCB, "rtt"),
+		asm.JEq.Imm(asm.R7, sockOpsRetransCB, "retrans"),
+		asm.Ja.Label("out"),
+
+		// Established: only sockets whose port is in the map get callbacks
+		asm.Mov.Reg(asm.R2, asm.R8).WithSymbol("established"),
+		asm.StoreMem(asm.RFP, -4, asm.R2, asm.Word),
+		asm.LoadMapPtr(asm.R1, counters.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -4),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "out"),
+		asm.Mov.Reg(asm.R1, asm.R6),
+		asm.Mov.Imm(asm.R2, sockOpsRTTCBFlag|sockOpsRetransCBFlag),
+		asm.FnSockOpsCbFlagsSet.Call(),
+		asm.Ja.Label("out"),
+
+		// Retransmission: count += 1
+		asm.Mov.Reg(asm.R2, asm.R8).WithSymbol("retrans"),
+		asm.StoreMem(asm.RFP, -4, asm.R2, asm.Word),
+		asm.LoadMapPtr(asm.R1, counters.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -4),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "out"),
+		asm.Mov.Imm(asm.R1, 1),
+		asm.StoreXAdd(asm.R0, asm.R1, asm.DWord),
+		asm.Ja.Label("out"),
+
+		// RTT sample: srtt_us is stored << 3
+		asm.LoadMem(asm.R9, asm.R6, sockOpsSrttOffset, asm.Word).WithSymbol("rtt"),
+		asm.RSh.Imm(asm.R9, 3),
+		// sum += srtt
+		asm.Mov.Reg(asm.R2, asm.R8),
+		asm.Or.Imm(asm.R2, rttSlotSum<<16),
+		asm.StoreMem(asm.RFP, -4, asm.R2, asm.Word),
+		asm.LoadMapPtr(asm.R1, counters.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -4),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "out"),
+		asm.StoreXAdd(asm.R0, asm.R9, asm.DWord),
+	}
+
+	// Find the bucket slot for the sample into R2
+	for i, bound := range tcpRTTBuckets {
+		insns = append(insns, asm.JLT.Imm(asm.R9, bound, fmt.Sprintf("bucket%d", i)))
+	}
+	insns = append(insns,
+		asm.Mov.Imm(asm.R2, int32(rttSlotBucket+len(tcpRTTBuckets))),
+		asm.Ja.Label("count"),
+	)
+	for i := range tcpRTTBuckets {
+		insns = append(insns,
+			asm.Mov.Imm(asm.R2, int32(rttSlotBucket+i)).WithSymbol(fmt.Sprintf("bucket%d", i)),
+			asm.Ja.Label("count"),
+		)
+	}
+
+	return append(insns,
+		// bucket[slot] += 1
+		asm.LSh.Imm(asm.R2, 16).WithSymbol("count"),
+		asm.Or.Reg(asm.R2, asm.R8),
+		asm.StoreMem(asm.RFP, -4, asm.R2, asm.Word),
+		asm.LoadMapPtr(asm.R1, counters.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -4),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "out"),
+		asm.Mov.Imm(asm.R1, 1),
+		asm.StoreXAdd(asm.R0, asm.R1, asm.DWord),
+
+		asm.Mov.Imm(asm.R0, 1).WithSymbol("out"),
+		asm.Return(),
+	)
+}
+
+func parseTCPRTTPorts(s string) ([]uint16, error) {
+	var ports []uint16
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		port, err := strconv.ParseUint(item, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", item)
+		}
+		ports = append(ports, uint16(port))
+	}
+	if len(ports) == 0 {
+		return nil, errors.New("no ports configured")
+	}
+	return ports, nil
+}
+
+// Load and attach the sock_ops program and register the metrics
+func startTCPRTT() error {
+	ports, err := parseTCPRTTPorts(*tcpRTTPorts)
+	if err != nil {
+		return err
+	}
+	cgroupPath, err := findCgroup2Path(*tcpRTTCgroupPath)
+	if err != nil {
+		return err
+	}
+	if err := rlimit.RemoveMemlock(); err != nil {
+		return err
+	}
+
+	if *nativeHistograms {
+		tcpRTTBuckets = tcpRTTNativeBuckets()
+	}
+	slots := rttSlotBucket + len(tcpRTTBuckets) + 1
+	counters, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "game_tcp_rtt",
+		Type:       ebpf.Hash,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: uint32(len(ports) * slots),
+	})
+	if err != nil {
+		return fmt.Errorf("creating map: %w", err)
+	}
+	for _, port := range ports {
+		for slot := 0; slot < slots; slot++ {
+			if err := counters.Put(rttKey(port, slot), uint64(0)); err != nil {
+				counters.Close()
+				return fmt.Errorf("populating map: %w", err)
+			}
+		}
+	}
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Name:         "game_tcp_rtt",
+		Type:         ebpf.SockOps,
+		AttachType:   ebpf.AttachCGroupSockOps,
+		Instructions: tcpRTTProgram(counters),
+		License:      "GPL",
+	})
+	if err != nil {
+		counters.Close()
+		return fmt.Errorf("loading program: %w", err)
+	}
+	defer prog.Close()
+	l, err := link.AttachCgroup(link.CgroupOptions{Path: cgroupPath, Attach: ebpf.AttachCGroupSockOps, Program: prog})
+	if err != nil {
+		counters.Close()
+		return fmt.Errorf("attaching to %s: %w", cgroupPath, err)
+	}
+
+	tcpRTTPortList = ports
+	tcpRTTMap = counters
+	tcpRTTStarted = time.Now()
+	tcpRTTLink = l
+	prometheus.MustRegister(tcpRTTCollector{})
+	return nil
+}
+
+// tcpRTTCollector reads the eBPF map at scrape time, since histograms can't be
+// set from the collection loop like gauges
+type tcpRTTCollector struct{}
+
+func (tcpRTTCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tcpRTTDesc
+	ch <- tcpRetransmitsDesc
+}
+
+func (tcpRTTCollector) Collect(ch chan<- prometheus.Metric) {
+	lookup := func(port uint16, slot int) (uint64, error) {
+		var value uint64
+		err := tcpRTTMap.Lookup(rttKey(port, slot), &value)
+		return value, err
+	}
+	for _, port := range tcpRTTPortList {
+		label := strconv.Itoa(int(port))
+
+		retrans, err := lookup(port, rttSlotRetrans)
+		if err != nil {
+			log.Println("Error reading TCP RTT map:", err)
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(tcpRetransmitsDesc, prometheus.CounterValue, float64(retrans), label)
+
+		sumMicros, err := lookup(port, rttSlotSum)
+		if err != nil {
+			log.Println("Error reading TCP RTT map:", err)
+			return
+		}
+		counts := make([]uint64, len(tcpRTTBuckets)+1)
+		for i := range counts {
+			count, err := lookup(port, rttSlotBucket+i)
+			if err != nil && i < len(tcpRTTBuckets) {
+				log.Println("Error reading TCP RTT map:", err)
+				return
+			}
+			counts[i] = count
+		}
+		sum := float64(sumMicros) / 1e6
+		if *nativeHistograms {
+			// Bucket i is 2^exp s, the overflow goes into the next one
+			buckets := make(map[int]int64, len(counts))
+			var total uint64
+			for i, count := range counts {
+				if count > 0 {
+					buckets[tcpRTTNativeMinExp+i] = int64(count)
+				}
+				total += count
+			}
+			ch <- prometheus.MustNewConstNativeHistogram(tcpRTTDesc, total, sum, buckets, nil, 0, 0,
+				prometheus.DefNativeHistogramZeroThreshold, tcpRTTStarted, label)
+			continue
+		}
+		buckets := make(map[float64]uint64, len(tcpRTTBuckets))
+		var cumulative uint64
+		for i, bound := range tcpRTTBuckets {
+			cumulative += counts[i]
+			buckets[float64(bound)/1e6] = cumulative
+		}
+		ch <- prometheus.MustNewConstHistogram(tcpRTTDesc, cumulative+counts[len(tcpRTTBuckets)], sum, buckets, label)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	tcpListenOverflows = prometheus.NewDesc("game_tcp_listen_overflows_total",
+		"Times a listen socket's accept queue overflowed since boot (TcpExt ListenOverflows)", nil, nil)
+	tcpListenDrops = prometheus.NewDesc("game_tcp_listen_drops_total",
+		"SYNs to listen sockets dropped since boot (TcpExt ListenDrops)", nil, nil)
+	tcpConnectionEvents = prometheus.NewDesc("game_tcp_connection_events_total",
+		"Host-wide TCP connection events since boot (passive_opens, out_rsts, estab_resets, syncookies_sent)",
+		[]string{"event"}, nil)
+
+	tcpStatCounters = newCounterSeries(tcpListenOverflows, tcpListenDrops, tcpConnectionEvents)
+
+	tcpAcceptQueue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_tcp_accept_queue",
+		Help: "Connections waiting in the accept queue of listening game ports",
+	}, []string{"port"})
+	tcpSynRecv = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_tcp_syn_recv",
+		Help: "Half-open connections (SYN_RECV) of listening game ports; a SYN flood against a port shows here. Not counted while SYN cookies are sent.",
+	}, []string{"port"})
+)
+
+func init() {
+	prometheus.MustRegister(tcpStatCounters)
+	prometheus.MustRegister(tcpAcceptQueue)
+	prometheus.MustRegister(tcpSynRecv)
+}
+
+// getProtoCounters parses files like /proc/net/netstat and /proc/net/snmp,
+// where each protocol has a header line of names followed by a line of values
+func getProtoCounters(name string) map[string]map[string]float64 {
+	data, err := os.ReadFile(procFilePath(name))
+	if err != nil {
+		logCollectorError("tcpstat", "Error reading", procFilePath(name)+":", err)
+		return nil
+	}
+	counters := make(map[string]map[string]float64)
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i+1 < len(lines); i += 2 {
+		names := strings.Fields(lines[i])
+		values := strings.Fields(lines[i+1])
+		if len(names) == 0 || len(names) != len(values) || names[0] != values[0] {
+			continue
+		}
+		proto := strings.TrimSuffix(names[0], ":")
+		counters[proto] = make(map[string]float64)
+		for j := 1; j < len(names); j++ {
+			value, _ := strconv.ParseFloat(values[j], 64)
+			counters[proto][names[j]] = value
+		}
+	}
+	return counters
+}
+
+// Series of the listening game ports, to drop those of closed ones
+var tcpStatSeries = newSeriesGeneration()
+
+// Collect listen queue, connection event counters, accept queue depths and
+// half-open connections per game port. Game ports are the configured ports of
+// the instances and those the game processes listen on, e.g. RCON.
+func updateTCPStatMetrics(processes []gameProcess) {
+	if tcpExt, ok := getProtoCounters("net/netstat")["TcpExt"]; ok {
+		tcpStatCounters.set(tcpListenOverflows, tcpExt["ListenOverflows"])
+		tcpStatCounters.set(tcpListenDrops, tcpExt["ListenDrops"])
+		tcpStatCounters.set(tcpConnectionEvents, tcpExt["SyncookiesSent"], "syncookies_sent")
+	}
+	if tcp, ok := getProtoCounters("net/snmp")["Tcp"]; ok {
+		tcpStatCounters.set(tcpConnectionEvents, tcp["PassiveOpens"], "passive_opens")
+		tcpStatCounters.set(tcpConnectionEvents, tcp["OutRsts"], "out_rsts")
+		tcpStatCounters.set(tcpConnectionEvents, tcp["EstabResets"], "estab_resets")
+	}
+	tcpStatCounters.sweep()
+
+	gamePorts := make(map[string]bool)
+	for _, inst := range gameInstances {
+		if inst.port > 0 {
+			gamePorts[strconv.Itoa(inst.port)] = true
+		}
+	}
+	owners := gameSocketOwners(processes)
+	sockets := readTCPSockets()
+	for _, sock := range sockets {
+		if _, owned := owners[sock.inode]; owned && sock.state == "LISTEN" {
+			gamePorts[sock.localPort] = true
+		}
+	}
+
+	// For LISTEN sockets the rx_queue column is the accept queue length
+	queues := make(map[string]float64)
+	synRecv := make(map[string]float64)
+	for _, sock := range sockets {
+		if !gamePorts[sock.localPort] {
+			continue
+		}
+		switch sock.state {
+		case "LISTEN":
+			queues[sock.localPort] += float64(sock.rxQueue)
+			// Listening ports without half-open connections export 0
+			if _, ok := synRecv[sock.localPort]; !ok {
+				synRecv[sock.localPort] = 0
+			}
+		case "SYN_RECV":
+			synRecv[sock.localPort]++
+		}
+	}
+	for port, depth := range queues {
+		tcpStatSeries.set(tcpAcceptQueue, depth, port)
+	}
+	for port, count := range synRecv {
+		tcpStatSeries.set(tcpSynRecv, count, port)
+	}
+	tcpStatSeries.sweep()
+}
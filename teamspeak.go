@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// teamspeakClient is a TeamSpeak 3 ServerQuery connection, kept open between
+// queries so the server's flood protection and query log stay quiet
+type teamspeakClient struct {
+	address  string
+	username string
+	password string
+	conn     net.Conn
+	r        *bufio.Reader
+}
+
+// ServerQuery escapes in keys and values
+var teamspeakUnescaper = strings.NewReplacer(`\\`, `\`, `\/`, `/`, `\s`, " ", `\p`, "|",
+	`\a`, "\a", `\b`, "\b", `\f`, "\f", `\n`, "\n", `\r`, "\r", `\t`, "\t", `\v`, "\v")
+
+var teamspeakEscaper = strings.NewReplacer(`\`, `\\`, `/`, `\/`, " ", `\s`, "|", `\p`,
+	"\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// parseTeamSpeak splits a reply into its items, separated by |, each made of
+// space separated key=value pairs
+func parseTeamSpeak(reply string) []map[string]string {
+	var items []map[string]string
+	for _, item := range strings.Split(reply, "|") {
+		values := make(map[string]string)
+		for _, field := range strings.Fields(item) {
+			key, value, _ := strings.Cut(field, "=")
+			values[key] = teamspeakUnescaper.Replace(value)
+		}
+		items = append(items, values)
+	}
+	return items
+}
+
+// readLine returns the next line without its "\n\r" ending
+func (c *teamspeakClient) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(line, "\r\n"), nil
+}
+
+// connect opens the connection, skips the greeting and logs in
+func (c *teamspeakClient) connect() error {
+	conn, err := net.DialTimeout("tcp", c.address, *queryTimeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+	c.conn.SetDeadline(time.Now().Add(*queryTimeout))
+	// "TS3" and a welcome line
+	for range 2 {
+		if _, err := c.readLine(); err != nil {
+			return err
+		}
+	}
+	if c.username != "" {
+		if _, err := c.command("login client_login_name=" + teamspeakEscaper.Replace(c.username) +
+			" client_login_password=" + teamspeakEscaper.Replace(c.password)); err != nil {
+			return fmt.Errorf("login: %w", err)
+		}
+	}
+	return nil
+}
+
+// command runs a command and returns its reply, all lines before the
+// closing "error id=0 msg=ok"
+func (c *teamspeakClient) command(cmd string) (string, error) {
+	c.conn.SetDeadline(time.Now().Add(*queryTimeout))
+	if _, err := c.conn.Write([]byte(cmd + "\n")); err != nil {
+		return "", err
+	}
+	var reply []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return "", err
+		}
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "error ") {
+			status := parseTeamSpeak(line[len("error "):])[0]
+			if status["id"] != "0" {
+				return "", fmt.Errorf("%s: error %s: %s", strings.Fields(cmd)[0], status["id"], status["msg"])
+			}
+			return strings.Join(reply, "\n"), nil
+		}
+		reply = append(reply, line)
+	}
+}
+
+func (c *teamspeakClient) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// query reads every online virtual server, reconnecting if the connection
+// was lost
+func (c *teamspeakClient) query() ([]voiceServer, error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	servers, err := c.queryServers()
+	if err != nil {
+		c.close()
+	}
+	return servers, err
+}
+
+func (c *teamspeakClient) queryServers() ([]voiceServer, error) {
+	reply, err := c.command("serverlist")
+	if err != nil {
+		return nil, err
+	}
+	var servers []voiceServer
+	for _, item := range parseTeamSpeak(reply) {
+		if item["virtualserver_status"] != "online" {
+			continue
+		}
+		if _, err := c.command("use sid=" + item["virtualserver_id"]); err != nil {
+			return nil, err
+		}
+		reply, err := c.command("serverinfo")
+		if err != nil {
+			return nil, err
+		}
+		info := parseTeamSpeak(reply)[0]
+		number := func(key string) float64 {
+			v, err := strconv.ParseFloat(info[key], 64)
+			if err != nil {
+				return -1
+			}
+			return v
+		}
+		s := voiceServer{
+			id:                   info["virtualserver_port"],
+			name:                 info["virtualserver_name"],
+			version:              info["virtualserver_version"],
+			clients:              number("virtualserver_clientsonline") - number("virtualserver_queryclientsonline"),
+			maxClients:           number("virtualserver_maxclients"),
+			channels:             number("virtualserver_channelsonline"),
+			sentPerSecond:        number("connection_bandwidth_sent_last_second_total"),
+			recvPerSecond:        number("connection_bandwidth_received_last_second_total"),
+			sentBytes:            number("connection_bytes_sent_total"),
+			recvBytes:            number("connection_bytes_received_total"),
+			clientBandwidthLimit: -1,
+		}
+		if s.id == "" {
+			s.id = item["virtualserver_id"]
+		}
+		if number("virtualserver_queryclientsonline") < 0 {
+			s.clients = number("virtualserver_clientsonline")
+		}
+		servers = append(servers, s)
+	}
+	return servers, nil
+}
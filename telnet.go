@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+)
+
+// telnetConfig is the options of a telnet target, a game with a telnet admin
+// console such as 7 Days to Die or modded Valheim. Every query logs in, runs
+// the command and extracts values from its output with regexps.
+type telnetConfig struct {
+	Address    string             `yaml:"address"`
+	Login      []telnetStep       `yaml:"login"`
+	Command    string             `yaml:"command"`
+	Expect     string             `yaml:"expect"`      // End of the command's output, default all patterns matched
+	Players    string             `yaml:"players"`     // Pattern of the player count for game_query_players
+	MaxPlayers string             `yaml:"max_players"` // Pattern of the slots for game_query_max_players
+	Values     []queryValueConfig `yaml:"values"`
+}
+
+// telnetStep waits for the console to print expect, then sends a line if
+// send is set
+type telnetStep struct {
+	Expect string `yaml:"expect"`
+	Send   string `yaml:"send"`
+}
+
+// Telnet commands
+const (
+	telnetIAC  = 255
+	telnetDont = 254
+	telnetDo   = 253
+	telnetWont = 252
+	telnetWill = 251
+	telnetSB   = 250
+	telnetSE   = 240
+)
+
+func init() {
+	registerQueryDriver("telnet", func(target queryConfig) (querier, error) {
+		var c telnetConfig
+		if err := target.decodeOptions(&c); err != nil {
+			return nil, err
+		}
+		return newTelnetTarget(c, target.timeout())
+	})
+}
+
+// telnetTarget is one configured console with its compiled patterns
+type telnetTarget struct {
+	telnetConfig
+	timeout  time.Duration
+	login    []*regexp.Regexp
+	expect   *regexp.Regexp
+	patterns *outputPatterns
+}
+
+func newTelnetTarget(c telnetConfig, timeout time.Duration) (querier, error) {
+	if c.Address == "" || c.Command == "" {
+		return nil, errors.New("address and command are required")
+	}
+	t := &telnetTarget{telnetConfig: c, timeout: timeout}
+	var err error
+	if t.patterns, err = newOutputPatterns(c.Players, c.MaxPlayers, c.Values); err != nil {
+		return nil, err
+	}
+	if t.expect, err = compileOptional(c.Expect); err != nil {
+		return nil, err
+	}
+	for _, step := range c.Login {
+		re, err := regexp.Compile(step.Expect)
+		if err != nil {
+			return nil, err
+		}
+		t.login = append(t.login, re)
+	}
+	return t, nil
+}
+
+// telnetConn reads console output with telnet option negotiation removed
+type telnetConn struct {
+	conn net.Conn
+	buf  []byte // Output not consumed by an expect yet
+}
+
+// read appends the next chunk of output to the buffer, refusing every option
+// the server asks for
+func (c *telnetConn) read() error {
+	raw := make([]byte, 4096)
+	n, err := c.conn.Read(raw)
+	if err != nil {
+		return err
+	}
+	var reply []byte
+	for i := 0; i < n; i++ {
+		if raw[i] != telnetIAC || i+1 >= n {
+			c.buf = append(c.buf, raw[i])
+			continue
+		}
+		i++
+		switch raw[i] {
+		case telnetIAC:
+			c.buf = append(c.buf, telnetIAC)
+		case telnetDo, telnetDont, telnetWill, telnetWont:
+			if i+1 < n {
+				i++
+				if raw[i-1] == telnetDo {
+					reply = append(reply, telnetIAC, telnetWont, raw[i])
+				} else if raw[i-1] == telnetWill {
+					reply = append(reply, telnetIAC, telnetDont, raw[i])
+				}
+			}
+		case telnetSB:
+			for i < n && !(raw[i-1] == telnetIAC && raw[i] == telnetSE) {
+				i++
+			}
+		}
+	}
+	if reply != nil {
+		_, err = c.conn.Write(reply)
+	}
+	return err
+}
+
+// expect reads until the output matches re and consumes it up to the match
+func (c *telnetConn) expect(re *regexp.Regexp) error {
+	for {
+		if loc := re.FindIndex(c.buf); loc != nil {
+			c.buf = c.buf[loc[1]:]
+			return nil
+		}
+		if err := c.read(); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *telnetConn) send(line string) error {
+	_, err := c.conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+// query logs in, runs the command and reads its output until the expect
+// pattern or all value patterns matched. The time to the first output after
+// the command is the latency.
+func (t *telnetTarget) query() (*serverInfo, []playerInfo, error) {
+	conn, err := net.DialTimeout("tcp", t.Address, t.timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(t.timeout))
+	c := &telnetConn{conn: conn}
+	for i, step := range t.Login {
+		if err := c.expect(t.login[i]); err != nil {
+			return nil, nil, fmt.Errorf("login: waiting for %q: %w", step.Expect, err)
+		}
+		if step.Send == "" {
+			continue
+		}
+		if err := c.send(step.Send); err != nil {
+			return nil, nil, err
+		}
+	}
+	// Drop what the console printed after logging in
+	c.buf = nil
+	start := time.Now()
+	if err := c.send(t.Command); err != nil {
+		return nil, nil, err
+	}
+	info := &serverInfo{}
+	for !t.complete(c.buf) {
+		err := c.read()
+		if info.latency == 0 {
+			info.latency = time.Since(start)
+		}
+		if err != nil {
+			var netErr net.Error
+			// Some patterns may never match, e.g. without players online
+			if errors.As(err, &netErr) && netErr.Timeout() && t.expect == nil && t.patterns.matchedAny(c.buf) {
+				break
+			}
+			return nil, nil, err
+		}
+	}
+	t.patterns.apply(info, c.buf)
+	return info, nil, nil
+}
+
+// complete tells whether the command's output is all there
+func (t *telnetTarget) complete(output []byte) bool {
+	if t.expect != nil {
+		return t.expect.Match(output)
+	}
+	return t.patterns.matchedAll(output)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var webUI = flag.Bool("web.ui", true, "Serve a dashboard with charts of CPU, memory, network and players on /.")
+
+//go:embed ui/index.html
+var uiPage []byte
+
+// uiData is what the dashboard polls from /ui/data
+type uiData struct {
+	Host    string                 `json:"host"`
+	Time    float64                `json:"time"`
+	CPU     float64                `json:"cpu"`    // Percent
+	Memory  float64                `json:"memory"` // Percent
+	Load    float64                `json:"load"`   // 1m
+	Network map[string]uiInterface `json:"network"`
+	Players map[string]uiInstance  `json:"players"`
+}
+
+type uiInterface struct {
+	In  float64 `json:"in"` // bps
+	Out float64 `json:"out"`
+}
+
+type uiInstance struct {
+	Up      bool    `json:"up"`
+	Players float64 `json:"players"`
+	Max     float64 `json:"max"`
+}
+
+// startUI serves the dashboard, if enabled
+func startUI() {
+	if !*webUI {
+		return
+	}
+	http.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(uiPage)
+	})
+	http.HandleFunc("GET /ui/data", uiDataHandler)
+}
+
+func uiDataHandler(w http.ResponseWriter, r *http.Request) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil && len(families) == 0 {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	host, _ := os.Hostname()
+	data := uiData{
+		Host:    host,
+		Time:    float64(time.Now().UnixMilli()) / 1000,
+		Network: make(map[string]uiInterface),
+		Players: make(map[string]uiInstance),
+	}
+	first := func(s metricSelector) float64 {
+		if samples := s.selectSamples(families); len(samples) > 0 {
+			return samples[0].value
+		}
+		return 0
+	}
+	data.CPU = first(metricSelector{Metric: "game_cpu_usage_percent"})
+	data.Memory = first(metricSelector{Metric: "game_memory_usage_percent"})
+	data.Load = first(metricSelector{Metric: "game_system_load", Labels: map[string]string{"duration": "1m"}})
+	for _, s := range (metricSelector{Metric: "game_network", Labels: map[string]string{"metric": "bps"}}).selectSamples(families) {
+		iface := data.Network[s.labels["interface"]]
+		switch s.labels["activity"] {
+		case "in":
+			iface.In = s.value
+		case "out":
+			iface.Out = s.value
+		}
+		data.Network[s.labels["interface"]] = iface
+	}
+	instances := func(metric string, set func(*uiInstance, float64)) {
+		for _, s := range (metricSelector{Metric: metric}).selectSamples(families) {
+			inst := data.Players[s.labels["instance_name"]]
+			set(&inst, s.value)
+			data.Players[s.labels["instance_name"]] = inst
+		}
+	}
+	instances("game_query_up", func(i *uiInstance, v float64) { i.Up = v == 1 })
+	instances("game_query_players", func(i *uiInstance, v float64) { i.Players = v })
+	instances("game_query_max_players", func(i *uiInstance, v float64) { i.Max = v })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// voiceConfig is one entry of the voice config section, a TeamSpeak 3 server
+// queried over ServerQuery or a Mumble server answering pings
+type voiceConfig struct {
+	Instance string `yaml:"instance"`
+	Type     string `yaml:"type"`     // teamspeak or mumble
+	Address  string `yaml:"address"`  // ServerQuery port (10011) or Mumble port (64738)
+	Username string `yaml:"username"` // ServerQuery login, e.g. serveradmin
+	Password string `yaml:"password"`
+}
+
+var (
+	voiceUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_voice_up",
+		Help: "Whether the voice server answered the last query",
+	}, []string{"instance_name"})
+	voiceServerInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_voice_server_info",
+		Help: "Name and version of the virtual server, always 1",
+	}, []string{"instance_name", "server", "name", "version"})
+	voiceClients = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_voice_clients",
+		Help: "Clients connected to the virtual server, not counting query clients",
+	}, []string{"instance_name", "server"})
+	voiceMaxClients = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_voice_max_clients",
+		Help: "Client slots of the virtual server",
+	}, []string{"instance_name", "server"})
+	voiceChannels = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_voice_channels",
+		Help: "Channels of the virtual server (TeamSpeak)",
+	}, []string{"instance_name", "server"})
+	voiceBandwidth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_voice_bandwidth_bytes_per_second",
+		Help: "Bandwidth of the virtual server over the last second by direction (TeamSpeak)",
+	}, []string{"instance_name", "server", "direction"})
+	voiceBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_voice_bytes",
+		Help: "Bytes transferred by the virtual server since it started by direction (TeamSpeak)",
+	}, []string{"instance_name", "server", "direction"})
+	voiceClientBandwidthLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_voice_client_bandwidth_limit_bits_per_second",
+		Help: "Maximum bandwidth allowed per client (Mumble)",
+	}, []string{"instance_name", "server"})
+)
+
+func init() {
+	prometheus.MustRegister(voiceUp)
+	prometheus.MustRegister(voiceServerInfo)
+	prometheus.MustRegister(voiceClients)
+	prometheus.MustRegister(voiceMaxClients)
+	prometheus.MustRegister(voiceChannels)
+	prometheus.MustRegister(voiceBandwidth)
+	prometheus.MustRegister(voiceBytes)
+	prometheus.MustRegister(voiceClientBandwidthLimit)
+}
+
+// Per virtual server series, removed when the server goes away
+var voiceServerVecs = []*prometheus.GaugeVec{voiceServerInfo, voiceClients, voiceMaxClients, voiceChannels, voiceBandwidth, voiceBytes, voiceClientBandwidthLimit}
+
+// voiceServer is one virtual server; negative values weren't reported
+type voiceServer struct {
+	id, name, version            string
+	clients, maxClients          float64
+	channels                     float64
+	sentPerSecond, recvPerSecond float64
+	sentBytes, recvBytes         float64
+	clientBandwidthLimit         float64
+}
+
+func validateVoice(configs []voiceConfig) error {
+	instances := make(map[string]bool)
+	for _, c := range configs {
+		if c.Instance == "" || c.Address == "" {
+			return errors.New("voice: instance and address are required")
+		}
+		switch c.Type {
+		case "teamspeak":
+		case "mumble":
+		default:
+			return fmt.Errorf("voice %q: type must be teamspeak or mumble", c.Instance)
+		}
+		if instances[c.Instance] {
+			return fmt.Errorf("voice %q defined twice", c.Instance)
+		}
+		instances[c.Instance] = true
+	}
+	return nil
+}
+
+// setVoiceValue exports a value if the server reported it
+func setVoiceValue(g *prometheus.GaugeVec, value float64, labels ...string) {
+	if value >= 0 {
+		g.WithLabelValues(labels...).Set(value)
+	}
+}
+
+// Start querying the configured voice servers in the background
+func startVoice(configs []voiceConfig) {
+	for _, c := range configs {
+		if c.Type == "mumble" {
+			go runVoiceQueries(c.Type, c.Instance, func() ([]voiceServer, error) { return pingMumble(c.Address) })
+			continue
+		}
+		client := &teamspeakClient{address: c.Address, username: c.Username, password: c.Password}
+		go runVoiceQueries(c.Type, c.Instance, client.query)
+	}
+}
+
+// runVoiceQueries queries one voice server every interval
+func runVoiceQueries(protocol, instance string, query func() ([]voiceServer, error)) {
+	servers := make(map[string]bool)
+	for {
+		start := time.Now()
+		result, err := query()
+		observeQuery(protocol, instance, time.Since(start), err, "")
+		if err != nil {
+			log.Println("Error querying voice server", instance+":", err)
+			voiceUp.WithLabelValues(instance).Set(0)
+		} else {
+			voiceUp.WithLabelValues(instance).Set(1)
+		}
+
+		seen := make(map[string]bool)
+		for _, s := range result {
+			seen[s.id] = true
+			// The info series is replaced when the name or version changes
+			voiceServerInfo.DeletePartialMatch(prometheus.Labels{"instance_name": instance, "server": s.id})
+			voiceServerInfo.WithLabelValues(instance, s.id, s.name, s.version).Set(1)
+			setVoiceValue(voiceClients, s.clients, instance, s.id)
+			setVoiceValue(voiceMaxClients, s.maxClients, instance, s.id)
+			setVoiceValue(voiceChannels, s.channels, instance, s.id)
+			setVoiceValue(voiceBandwidth, s.sentPerSecond, instance, s.id, "sent")
+			setVoiceValue(voiceBandwidth, s.recvPerSecond, instance, s.id, "received")
+			setVoiceValue(voiceBytes, s.sentBytes, instance, s.id, "sent")
+			setVoiceValue(voiceBytes, s.recvBytes, instance, s.id, "received")
+			setVoiceValue(voiceClientBandwidthLimit, s.clientBandwidthLimit, instance, s.id)
+		}
+		for id := range servers {
+			if !seen[id] {
+				for _, g := range voiceServerVecs {
+					g.DeletePartialMatch(prometheus.Labels{"instance_name": instance, "server": id})
+				}
+			}
+		}
+		servers = seen
+		time.Sleep(*queryInterval)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Windows game servers run under Wine or Proton are a tree of processes: the
+// game exe, wineserver and helpers like services.exe and winedevice.exe. They
+// are grouped by their Wine prefix and accounted to the game instance.
+var wineEnabled = flag.Bool("collector.wine", false, "Enable the Wine/Proton collector, accounting the Wine processes sharing a game instance's prefix to the instance.")
+
+var (
+	wineProcesses = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_wine_processes",
+		Help: "Wine processes in the game instance's Wine prefix, including wineserver",
+	}, []string{"instance_name"})
+	wineCPUSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_wine_cpu_seconds",
+		Help: "CPU time of the Wine processes in the game instance's prefix by mode (user, system)",
+	}, []string{"instance_name", "mode"})
+	wineMemory = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_wine_memory_bytes",
+		Help: "Resident memory of the Wine processes in the game instance's prefix",
+	}, []string{"instance_name"})
+	wineserverUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "game_wineserver_up",
+		Help: "Whether the wineserver of the game instance's prefix is running",
+	}, []string{"instance_name"})
+)
+
+func init() {
+	prometheus.MustRegister(wineProcesses)
+	prometheus.MustRegister(wineCPUSeconds)
+	prometheus.MustRegister(wineMemory)
+	prometheus.MustRegister(wineserverUp)
+}
+
+// readProcEnv returns the environment variables of a process. Other users'
+// processes need root.
+func readProcEnv(pid int) (map[string]string, error) {
+	data, err := os.ReadFile(procFilePath(strconv.Itoa(pid) + "/environ"))
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]string)
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		if key, value, ok := strings.Cut(string(entry), "="); ok {
+			env[key] = value
+		}
+	}
+	return env, nil
+}
+
+// isWineProcess reports whether a process is part of Wine: wineserver, the
+// preloader before it execs, or a Windows executable
+func isWineProcess(comm, cmdline string) bool {
+	if comm == "wineserver" || strings.HasPrefix(comm, "wine") {
+		return true
+	}
+	exe, _, _ := strings.Cut(cmdline, " ")
+	return strings.HasSuffix(strings.ToLower(exe), ".exe")
+}
+
+// winePrefix returns the Wine prefix of a process, ~/.wine when WINEPREFIX
+// isn't set
+func winePrefix(pid int) (string, error) {
+	env, err := readProcEnv(pid)
+	if err != nil {
+		return "", err
+	}
+	if prefix := env["WINEPREFIX"]; prefix != "" {
+		return filepath.Clean(prefix), nil
+	}
+	return filepath.Join(env["HOME"], ".wine"), nil
+}
+
+var wineSeries = newSeriesGeneration()
+
+// Collect combined usage of the Wine process trees of the game instances
+func updateWineMetrics(processes []gameProcess) {
+	defer wineSeries.sweep()
+
+	// Prefixes of the game processes run under Wine
+	instances := make(map[string][]string)
+	for _, p := range processes {
+		if !isWineProcess(p.comm, readCmdline(p.pid)) {
+			continue
+		}
+		prefix, err := winePrefix(p.pid)
+		if err != nil {
+			checkPermission("wine", err)
+			continue
+		}
+		instances[prefix] = append(instances[prefix], p.instance)
+	}
+	if len(instances) == 0 {
+		return
+	}
+
+	type wineUsage struct {
+		processes, utime, stime, rss float64
+		wineserver                   bool
+	}
+	usage := make(map[string]*wineUsage)
+	for _, pid := range listPIDs() {
+		st, err := readProcStat(pid)
+		if err != nil || !isWineProcess(st.comm, readCmdline(pid)) {
+			continue
+		}
+		prefix, err := winePrefix(pid)
+		if err != nil || instances[prefix] == nil {
+			continue
+		}
+		u := usage[prefix]
+		if u == nil {
+			u = &wineUsage{}
+			usage[prefix] = u
+		}
+		u.processes++
+		u.utime += float64(st.utime) / userHZ
+		u.stime += float64(st.stime) / userHZ
+		memory := make(map[string]float64)
+		if readProcMemory(pid, "status", map[string]string{"VmRSS:": "rss"}, memory) == nil {
+			u.rss += memory["rss"]
+		}
+		if st.comm == "wineserver" {
+			u.wineserver = true
+		}
+	}
+
+	for prefix, names := range instances {
+		u := usage[prefix]
+		if u == nil {
+			continue // Exited meanwhile
+		}
+		for _, name := range names {
+			wineSeries.set(wineProcesses, u.processes, name)
+			wineSeries.set(wineCPUSeconds, u.utime, name, "user")
+			wineSeries.set(wineCPUSeconds, u.stime, name, "system")
+			wineSeries.set(wineMemory, u.rss, name)
+			up := 0.0
+			if u.wineserver {
+				up = 1
+			}
+			wineSeries.set(wineserverUp, up, name)
+		}
+	}
+}
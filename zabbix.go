@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// zabbixConfig is the zabbix config section, a sink sending the metrics to
+// trapper items of a Zabbix server or proxy with the zabbix_sender protocol,
+// for setups migrating from Zabbix
+type zabbixConfig struct {
+	Server   string        `yaml:"server"`   // host:port, port 10051 by default
+	Host     string        `yaml:"host"`     // Host name in Zabbix, default the hostname
+	Interval time.Duration `yaml:"interval"` // Default --collector.query.interval
+	Metrics  []string      `yaml:"metrics"`  // Names or prefixes up to a _, default all
+}
+
+const zabbixTimeout = 10 * time.Second
+
+func validateZabbix(c zabbixConfig) error {
+	if c.Server == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(zabbixAddress(c.Server)); err != nil {
+		return fmt.Errorf("zabbix: server: %w", err)
+	}
+	return nil
+}
+
+func zabbixAddress(server string) string {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		return net.JoinHostPort(server, "10051")
+	}
+	return server
+}
+
+// Start sending to Zabbix in the background, if configured
+func startZabbix(c zabbixConfig) {
+	if c.Server == "" {
+		return
+	}
+	go runSink("zabbix", c.Interval, c.Metrics, c.send)
+}
+
+// zabbixItem is a value for a trapper item
+type zabbixItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+// send sends the values of a cycle in one sender data request
+func (c zabbixConfig) send(msg sinkMessage) (int, error) {
+	host := c.Host
+	if host == "" {
+		host = msg.Host
+	}
+	clock := int64(msg.Timestamp)
+	items := make([]zabbixItem, 0, len(msg.Metrics))
+	for _, s := range msg.Metrics {
+		items = append(items, zabbixItem{
+			Host:  host,
+			Key:   zabbixKey(s.Name, s.Labels),
+			Value: strconv.FormatFloat(s.Value, 'g', -1, 64),
+			Clock: clock,
+		})
+	}
+	body, err := json.Marshal(map[string]any{"request": "sender data", "data": items, "clock": clock})
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := net.DialTimeout("tcp", zabbixAddress(c.Server), zabbixTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(zabbixTimeout))
+	if _, err := conn.Write(zabbixPacket(body)); err != nil {
+		return 0, err
+	}
+	var header [13]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return 0, err
+	}
+	if string(header[:4]) != "ZBXD" {
+		return 0, errors.New("not a Zabbix response")
+	}
+	n := binary.LittleEndian.Uint64(header[5:])
+	if n > 1<<20 {
+		return 0, fmt.Errorf("response of %d bytes", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(conn, data); err != nil {
+		return 0, err
+	}
+	var resp struct {
+		Response string `json:"response"`
+		Info     string `json:"info"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return 0, err
+	}
+	if resp.Response != "success" {
+		return 0, fmt.Errorf("%s: %s", resp.Response, resp.Info)
+	}
+	// Values without a trapper item of the key on the host fail
+	if m := zabbixFailed.FindStringSubmatch(resp.Info); m != nil && m[1] != "0" {
+		return 1, errors.New(resp.Info)
+	}
+	return 1, nil
+}
+
+var zabbixFailed = regexp.MustCompile(`failed: (\d+)`)
+
+// zabbixPacket frames data in the Zabbix protocol header
+func zabbixPacket(data []byte) []byte {
+	packet := append([]byte("ZBXD"), 0x01)
+	packet = binary.LittleEndian.AppendUint64(packet, uint64(len(data)))
+	return append(packet, data...)
+}
+
+// zabbixKey is the item key of a series: the metric name, with the label
+// values ordered by label name as parameters, e.g.
+// game_network[in,eth0,bps] for game_network{activity,interface,metric}
+func zabbixKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	names := make([]string, 0, len(labels))
+	for label := range labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+	params := make([]string, len(names))
+	for i, label := range names {
+		params[i] = zabbixParam(labels[label])
+	}
+	return name + "[" + strings.Join(params, ",") + "]"
+}
+
+// zabbixParam quotes a key parameter if needed
+func zabbixParam(s string) string {
+	if !strings.ContainsAny(s, `,[]"`) && !strings.HasPrefix(s, " ") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}